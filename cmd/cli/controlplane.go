@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/controlplane"
+)
+
+// controlPlaneGroups are the command groups served by the control-plane API.
+var controlPlaneGroups = map[string]bool{"tenants": true, "usage": true, "rates": true, "invoice": true}
+
+// cpOptions are the flags shared by control-plane commands.
+type cpOptions struct {
+	json     bool
+	url      string
+	apiKey   string
+	role     string
+	query    string
+	page     int
+	pageSize int
+	tenant   string
+	status   string
+	month    string
+	currency string
+	format   string
+	output   string
+	reason   string
+}
+
+// cpResult is a command's outcome: data for --json, a table for humans.
+// Written is set when the command already streamed its output.
+type cpResult struct {
+	message string
+	data    any
+	table   func(w io.Writer)
+	written bool
+}
+
+func runControlPlane(group string, args []string, jsonOut bool, stdout io.Writer, stderr io.Writer) int {
+	opts, positional, err := parseControlPlaneFlags(group, args)
+	if err != nil {
+		return fail(stderr, jsonOut, group, "", err)
+	}
+	jsonOut = jsonOut || opts.json
+	if len(positional) == 0 {
+		return fail(stderr, jsonOut, group, "", fmt.Errorf("usage: fluxroute-cli %s <action> [args] (see --help)", group))
+	}
+	action, positional := positional[0], positional[1:]
+	command := group + " " + action
+
+	client := controlplane.NewClient(controlplane.ClientConfig{BaseURL: opts.url, APIKey: opts.apiKey, Role: opts.role})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var res cpResult
+	switch group {
+	case "tenants":
+		res, err = tenantsCommand(ctx, client, action, positional, opts)
+	case "usage":
+		res, err = usageCommand(ctx, client, action, positional, opts)
+	case "rates":
+		res, err = ratesCommand(ctx, client, action, positional, opts)
+	case "invoice":
+		res, err = invoiceCommand(ctx, client, action, positional, opts, stdout, jsonOut)
+	}
+	if err != nil {
+		return fail(stderr, jsonOut, command, client.BaseURL(), err)
+	}
+	if res.written {
+		return 0
+	}
+	if jsonOut {
+		return ok(stdout, command, jsonOut, res.message, res.data)
+	}
+	if res.table != nil {
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		res.table(tw)
+		_ = tw.Flush()
+		return 0
+	}
+	return ok(stdout, command, jsonOut, res.message, res.data)
+}
+
+// parseControlPlaneFlags accepts flags before, between and after positional
+// arguments. The URL, key and role default to CONTROLPLANE_URL,
+// CONTROLPLANE_API_KEY and REQUEST_ROLE.
+func parseControlPlaneFlags(group string, args []string) (cpOptions, []string, error) {
+	var opts cpOptions
+	fs := flag.NewFlagSet(group, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.json, "json", false, "machine-readable output")
+	fs.StringVar(&opts.url, "url", envOr("CONTROLPLANE_URL", controlplane.DefaultURL), "control plane base URL")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("CONTROLPLANE_API_KEY"), "control plane API key")
+	fs.StringVar(&opts.role, "role", os.Getenv("REQUEST_ROLE"), "X-Role for a control plane in local mode")
+	fs.StringVar(&opts.query, "q", "", "substring filter")
+	fs.IntVar(&opts.page, "page", 0, "page number")
+	fs.IntVar(&opts.pageSize, "page-size", 0, "page size")
+	fs.StringVar(&opts.tenant, "tenant", "", "tenant ID")
+	fs.StringVar(&opts.status, "status", "", "invoice status")
+	fs.StringVar(&opts.month, "month", "", "billing month (YYYY-MM)")
+	fs.StringVar(&opts.currency, "currency", "", "ISO 4217 currency")
+	fs.StringVar(&opts.format, "format", "csv", "invoice download format (csv|json|html)")
+	fs.StringVar(&opts.output, "output", "", "download path, - for stdout")
+	fs.StringVar(&opts.output, "o", "", "download path, - for stdout")
+	fs.StringVar(&opts.reason, "reason", "", "void reason")
+
+	positional := make([]string, 0, len(args))
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return opts, positional, nil
+}
+
+func envOr(key string, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func arg(args []string, name string) (string, error) {
+	if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	return strings.TrimSpace(args[0]), nil
+}
+
+func tenantsCommand(ctx context.Context, c *controlplane.Client, action string, args []string, opts cpOptions) (cpResult, error) {
+	switch action {
+	case "list":
+		list, err := c.ListTenants(ctx, opts.query, controlplane.Page{Number: opts.page, Size: opts.pageSize})
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: list, table: func(w io.Writer) {
+			_, _ = fmt.Fprintln(w, "TENANT")
+			for _, id := range list.Tenants {
+				_, _ = fmt.Fprintln(w, id)
+			}
+			pageFooter(w, len(list.Tenants), list.Total, list.Page)
+		}}, nil
+	case "create":
+		id, err := arg(args, "tenant id")
+		if err != nil {
+			return cpResult{}, err
+		}
+		if err := c.CreateTenant(ctx, id); err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{message: "tenant created: " + id, data: map[string]any{"tenant_id": id}}, nil
+	case "show", "suspend", "resume":
+		id, err := arg(args, "tenant id")
+		if err != nil {
+			return cpResult{}, err
+		}
+		var t controlplane.Tenant
+		switch action {
+		case "show":
+			t, err = c.Tenant(ctx, id)
+		case "suspend":
+			status := controlplane.TenantSuspended
+			t, err = c.UpdateTenant(ctx, id, controlplane.TenantUpdate{Status: &status})
+		default:
+			status := controlplane.TenantActive
+			t, err = c.UpdateTenant(ctx, id, controlplane.TenantUpdate{Status: &status})
+		}
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: t, table: func(w io.Writer) {
+			_, _ = fmt.Fprintf(w, "tenant\t%s\n", t.ID)
+			_, _ = fmt.Fprintf(w, "status\t%s\n", t.Status)
+			keys := make([]string, 0, len(t.Attributes))
+			for k := range t.Attributes {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				_, _ = fmt.Fprintf(w, "%s\t%s\n", k, t.Attributes[k])
+			}
+		}}, nil
+	default:
+		return cpResult{}, fmt.Errorf("unknown tenants action %q (want list|create|show|suspend|resume)", action)
+	}
+}
+
+func usageCommand(ctx context.Context, c *controlplane.Client, action string, args []string, opts cpOptions) (cpResult, error) {
+	switch action {
+	case "show":
+		tenantID, err := arg(args, "tenant id")
+		if err != nil {
+			return cpResult{}, err
+		}
+		u, err := c.TenantUsage(ctx, tenantID)
+		if err != nil {
+			return cpResult{}, err
+		}
+		models := make([]string, 0, len(u.ByModel))
+		for m := range u.ByModel {
+			models = append(models, m)
+		}
+		sort.Strings(models)
+		return cpResult{data: u, table: func(w io.Writer) {
+			_, _ = fmt.Fprintln(w, "MODEL\tINVOCATIONS\tINPUT_TOKENS\tOUTPUT_TOKENS")
+			for _, m := range models {
+				row := u.ByModel[m]
+				_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", m, row.Invocations, row.InputTokens, row.OutputTokens)
+			}
+			_, _ = fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\n", u.Invocations, u.InputTokens, u.OutputTokens)
+		}}, nil
+	case "list":
+		list, err := c.ListUsage(ctx, opts.query, controlplane.Page{Number: opts.page, Size: opts.pageSize})
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: list, table: func(w io.Writer) {
+			_, _ = fmt.Fprintln(w, "TENANT\tINVOCATIONS\tINPUT_TOKENS\tOUTPUT_TOKENS")
+			for _, row := range list.Items {
+				_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", row.TenantID, row.Invocations, row.InputTokens, row.OutputTokens)
+			}
+			pageFooter(w, len(list.Items), list.Total, list.Page)
+		}}, nil
+	default:
+		return cpResult{}, fmt.Errorf("unknown usage action %q (want show|list)", action)
+	}
+}
+
+func ratesCommand(ctx context.Context, c *controlplane.Client, action string, args []string, opts cpOptions) (cpResult, error) {
+	switch action {
+	case "get":
+		rate, err := c.Rate(ctx)
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: rate, table: func(w io.Writer) {
+			_, _ = fmt.Fprintln(w, "PER_THOUSAND\tCURRENCY")
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", rate.PerThousand, rate.Currency)
+		}}, nil
+	case "set":
+		raw, err := arg(args, "price per thousand")
+		if err != nil {
+			return cpResult{}, err
+		}
+		price, err := billing.ParseAmount(raw)
+		if err != nil {
+			return cpResult{}, err
+		}
+		if err := c.SetRate(ctx, price, billing.Currency(strings.ToUpper(opts.currency))); err != nil {
+			return cpResult{}, err
+		}
+		rate, err := c.Rate(ctx)
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{message: fmt.Sprintf("rate updated: %s %s per thousand", rate.PerThousand, rate.Currency), data: rate}, nil
+	default:
+		return cpResult{}, fmt.Errorf("unknown rates action %q (want get|set)", action)
+	}
+}
+
+func invoiceCommand(ctx context.Context, c *controlplane.Client, action string, args []string, opts cpOptions, stdout io.Writer, jsonOut bool) (cpResult, error) {
+	switch action {
+	case "list":
+		list, err := c.ListInvoices(ctx, opts.tenant, billing.InvoiceStatus(opts.status), controlplane.Page{Number: opts.page, Size: opts.pageSize})
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: list, table: func(w io.Writer) {
+			invoiceTable(w, list.Items...)
+			pageFooter(w, len(list.Items), list.Total, list.Page)
+		}}, nil
+	case "preview", "create":
+		tenantID, err := arg(args, "tenant id")
+		if err != nil {
+			return cpResult{}, err
+		}
+		var inv billing.Invoice
+		if action == "preview" {
+			inv, err = c.PreviewInvoice(ctx, tenantID, opts.month)
+		} else {
+			inv, err = c.CreateInvoice(ctx, tenantID, opts.month)
+		}
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: inv, table: func(w io.Writer) { invoiceDetail(w, inv) }}, nil
+	case "show", "finalize", "void":
+		id, err := arg(args, "invoice id")
+		if err != nil {
+			return cpResult{}, err
+		}
+		var inv billing.Invoice
+		switch action {
+		case "show":
+			inv, err = c.Invoice(ctx, id)
+		case "finalize":
+			inv, err = c.FinalizeInvoice(ctx, id)
+		default:
+			inv, err = c.VoidInvoice(ctx, id, opts.reason)
+		}
+		if err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{data: inv, table: func(w io.Writer) { invoiceDetail(w, inv) }}, nil
+	case "download":
+		id, err := arg(args, "invoice id")
+		if err != nil {
+			return cpResult{}, err
+		}
+		format, err := billing.ParseRenderFormat(opts.format)
+		if err != nil {
+			return cpResult{}, err
+		}
+		body, err := c.RenderInvoice(ctx, id, format)
+		if err != nil {
+			return cpResult{}, err
+		}
+		path := opts.output
+		if path == "" {
+			path = id + "." + string(format)
+		}
+		if path == "-" {
+			if jsonOut && format != billing.FormatJSON {
+				return cpResult{}, fmt.Errorf("--json with --output - needs --format json")
+			}
+			_, err := stdout.Write(body)
+			return cpResult{written: true}, err
+		}
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return cpResult{}, err
+			}
+		}
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			return cpResult{}, err
+		}
+		return cpResult{
+			message: fmt.Sprintf("invoice %s saved to %s", id, path),
+			data:    map[string]any{"invoice_id": id, "format": format, "output_path": path, "bytes": len(body)},
+		}, nil
+	default:
+		return cpResult{}, fmt.Errorf("unknown invoice action %q (want list|preview|create|show|download|finalize|void)", action)
+	}
+}
+
+func invoiceTable(w io.Writer, invoices ...billing.Invoice) {
+	_, _ = fmt.Fprintln(w, "ID\tTENANT\tPERIOD\tSTATUS\tINVOCATIONS\tTOTAL")
+	for _, inv := range invoices {
+		id := inv.ID
+		if id == "" {
+			id = "(preview)"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s..%s\t%s\t%d\t%s\n", id, inv.TenantID,
+			inv.PeriodStart.Format("2006-01-02"), inv.PeriodEnd.Format("2006-01-02"), inv.Status, inv.Invocations, inv.Total)
+	}
+}
+
+func invoiceDetail(w io.Writer, inv billing.Invoice) {
+	invoiceTable(w, inv)
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "LINE\tQUANTITY\tAMOUNT")
+	for _, l := range inv.Lines {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s %s\n", l.Description, l.Quantity, l.Amount, inv.Currency)
+	}
+	_, _ = fmt.Fprintf(w, "SUBTOTAL\t\t%s\n", inv.Subtotal)
+	if inv.Credits.Amount != 0 {
+		_, _ = fmt.Fprintf(w, "CREDITS\t\t%s\n", inv.Credits)
+	}
+	_, _ = fmt.Fprintf(w, "TAX\t\t%s\n", inv.Tax)
+	_, _ = fmt.Fprintf(w, "TOTAL\t\t%s\n", inv.Total)
+}
+
+func pageFooter(w io.Writer, shown int, total int, page int) {
+	if shown < total {
+		_, _ = fmt.Fprintf(w, "\n(page %d: %d of %d; use --page to see more)\n", page, shown, total)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/your-org/fluxroute/internal/app"
+)
+
+// debugOptions are the flags of the debug command.
+type debugOptions struct {
+	json   bool
+	output string
+	app.DebugOptions
+}
+
+func runDebug(args []string, jsonOut bool, stdout io.Writer, stderr io.Writer) int {
+	opts, positional, err := parseDebugFlags(args)
+	if err != nil {
+		return fail(stderr, jsonOut, "debug", "", err)
+	}
+	jsonOut = jsonOut || opts.json
+	if len(positional) < 2 {
+		return fail(stderr, jsonOut, "debug", "", fmt.Errorf("usage: fluxroute-cli debug <expected_trace> <actual_trace> [--format text|json|html] [--config file] [--tolerance n] [-o file]"))
+	}
+	expectedPath, actualPath := positional[0], positional[1]
+
+	if jsonOut {
+		opts.Format = "json"
+		var buf bytes.Buffer
+		diffErr := app.DebugTraceWithOptions(expectedPath, actualPath, opts.DebugOptions, &buf)
+		var report map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+			return fail(stderr, jsonOut, "debug", expectedPath, diffErr)
+		}
+		if diffErr != nil {
+			_ = json.NewEncoder(stderr).Encode(cliResult{Command: "debug", Status: "error", Error: diffErr.Error(), Data: report})
+			return 1
+		}
+		return ok(stdout, "debug", jsonOut, "no divergence detected", report)
+	}
+
+	out := stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return fail(stderr, jsonOut, "debug", opts.output, err)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	if err := app.DebugTraceWithOptions(expectedPath, actualPath, opts.DebugOptions, out); err != nil {
+		return fail(stderr, jsonOut, "debug", expectedPath, err)
+	}
+	return 0
+}
+
+// parseDebugFlags accepts flags anywhere among the arguments.
+func parseDebugFlags(args []string) (debugOptions, []string, error) {
+	var opts debugOptions
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.json, "json", false, "machine-readable output")
+	fs.StringVar(&opts.Format, "format", "text", "report format: text, json or html")
+	fs.StringVar(&opts.ConfigPath, "config", "", "diff config with ignore_paths, ignore_fields and tolerance")
+	fs.Float64Var(&opts.Tolerance, "tolerance", 0, "numbers within this absolute difference are equal")
+	fs.StringVar(&opts.output, "output", "", "write the report to this file")
+	fs.StringVar(&opts.output, "o", "", "write the report to this file")
+
+	positional := make([]string, 0, len(args))
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return opts, positional, nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -55,6 +54,13 @@ func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
 		return 0
 	}
 
+	if controlPlaneGroups[command] {
+		return runControlPlane(command, rest, jsonOut, stdout, stderr)
+	}
+	if command == "traces" {
+		return runTraces(rest, jsonOut, stdout, stderr)
+	}
+
 	switch command {
 	case "run":
 		path := pick(rest, "configs/router.example.yaml", 0)
@@ -92,18 +98,7 @@ func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
 		_, _ = fmt.Fprintf(stdout, "manifest is valid: %s\n", path)
 		return 0
 	case "replay":
-		path := pick(rest, "trace.json", 0)
-		if jsonOut {
-			var buf bytes.Buffer
-			if err := app.ReplayTrace(path, &buf); err != nil {
-				return fail(stderr, jsonOut, command, path, err)
-			}
-			return ok(stdout, command, jsonOut, strings.TrimSpace(buf.String()), map[string]any{"trace_path": path})
-		}
-		if err := app.ReplayTrace(path, stdout); err != nil {
-			return fail(stderr, jsonOut, command, path, err)
-		}
-		return 0
+		return runReplay(rest, jsonOut, stdout, stderr)
 	case "audit-export":
 		inputPath := pick(rest, "audit.log", 0)
 		outputPath := pick(rest, "audit.csv", 1)
@@ -126,20 +121,11 @@ func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
 		}
 		return 0
 	case "debug":
-		if len(rest) < 2 {
-			return fail(stderr, jsonOut, command, "", fmt.Errorf("usage: fluxroute-cli debug <expected_trace> <actual_trace>"))
-		}
-		if jsonOut {
-			var buf bytes.Buffer
-			if err := app.DebugTrace(rest[0], rest[1], &buf); err != nil {
-				return fail(stderr, jsonOut, command, rest[0], err)
-			}
-			return ok(stdout, command, jsonOut, strings.TrimSpace(buf.String()), map[string]any{"expected_trace": rest[0], "actual_trace": rest[1]})
-		}
-		if err := app.DebugTrace(rest[0], rest[1], stdout); err != nil {
-			return fail(stderr, jsonOut, command, rest[0], err)
-		}
-		return 0
+		return runDebug(rest, jsonOut, stdout, stderr)
+	case "test":
+		return runTest(rest, jsonOut, stdout, stderr)
+	case "redact":
+		return runRedact(rest, jsonOut, stdout, stderr)
 	default:
 		return fail(stderr, jsonOut, command, "", fmt.Errorf("unknown command: %s", command))
 	}
@@ -186,17 +172,45 @@ func usage(out io.Writer) {
 	_, _ = fmt.Fprintln(out, "Commands:")
 	_, _ = fmt.Fprintln(out, "  run [manifest_path]                    Execute a manifest")
 	_, _ = fmt.Fprintln(out, "  validate [manifest_path]               Validate manifest only")
-	_, _ = fmt.Fprintln(out, "  replay [trace_path]                    Replay a trace and verify outputs")
+	_, _ = fmt.Fprintln(out, "  replay [trace_path] [--dag]            Replay a trace and verify outputs (--dag: every attempt)")
+	_, _ = fmt.Fprintln(out, "  replay [trace_path] --from <inv>       What-if replay (--override agent=v|payload=file, --manifest, -o)")
 	_, _ = fmt.Fprintln(out, "  audit-export [jsonl_path] [csv_path]   Export audit JSONL to CSV")
 	_, _ = fmt.Fprintln(out, "  scaffold [target_dir] [pipeline_name]  Generate a starter pipeline")
-	_, _ = fmt.Fprintln(out, "  debug <expected_trace> <actual_trace>  Show replay divergence")
+	_, _ = fmt.Fprintln(out, "  debug <expected_trace> <actual_trace>  Show replay divergence (--format text|json|html, --config, --tolerance, -o)")
+	_, _ = fmt.Fprintln(out, "  test [fixtures_dir] [--update]         Run golden-trace fixtures (--format text|junit|json, -o)")
+	_, _ = fmt.Fprintln(out, "  redact keygen                          Print a new tokenization key for manifest redaction")
+	_, _ = fmt.Fprintln(out, "  redact reveal <file> [-o path]         Restore tokenized values (admin; --key-file)")
+	_, _ = fmt.Fprintln(out, "  traces list [--agent a] [--status s]   List stored runs (--namespace, --error, --since, --until, --limit)")
+	_, _ = fmt.Fprintln(out, "  traces show <run_id> [-o path]         Show a stored run's steps")
+	_, _ = fmt.Fprintln(out, "  traces gc [--ttl 168h] [--max-runs n]  Delete runs outside retention (--dir or TRACE_STORE_DIR)")
 	_, _ = fmt.Fprintln(out, "  version                                Print CLI version")
 	_, _ = fmt.Fprintln(out)
+	_, _ = fmt.Fprintln(out, "Control-plane commands (flags: --url, --api-key, --role; env CONTROLPLANE_URL, CONTROLPLANE_API_KEY):")
+	_, _ = fmt.Fprintln(out, "  tenants list [--q text] [--page n]     List tenants")
+	_, _ = fmt.Fprintln(out, "  tenants create <tenant_id>             Create a tenant")
+	_, _ = fmt.Fprintln(out, "  tenants show <tenant_id>               Show a tenant's status and attributes")
+	_, _ = fmt.Fprintln(out, "  tenants suspend|resume <tenant_id>     Stop or allow router runs for a tenant")
+	_, _ = fmt.Fprintln(out, "  usage show <tenant_id>                 Usage totals by model")
+	_, _ = fmt.Fprintln(out, "  usage list [--q text] [--page n]       Usage totals per tenant")
+	_, _ = fmt.Fprintln(out, "  rates get                              Show the default rate")
+	_, _ = fmt.Fprintln(out, "  rates set <per_thousand> [--currency]  Change the default rate")
+	_, _ = fmt.Fprintln(out, "  invoice list [--tenant id] [--status]  List stored invoices")
+	_, _ = fmt.Fprintln(out, "  invoice preview|create <tenant_id>     Preview or draft a month's invoice (--month YYYY-MM)")
+	_, _ = fmt.Fprintln(out, "  invoice show|finalize|void <id>        Show, finalize or void (--reason) an invoice")
+	_, _ = fmt.Fprintln(out, "  invoice download <id>                  Save as CSV/JSON/HTML (--format, --output path|-)")
+	_, _ = fmt.Fprintln(out)
 	_, _ = fmt.Fprintln(out, "Examples:")
 	_, _ = fmt.Fprintln(out, "  fluxroute-cli run configs/router.example.yaml")
 	_, _ = fmt.Fprintln(out, "  fluxroute-cli --json validate configs/router.example.yaml")
 	_, _ = fmt.Fprintln(out, "  fluxroute-cli replay trace.json")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli replay trace.json --from 0002_enrich --override agent=v2 --manifest router.yaml")
 	_, _ = fmt.Fprintln(out, "  fluxroute-cli audit-export audit.log audit.csv")
 	_, _ = fmt.Fprintln(out, "  fluxroute-cli scaffold ./generated customer-support")
 	_, _ = fmt.Fprintln(out, "  fluxroute-cli debug expected.json actual.json")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli test tests/golden --format junit -o golden.xml")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli debug expected.json actual.json --config diff.yaml --format html -o diff.html")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli traces list --agent classify_agent --status failed --since 24h")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli tenants list --url https://cp.example.com --api-key $KEY")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli --json usage show acme")
+	_, _ = fmt.Fprintln(out, "  fluxroute-cli invoice download inv_000001 --format csv -o invoices/acme.csv")
 }
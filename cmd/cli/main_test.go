@@ -2,10 +2,17 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/trace"
 )
 
 func TestRunCLIHelp(t *testing.T) {
@@ -58,3 +65,132 @@ pipeline:
 		t.Fatalf("expected success json payload, got %q", out.String())
 	}
 }
+
+func TestRunCLIControlPlaneCommands(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	srv := httptest.NewServer(svc.Handler())
+	defer srv.Close()
+	t.Setenv("CONTROLPLANE_URL", srv.URL)
+	t.Setenv("REQUEST_ROLE", "admin")
+
+	cli := func(args ...string) (int, string, string) {
+		var out, errOut bytes.Buffer
+		code := runCLI(args, &out, &errOut)
+		return code, out.String(), errOut.String()
+	}
+
+	if code, out, errOut := cli("tenants", "create", "acme"); code != 0 || !strings.Contains(out, "tenant created: acme") {
+		t.Fatalf("tenants create: %d %q %q", code, out, errOut)
+	}
+	if err := svc.AddUsage("acme", 4000); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	if code, out, _ := cli("tenants", "list"); code != 0 || !strings.HasPrefix(out, "TENANT\nacme\n") {
+		t.Fatalf("expected tenant table, got %d %q", code, out)
+	}
+	if code, out, errOut := cli("tenants", "suspend", "acme"); code != 0 || !strings.Contains(out, "suspended") {
+		t.Fatalf("tenants suspend: %d %q %q", code, out, errOut)
+	}
+	if code, out, _ := cli("tenants", "resume", "acme", "--json"); code != 0 || !strings.Contains(out, `"status":"active"`) {
+		t.Fatalf("tenants resume: %d %q", code, out)
+	}
+	code, out, _ := cli("--json", "usage", "show", "acme")
+	if code != 0 || !strings.Contains(out, `"command":"usage show"`) || !strings.Contains(out, `"invocations":4000`) {
+		t.Fatalf("expected json usage, got %d %q", code, out)
+	}
+	if code, out, errOut := cli("rates", "set", "2.5", "--currency", "eur"); code != 0 || !strings.Contains(out, "2.5 EUR per thousand") {
+		t.Fatalf("rates set: %d %q %q", code, out, errOut)
+	}
+	if code, out, _ := cli("rates", "get", "--json"); code != 0 || !strings.Contains(out, `"per_thousand":"2.5"`) {
+		t.Fatalf("expected --json after the action to work, got %d %q", code, out)
+	}
+
+	month := time.Now().UTC().Format("2006-01")
+	code, out, errOut := cli("--json", "invoice", "create", "acme", "--month", month)
+	if code != 0 {
+		t.Fatalf("invoice create: %d %q", code, errOut)
+	}
+	var created struct {
+		Data billing.Invoice `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(out), &created); err != nil || created.Data.ID == "" {
+		t.Fatalf("decode created invoice: %v %q", err, out)
+	}
+	if code, out, _ := cli("invoice", "list", "--tenant", "acme"); code != 0 || !strings.Contains(out, created.Data.ID) || !strings.Contains(out, "10.00 EUR") {
+		t.Fatalf("expected invoice table, got %d %q", code, out)
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "out", "acme.csv")
+	if code, out, errOut := cli("invoice", "download", created.Data.ID, "-o", csvPath); code != 0 || !strings.Contains(out, "saved to") {
+		t.Fatalf("invoice download: %d %q %q", code, out, errOut)
+	}
+	body, err := os.ReadFile(csvPath)
+	if err != nil || !strings.Contains(string(body), created.Data.ID) {
+		t.Fatalf("expected csv invoice on disk, got %q, %v", body, err)
+	}
+	if code, out, _ := cli("invoice", "download", created.Data.ID, "--format", "json", "--output", "-"); code != 0 || !strings.Contains(out, `"tenant_id":"acme"`) {
+		t.Fatalf("expected json invoice on stdout, got %d %q", code, out)
+	}
+
+	code, _, errOut = cli("--json", "usage", "show", "nobody", "--api-key", "wrong")
+	if code != 1 || !strings.Contains(errOut, `"status":"error"`) || !strings.Contains(errOut, "401") {
+		t.Fatalf("expected auth error from the control plane, got %d %q", code, errOut)
+	}
+}
+
+func TestRunCLITracesListShowGC(t *testing.T) {
+	dir := t.TempDir()
+	store := trace.NewFileStore(dir)
+	start := time.Now().Add(-time.Hour)
+	tr := trace.ExecutionTrace{TaskID: "task", StartTime: start, EndTime: start.Add(time.Second), Steps: []trace.Step{
+		{InvocationID: "1", AgentID: "classify_agent", Attempt: 1, StartTime: start, Error: "boom"},
+	}}
+	if _, err := store.Put("run_1", "team-a", tr); err != nil {
+		t.Fatalf("put trace: %v", err)
+	}
+	cli := func(args ...string) (int, string) {
+		var out, errOut bytes.Buffer
+		code := runCLI(args, &out, &errOut)
+		return code, out.String() + errOut.String()
+	}
+
+	if code, out := cli("traces", "list", "--dir", dir, "--agent", "classify_agent", "--status", "failed", "--since", "24h"); code != 0 || !strings.Contains(out, "run_1") || !strings.Contains(out, "boom") {
+		t.Fatalf("traces list: %d %q", code, out)
+	}
+	if code, out := cli("traces", "list", "--dir", dir, "--status", "succeeded"); code != 0 || strings.Contains(out, "run_1") {
+		t.Fatalf("expected status filter to exclude run_1: %d %q", code, out)
+	}
+	if code, out := cli("--json", "traces", "show", "run_1", "--dir", dir); code != 0 || !strings.Contains(out, `"run_id":"run_1"`) {
+		t.Fatalf("traces show: %d %q", code, out)
+	}
+	if code, out := cli("traces", "gc", "--dir", dir, "--ttl", "1m"); code != 0 || !strings.Contains(out, "removed 1 run(s)") {
+		t.Fatalf("traces gc: %d %q", code, out)
+	}
+}
+
+func TestRunCLITestGoldenFixtures(t *testing.T) {
+	junitPath := filepath.Join(t.TempDir(), "golden.xml")
+	var out bytes.Buffer
+	var errOut bytes.Buffer
+	code := runCLI([]string{"test", "../../tests/golden", "--format", "junit", "-o", junitPath}, &out, &errOut)
+	if code != 0 {
+		t.Fatalf("expected exit 0, got %d: %s%s", code, out.String(), errOut.String())
+	}
+	if !strings.Contains(out.String(), "PASSED  summarize") {
+		t.Fatalf("expected a text summary on stdout, got %q", out.String())
+	}
+	b, err := os.ReadFile(junitPath)
+	if err != nil {
+		t.Fatalf("read junit report: %v", err)
+	}
+	if !strings.Contains(string(b), `<testcase name="summarize" classname="fluxroute.golden"`) {
+		t.Fatalf("unexpected junit report:\n%s", b)
+	}
+
+	out.Reset()
+	if code := runCLI([]string{"test", t.TempDir()}, &out, &errOut); code != 1 {
+		t.Fatalf("expected exit 1 without fixtures, got %d", code)
+	}
+}
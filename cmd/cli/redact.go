@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/redact"
+)
+
+// redactOptions are the flags of the redact command.
+type redactOptions struct {
+	json    bool
+	keyFile string
+	output  string
+}
+
+func runRedact(args []string, jsonOut bool, stdout io.Writer, stderr io.Writer) int {
+	opts, positional, err := parseRedactFlags(args)
+	if err != nil {
+		return fail(stderr, jsonOut, "redact", "", err)
+	}
+	jsonOut = jsonOut || opts.json
+	if len(positional) == 0 {
+		return fail(stderr, jsonOut, "redact", "", fmt.Errorf("usage: fluxroute-cli redact keygen | redact reveal <file> [--key-file f] [-o file]"))
+	}
+	action, positional := positional[0], positional[1:]
+	command := "redact " + action
+
+	switch action {
+	case "keygen":
+		key, err := redact.GenerateKey()
+		if err != nil {
+			return fail(stderr, jsonOut, command, "", err)
+		}
+		if jsonOut {
+			return ok(stdout, command, jsonOut, "key generated", map[string]any{"key": key})
+		}
+		_, _ = fmt.Fprintln(stdout, key)
+		return 0
+	case "reveal":
+		if len(positional) == 0 {
+			return fail(stderr, jsonOut, command, "", fmt.Errorf("usage: fluxroute-cli redact reveal <file> [--key-file f] [-o file]"))
+		}
+		path := positional[0]
+		if jsonOut && opts.output == "" {
+			return fail(stderr, jsonOut, command, path, fmt.Errorf("--json needs -o, the revealed content is not wrapped"))
+		}
+		out := stdout
+		if opts.output != "" {
+			f, err := os.OpenFile(opts.output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+			if err != nil {
+				return fail(stderr, jsonOut, command, opts.output, err)
+			}
+			defer func() { _ = f.Close() }()
+			out = f
+		}
+		n, err := app.RevealTokens(path, opts.keyFile, out)
+		if err != nil {
+			return fail(stderr, jsonOut, command, path, err)
+		}
+		if opts.output != "" {
+			return ok(stdout, command, jsonOut, fmt.Sprintf("revealed %d token(s) into %s", n, opts.output), map[string]any{"path": path, "output": opts.output, "revealed": n})
+		}
+		return 0
+	default:
+		return fail(stderr, jsonOut, command, "", fmt.Errorf("unknown redact action %q (want keygen|reveal)", action))
+	}
+}
+
+// parseRedactFlags accepts flags anywhere among the arguments.
+func parseRedactFlags(args []string) (redactOptions, []string, error) {
+	var opts redactOptions
+	fs := flag.NewFlagSet("redact", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.json, "json", false, "machine-readable output")
+	fs.StringVar(&opts.keyFile, "key-file", "", "tokenization key file (default REDACTION_KEY_FILE or REDACTION_KEY)")
+	fs.StringVar(&opts.output, "output", "", "write the revealed file here instead of stdout")
+	fs.StringVar(&opts.output, "o", "", "write the revealed file here instead of stdout")
+
+	positional := make([]string, 0, len(args))
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return opts, positional, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+
+	"github.com/your-org/fluxroute/internal/app"
+)
+
+// replayOptions are the flags of the replay command.
+type replayOptions struct {
+	json bool
+	dag  bool
+	app.WhatIfOptions
+}
+
+// overrideFlags collects repeated --override values.
+type overrideFlags []string
+
+func (o *overrideFlags) String() string { return strings.Join(*o, ",") }
+
+func (o *overrideFlags) Set(v string) error {
+	*o = append(*o, v)
+	return nil
+}
+
+func runReplay(args []string, jsonOut bool, stdout io.Writer, stderr io.Writer) int {
+	opts, positional, err := parseReplayFlags(args)
+	if err != nil {
+		return fail(stderr, jsonOut, "replay", "", err)
+	}
+	jsonOut = jsonOut || opts.json
+	path := pick(positional, "trace.json", 0)
+
+	replay, mode := app.ReplayTrace, "outputs"
+	data := map[string]any{"trace_path": path}
+	switch {
+	case opts.From != "" && opts.dag:
+		return fail(stderr, jsonOut, "replay", path, errors.New("--from and --dag cannot be combined"))
+	case opts.From != "":
+		mode = "whatif"
+		if opts.Output == "" {
+			opts.Output = app.WhatIfTracePath(path)
+		}
+		data["from"], data["output"] = opts.From, opts.Output
+		replay = func(path string, out io.Writer) error { return app.ReplayFrom(path, opts.WhatIfOptions, out) }
+	case len(opts.Overrides) > 0:
+		return fail(stderr, jsonOut, "replay", path, errors.New("--override needs --from"))
+	case opts.dag:
+		replay, mode = app.ReplayTraceDAG, "dag"
+	}
+	data["mode"] = mode
+	if jsonOut {
+		var buf bytes.Buffer
+		if err := replay(path, &buf); err != nil {
+			return fail(stderr, jsonOut, "replay", path, err)
+		}
+		return ok(stdout, "replay", jsonOut, strings.TrimSpace(buf.String()), data)
+	}
+	if err := replay(path, stdout); err != nil {
+		return fail(stderr, jsonOut, "replay", path, err)
+	}
+	return 0
+}
+
+// parseReplayFlags accepts flags anywhere among the arguments.
+func parseReplayFlags(args []string) (replayOptions, []string, error) {
+	var opts replayOptions
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.json, "json", false, "machine-readable output")
+	fs.BoolVar(&opts.dag, "dag", false, "re-run the recorded plan through the engine and compare every attempt")
+	fs.StringVar(&opts.From, "from", "", "re-execute this invocation and its descendants, reusing everything else")
+	fs.Var((*overrideFlags)(&opts.Overrides), "override", "agent=<version> or payload=<file> for the --from invocation")
+	fs.StringVar(&opts.ManifestPath, "manifest", "", "manifest whose agents and versions re-execute")
+	fs.StringVar(&opts.Output, "output", "", "where to write the what-if trace")
+	fs.StringVar(&opts.Output, "o", "", "shorthand for --output")
+
+	positional := make([]string, 0, len(args))
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return opts, positional, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/your-org/fluxroute/internal/app"
+)
+
+// testOptions are the flags of the test command.
+type testOptions struct {
+	json   bool
+	update bool
+	format string
+	output string
+}
+
+func runTest(args []string, jsonOut bool, stdout io.Writer, stderr io.Writer) int {
+	opts, positional, err := parseTestFlags(args)
+	if err != nil {
+		return fail(stderr, jsonOut, "test", "", err)
+	}
+	jsonOut = jsonOut || opts.json
+	dir := pick(positional, "tests/golden", 0)
+
+	var write func(io.Writer, app.GoldenReport) error
+	switch opts.format {
+	case "text":
+		write = func(w io.Writer, r app.GoldenReport) error {
+			_, err := io.WriteString(w, app.FormatGoldenReport(r))
+			return err
+		}
+	case "junit":
+		write = app.WriteGoldenJUnit
+	case "json":
+		write = app.WriteGoldenJSON
+	default:
+		return fail(stderr, jsonOut, "test", dir, fmt.Errorf("unknown test report format %q (want text|junit|json)", opts.format))
+	}
+
+	report, err := app.RunGoldenTests(dir, opts.update)
+	if err != nil {
+		return fail(stderr, jsonOut, "test", dir, err)
+	}
+	summary := fmt.Sprintf("golden tests: %d passed, %d failed, %d error(s), %d updated", report.Passed, report.Failed, report.Errors, report.Updated)
+
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return fail(stderr, jsonOut, "test", opts.output, err)
+		}
+		werr := write(f, report)
+		if cerr := f.Close(); werr == nil {
+			werr = cerr
+		}
+		if werr != nil {
+			return fail(stderr, jsonOut, "test", opts.output, werr)
+		}
+	}
+
+	switch {
+	case jsonOut && report.OK():
+		return ok(stdout, "test", jsonOut, summary, report)
+	case jsonOut:
+		_ = json.NewEncoder(stderr).Encode(cliResult{Command: "test", Status: "error", Error: summary, Data: report})
+		return 1
+	case opts.output != "":
+		_, _ = fmt.Fprint(stdout, app.FormatGoldenReport(report))
+	default:
+		if err := write(stdout, report); err != nil {
+			return fail(stderr, jsonOut, "test", dir, err)
+		}
+	}
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// parseTestFlags accepts flags anywhere among the arguments.
+func parseTestFlags(args []string) (testOptions, []string, error) {
+	var opts testOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.json, "json", false, "machine-readable output")
+	fs.BoolVar(&opts.update, "update", false, "rewrite the golden traces instead of comparing")
+	fs.StringVar(&opts.format, "format", "text", "report format: text, junit or json")
+	fs.StringVar(&opts.output, "output", "", "write the report to this file")
+	fs.StringVar(&opts.output, "o", "", "write the report to this file")
+
+	positional := make([]string, 0, len(args))
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return opts, positional, nil
+}
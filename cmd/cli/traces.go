@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/trace"
+)
+
+// traceOptions are the flags of the traces command group.
+type traceOptions struct {
+	json      bool
+	dir       string
+	namespace string
+	agent     string
+	status    string
+	errorText string
+	since     string
+	until     string
+	limit     string
+	ttl       time.Duration
+	maxRuns   int
+	output    string
+}
+
+func runTraces(args []string, jsonOut bool, stdout io.Writer, stderr io.Writer) int {
+	opts, positional, err := parseTraceFlags(args)
+	if err != nil {
+		return fail(stderr, jsonOut, "traces", "", err)
+	}
+	jsonOut = jsonOut || opts.json
+	if len(positional) == 0 {
+		return fail(stderr, jsonOut, "traces", "", fmt.Errorf("usage: fluxroute-cli traces list|show|gc [args] (see --help)"))
+	}
+	action, positional := positional[0], positional[1:]
+	command := "traces " + action
+	if opts.dir == "" {
+		return fail(stderr, jsonOut, command, "", fmt.Errorf("trace store directory is required (--dir or TRACE_STORE_DIR)"))
+	}
+	store := trace.NewFileStore(opts.dir)
+
+	var res cpResult
+	switch action {
+	case "list":
+		res, err = tracesList(store, opts)
+	case "show":
+		res, err = tracesShow(store, positional, opts)
+	case "gc":
+		res, err = tracesGC(store, opts)
+	default:
+		err = fmt.Errorf("unknown traces action %q (want list|show|gc)", action)
+	}
+	if err != nil {
+		return fail(stderr, jsonOut, command, opts.dir, err)
+	}
+	if jsonOut || res.table == nil {
+		return ok(stdout, command, jsonOut, res.message, res.data)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	res.table(tw)
+	_ = tw.Flush()
+	return 0
+}
+
+// parseTraceFlags accepts flags anywhere among the arguments. The store
+// directory and retention default to TRACE_STORE_DIR, TRACE_STORE_TTL and
+// TRACE_STORE_MAX_RUNS.
+func parseTraceFlags(args []string) (traceOptions, []string, error) {
+	var opts traceOptions
+	_, retention, err := trace.StoreConfigFromEnv()
+	if err != nil {
+		return opts, nil, err
+	}
+	fs := flag.NewFlagSet("traces", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.json, "json", false, "machine-readable output")
+	fs.StringVar(&opts.dir, "dir", envOr("TRACE_STORE_DIR", ""), "trace store directory")
+	fs.StringVar(&opts.namespace, "namespace", "", "namespace filter")
+	fs.StringVar(&opts.agent, "agent", "", "agent filter")
+	fs.StringVar(&opts.status, "status", "", "run status filter (succeeded|failed)")
+	fs.StringVar(&opts.errorText, "error", "", "error text filter")
+	fs.StringVar(&opts.since, "since", "", "runs started at or after (RFC 3339, YYYY-MM-DD or duration)")
+	fs.StringVar(&opts.until, "until", "", "runs started before (RFC 3339, YYYY-MM-DD or duration)")
+	fs.StringVar(&opts.limit, "limit", "50", "maximum runs listed, 0 for all")
+	fs.DurationVar(&opts.ttl, "ttl", retention.TTL, "gc: delete runs older than this")
+	fs.IntVar(&opts.maxRuns, "max-runs", retention.MaxRuns, "gc: keep at most this many runs")
+	fs.StringVar(&opts.output, "output", "", "show: also write the trace to this path")
+	fs.StringVar(&opts.output, "o", "", "show: also write the trace to this path")
+
+	positional := make([]string, 0, len(args))
+	for {
+		if err := fs.Parse(args); err != nil {
+			return opts, nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return opts, positional, nil
+}
+
+func tracesList(store trace.Store, opts traceOptions) (cpResult, error) {
+	values := map[string]string{
+		"namespace": opts.namespace, "agent": opts.agent, "status": opts.status, "error": opts.errorText,
+		"since": opts.since, "until": opts.until, "limit": opts.limit,
+	}
+	q, err := app.QueryFromValues(func(k string) string { return values[k] }, time.Now())
+	if err != nil {
+		return cpResult{}, err
+	}
+	runs, err := store.List(q)
+	if err != nil {
+		return cpResult{}, err
+	}
+	return cpResult{data: map[string]any{"runs": runs}, table: func(w io.Writer) {
+		_, _ = fmt.Fprintln(w, "RUN\tSTARTED\tNAMESPACE\tSTATUS\tDURATION\tSTEPS\tAGENTS\tERROR")
+		for _, r := range runs {
+			errText := ""
+			if len(r.Errors) > 0 {
+				errText = truncate(r.Errors[0], 60)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				r.RunID, r.StartTime.UTC().Format(time.RFC3339), r.Namespace, r.Status,
+				time.Duration(r.DurationMS)*time.Millisecond, r.Steps, strings.Join(r.Agents, ","), errText)
+		}
+		_, _ = fmt.Fprintf(w, "(%d run(s))\n", len(runs))
+	}}, nil
+}
+
+func tracesShow(store trace.Store, args []string, opts traceOptions) (cpResult, error) {
+	runID, err := arg(args, "run id")
+	if err != nil {
+		return cpResult{}, err
+	}
+	tr, sum, err := store.Get(runID)
+	if err != nil {
+		return cpResult{}, err
+	}
+	if opts.output != "" {
+		if err := trace.SaveToFile(opts.output, tr); err != nil {
+			return cpResult{}, err
+		}
+	}
+	return cpResult{data: map[string]any{"summary": sum, "trace": tr}, table: func(w io.Writer) {
+		_, _ = fmt.Fprintf(w, "run\t%s\n", sum.RunID)
+		_, _ = fmt.Fprintf(w, "task\t%s\n", sum.TaskID)
+		_, _ = fmt.Fprintf(w, "namespace\t%s\n", sum.Namespace)
+		_, _ = fmt.Fprintf(w, "status\t%s\n", sum.Status)
+		_, _ = fmt.Fprintf(w, "started\t%s\n", sum.StartTime.UTC().Format(time.RFC3339Nano))
+		_, _ = fmt.Fprintf(w, "duration\t%s\n", tr.TotalLatency)
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintln(w, "OFFSET\tINVOCATION\tAGENT\tATTEMPT\tLEVEL\tDURATION\tERROR")
+		for _, s := range tr.Steps {
+			_, _ = fmt.Fprintf(w, "+%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+				s.StartTime.Sub(tr.StartTime).Round(time.Microsecond), s.InvocationID, s.AgentID, s.Attempt, s.Level, s.Duration, truncate(s.Error, 60))
+		}
+		if opts.output != "" {
+			_, _ = fmt.Fprintf(w, "\ntrace written to %s\n", opts.output)
+		}
+	}}, nil
+}
+
+func tracesGC(store trace.Store, opts traceOptions) (cpResult, error) {
+	if opts.ttl <= 0 && opts.maxRuns <= 0 {
+		return cpResult{}, fmt.Errorf("gc needs --ttl or --max-runs (or TRACE_STORE_TTL, TRACE_STORE_MAX_RUNS)")
+	}
+	removed, err := store.GC(trace.Retention{TTL: opts.ttl, MaxRuns: opts.maxRuns}, time.Now())
+	if err != nil {
+		return cpResult{}, err
+	}
+	return cpResult{message: fmt.Sprintf("removed %d run(s)", removed), data: map[string]any{"removed": removed}}, nil
+}
+
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
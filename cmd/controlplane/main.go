@@ -28,8 +28,22 @@ func main() {
 	defer cancel()
 
 	svc := controlplane.NewService()
+	redactor, err := controlplane.RedactorFromEnv()
+	if err == nil && redactor != nil {
+		svc.SetRedactor(redactor)
+	}
+	var haCfg *controlplane.HAConfig
+	if err == nil {
+		haCfg, err = controlplane.HAConfigFromEnv()
+	}
+	if err == nil && haCfg != nil {
+		err = svc.EnableHA(*haCfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "controlplane failed: %v\n", err)
+		os.Exit(1)
+	}
 	tlsEnabled := os.Getenv("CONTROLPLANE_TLS_ENABLED") == "true"
-	var err error
 	if tlsEnabled {
 		err = controlplane.StartServerTLS(
 			ctx,
@@ -0,0 +1,310 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/config"
+	"github.com/your-org/fluxroute/internal/redact"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/adapters"
+)
+
+// Golden fixture files. A directory holding goldenManifest is one case; the
+// others are optional, and the golden trace is created by an update run.
+const (
+	goldenManifest = "manifest.yaml"
+	goldenInput    = "input.json"
+	goldenTrace    = "golden.json"
+	goldenCassette = "cassette.json"
+)
+
+// goldenEpoch is the virtual start time of every golden run, so traces
+// carry the same timestamps run after run.
+var goldenEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Golden case statuses.
+const (
+	GoldenPassed  = "passed"
+	GoldenFailed  = "failed"
+	GoldenError   = "error"
+	GoldenUpdated = "updated"
+)
+
+// GoldenCase is the outcome of one fixture.
+type GoldenCase struct {
+	Name        string             `json:"name"`
+	Dir         string             `json:"dir"`
+	Status      string             `json:"status"`
+	Divergences []trace.Divergence `json:"divergences,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Duration    time.Duration      `json:"duration_ns"`
+}
+
+// GoldenReport is the outcome of a golden-trace test run.
+type GoldenReport struct {
+	Dir     string       `json:"dir"`
+	Cases   []GoldenCase `json:"cases"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Errors  int          `json:"errors"`
+	Updated int          `json:"updated"`
+}
+
+// OK reports whether every case passed or was updated.
+func (r GoldenReport) OK() bool { return r.Failed == 0 && r.Errors == 0 }
+
+// RunGoldenTests runs every fixture under dir and compares its trace to the
+// golden one with trace.Compare. A fixture is a directory with manifest.yaml,
+// optionally input.json (the payload every invocation receives instead of
+// the default) and cassette.json (provider responses to replay; without it
+// provider-backed agents are stubbed). Runs use a virtual clock and never
+// touch the network. With update, golden.json is rewritten instead.
+func RunGoldenTests(dir string, update bool) (GoldenReport, error) {
+	dirs, err := discoverGoldenCases(dir)
+	if err != nil {
+		return GoldenReport{}, err
+	}
+	report := GoldenReport{Dir: dir}
+	for _, caseDir := range dirs {
+		name, _ := filepath.Rel(dir, caseDir)
+		c := GoldenCase{Name: filepath.ToSlash(name), Dir: caseDir}
+		started := time.Now()
+		div, err := runGoldenCase(caseDir, update)
+		c.Duration = time.Since(started)
+		switch {
+		case err != nil:
+			c.Status, c.Error = GoldenError, err.Error()
+			report.Errors++
+		case update:
+			c.Status = GoldenUpdated
+			report.Updated++
+		case len(div) > 0:
+			c.Status, c.Divergences = GoldenFailed, div
+			report.Failed++
+		default:
+			c.Status = GoldenPassed
+			report.Passed++
+		}
+		report.Cases = append(report.Cases, c)
+	}
+	return report, nil
+}
+
+// discoverGoldenCases returns the directories under dir holding a manifest,
+// in lexical order.
+func discoverGoldenCases(dir string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == goldenManifest {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("discover golden fixtures: %w", err)
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no golden fixtures (%s) under %s", goldenManifest, dir)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// runGoldenCase runs one fixture and diffs it against its golden trace, or
+// writes the golden trace when update is set.
+func runGoldenCase(dir string, update bool) ([]trace.Divergence, error) {
+	actual, err := runGoldenFixture(dir)
+	if err != nil {
+		return nil, err
+	}
+	goldenPath := filepath.Join(dir, goldenTrace)
+	if update {
+		return nil, trace.SaveToFile(goldenPath, actual)
+	}
+	golden, err := trace.LoadFromFile(goldenPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no %s; run with --update to create it", goldenTrace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return trace.Compare(golden, actual), nil
+}
+
+// runGoldenFixture executes the fixture's manifest in process, without the
+// run's side effects (trace output, usage, quota, leases, exports).
+func runGoldenFixture(dir string) (trace.ExecutionTrace, error) {
+	manifest, err := config.LoadManifest(filepath.Join(dir, goldenManifest))
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	namespace, err := config.NamespaceFromManifest(manifest)
+	if err != nil {
+		return trace.ExecutionTrace{}, fmt.Errorf("namespace: %w", err)
+	}
+
+	var providers *providerSession
+	cassettePath := filepath.Join(dir, goldenCassette)
+	switch c, err := adapters.LoadCassette(cassettePath); {
+	case err == nil:
+		providers = &providerSession{
+			mode:   cassetteReplay,
+			path:   cassettePath,
+			client: &http.Client{Transport: adapters.NewReplayer(c)},
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		for i := range manifest.Agents {
+			manifest.Agents[i].Provider = ""
+			for version := range manifest.Agents[i].Versions {
+				manifest.Agents[i].Versions[version] = config.AgentVersion{}
+			}
+		}
+	default:
+		return trace.ExecutionTrace{}, err
+	}
+	redactor, err := redact.FromConfig(manifest.Redaction)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	providers.redactWith(redactor)
+	registry, err := buildRegistry(manifest, providers)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+
+	runtimeCfg, err := config.RouterConfigFromManifest(manifest, config.FromEnv())
+	if err != nil {
+		return trace.ExecutionTrace{}, fmt.Errorf("build runtime config: %w", err)
+	}
+	plan, err := buildExecutionPlan(manifest, namespace, runtimeCfg.CircuitBreaker)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	input, err := os.ReadFile(filepath.Join(dir, goldenInput))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return trace.ExecutionTrace{}, fmt.Errorf("read %s: %w", goldenInput, err)
+	}
+	for i := range plan.Nodes {
+		if input != nil {
+			plan.Nodes[i].Invocation.Input.Payload = input
+		}
+		plan.Nodes[i].Invocation.Input.Timestamp = goldenEpoch
+	}
+
+	engine := router.NewEngine(registry, runtimeCfg)
+	engine.SetClock(router.NewVirtualClock(goldenEpoch))
+	if redactor != nil {
+		engine.SetRedactor(redactor)
+	}
+	_, tr := engine.RunPlan(context.Background(), plan)
+	return tr, nil
+}
+
+// FormatGoldenReport renders report as text, one line per case followed by
+// the divergences of failed cases.
+func FormatGoldenReport(report GoldenReport) string {
+	var b strings.Builder
+	for _, c := range report.Cases {
+		fmt.Fprintf(&b, "%-7s %s (%s)\n", strings.ToUpper(c.Status), c.Name, c.Duration.Round(time.Millisecond))
+		switch {
+		case c.Error != "":
+			fmt.Fprintf(&b, "    %s\n", c.Error)
+		case len(c.Divergences) > 0:
+			for _, line := range strings.Split(strings.TrimSpace(trace.FormatDivergence(c.Divergences)), "\n")[1:] {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "golden tests: %d passed, %d failed, %d error(s), %d updated\n", report.Passed, report.Failed, report.Errors, report.Updated)
+	return b.String()
+}
+
+// WriteGoldenJSON writes report as indented JSON.
+func WriteGoldenJSON(w io.Writer, report GoldenReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteGoldenJUnit writes report as JUnit XML, one test case per fixture.
+func WriteGoldenJUnit(w io.Writer, report GoldenReport) error {
+	suite := junitSuite{Name: "fluxroute.golden", Failures: report.Failed, Errors: report.Errors}
+	var total time.Duration
+	for _, c := range report.Cases {
+		total += c.Duration
+		jc := junitCase{Name: c.Name, Classname: suite.Name, Time: junitSeconds(c.Duration)}
+		switch c.Status {
+		case GoldenFailed:
+			jc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%d divergence(s) from %s", len(c.Divergences), goldenTrace),
+				Body:    trace.FormatDivergence(c.Divergences),
+			}
+		case GoldenError:
+			jc.Error = &junitMessage{Message: c.Error}
+		}
+		suite.Cases = append(suite.Cases, jc)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Tests: suite.Tests, Failures: suite.Failures, Errors: suite.Errors, Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
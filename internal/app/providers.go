@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/your-org/fluxroute/internal/config"
+	"github.com/your-org/fluxroute/internal/redact"
+	"github.com/your-org/fluxroute/pkg/adapters"
+	"github.com/your-org/fluxroute/pkg/adapters/anthropic"
+	"github.com/your-org/fluxroute/pkg/adapters/gemini"
+	"github.com/your-org/fluxroute/pkg/adapters/openai"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+// Cassette modes selected by ADAPTER_CASSETTE_MODE.
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// providerSession holds the HTTP client shared by the provider-backed agents
+// of one run, and the cassette it records to or replays from.
+type providerSession struct {
+	mode     string
+	path     string
+	client   *http.Client
+	recorder *adapters.Recorder
+	redactor *redact.Redactor
+	bindings map[string]string
+}
+
+// providerSessionFromEnv reads ADAPTER_CASSETTE_MODE (record|replay) and
+// ADAPTER_CASSETTE. A recording without ADAPTER_CASSETTE goes to a sidecar
+// next to TRACE_OUTPUT, where ReplayTrace looks for it.
+func providerSessionFromEnv() (*providerSession, error) {
+	s := &providerSession{
+		mode:     strings.ToLower(strings.TrimSpace(os.Getenv("ADAPTER_CASSETTE_MODE"))),
+		path:     strings.TrimSpace(os.Getenv("ADAPTER_CASSETTE")),
+		client:   &http.Client{},
+		bindings: map[string]string{},
+	}
+	switch s.mode {
+	case "":
+	case cassetteRecord:
+		if s.path == "" {
+			tracePath := strings.TrimSpace(os.Getenv("TRACE_OUTPUT"))
+			if tracePath == "" {
+				return nil, fmt.Errorf("cassette: record mode needs ADAPTER_CASSETTE or TRACE_OUTPUT")
+			}
+			s.path = cassettePath(tracePath)
+		}
+		s.recorder = adapters.NewRecorder(nil)
+		s.client = &http.Client{Transport: s.recorder}
+	case cassetteReplay:
+		if s.path == "" {
+			return nil, fmt.Errorf("cassette: replay mode needs ADAPTER_CASSETTE")
+		}
+		c, err := adapters.LoadCassette(s.path)
+		if err != nil {
+			return nil, err
+		}
+		s.client = &http.Client{Transport: adapters.NewReplayer(c)}
+	default:
+		return nil, fmt.Errorf("cassette: invalid ADAPTER_CASSETTE_MODE %q (want record|replay)", s.mode)
+	}
+	return s, nil
+}
+
+// replaySession serves the cassette recorded for tracePath, if there is one:
+// ADAPTER_CASSETTE when set, otherwise the trace's sidecar. It returns nil
+// when the trace was recorded without a cassette.
+func replaySession(tracePath string) (*providerSession, *adapters.Cassette, error) {
+	path := strings.TrimSpace(os.Getenv("ADAPTER_CASSETTE"))
+	if path == "" {
+		path = cassettePath(tracePath)
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil, nil
+		}
+	}
+	c, err := adapters.LoadCassette(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &providerSession{
+		mode:   cassetteReplay,
+		path:   path,
+		client: &http.Client{Transport: adapters.NewReplayer(c)},
+	}, c, nil
+}
+
+// cassettePath is the sidecar cassette recorded next to a trace file.
+func cassettePath(tracePath string) string {
+	return tracePath + ".cassette.json"
+}
+
+// agent builds a provider-backed agent and remembers its binding so that
+// a replay can rebuild it from the cassette alone.
+func (s *providerSession) agent(agentID string, provider string, model string) (agentfunc.AgentFunc, error) {
+	p, err := s.provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if s.bindings != nil {
+		s.bindings["agent."+agentID+".provider"] = provider
+		if model != "" {
+			s.bindings["agent."+agentID+".model"] = model
+		}
+	}
+	return providerAgent(p, model), nil
+}
+
+func (s *providerSession) provider(name string) (adapters.Provider, error) {
+	prefix := strings.ToUpper(name)
+	apiKey := os.Getenv(prefix + "_API_KEY")
+	if apiKey == "" && s.mode == cassetteReplay {
+		// Credentials are never recorded, so replay needs none.
+		apiKey = "replay"
+	}
+	baseURL := os.Getenv(prefix + "_BASE_URL")
+	switch name {
+	case "openai":
+		return openai.NewClient(apiKey, s.client, baseURL), nil
+	case "anthropic":
+		return anthropic.NewClient(apiKey, s.client, baseURL), nil
+	case "gemini":
+		return gemini.NewClient(apiKey, s.client, baseURL), nil
+	}
+	return nil, fmt.Errorf("unknown provider %q", name)
+}
+
+// redactWith makes the session redact provider bodies with r: before they
+// are saved to the cassette and, on replay, before requests are matched.
+func (s *providerSession) redactWith(r *redact.Redactor) {
+	if s == nil || r == nil {
+		return
+	}
+	s.redactor = r
+	if replayer, ok := s.client.Transport.(*adapters.Replayer); ok {
+		replayer.SetRedactor(r)
+	}
+}
+
+// save writes the recorded interactions when recording.
+func (s *providerSession) save() error {
+	if s == nil || s.recorder == nil {
+		return nil
+	}
+	c := s.recorder.Cassette()
+	c.Metadata = s.bindings
+	if s.redactor != nil {
+		c.Redact(s.redactor)
+	}
+	return c.Save(s.path)
+}
+
+// providerAgent sends the invocation payload to p as the prompt and returns
+// the generated text as the output payload.
+func providerAgent(p adapters.Provider, model string) agentfunc.AgentFunc {
+	return func(ctx context.Context, input agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		resp, err := p.Generate(ctx, adapters.GenerateRequest{Model: model, Prompt: string(input.Payload)})
+		if err != nil {
+			return agentfunc.AgentOutput{}, fmt.Errorf("%s: %w", p.Name(), err)
+		}
+		return agentfunc.AgentOutput{
+			RequestID: input.RequestID,
+			Payload:   []byte(resp.Text),
+			Metadata:  map[string]string{"provider": p.Name()},
+		}, nil
+	}
+}
+
+// cassetteAgents rebuilds the agents the cassette recorded as
+// provider-backed, keyed by agent ID.
+func cassetteAgents(s *providerSession, c *adapters.Cassette, agentIDs []string) (map[string]agentfunc.AgentFunc, error) {
+	agents := make(map[string]agentfunc.AgentFunc)
+	for _, agentID := range agentIDs {
+		provider := c.Metadata["agent."+agentID+".provider"]
+		if provider == "" {
+			continue
+		}
+		if !config.KnownProvider(provider) {
+			return nil, fmt.Errorf("cassette: agent %q has unknown provider %q", agentID, provider)
+		}
+		fn, err := s.agent(agentID, provider, c.Metadata["agent."+agentID+".model"])
+		if err != nil {
+			return nil, err
+		}
+		agents[agentID] = fn
+	}
+	return agents, nil
+}
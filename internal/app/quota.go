@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/quota"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/usage"
+)
+
+var (
+	quotaClientsMu sync.Mutex
+	quotaClients   = map[string]*quota.Client{}
+)
+
+// quotaClient returns a process-wide client per control plane URL so the
+// router server reuses its cached quota view across runs.
+func quotaClient() (*quota.Client, error) {
+	key := strings.TrimSpace(os.Getenv("CONTROLPLANE_URL")) + "|" + strings.TrimSpace(os.Getenv("QUOTA_CACHE_TTL"))
+	quotaClientsMu.Lock()
+	defer quotaClientsMu.Unlock()
+	if c, ok := quotaClients[key]; ok {
+		return c, nil
+	}
+	c, err := quota.ClientFromEnv()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	quotaClients[key] = c
+	return c, nil
+}
+
+// checkQuota rejects a run that would exceed a hard quota for the tenant and
+// warns on soft thresholds. If the control plane cannot be reached the run is
+// allowed on the last known status, or unconditionally, unless
+// QUOTA_FAIL_CLOSED is set. The namespace is the tenant.
+func checkQuota(namespace string, plan router.ExecutionPlan) error {
+	client, err := quotaClient()
+	if err != nil {
+		return fmt.Errorf("quota client: %w", err)
+	}
+	if client == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := client.Status(ctx, namespace)
+	if err != nil {
+		if envBool("QUOTA_FAIL_CLOSED") {
+			return fmt.Errorf("check quota: %w", err)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: quota check used cached or no status: %v\n", err)
+	}
+	if err := status.Admit(int64(len(plan.Nodes))); err != nil {
+		return err
+	}
+	for _, c := range status.Warnings() {
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: tenant %q %s at %s of soft limit %s\n", namespace, c.Metric, c.Used, c.Soft)
+	}
+	if c := status.Credits; c != nil && c.State == quota.StateWarn {
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: tenant %q prepaid credit balance is %s; usage is billed\n", namespace, c.Balance)
+	}
+	return nil
+}
+
+// consumeQuota applies a finished run's usage to the cached quota view.
+func consumeQuota(namespace string, results []router.AgentResult) {
+	client, err := quotaClient()
+	if err != nil || client == nil {
+		return
+	}
+	var invocations, tokens int64
+	for _, ev := range usage.FromResults("", namespace, namespace, results, time.Now()) {
+		invocations += ev.Invocations
+		tokens += ev.InputTokens + ev.OutputTokens
+	}
+	client.Consume(namespace, invocations, tokens)
+}
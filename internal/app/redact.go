@@ -0,0 +1,66 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/redact"
+	"github.com/your-org/fluxroute/internal/security"
+	"github.com/your-org/fluxroute/internal/trace"
+)
+
+// RevealTokens writes the file at path with every redaction token replaced
+// by its original value, decrypted with the key in keyFile (or
+// REDACTION_KEY_FILE / REDACTION_KEY). It needs the admin role, is audited,
+// and returns how many tokens it revealed.
+func RevealTokens(path string, keyFile string, out io.Writer) (n int, retErr error) {
+	logger := audit.NewLogger(strings.TrimSpace(os.Getenv("AUDIT_LOG_PATH")))
+	actor := currentRole().String()
+	defer func() {
+		status := "success"
+		if retErr != nil {
+			status = "error"
+		}
+		_ = logger.Write(actor, "reveal_tokens", path, status, retErr)
+	}()
+
+	if err := authorize(security.DefaultPolicy(), security.ActionAdmin); err != nil {
+		return 0, err
+	}
+	key, err := redact.LoadKey(keyFile)
+	if err != nil {
+		return 0, err
+	}
+	revealer, err := redact.NewRevealer(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// Trace payloads are base64 in the file, so traces are revealed step by
+	// step; anything else (audit logs, exports, logs) as text.
+	if tr, err := trace.LoadFromFile(path); err == nil && len(tr.Steps) > 0 {
+		tr = trace.Redact(tr, revealer)
+		if err := revealer.Err(); err != nil {
+			return 0, err
+		}
+		if err := trace.Encode(out, tr, trace.CompressionNone); err != nil {
+			return 0, err
+		}
+		return revealer.Revealed(), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	revealed := revealer.RedactText(string(b))
+	if err := revealer.Err(); err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(out, revealed); err != nil {
+		return 0, err
+	}
+	return revealer.Revealed(), nil
+}
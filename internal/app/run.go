@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -19,18 +20,23 @@ import (
 	"github.com/your-org/fluxroute/internal/config"
 	"github.com/your-org/fluxroute/internal/coordinator"
 	"github.com/your-org/fluxroute/internal/metrics"
+	"github.com/your-org/fluxroute/internal/redact"
 	"github.com/your-org/fluxroute/internal/router"
 	"github.com/your-org/fluxroute/internal/security"
+	"github.com/your-org/fluxroute/internal/tenant"
 	"github.com/your-org/fluxroute/internal/trace"
 	"github.com/your-org/fluxroute/pkg/agentfunc"
 )
 
 // RunReport captures the outputs from one manifest execution.
 type RunReport struct {
+	RunID     string
 	Results   []router.AgentResult
 	Trace     trace.ExecutionTrace
 	Metrics   metrics.Snapshot
 	Namespace string
+	// redactor scrubs the errors RunManifest prints and logs.
+	redactor *redact.Redactor
 }
 
 // RunManifest loads a manifest, executes the pipeline, and writes a summary.
@@ -45,7 +51,7 @@ func RunManifest(manifestPath string, out io.Writer) error {
 	for _, r := range report.Results {
 		if r.Err != nil {
 			failed++
-			_, _ = fmt.Fprintf(out, "- %s (%s): error=%v\n", r.Invocation.ID, r.Invocation.AgentID, r.Err)
+			_, _ = fmt.Fprintf(out, "- %s (%s): error=%s\n", r.Invocation.ID, r.Invocation.AgentID, report.redactor.RedactText(r.Err.Error()))
 			continue
 		}
 		_, _ = fmt.Fprintf(out, "- %s (%s): ok duration=%s\n", r.Invocation.ID, r.Invocation.AgentID, r.Output.Duration)
@@ -81,6 +87,13 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 	if err != nil {
 		return RunReport{}, fmt.Errorf("load manifest: %w", err)
 	}
+	redactor, err := redact.FromConfig(manifest.Redaction)
+	if err != nil {
+		return RunReport{}, err
+	}
+	if redactor != nil {
+		logger.SetRedactor(redactor)
+	}
 
 	policy, err := config.RBACPolicyFromManifest(manifest)
 	if err != nil {
@@ -95,7 +108,12 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 		return RunReport{}, fmt.Errorf("namespace: %w", err)
 	}
 
-	registry, err := buildRegistry(manifest)
+	providers, err := providerSessionFromEnv()
+	if err != nil {
+		return RunReport{}, err
+	}
+	providers.redactWith(redactor)
+	registry, err := buildRegistry(manifest, providers)
 	if err != nil {
 		return RunReport{}, err
 	}
@@ -111,6 +129,15 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 		return RunReport{}, err
 	}
 
+	tenantLabels, err := verifyTenant(namespace)
+	if err != nil {
+		return RunReport{}, err
+	}
+
+	if err := checkQuota(namespace, plan); err != nil {
+		return RunReport{}, err
+	}
+
 	lease, err := acquireLeaseIfEnabled(context.Background(), namespace, plan.TaskID)
 	if err != nil {
 		return RunReport{}, err
@@ -126,13 +153,17 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 	}
 	defer func() { _ = otelRuntime.Shutdown(context.Background()) }()
 	engine.SetTracer(otelRuntime.Tracer)
+	engine.SetAttributes(tenantLabels)
+	if redactor != nil {
+		engine.SetRedactor(redactor)
+	}
 
 	metricRecorder := metrics.NewInMemoryRecorder()
 	activeRecorder := metrics.Recorder(metricRecorder)
 	var metricsServer *http.Server
 	if envBool("METRICS_ENABLED") {
 		promRegistry := prometheus.NewRegistry()
-		promRecorder, err := metrics.NewPrometheusRecorder(promRegistry)
+		promRecorder, err := metrics.NewPrometheusRecorderWithLabels(promRegistry, tenant.MetricLabels(tenantLabels))
 		if err != nil {
 			return RunReport{}, fmt.Errorf("setup prometheus recorder: %w", err)
 		}
@@ -156,7 +187,18 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 	}
 	engine.SetMetricsRecorder(activeRecorder)
 
+	runID := newRunID()
+	started := time.Now()
 	results, execTrace := engine.RunPlan(context.Background(), plan)
+	elapsed := time.Since(started)
+	consumeQuota(namespace, results)
+
+	if err := reportUsage(runID, namespace, results, elapsed); err != nil {
+		if envBool("USAGE_REPORT_STRICT") {
+			return RunReport{}, fmt.Errorf("report usage: %w", err)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: usage report failed: %v\n", err)
+	}
 
 	if tracePath := os.Getenv("TRACE_OUTPUT"); tracePath != "" {
 		if err := trace.SaveToFile(tracePath, execTrace); err != nil {
@@ -164,6 +206,14 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 		}
 	}
 
+	if err := providers.save(); err != nil {
+		return RunReport{}, fmt.Errorf("persist cassette: %w", err)
+	}
+
+	if err := storeTrace(runID, namespace, execTrace); err != nil {
+		return RunReport{}, fmt.Errorf("store trace: %w", err)
+	}
+
 	if _, err := trace.ExportAstraGraphAudit(execTrace, namespace); err != nil {
 		if envBool("ASTRAGRAPH_EXPORT_STRICT") {
 			return RunReport{}, fmt.Errorf("export astragraph audit: %w", err)
@@ -171,7 +221,7 @@ func RunManifestReport(manifestPath string) (report RunReport, retErr error) {
 		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: astragraph export failed: %v\n", err)
 	}
 
-	return RunReport{Results: results, Trace: execTrace, Metrics: metricRecorder.Snapshot(), Namespace: namespace}, nil
+	return RunReport{RunID: runID, Results: results, Trace: execTrace, Metrics: metricRecorder.Snapshot(), Namespace: namespace, redactor: redactor}, nil
 }
 
 // ValidateManifest loads and validates a manifest only.
@@ -221,25 +271,252 @@ func ReplayTrace(tracePath string, out io.Writer) (retErr error) {
 		return fmt.Errorf("load trace: %w", err)
 	}
 
-	registry := newGenericRegistry(uniqueAgentIDs(tr))
+	agentIDs := uniqueAgentIDs(tr)
+	registry := newGenericRegistry(agentIDs)
 	resolver := func(agentID string) (agentfunc.AgentFunc, bool) {
 		return registry.Get(agentID)
 	}
+	providers, cassette, err := replaySession(tracePath)
+	if err != nil {
+		return fmt.Errorf("load cassette: %w", err)
+	}
+	if cassette != nil {
+		recorded, err := cassetteAgents(providers, cassette, agentIDs)
+		if err != nil {
+			return err
+		}
+		resolver = func(agentID string) (agentfunc.AgentFunc, bool) {
+			if fn, ok := recorded[agentID]; ok {
+				return fn, true
+			}
+			return registry.Get(agentID)
+		}
+	}
 
 	if err := trace.ReplayAndCompare(context.Background(), tr, 30*time.Second, resolver); err != nil {
 		return fmt.Errorf("replay compare failed: %w", err)
 	}
+	if cassette != nil {
+		_, _ = fmt.Fprintf(out, "replay matched recorded outputs for %d step(s) using cassette %s\n", len(tr.Steps), providers.path)
+		return nil
+	}
 	_, _ = fmt.Fprintf(out, "replay matched recorded outputs for %d step(s)\n", len(tr.Steps))
 	return nil
 }
 
-func buildRegistry(manifest config.Manifest) (*agent.Registry, error) {
+// ReplayTraceDAG re-runs the plan recorded in a trace through the router
+// engine on a virtual clock, and checks that attempts, retry decisions,
+// circuit transitions and ordering match the recording.
+func ReplayTraceDAG(tracePath string, out io.Writer) (retErr error) {
+	logger := audit.NewLogger(strings.TrimSpace(os.Getenv("AUDIT_LOG_PATH")))
+	actor := currentRole().String()
+	defer func() {
+		status := "success"
+		if retErr != nil {
+			status = "error"
+		}
+		_ = logger.Write(actor, string(security.ActionReplay), tracePath, status, retErr)
+	}()
+
+	if err := authorize(security.DefaultPolicy(), security.ActionReplay); err != nil {
+		return err
+	}
+
+	tr, err := trace.LoadFromFile(tracePath)
+	if err != nil {
+		return fmt.Errorf("load trace: %w", err)
+	}
+	replayed, div, err := router.Replay(context.Background(), tr)
+	if err != nil {
+		return fmt.Errorf("dag replay: %w", err)
+	}
+	if len(div) > 0 {
+		return fmt.Errorf("dag replay diverged: %s", strings.TrimSpace(trace.FormatDivergence(div)))
+	}
+	_, _ = fmt.Fprintf(out, "dag replay matched %d attempt(s) across %d invocation(s)\n", len(replayed.Steps), invocationCount(replayed))
+	return nil
+}
+
+// WhatIfOptions describe a what-if replay: the invocation to start from,
+// overrides in agent=<version> or payload=<file> form, the manifest whose
+// agents (and versions) re-execute, and where to write the new trace.
+type WhatIfOptions struct {
+	From         string
+	Overrides    []string
+	ManifestPath string
+	// Output defaults to the trace path with .whatif before its extension.
+	Output string
+}
+
+// ReplayFrom reuses the recorded outcome of every invocation outside
+// opts.From and its descendants, re-executes those with the overrides
+// applied, writes the new trace and reports how it differs from the
+// original. Differences are the point of the exercise, not an error.
+// Tokenized inputs are revealed with the manifest's redaction key.
+func ReplayFrom(tracePath string, opts WhatIfOptions, out io.Writer) (retErr error) {
+	logger := audit.NewLogger(strings.TrimSpace(os.Getenv("AUDIT_LOG_PATH")))
+	actor := currentRole().String()
+	defer func() {
+		status := "success"
+		if retErr != nil {
+			status = "error"
+		}
+		_ = logger.Write(actor, string(security.ActionReplay), tracePath, status, retErr)
+	}()
+
+	if err := authorize(security.DefaultPolicy(), security.ActionReplay); err != nil {
+		return err
+	}
+	if strings.TrimSpace(opts.From) == "" {
+		return errors.New("what-if replay needs an invocation to start from")
+	}
+	w := router.WhatIf{From: opts.From}
+	for _, o := range opts.Overrides {
+		key, value, found := strings.Cut(o, "=")
+		if !found || value == "" {
+			return fmt.Errorf("invalid override %q (want agent=<version> or payload=<file>)", o)
+		}
+		switch key {
+		case "agent":
+			if w.AgentVersion != "" {
+				return errors.New("override agent given more than once")
+			}
+			w.AgentVersion = value
+		case "payload":
+			if w.Payload != nil {
+				return errors.New("override payload given more than once")
+			}
+			b, err := os.ReadFile(value)
+			if err != nil {
+				return fmt.Errorf("read payload override: %w", err)
+			}
+			w.Payload = b
+		default:
+			return fmt.Errorf("invalid override %q (want agent=<version> or payload=<file>)", o)
+		}
+	}
+
+	tr, err := trace.LoadFromFile(tracePath)
+	if err != nil {
+		return fmt.Errorf("load trace: %w", err)
+	}
+	registry := newGenericRegistry(uniqueAgentIDs(tr))
+	var redactor *redact.Redactor
+	if opts.ManifestPath != "" {
+		manifest, err := config.LoadManifest(opts.ManifestPath)
+		if err != nil {
+			return err
+		}
+		if redactor, err = redact.FromConfig(manifest.Redaction); err != nil {
+			return err
+		}
+		// Agents get the original values back; the new trace is redacted
+		// again below.
+		if redactor != nil && manifest.Redaction.Mode == redact.ModeTokenize {
+			if tr, err = revealTrace(tr, manifest.Redaction.KeyFile); err != nil {
+				return err
+			}
+		}
+		providers, err := providerSessionFromEnv()
+		if err != nil {
+			return err
+		}
+		providers.redactWith(redactor)
+		if registry, err = buildRegistry(manifest, providers); err != nil {
+			return err
+		}
+	}
+
+	replayed, err := router.ReplayFrom(context.Background(), tr, registry, w)
+	if errors.Is(err, router.ErrRedactedInput) {
+		return fmt.Errorf("what-if replay: %w; pass --manifest with the tokenize-mode redaction config and key it was recorded with, or override its payload", err)
+	}
+	if err != nil {
+		return fmt.Errorf("what-if replay: %w", err)
+	}
+	if redactor != nil {
+		replayed = trace.Redact(replayed, redactor)
+	}
+	output := opts.Output
+	if output == "" {
+		output = WhatIfTracePath(tracePath)
+	}
+	if err := trace.SaveToFile(output, replayed); err != nil {
+		return err
+	}
+
+	reused := 0
+	for _, s := range replayed.Steps {
+		if s.Reused {
+			reused++
+		}
+	}
+	_, _ = fmt.Fprintf(out, "what-if replay from %s reused %d step(s), re-executed %d; trace written to %s\n",
+		w.From, reused, len(replayed.Steps)-reused, output)
+	div := trace.Diff(tr, replayed, trace.DiffConfig{})
+	_, _ = fmt.Fprintln(out, trace.FormatDivergence(div))
+	if roots := trace.RootCauses(tr, replayed, div, trace.DiffConfig{}); len(roots) > 0 {
+		_, _ = fmt.Fprint(out, trace.FormatRootCauses(roots))
+	}
+	return nil
+}
+
+// revealTrace replaces the redaction tokens in tr with the values they stand
+// for, using the key in keyFile (or REDACTION_KEY_FILE / REDACTION_KEY).
+func revealTrace(tr trace.ExecutionTrace, keyFile string) (trace.ExecutionTrace, error) {
+	key, err := redact.LoadKey(keyFile)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	revealer, err := redact.NewRevealer(key)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	tr = trace.Redact(tr, revealer)
+	if err := revealer.Err(); err != nil {
+		return trace.ExecutionTrace{}, fmt.Errorf("reveal trace: %w", err)
+	}
+	return tr, nil
+}
+
+// WhatIfTracePath is where a what-if replay of tracePath writes its trace
+// by default: .whatif goes before the extensions, so trace.jsonl.gz
+// becomes trace.whatif.jsonl.gz.
+func WhatIfTracePath(tracePath string) string {
+	dir, base := filepath.Split(tracePath)
+	if i := strings.Index(base, "."); i > 0 {
+		return dir + base[:i] + ".whatif" + base[i:]
+	}
+	return tracePath + ".whatif"
+}
+
+func buildRegistry(manifest config.Manifest, providers *providerSession) (*agent.Registry, error) {
 	registry := newGenericRegistry(nil)
 	for _, a := range manifest.Agents {
 		agentID := a.ID
-		if err := registry.Register(agentID, deterministicAgent(agentID)); err != nil {
+		fn := deterministicAgent(agentID)
+		if a.Provider != "" {
+			var err error
+			if fn, err = providers.agent(agentID, a.Provider, a.Model); err != nil {
+				return nil, fmt.Errorf("agent %q: %w", agentID, err)
+			}
+		}
+		if err := registry.Register(agentID, fn); err != nil {
 			return nil, fmt.Errorf("register agent %q: %w", agentID, err)
 		}
+		for version, v := range a.Versions {
+			versioned := agent.VersionedID(agentID, version)
+			fn := deterministicAgent(versioned)
+			if v.Provider != "" {
+				var err error
+				if fn, err = providers.agent(versioned, v.Provider, v.Model); err != nil {
+					return nil, fmt.Errorf("agent %q: %w", versioned, err)
+				}
+			}
+			if err := registry.RegisterVersion(agentID, version, fn); err != nil {
+				return nil, fmt.Errorf("register agent %q: %w", versioned, err)
+			}
+		}
 	}
 	return registry, nil
 }
@@ -348,6 +625,14 @@ func buildExecutionPlan(manifest config.Manifest, namespace string, defaultCB ag
 	return router.ExecutionPlan{TaskID: taskID, Nodes: nodes}, nil
 }
 
+func invocationCount(tr trace.ExecutionTrace) int {
+	ids := make(map[string]struct{}, len(tr.Steps))
+	for _, s := range tr.Steps {
+		ids[s.InvocationID] = struct{}{}
+	}
+	return len(ids)
+}
+
 func uniqueAgentIDs(tr trace.ExecutionTrace) []string {
 	set := make(map[string]struct{})
 	for _, s := range tr.Steps {
@@ -370,7 +655,7 @@ func emitStructuredLogs(out io.Writer, report RunReport) {
 		errText := ""
 		if r.Err != nil {
 			status = "error"
-			errText = r.Err.Error()
+			errText = report.redactor.RedactText(r.Err.Error())
 		}
 
 		entry := map[string]any{
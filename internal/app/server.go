@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/your-org/fluxroute/internal/quota"
 	"github.com/your-org/fluxroute/internal/security"
+	"github.com/your-org/fluxroute/internal/tenant"
 )
 
 func RouterHandler() http.Handler {
@@ -43,7 +46,14 @@ func RouterHandler() http.Handler {
 			req.ManifestPath = "configs/router.example.yaml"
 		}
 		if _, err := RunManifestReport(req.ManifestPath); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, quota.ErrQuotaExceeded):
+				status = http.StatusTooManyRequests
+			case errors.Is(err, tenant.ErrUnknownTenant), errors.Is(err, tenant.ErrTenantSuspended):
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
 			return
 		}
 		w.WriteHeader(http.StatusAccepted)
@@ -76,6 +86,7 @@ func RouterHandler() http.Handler {
 		}
 		var req struct {
 			TracePath string `json:"trace_path"`
+			Mode      string `json:"mode"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -85,11 +96,21 @@ func RouterHandler() http.Handler {
 			http.Error(w, "trace_path is required", http.StatusBadRequest)
 			return
 		}
-		if err := ReplayTrace(req.TracePath, w); err != nil {
+		replay := ReplayTrace
+		switch req.Mode {
+		case "", "outputs":
+		case "dag":
+			replay = ReplayTraceDAG
+		default:
+			http.Error(w, "mode must be outputs or dag", http.StatusBadRequest)
+			return
+		}
+		if err := replay(req.TracePath, w); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	})
+	registerTraceRoutes(register)
 	return mux
 }
 
@@ -126,6 +147,9 @@ func StartRouterServerTLS(ctx context.Context, addr string, certFile string, key
 }
 
 func StartRouterServerFromEnv(ctx context.Context) error {
+	if err := startUsageFlusher(ctx); err != nil {
+		return fmt.Errorf("usage reporter: %w", err)
+	}
 	addr := os.Getenv("ROUTER_ADDR")
 	if addr == "" {
 		addr = ":8080"
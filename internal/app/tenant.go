@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/tenant"
+)
+
+var (
+	tenantRegistriesMu sync.Mutex
+	tenantRegistries   = map[string]*tenant.Registry{}
+)
+
+// tenantRegistry returns a process-wide registry per control plane URL so
+// the router server reuses its cached tenant view across runs. It is nil
+// unless TENANT_VERIFY is enabled.
+func tenantRegistry() (*tenant.Registry, error) {
+	key := strings.TrimSpace(os.Getenv("TENANT_VERIFY")) + "|" + strings.TrimSpace(os.Getenv("CONTROLPLANE_URL")) + "|" + strings.TrimSpace(os.Getenv("TENANT_CACHE_TTL"))
+	tenantRegistriesMu.Lock()
+	defer tenantRegistriesMu.Unlock()
+	if r, ok := tenantRegistries[key]; ok {
+		return r, nil
+	}
+	r, err := tenant.RegistryFromEnv()
+	if err != nil || r == nil {
+		return nil, err
+	}
+	tenantRegistries[key] = r
+	return r, nil
+}
+
+// verifyTenant refuses to run a manifest whose namespace is not a known,
+// active control-plane tenant, and returns the labels traces and metrics
+// carry for the run. Without TENANT_VERIFY only tenant.id is set. If the
+// control plane cannot be reached the last known tenant is used, or the run
+// is allowed, unless TENANT_FAIL_CLOSED is set.
+func verifyTenant(namespace string) (map[string]string, error) {
+	labels := map[string]string{"tenant.id": namespace}
+	registry, err := tenantRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("tenant registry: %w", err)
+	}
+	if registry == nil {
+		return labels, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := registry.Lookup(ctx, namespace)
+	switch {
+	case errors.Is(err, tenant.ErrUnknownTenant):
+		return nil, err
+	case err != nil:
+		if envBool("TENANT_FAIL_CLOSED") {
+			return nil, fmt.Errorf("verify tenant: %w", err)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: tenant check used cached or no registry entry: %v\n", err)
+		if info.ID == "" {
+			return labels, nil
+		}
+	}
+	if err := info.Admit(); err != nil {
+		return nil, err
+	}
+	return info.Labels(), nil
+}
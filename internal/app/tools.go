@@ -1,8 +1,11 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/your-org/fluxroute/internal/scaffold"
 	"github.com/your-org/fluxroute/internal/trace"
@@ -16,7 +19,44 @@ func ScaffoldProject(targetDir string, pipelineName string, out io.Writer) error
 	return nil
 }
 
+// DebugOptions select how DebugTraceWithOptions reports divergences.
+type DebugOptions struct {
+	// Format is text (default), json or html.
+	Format string
+	// ConfigPath names a trace.DiffConfig file; DEBUG_DIFF_CONFIG is used
+	// when empty.
+	ConfigPath string
+	// Tolerance, when positive, overrides the config's numeric tolerance.
+	Tolerance float64
+}
+
 func DebugTrace(expectedPath string, actualPath string, out io.Writer) error {
+	return DebugTraceWithOptions(expectedPath, actualPath, DebugOptions{}, out)
+}
+
+// DebugTraceWithOptions compares two trace files with structural payload
+// diffs, traces divergences back to their root causes and writes the
+// report in the requested format.
+func DebugTraceWithOptions(expectedPath string, actualPath string, opts DebugOptions, out io.Writer) error {
+	switch opts.Format {
+	case "", "text", "json", "html":
+	default:
+		return fmt.Errorf("unknown debug format %q (want text|json|html)", opts.Format)
+	}
+	var cfg trace.DiffConfig
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = strings.TrimSpace(os.Getenv("DEBUG_DIFF_CONFIG"))
+	}
+	if opts.ConfigPath != "" {
+		var err error
+		if cfg, err = trace.LoadDiffConfig(opts.ConfigPath); err != nil {
+			return err
+		}
+	}
+	if opts.Tolerance > 0 {
+		cfg.Tolerance = opts.Tolerance
+	}
+
 	expected, err := trace.LoadFromFile(expectedPath)
 	if err != nil {
 		return err
@@ -25,8 +65,31 @@ func DebugTrace(expectedPath string, actualPath string, out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	div := trace.Compare(expected, actual)
-	_, _ = fmt.Fprintln(out, trace.FormatDivergence(div))
+	div := trace.Diff(expected, actual, cfg)
+	report := trace.DiffReport{
+		Expected:    expectedPath,
+		Actual:      actualPath,
+		Divergences: div,
+		RootCauses:  trace.RootCauses(expected, actual, div, cfg),
+	}
+
+	switch opts.Format {
+	case "", "text":
+		_, _ = fmt.Fprintln(out, trace.FormatDivergence(div))
+		if len(report.RootCauses) > 0 {
+			_, _ = fmt.Fprint(out, trace.FormatRootCauses(report.RootCauses))
+		}
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	case "html":
+		if err := trace.WriteDiffHTML(out, report); err != nil {
+			return err
+		}
+	}
 	if len(div) > 0 {
 		return fmt.Errorf("trace divergence found: %d issue(s)", len(div))
 	}
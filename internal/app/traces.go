@@ -0,0 +1,129 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/security"
+	"github.com/your-org/fluxroute/internal/trace"
+)
+
+// storeTrace keeps the run's trace in the TRACE_STORE_DIR store, if one is
+// configured, and applies its retention. Retention failures only warn.
+func storeTrace(runID string, namespace string, tr trace.ExecutionTrace) error {
+	store, retention, err := trace.StoreConfigFromEnv()
+	if err != nil || store == nil {
+		return err
+	}
+	if _, err := store.Put(runID, namespace, tr); err != nil {
+		return err
+	}
+	if _, err := store.GC(retention, time.Now()); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: trace retention failed: %v\n", err)
+	}
+	return nil
+}
+
+// QueryFromValues builds a trace query from list filters: namespace, agent,
+// status, error, since, until and limit.
+func QueryFromValues(get func(string) string, now time.Time) (trace.Query, error) {
+	q := trace.Query{
+		Namespace: strings.TrimSpace(get("namespace")),
+		Agent:     strings.TrimSpace(get("agent")),
+		Status:    strings.ToLower(strings.TrimSpace(get("status"))),
+		Error:     strings.TrimSpace(get("error")),
+	}
+	switch q.Status {
+	case "", trace.RunSucceeded, trace.RunFailed:
+	default:
+		return trace.Query{}, fmt.Errorf("invalid status %q (want %s|%s)", q.Status, trace.RunSucceeded, trace.RunFailed)
+	}
+	var err error
+	if q.Since, err = trace.ParseQueryTime(get("since"), now); err != nil {
+		return trace.Query{}, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = trace.ParseQueryTime(get("until"), now); err != nil {
+		return trace.Query{}, fmt.Errorf("until: %w", err)
+	}
+	if raw := strings.TrimSpace(get("limit")); raw != "" {
+		if q.Limit, err = strconv.Atoi(raw); err != nil || q.Limit < 0 {
+			return trace.Query{}, fmt.Errorf("invalid limit %q", raw)
+		}
+	}
+	return q, nil
+}
+
+func registerTraceRoutes(register func(string, http.HandlerFunc)) {
+	store := func(w http.ResponseWriter) *trace.FileStore {
+		if err := authorize(security.DefaultPolicy(), security.ActionReplay); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return nil
+		}
+		s, _, err := trace.StoreConfigFromEnv()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil
+		}
+		if s == nil {
+			http.Error(w, "trace store is not configured (set TRACE_STORE_DIR)", http.StatusNotFound)
+			return nil
+		}
+		return s
+	}
+
+	register("/traces", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s := store(w)
+		if s == nil {
+			return
+		}
+		q, err := QueryFromValues(r.URL.Query().Get, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Limit == 0 {
+			q.Limit = 100
+		}
+		runs, err := s.List(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"runs": runs})
+	})
+	register("/traces/{run_id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s := store(w)
+		if s == nil {
+			return
+		}
+		tr, sum, err := s.Get(r.PathValue("run_id"))
+		if errors.Is(err, trace.ErrTraceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"summary": sum, "trace": tr})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/usage"
+)
+
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("run_%d", time.Now().UnixNano())
+	}
+	return "run_" + hex.EncodeToString(b)
+}
+
+// reportUsage enqueues the run's usage and outcome in the outbox and makes
+// one delivery attempt. Events that cannot be delivered now stay queued for
+// the next run or the router server's background flusher. The namespace is
+// the tenant.
+func reportUsage(runID string, namespace string, results []router.AgentResult, duration time.Duration) error {
+	reporter, err := usage.ReporterFromEnv()
+	if err != nil || reporter == nil {
+		return err
+	}
+	now := time.Now()
+	events := usage.FromResults(runID, namespace, namespace, results, now)
+	if err := reporter.Enqueue(events...); err != nil {
+		return fmt.Errorf("enqueue usage: %w", err)
+	}
+	if err := reporter.EnqueueRun(usage.RunFromResults(runID, namespace, namespace, results, duration, now)); err != nil {
+		return fmt.Errorf("enqueue run outcome: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := reporter.Flush(ctx); err != nil {
+		return fmt.Errorf("deliver usage (queued in %s): %w", reporter.Outbox().Dir(), err)
+	}
+	return nil
+}
+
+// startUsageFlusher retries queued usage events in the background while the
+// router server runs.
+func startUsageFlusher(ctx context.Context) error {
+	reporter, err := usage.ReporterFromEnv()
+	if err != nil || reporter == nil {
+		return err
+	}
+	interval := 10 * time.Second
+	if v := strings.TrimSpace(os.Getenv("USAGE_FLUSH_INTERVAL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			interval = d
+		}
+	}
+	go reporter.Run(ctx, interval, func(err error) {
+		_, _ = fmt.Fprintf(os.Stderr, "fluxroute: warning: usage flush: %v\n", err)
+	})
+	return nil
+}
@@ -9,20 +9,36 @@ import (
 	"time"
 )
 
-// Event is one audit-log record.
+// Event is one audit-log record. The fields after Error are set by the
+// control plane, which records who changed what from where.
 type Event struct {
-	Timestamp string `json:"ts"`
-	Actor     string `json:"actor"`
-	Action    string `json:"action"`
-	Resource  string `json:"resource"`
-	Status    string `json:"status"`
-	Error     string `json:"error,omitempty"`
+	Timestamp string          `json:"ts"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Resource  string          `json:"resource"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	TenantID  string          `json:"tenant_id,omitempty"`
+	SourceIP  string          `json:"source_ip,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
 }
 
 // Logger writes JSONL audit records.
 type Logger struct {
-	mu   sync.Mutex
-	path string
+	mu       sync.Mutex
+	path     string
+	redactor Redactor
+}
+
+// Redactor scrubs sensitive values from events before they are written.
+// Package redact provides the implementation configured from a manifest.
+type Redactor interface {
+	RedactText(s string) string
+	RedactPayload(b []byte) []byte
 }
 
 func NewLogger(path string) *Logger {
@@ -48,14 +64,51 @@ func (l *Logger) Write(actor, action, resource, status string, err error) error
 	if err != nil {
 		ev.Error = err.Error()
 	}
-	b, mErr := json.Marshal(ev)
-	if mErr != nil {
-		return fmt.Errorf("audit marshal: %w", mErr)
+	return l.Record(ev)
+}
+
+// SetRedactor makes the logger redact the resource, error and before/after
+// snapshots of every event it writes.
+func (l *Logger) SetRedactor(r Redactor) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = r
+}
+
+// redactEvent returns ev with its resource, error and before/after
+// snapshots passed through r, if r is set.
+func redactEvent(ev Event, r Redactor) Event {
+	if r == nil {
+		return ev
+	}
+	ev.Resource = r.RedactText(ev.Resource)
+	ev.Error = r.RedactText(ev.Error)
+	ev.Before = r.RedactPayload(ev.Before)
+	ev.After = r.RedactPayload(ev.After)
+	return ev
+}
+
+// Record appends a fully populated event. An empty Timestamp is set to now.
+func (l *Logger) Record(ev Event) error {
+	if !l.Enabled() {
+		return nil
+	}
+	if ev.Timestamp == "" {
+		ev.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	ev = redactEvent(ev, l.redactor)
+	b, mErr := json.Marshal(ev)
+	if mErr != nil {
+		return fmt.Errorf("audit marshal: %w", mErr)
+	}
+
 	if mkErr := os.MkdirAll(filepath.Dir(l.path), 0o755); mkErr != nil {
 		return fmt.Errorf("audit mkdir: %w", mkErr)
 	}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTrailSize is how many events a Trail keeps in memory.
+const DefaultTrailSize = 10000
+
+// Filter selects events from a Trail. Zero fields match everything;
+// Resource matches by prefix and From/To bound the timestamp to [From, To).
+type Filter struct {
+	Actor     string
+	Action    string
+	Resource  string
+	TenantID  string
+	Status    string
+	RequestID string
+	From      time.Time
+	To        time.Time
+}
+
+func (f Filter) matches(ev Event, at time.Time) bool {
+	switch {
+	case f.Actor != "" && ev.Actor != f.Actor,
+		f.Action != "" && ev.Action != f.Action,
+		f.Resource != "" && !strings.HasPrefix(ev.Resource, f.Resource),
+		f.TenantID != "" && ev.TenantID != f.TenantID,
+		f.Status != "" && ev.Status != f.Status,
+		f.RequestID != "" && ev.RequestID != f.RequestID,
+		!f.From.IsZero() && at.Before(f.From),
+		!f.To.IsZero() && !at.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// Trail keeps recent events queryable in memory and appends each one to a
+// Logger, whose JSONL file is the durable record.
+type Trail struct {
+	mu       sync.Mutex
+	logger   *Logger
+	redactor Redactor
+	max      int
+	seq      int64
+	events   []Event
+}
+
+// NewTrail returns a trail keeping at most max events (DefaultTrailSize
+// when max <= 0). A nil or disabled logger keeps events in memory only.
+func NewTrail(logger *Logger, max int) *Trail {
+	if max <= 0 {
+		max = DefaultTrailSize
+	}
+	return &Trail{logger: logger, max: max}
+}
+
+// SetRedactor makes the trail redact the resource, error and before/after
+// snapshots of every event before storing it, so queries, shared state and
+// the log all see the redacted event.
+func (t *Trail) SetRedactor(r Redactor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.redactor = r
+}
+
+// Append assigns the event an ID and timestamp, stores it and writes it to
+// the logger. The stored event is returned even when the write fails.
+func (t *Trail) Append(ev Event) (Event, error) {
+	t.mu.Lock()
+	ev = redactEvent(ev, t.redactor)
+	t.seq++
+	ev.ID = fmt.Sprintf("aud_%08d", t.seq)
+	if ev.Timestamp == "" {
+		ev.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	t.events = append(t.events, ev)
+	if over := len(t.events) - t.max; over > 0 {
+		t.events = append(t.events[:0:0], t.events[over:]...)
+	}
+	t.mu.Unlock()
+	return ev, t.logger.Record(ev)
+}
+
+// TrailState is a trail's retained events in serializable form, used to
+// share the trail between control-plane replicas.
+type TrailState struct {
+	Seq    int64   `json:"seq"`
+	Events []Event `json:"events,omitempty"`
+}
+
+func (t *Trail) State() TrailState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return TrailState{Seq: t.seq, Events: append([]Event(nil), t.events...)}
+}
+
+// Restore replaces the retained events with st without logging them again.
+func (t *Trail) Restore(st TrailState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq = st.Seq
+	t.events = append([]Event(nil), st.Events...)
+	if over := len(t.events) - t.max; over > 0 {
+		t.events = t.events[over:]
+	}
+}
+
+// Seq is the sequence number of the latest event.
+func (t *Trail) Seq() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seq
+}
+
+// Since returns the retained events appended after seq, for Extend to add
+// to another trail.
+func (t *Trail) Since(seq int64) TrailState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := min(t.seq-seq, int64(len(t.events)))
+	if n <= 0 {
+		return TrailState{Seq: t.seq}
+	}
+	return TrailState{Seq: t.seq, Events: append([]Event(nil), t.events[int64(len(t.events))-n:]...)}
+}
+
+// Extend appends the events of st, as returned by Since, without logging
+// them again. Events the trail already holds are skipped.
+func (t *Trail) Extend(st TrailState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := st.Events
+	if held := t.seq - (st.Seq - int64(len(events))); held > 0 {
+		events = events[min(held, int64(len(events))):]
+	}
+	t.events = append(t.events, events...)
+	t.seq = max(t.seq, st.Seq)
+	if over := len(t.events) - t.max; over > 0 {
+		t.events = append(t.events[:0:0], t.events[over:]...)
+	}
+}
+
+// Query returns matching events, newest first.
+func (t *Trail) Query(f Filter) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Event, 0)
+	for i := len(t.events) - 1; i >= 0; i-- {
+		ev := t.events[i]
+		at, _ := time.Parse(time.RFC3339Nano, ev.Timestamp)
+		if f.matches(ev, at) {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
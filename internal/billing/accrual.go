@@ -0,0 +1,87 @@
+package billing
+
+import (
+	"fmt"
+	"time"
+)
+
+// priceScope identifies the price a quantity is rated under. Tier positions
+// are tracked per scope, as on the invoice.
+type priceScope struct {
+	meter Meter
+	model string
+}
+
+// Accrual prices one tenant's usage in [Start, End) as it is recorded, so
+// the charges so far are known without re-rating the period. Each record is
+// priced by the plan in effect when it occurred and tier positions carry
+// over from earlier records. Amounts are not rounded, so Usage can differ
+// from the invoice's usage lines by per-line rounding.
+type Accrual struct {
+	TenantID string
+	Start    time.Time
+	End      time.Time
+	Currency Currency
+	// Usage is the sum of usage charges accrued so far.
+	Usage Amount
+
+	consumed map[priceScope]int64
+	volume   map[priceScope]Amount
+}
+
+// NewAccrual starts an empty accrual in the currency the period would be
+// invoiced in.
+func (c *Catalog) NewAccrual(tenantID string, start time.Time, end time.Time) *Accrual {
+	start, end = start.UTC(), end.UTC()
+	return &Accrual{
+		TenantID: tenantID,
+		Start:    start,
+		End:      end,
+		Currency: c.PlanAt(tenantID, end.Add(-time.Nanosecond)).Currency,
+		consumed: make(map[priceScope]int64),
+		volume:   make(map[priceScope]Amount),
+	}
+}
+
+// Accrue prices u and adds it to a, returning the charge it added. Records
+// outside the period add nothing. Graduated tiers price only the new units;
+// volume tiers reprice the scope's whole quantity at its new tier, so the
+// charge can be negative when a cheaper tier is reached.
+func (c *Catalog) Accrue(a *Accrual, u UsageRecord) (Amount, error) {
+	at := u.OccurredAt.UTC()
+	if at.Before(a.Start) || !at.Before(a.End) {
+		return 0, nil
+	}
+	plan := c.PlanAt(a.TenantID, at)
+	if plan.Currency != a.Currency {
+		return 0, fmt.Errorf("%w: tenant %q is billed in %s and %s within one period", ErrCurrencyMismatch, a.TenantID, plan.Currency, a.Currency)
+	}
+	var added Amount
+	for _, m := range Meters {
+		q := u.Quantity(m)
+		if q == 0 {
+			continue
+		}
+		mp, ok := plan.priceFor(m, u.Model)
+		if !ok {
+			continue
+		}
+		scope := priceScope{mp.Meter, mp.Model}
+		before := a.consumed[scope]
+		a.consumed[scope] = before + q
+		if mp.Mode == TierVolume {
+			var total Amount
+			for _, ch := range mp.charges(0, before+q, before+q) {
+				total += ch.amount
+			}
+			added += total - a.volume[scope]
+			a.volume[scope] = total
+			continue
+		}
+		for _, ch := range mp.charges(before, q, before+q) {
+			added += ch.amount
+		}
+	}
+	a.Usage += added
+	return added, nil
+}
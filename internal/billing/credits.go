@@ -0,0 +1,476 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrCreditGrantNotFound = errors.New("credit grant not found")
+
+// CreditKind records why credits were granted.
+type CreditKind string
+
+const (
+	CreditPromotional CreditKind = "promotional"
+	CreditPurchased   CreditKind = "purchased"
+)
+
+func ParseCreditKind(raw string) (CreditKind, error) {
+	switch k := CreditKind(strings.ToLower(strings.TrimSpace(raw))); k {
+	case "":
+		return CreditPurchased, nil
+	case CreditPromotional, CreditPurchased:
+		return k, nil
+	default:
+		return "", fmt.Errorf("unknown credit kind %q", raw)
+	}
+}
+
+// CreditGrant is a block of prepaid credit. Remaining falls as usage draws
+// it down and drops to zero when the grant expires.
+type CreditGrant struct {
+	ID        string     `json:"id"`
+	TenantID  string     `json:"tenant_id"`
+	Kind      CreditKind `json:"kind"`
+	Amount    Money      `json:"amount"`
+	Remaining Amount     `json:"remaining"`
+	GrantedAt time.Time  `json:"granted_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiredAt *time.Time `json:"expired_at,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+// LedgerEntryKind classifies credit ledger entries.
+type LedgerEntryKind string
+
+const (
+	LedgerGrant    LedgerEntryKind = "grant"
+	LedgerDrawdown LedgerEntryKind = "drawdown"
+	LedgerExpiry   LedgerEntryKind = "expiry"
+)
+
+// LedgerEntry is one balance movement. Amount is positive for grants and
+// negative for drawdowns and expiries; Balance is the total after it.
+// Drawdowns carry the UTC month of the usage they paid for in Period.
+type LedgerEntry struct {
+	ID       string          `json:"id"`
+	TenantID string          `json:"tenant_id"`
+	Kind     LedgerEntryKind `json:"kind"`
+	GrantID  string          `json:"grant_id"`
+	Amount   Money           `json:"amount"`
+	Balance  Money           `json:"balance"`
+	Period   *time.Time      `json:"period,omitempty"`
+	At       time.Time       `json:"at"`
+}
+
+type creditAccount struct {
+	currency    Currency
+	blockAtZero bool
+	openedAt    time.Time
+	grants      []*CreditGrant
+	entries     []LedgerEntry
+	// applied sums drawdowns by the Unix start of their usage month.
+	applied map[int64]Amount
+	// taken is how many entries were already returned by Changes.
+	taken int
+}
+
+// CreditLedger tracks prepaid credit per tenant. Like Catalog it is not safe
+// for concurrent use; callers serialize access.
+type CreditLedger struct {
+	accounts map[string]*creditAccount
+	seq      int64
+	// changed holds the tenants whose accounts changed since Changes was
+	// last called; it is nil unless TrackChanges was called.
+	changed map[string]struct{}
+}
+
+func NewCreditLedger() *CreditLedger {
+	return &CreditLedger{accounts: make(map[string]*creditAccount)}
+}
+
+// Has reports whether the tenant has a credit account.
+func (l *CreditLedger) Has(tenantID string) bool {
+	_, ok := l.accounts[tenantID]
+	return ok
+}
+
+// OpenedAt is when the tenant's account was created; usage before it is
+// never drawn from credits.
+func (l *CreditLedger) OpenedAt(tenantID string) time.Time {
+	if acct, ok := l.accounts[tenantID]; ok {
+		return acct.openedAt
+	}
+	return time.Time{}
+}
+
+func (l *CreditLedger) account(tenantID string, at time.Time) *creditAccount {
+	acct, ok := l.accounts[tenantID]
+	if !ok {
+		acct = &creditAccount{openedAt: at.UTC()}
+		l.accounts[tenantID] = acct
+		l.touch(tenantID)
+	}
+	return acct
+}
+
+func (l *CreditLedger) touch(tenantID string) {
+	if l.changed != nil {
+		l.changed[tenantID] = struct{}{}
+	}
+}
+
+// SetBlockAtZero opens the account if needed and sets whether an empty
+// balance should block further usage.
+func (l *CreditLedger) SetBlockAtZero(tenantID string, block bool, at time.Time) {
+	l.account(tenantID, at).blockAtZero = block
+	l.touch(tenantID)
+}
+
+func (l *CreditLedger) BlockAtZero(tenantID string) bool {
+	acct, ok := l.accounts[tenantID]
+	return ok && acct.blockAtZero
+}
+
+// Grant adds credit. An account holds a single currency, set by its first grant.
+func (l *CreditLedger) Grant(tenantID string, kind CreditKind, amount Money, expiresAt time.Time, note string, at time.Time) (CreditGrant, error) {
+	at = at.UTC()
+	if amount.Amount <= 0 {
+		return CreditGrant{}, fmt.Errorf("credit amount must be > 0")
+	}
+	currency, err := ParseCurrency(string(amount.Currency))
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(at) {
+		return CreditGrant{}, fmt.Errorf("expires_at must be after the grant time")
+	}
+	if acct, ok := l.accounts[tenantID]; ok && acct.currency != "" && acct.currency != currency {
+		return CreditGrant{}, fmt.Errorf("%w: tenant %q holds %s credit, grant is %s", ErrCurrencyMismatch, tenantID, acct.currency, currency)
+	}
+	acct := l.account(tenantID, at)
+	l.expire(tenantID, acct, at)
+	acct.currency = currency
+	l.seq++
+	g := &CreditGrant{
+		ID:        fmt.Sprintf("cg_%06d", l.seq),
+		TenantID:  tenantID,
+		Kind:      kind,
+		Amount:    NewMoney(amount.Amount, currency),
+		Remaining: amount.Amount,
+		GrantedAt: at,
+		Note:      strings.TrimSpace(note),
+	}
+	if !expiresAt.IsZero() {
+		exp := expiresAt.UTC()
+		g.ExpiresAt = &exp
+	}
+	acct.grants = append(acct.grants, g)
+	l.record(tenantID, acct, LedgerGrant, g.ID, amount.Amount, nil, at)
+	return cloneGrant(g), nil
+}
+
+// Draw spends up to amount from active grants, soonest-expiring first, and
+// returns what was covered. The rest is left for the invoice to bill.
+func (l *CreditLedger) Draw(tenantID string, amount Money, period time.Time, at time.Time) (Money, error) {
+	acct, ok := l.accounts[tenantID]
+	if !ok || amount.Amount <= 0 {
+		return NewMoney(0, amount.Currency), nil
+	}
+	at = at.UTC()
+	l.expire(tenantID, acct, at)
+	if acct.currency == "" {
+		return NewMoney(0, amount.Currency), nil
+	}
+	if acct.currency != amount.Currency {
+		return Money{}, fmt.Errorf("%w: tenant %q holds %s credit, usage is billed in %s", ErrCurrencyMismatch, tenantID, acct.currency, amount.Currency)
+	}
+	period = period.UTC()
+	need := amount.Amount
+	for _, g := range drawOrder(acct.grants) {
+		if need == 0 {
+			break
+		}
+		if g.Remaining == 0 || g.GrantedAt.After(at) {
+			continue
+		}
+		take := min(g.Remaining, need)
+		g.Remaining -= take
+		need -= take
+		l.record(tenantID, acct, LedgerDrawdown, g.ID, -take, &period, at)
+	}
+	return NewMoney(amount.Amount-need, acct.currency), nil
+}
+
+// drawOrder sorts grants by expiry (never-expiring last), then grant time.
+func drawOrder(grants []*CreditGrant) []*CreditGrant {
+	out := append([]*CreditGrant(nil), grants...)
+	sort.SliceStable(out, func(i, j int) bool {
+		ei, ej := out[i].ExpiresAt, out[j].ExpiresAt
+		switch {
+		case ei != nil && ej != nil && !ei.Equal(*ej):
+			return ei.Before(*ej)
+		case (ei == nil) != (ej == nil):
+			return ei != nil
+		}
+		return out[i].GrantedAt.Before(out[j].GrantedAt)
+	})
+	return out
+}
+
+// Expire writes off the remainder of grants expired by at.
+func (l *CreditLedger) Expire(tenantID string, at time.Time) {
+	if acct, ok := l.accounts[tenantID]; ok {
+		l.expire(tenantID, acct, at.UTC())
+	}
+}
+
+func (l *CreditLedger) expire(tenantID string, acct *creditAccount, at time.Time) {
+	due := make([]*CreditGrant, 0)
+	for _, g := range acct.grants {
+		if g.ExpiredAt == nil && g.ExpiresAt != nil && !g.ExpiresAt.After(at) {
+			due = append(due, g)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+	l.touch(tenantID)
+	sort.SliceStable(due, func(i, j int) bool { return due[i].ExpiresAt.Before(*due[j].ExpiresAt) })
+	for _, g := range due {
+		exp := *g.ExpiresAt
+		g.ExpiredAt = &exp
+		if g.Remaining > 0 {
+			lost := g.Remaining
+			g.Remaining = 0
+			l.record(tenantID, acct, LedgerExpiry, g.ID, -lost, nil, exp)
+		}
+	}
+}
+
+func (l *CreditLedger) record(tenantID string, acct *creditAccount, kind LedgerEntryKind, grantID string, amount Amount, period *time.Time, at time.Time) {
+	var balance Amount
+	for _, g := range acct.grants {
+		balance += g.Remaining
+	}
+	l.seq++
+	l.touch(tenantID)
+	acct.entries = append(acct.entries, LedgerEntry{
+		ID:       fmt.Sprintf("cle_%06d", l.seq),
+		TenantID: tenantID,
+		Kind:     kind,
+		GrantID:  grantID,
+		Amount:   NewMoney(amount, acct.currency),
+		Balance:  NewMoney(balance, acct.currency),
+		Period:   period,
+		At:       at,
+	})
+	if kind == LedgerDrawdown && period != nil {
+		acct.addApplied(*period, -amount)
+	}
+}
+
+func (acct *creditAccount) addApplied(period time.Time, amount Amount) {
+	if acct.applied == nil {
+		acct.applied = make(map[int64]Amount)
+	}
+	acct.applied[period.Unix()] += amount
+}
+
+// Balance returns the unexpired remaining credit at at.
+func (l *CreditLedger) Balance(tenantID string, at time.Time) Money {
+	acct, ok := l.accounts[tenantID]
+	if !ok {
+		return Money{}
+	}
+	l.expire(tenantID, acct, at.UTC())
+	var total Amount
+	for _, g := range acct.grants {
+		total += g.Remaining
+	}
+	return NewMoney(total, acct.currency)
+}
+
+// Grants returns a tenant's grants, oldest first.
+func (l *CreditLedger) Grants(tenantID string, at time.Time) []CreditGrant {
+	acct, ok := l.accounts[tenantID]
+	if !ok {
+		return []CreditGrant{}
+	}
+	l.expire(tenantID, acct, at.UTC())
+	out := make([]CreditGrant, 0, len(acct.grants))
+	for _, g := range acct.grants {
+		out = append(out, cloneGrant(g))
+	}
+	return out
+}
+
+// Entries returns a tenant's ledger in the order it was written.
+func (l *CreditLedger) Entries(tenantID string, at time.Time) []LedgerEntry {
+	acct, ok := l.accounts[tenantID]
+	if !ok {
+		return []LedgerEntry{}
+	}
+	l.expire(tenantID, acct, at.UTC())
+	return append([]LedgerEntry{}, acct.entries...)
+}
+
+// Applied sums drawdowns in currency for usage months within [start, end).
+func (l *CreditLedger) Applied(tenantID string, currency Currency, start time.Time, end time.Time) Amount {
+	acct, ok := l.accounts[tenantID]
+	if !ok || acct.currency != currency {
+		return 0
+	}
+	var total Amount
+	for period, amount := range acct.applied {
+		if period >= start.Unix() && period < end.Unix() {
+			total += amount
+		}
+	}
+	return total
+}
+
+func cloneGrant(g *CreditGrant) CreditGrant {
+	out := *g
+	if g.ExpiresAt != nil {
+		t := *g.ExpiresAt
+		out.ExpiresAt = &t
+	}
+	if g.ExpiredAt != nil {
+		t := *g.ExpiredAt
+		out.ExpiredAt = &t
+	}
+	return out
+}
+
+// CreditAccountState is one tenant's credit account in serializable form.
+type CreditAccountState struct {
+	Currency    Currency      `json:"currency,omitempty"`
+	BlockAtZero bool          `json:"block_at_zero,omitempty"`
+	OpenedAt    time.Time     `json:"opened_at"`
+	Grants      []CreditGrant `json:"grants,omitempty"`
+	Entries     []LedgerEntry `json:"entries,omitempty"`
+}
+
+// CreditLedgerState is a CreditLedger in serializable form.
+type CreditLedgerState struct {
+	Seq      int64                         `json:"seq"`
+	Accounts map[string]CreditAccountState `json:"accounts,omitempty"`
+}
+
+func (l *CreditLedger) State() CreditLedgerState {
+	st := CreditLedgerState{Seq: l.seq, Accounts: make(map[string]CreditAccountState, len(l.accounts))}
+	for tenantID, acct := range l.accounts {
+		st.Accounts[tenantID] = acct.state(0)
+	}
+	return st
+}
+
+// state returns the account with its entries from index from onwards.
+func (acct *creditAccount) state(from int) CreditAccountState {
+	as := CreditAccountState{
+		Currency:    acct.currency,
+		BlockAtZero: acct.blockAtZero,
+		OpenedAt:    acct.openedAt,
+		Entries:     append([]LedgerEntry(nil), acct.entries[from:]...),
+	}
+	for _, g := range acct.grants {
+		as.Grants = append(as.Grants, cloneGrant(g))
+	}
+	return as
+}
+
+// Restore replaces the ledger's contents with st.
+func (l *CreditLedger) Restore(st CreditLedgerState) {
+	l.seq = st.Seq
+	l.accounts = make(map[string]*creditAccount, len(st.Accounts))
+	for tenantID, as := range st.Accounts {
+		acct := &creditAccount{}
+		acct.restore(as, 0)
+		acct.taken = len(acct.entries)
+		l.accounts[tenantID] = acct
+	}
+	if l.changed != nil {
+		clear(l.changed)
+	}
+}
+
+// restore sets the account from as, whose entries replace those from index
+// from onwards.
+func (acct *creditAccount) restore(as CreditAccountState, from int) {
+	acct.currency, acct.blockAtZero, acct.openedAt = as.Currency, as.BlockAtZero, as.OpenedAt
+	from = min(from, len(acct.entries))
+	for _, e := range acct.entries[from:] {
+		if e.Kind == LedgerDrawdown && e.Period != nil {
+			acct.addApplied(*e.Period, e.Amount.Amount)
+		}
+	}
+	acct.entries = append(acct.entries[:from], as.Entries...)
+	for _, e := range as.Entries {
+		if e.Kind == LedgerDrawdown && e.Period != nil {
+			acct.addApplied(*e.Period, -e.Amount.Amount)
+		}
+	}
+	acct.grants = acct.grants[:0]
+	for _, g := range as.Grants {
+		g := cloneGrant(&g)
+		acct.grants = append(acct.grants, &g)
+	}
+}
+
+// CreditAccountChange is an account's settings and grants, and the entries
+// written to it since its changes were last taken, starting at index From.
+type CreditAccountChange struct {
+	CreditAccountState
+	From int `json:"from"`
+}
+
+// CreditLedgerChanges is what changed in a ledger since its changes were
+// last taken.
+type CreditLedgerChanges struct {
+	Seq      int64                          `json:"seq"`
+	Accounts map[string]CreditAccountChange `json:"accounts,omitempty"`
+}
+
+// TrackChanges makes the ledger remember which accounts change, so replicas
+// can copy just those through Changes.
+func (l *CreditLedger) TrackChanges() {
+	if l.changed == nil {
+		l.changed = make(map[string]struct{})
+	}
+}
+
+// Changes returns the accounts changed since the last call and starts over.
+// It is empty unless TrackChanges was called.
+func (l *CreditLedger) Changes() CreditLedgerChanges {
+	c := CreditLedgerChanges{Seq: l.seq}
+	for tenantID := range l.changed {
+		acct := l.accounts[tenantID]
+		if c.Accounts == nil {
+			c.Accounts = make(map[string]CreditAccountChange, len(l.changed))
+		}
+		c.Accounts[tenantID] = CreditAccountChange{CreditAccountState: acct.state(acct.taken), From: acct.taken}
+		acct.taken = len(acct.entries)
+	}
+	clear(l.changed)
+	return c
+}
+
+// ApplyChanges copies another ledger's changes into this one. Entries this
+// ledger wrote on its own past From, such as expiries noticed while reading,
+// are replaced.
+func (l *CreditLedger) ApplyChanges(c CreditLedgerChanges) {
+	l.seq = c.Seq
+	for tenantID, ac := range c.Accounts {
+		acct, ok := l.accounts[tenantID]
+		if !ok {
+			acct = &creditAccount{}
+			l.accounts[tenantID] = acct
+		}
+		acct.restore(ac.CreditAccountState, ac.From)
+		acct.taken = len(acct.entries)
+	}
+}
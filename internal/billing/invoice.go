@@ -0,0 +1,174 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvoiceImmutable     = errors.New("invoice is finalized and cannot be modified")
+	ErrInvalidInvoiceStatus = errors.New("invalid invoice status transition")
+)
+
+// InvoiceStatus is the lifecycle state of an invoice document.
+type InvoiceStatus string
+
+const (
+	StatusDraft     InvoiceStatus = "draft"
+	StatusFinalized InvoiceStatus = "finalized"
+	StatusVoid      InvoiceStatus = "void"
+)
+
+// LineKind classifies invoice lines.
+type LineKind string
+
+const (
+	LineUsage             LineKind = "usage"
+	LineMinimumCommitment LineKind = "minimum_commitment"
+	LineCredit            LineKind = "credit"
+)
+
+// LineItem is one priced row of an invoice in the invoice currency. Credit
+// lines carry negative amounts.
+type LineItem struct {
+	Kind        LineKind  `json:"kind"`
+	Description string    `json:"description"`
+	PlanID      string    `json:"plan_id,omitempty"`
+	Meter       Meter     `json:"meter,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	Tier        int       `json:"tier,omitempty"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Quantity    int64     `json:"quantity"`
+	PerThousand Amount    `json:"per_thousand"`
+	Amount      Amount    `json:"amount"`
+}
+
+// TaxLine is one tax charge computed by a TaxFunc.
+type TaxLine struct {
+	Description string  `json:"description"`
+	RatePercent float64 `json:"rate_percent,omitempty"`
+	Amount      Amount  `json:"amount"`
+}
+
+// TaxFunc computes taxes for an invoice. It sees lines and the taxable amount
+// (subtotal less credits) and must not modify the invoice.
+type TaxFunc func(inv Invoice, taxable Money) []TaxLine
+
+// Invoice is a billing document for one tenant and period in a single
+// currency. Total is the amount due: subtotal less credits plus tax.
+type Invoice struct {
+	ID           string        `json:"id,omitempty"`
+	TenantID     string        `json:"tenant_id"`
+	Status       InvoiceStatus `json:"status"`
+	PeriodStart  time.Time     `json:"period_start"`
+	PeriodEnd    time.Time     `json:"period_end"`
+	CreatedAt    time.Time     `json:"created_at"`
+	FinalizedAt  *time.Time    `json:"finalized_at,omitempty"`
+	VoidedAt     *time.Time    `json:"voided_at,omitempty"`
+	VoidReason   string        `json:"void_reason,omitempty"`
+	Currency     Currency      `json:"currency"`
+	Rounding     RoundingMode  `json:"rounding"`
+	Invocations  int64         `json:"invocations"`
+	InputTokens  int64         `json:"input_tokens"`
+	OutputTokens int64         `json:"output_tokens"`
+	Lines        []LineItem    `json:"lines"`
+	Subtotal     Money         `json:"subtotal"`
+	Credits      Money         `json:"credits"`
+	Taxes        []TaxLine     `json:"taxes,omitempty"`
+	Tax          Money         `json:"tax"`
+	Total        Money         `json:"total"`
+}
+
+// Recalculate derives subtotal, credits, tax and total from lines and taxes,
+// rounding to the currency's minor units according to the invoice rounding
+// mode. Per-line rounding rewrites line amounts to the billed values.
+func (inv *Invoice) Recalculate() {
+	if inv.Currency == "" {
+		inv.Currency = USD
+	}
+	if inv.Rounding == "" {
+		inv.Rounding = RoundPerLine
+	}
+	places := inv.Currency.MinorUnits()
+	perLine := inv.Rounding == RoundPerLine
+
+	var subtotal, credits, tax Amount
+	for i := range inv.Lines {
+		if perLine {
+			inv.Lines[i].Amount = inv.Lines[i].Amount.Round(places)
+		}
+		if inv.Lines[i].Kind == LineCredit {
+			credits -= inv.Lines[i].Amount
+			continue
+		}
+		subtotal += inv.Lines[i].Amount
+	}
+	for i := range inv.Taxes {
+		if perLine {
+			inv.Taxes[i].Amount = inv.Taxes[i].Amount.Round(places)
+		}
+		tax += inv.Taxes[i].Amount
+	}
+	if !perLine {
+		subtotal, credits, tax = subtotal.Round(places), credits.Round(places), tax.Round(places)
+	}
+	inv.Subtotal = NewMoney(subtotal, inv.Currency)
+	inv.Credits = NewMoney(credits, inv.Currency)
+	inv.Tax = NewMoney(tax, inv.Currency)
+	inv.Total = NewMoney(subtotal-credits+tax, inv.Currency)
+}
+
+// ApplyTax replaces the invoice taxes using fn. A nil fn clears taxes.
+func (inv *Invoice) ApplyTax(fn TaxFunc) error {
+	if inv.Status != StatusDraft {
+		return ErrInvoiceImmutable
+	}
+	inv.Taxes = nil
+	inv.Recalculate()
+	if fn != nil {
+		inv.Taxes = fn(inv.Clone(), NewMoney(inv.Subtotal.Amount-inv.Credits.Amount, inv.Currency))
+	}
+	inv.Recalculate()
+	return nil
+}
+
+// Finalize locks a draft invoice.
+func (inv *Invoice) Finalize(at time.Time) error {
+	if inv.Status != StatusDraft {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidInvoiceStatus, inv.Status, StatusFinalized)
+	}
+	at = at.UTC()
+	inv.Status = StatusFinalized
+	inv.FinalizedAt = &at
+	return nil
+}
+
+// Void cancels a draft or finalized invoice. Void invoices keep their lines for audit.
+func (inv *Invoice) Void(at time.Time, reason string) error {
+	if inv.Status == StatusVoid {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidInvoiceStatus, inv.Status, StatusVoid)
+	}
+	at = at.UTC()
+	inv.Status = StatusVoid
+	inv.VoidedAt = &at
+	inv.VoidReason = reason
+	return nil
+}
+
+// Clone returns a deep copy so stored documents cannot be mutated through callers.
+func (inv Invoice) Clone() Invoice {
+	out := inv
+	out.Lines = append([]LineItem(nil), inv.Lines...)
+	out.Taxes = append([]TaxLine(nil), inv.Taxes...)
+	if inv.FinalizedAt != nil {
+		t := *inv.FinalizedAt
+		out.FinalizedAt = &t
+	}
+	if inv.VoidedAt != nil {
+		t := *inv.VoidedAt
+		out.VoidedAt = &t
+	}
+	return out
+}
@@ -0,0 +1,242 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// amountDigits is the fixed number of fractional digits carried by Amount.
+const amountDigits = 6
+
+const amountScale = 1_000_000
+
+// Amount is an exact fixed-point decimal with six fractional digits. It is
+// precise enough for sub-cent unit prices and marshals to JSON as a decimal
+// string so clients never round-trip it through a float.
+type Amount int64
+
+// ParseAmount parses a decimal such as "12", "-0.5" or "0.000125".
+func ParseAmount(raw string) (Amount, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	if len(frac) > amountDigits {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", raw, amountDigits)
+	}
+	digits := whole + frac + strings.Repeat("0", amountDigits-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid amount %q", raw)
+		}
+	}
+	v, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q out of range", raw)
+	}
+	if neg {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+// AmountFromInt converts a whole number.
+func AmountFromInt(v int64) Amount {
+	return Amount(v * amountScale)
+}
+
+// MustParseAmount is ParseAmount for constants; it panics on invalid input.
+func MustParseAmount(raw string) Amount {
+	a, err := ParseAmount(raw)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// String renders the amount without trailing fractional zeros.
+func (a Amount) String() string {
+	s := a.StringFixed(amountDigits)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// StringFixed renders the amount rounded to exactly places fractional digits.
+func (a Amount) StringFixed(places int) string {
+	if places > amountDigits {
+		places = amountDigits
+	}
+	v := int64(a.Round(places))
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole := v / amountScale
+	if places <= 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	frac := fmt.Sprintf("%06d", v%amountScale)[:places]
+	return fmt.Sprintf("%s%d.%s", sign, whole, frac)
+}
+
+// Round rounds half away from zero to the given number of fractional digits.
+func (a Amount) Round(places int) Amount {
+	if places >= amountDigits {
+		return a
+	}
+	unit := int64(1)
+	for i := places; i < amountDigits; i++ {
+		unit *= 10
+	}
+	v := int64(a)
+	rem := v % unit
+	v -= rem
+	if rem < 0 {
+		rem = -rem
+		if rem*2 >= unit {
+			v -= unit
+		}
+	} else if rem*2 >= unit {
+		v += unit
+	}
+	return Amount(v)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts a decimal string or a bare JSON number. Numbers are
+// parsed from their literal text, never through float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unq, err := strconv.Unquote(s); err == nil {
+		s = unq
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// perThousand prices quantity units at price per 1000, rounded half away from
+// zero to Amount precision. Intermediate math is unbounded so token counts
+// cannot overflow.
+func perThousand(quantity int64, price Amount) Amount {
+	num := new(big.Int).Mul(big.NewInt(quantity), big.NewInt(int64(price)))
+	den := big.NewInt(1000)
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Abs(r).Cmp(big.NewInt(500)) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Amount(q.Int64())
+}
+
+// Currency is an ISO 4217 alphabetic code.
+type Currency string
+
+const USD Currency = "USD"
+
+// ParseCurrency normalizes a currency code; empty means USD.
+func ParseCurrency(raw string) (Currency, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	if s == "" {
+		return USD, nil
+	}
+	if len(s) != 3 {
+		return "", fmt.Errorf("invalid currency %q", raw)
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return "", fmt.Errorf("invalid currency %q", raw)
+		}
+	}
+	return Currency(s), nil
+}
+
+// MinorUnits returns the number of fractional digits invoices are rounded to.
+func (c Currency) MinorUnits() int {
+	switch c {
+	case "JPY", "KRW", "VND", "CLP", "ISK", "UGX", "XAF", "XOF":
+		return 0
+	case "BHD", "KWD", "OMR", "JOD", "TND", "LYD", "IQD":
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Money is an amount in a specific currency.
+type Money struct {
+	Amount   Amount   `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+func NewMoney(amount Amount, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Add sums two amounts of the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// String renders the amount at the currency's minor units, e.g. "6.25 USD".
+func (m Money) String() string {
+	return m.Amount.StringFixed(m.Currency.MinorUnits()) + " " + string(m.Currency)
+}
+
+// RoundingMode selects where invoice amounts are rounded to the currency's
+// minor units.
+type RoundingMode string
+
+const (
+	// RoundPerLine rounds every line and tax line; totals are exact sums.
+	RoundPerLine RoundingMode = "per_line"
+	// RoundPerInvoice keeps full precision on lines and rounds the totals once.
+	RoundPerInvoice RoundingMode = "per_invoice"
+)
+
+// ParseRoundingMode validates a rounding mode; empty means per line.
+func ParseRoundingMode(raw string) (RoundingMode, error) {
+	switch m := RoundingMode(strings.ToLower(strings.TrimSpace(raw))); m {
+	case "":
+		return RoundPerLine, nil
+	case RoundPerLine, RoundPerInvoice:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode %q", raw)
+	}
+}
@@ -0,0 +1,576 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPlanID identifies the plan derived from the global rate card.
+const DefaultPlanID = "default"
+
+// TierMode selects how tier prices are applied to a period's usage.
+type TierMode string
+
+const (
+	// TierGraduated prices each unit at the tier it falls into.
+	TierGraduated TierMode = "graduated"
+	// TierVolume prices every unit at the tier reached by the period total.
+	TierVolume TierMode = "volume"
+)
+
+// Meter names a billable usage dimension.
+type Meter string
+
+const (
+	MeterInvocations  Meter = "invocations"
+	MeterInputTokens  Meter = "input_tokens"
+	MeterOutputTokens Meter = "output_tokens"
+)
+
+// Meters lists every meter in invoice order.
+var Meters = []Meter{MeterInvocations, MeterInputTokens, MeterOutputTokens}
+
+// ParseMeter validates a meter name.
+func ParseMeter(raw string) (Meter, error) {
+	m := Meter(strings.ToLower(strings.TrimSpace(raw)))
+	for _, known := range Meters {
+		if m == known {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown meter %q", raw)
+}
+
+// Tier prices usage up to UpTo units per period. UpTo == 0 means unbounded.
+type Tier struct {
+	UpTo        int64  `json:"up_to"`
+	PerThousand Amount `json:"per_thousand"`
+}
+
+// MeterPrice prices one meter, optionally restricted to a single model.
+// A model-specific price takes precedence over the meter's catch-all price.
+type MeterPrice struct {
+	Meter Meter    `json:"meter"`
+	Model string   `json:"model,omitempty"`
+	Mode  TierMode `json:"mode"`
+	Tiers []Tier   `json:"tiers"`
+}
+
+// PricePlan is a named price schedule that can be assigned to tenants. All
+// prices are in Currency. Mode and Tiers are shorthand for a catch-all
+// invocations price.
+type PricePlan struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name,omitempty"`
+	Currency       Currency     `json:"currency"`
+	Rounding       RoundingMode `json:"rounding"`
+	Mode           TierMode     `json:"mode,omitempty"`
+	Tiers          []Tier       `json:"tiers,omitempty"`
+	Prices         []MeterPrice `json:"prices,omitempty"`
+	MinimumMonthly Amount       `json:"minimum_monthly"`
+}
+
+// Assignment binds a tenant to a plan from EffectiveFrom onwards.
+type Assignment struct {
+	TenantID      string    `json:"tenant_id"`
+	PlanID        string    `json:"plan_id"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// UsageRecord is one timestamped usage observation.
+type UsageRecord struct {
+	Model        string
+	Invocations  int64
+	InputTokens  int64
+	OutputTokens int64
+	OccurredAt   time.Time
+}
+
+// Quantity returns the record's value for a meter.
+func (u UsageRecord) Quantity(m Meter) int64 {
+	switch m {
+	case MeterInvocations:
+		return u.Invocations
+	case MeterInputTokens:
+		return u.InputTokens
+	case MeterOutputTokens:
+		return u.OutputTokens
+	default:
+		return 0
+	}
+}
+
+// segment is the part of an invoice period priced under a single plan.
+type segment struct {
+	plan PricePlan
+	from time.Time
+	to   time.Time
+}
+
+// tierCharge is the portion of a quantity priced at one tier.
+type tierCharge struct {
+	tier        int
+	quantity    int64
+	perThousand Amount
+	amount      Amount
+}
+
+// Plan returns the flat plan equivalent of the rate card.
+func (r RateCard) Plan() PricePlan {
+	return PricePlan{
+		ID:       DefaultPlanID,
+		Name:     "Default",
+		Currency: r.PerThousand.Currency,
+		Rounding: RoundPerLine,
+		Prices:   []MeterPrice{{Meter: MeterInvocations, Mode: TierGraduated, Tiers: []Tier{{PerThousand: r.PerThousand.Amount}}}},
+	}
+}
+
+// Validate checks that every price has ascending tiers ending unbounded with no negative prices.
+func (p PricePlan) Validate() error {
+	if strings.TrimSpace(p.ID) == "" {
+		return fmt.Errorf("plan id is empty")
+	}
+	if p.MinimumMonthly < 0 {
+		return fmt.Errorf("plan %q: negative minimum commitment is invalid", p.ID)
+	}
+	if _, err := ParseCurrency(string(p.Currency)); err != nil {
+		return fmt.Errorf("plan %q: %w", p.ID, err)
+	}
+	if _, err := ParseRoundingMode(string(p.Rounding)); err != nil {
+		return fmt.Errorf("plan %q: %w", p.ID, err)
+	}
+	prices := p.normalized().Prices
+	if len(prices) == 0 {
+		return fmt.Errorf("plan %q: at least one price is required", p.ID)
+	}
+	seen := make(map[string]struct{}, len(prices))
+	for _, mp := range prices {
+		if _, err := ParseMeter(string(mp.Meter)); err != nil {
+			return fmt.Errorf("plan %q: %w", p.ID, err)
+		}
+		key := string(mp.Meter) + "|" + mp.Model
+		if _, dup := seen[key]; dup {
+			return fmt.Errorf("plan %q: duplicate price for meter %q model %q", p.ID, mp.Meter, mp.Model)
+		}
+		seen[key] = struct{}{}
+		if err := mp.validate(); err != nil {
+			return fmt.Errorf("plan %q: %w", p.ID, err)
+		}
+	}
+	return nil
+}
+
+func (mp MeterPrice) validate() error {
+	switch mp.Mode {
+	case "", TierGraduated, TierVolume:
+	default:
+		return fmt.Errorf("meter %q: unknown tier mode %q", mp.Meter, mp.Mode)
+	}
+	if len(mp.Tiers) == 0 {
+		return fmt.Errorf("meter %q: at least one tier is required", mp.Meter)
+	}
+	prev := int64(0)
+	for i, t := range mp.Tiers {
+		if t.PerThousand < 0 {
+			return fmt.Errorf("meter %q: tier %d has negative price", mp.Meter, i+1)
+		}
+		last := i == len(mp.Tiers)-1
+		if t.UpTo == 0 {
+			if !last {
+				return fmt.Errorf("meter %q: only the last tier may be unbounded", mp.Meter)
+			}
+			continue
+		}
+		if last {
+			return fmt.Errorf("meter %q: last tier must be unbounded (up_to: 0)", mp.Meter)
+		}
+		if t.UpTo <= prev {
+			return fmt.Errorf("meter %q: tier %d up_to must be greater than %d", mp.Meter, i+1, prev)
+		}
+		prev = t.UpTo
+	}
+	return nil
+}
+
+// normalized folds the Mode/Tiers shorthand into Prices and fills default
+// modes, currency and rounding.
+func (p PricePlan) normalized() PricePlan {
+	out := p
+	out.Currency, _ = ParseCurrency(string(p.Currency))
+	out.Rounding, _ = ParseRoundingMode(string(p.Rounding))
+	out.Prices = make([]MeterPrice, 0, len(p.Prices)+1)
+	if len(p.Tiers) > 0 {
+		out.Prices = append(out.Prices, MeterPrice{Meter: MeterInvocations, Mode: p.Mode, Tiers: append([]Tier(nil), p.Tiers...)})
+	}
+	for _, mp := range p.Prices {
+		mp.Meter = Meter(strings.ToLower(strings.TrimSpace(string(mp.Meter))))
+		mp.Tiers = append([]Tier(nil), mp.Tiers...)
+		out.Prices = append(out.Prices, mp)
+	}
+	for i := range out.Prices {
+		if out.Prices[i].Mode == "" {
+			out.Prices[i].Mode = TierGraduated
+		}
+	}
+	out.Mode = ""
+	out.Tiers = nil
+	return out
+}
+
+// priceFor returns the most specific price for a meter and model.
+func (p PricePlan) priceFor(m Meter, model string) (MeterPrice, bool) {
+	var fallback *MeterPrice
+	for i := range p.Prices {
+		mp := p.Prices[i]
+		if mp.Meter != m {
+			continue
+		}
+		if mp.Model == model && model != "" {
+			return mp, true
+		}
+		if mp.Model == "" {
+			fallback = &p.Prices[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return MeterPrice{}, false
+}
+
+// charges splits n units into per-tier charges given `before` units of the same
+// price scope were already consumed earlier in the period and `total` is the
+// scope's period volume.
+func (mp MeterPrice) charges(before int64, n int64, total int64) []tierCharge {
+	if n <= 0 {
+		return nil
+	}
+	if mp.Mode == TierVolume {
+		idx := len(mp.Tiers) - 1
+		for i, t := range mp.Tiers {
+			if t.UpTo == 0 || total <= t.UpTo {
+				idx = i
+				break
+			}
+		}
+		rate := mp.Tiers[idx].PerThousand
+		return []tierCharge{{tier: idx + 1, quantity: n, perThousand: rate, amount: perThousand(n, rate)}}
+	}
+
+	out := make([]tierCharge, 0, 1)
+	lower := int64(0)
+	from, to := before, before+n
+	for i, t := range mp.Tiers {
+		upper := t.UpTo
+		if upper == 0 || upper > to {
+			upper = to
+		}
+		if upper > from && upper > lower {
+			start := from
+			if lower > start {
+				start = lower
+			}
+			q := upper - start
+			out = append(out, tierCharge{tier: i + 1, quantity: q, perThousand: t.PerThousand, amount: perThousand(q, t.PerThousand)})
+		}
+		if t.UpTo == 0 || t.UpTo >= to {
+			break
+		}
+		lower = t.UpTo
+	}
+	return out
+}
+
+// Catalog holds named plans and effective-dated tenant assignments.
+// It is not safe for concurrent use; callers serialize access.
+type Catalog struct {
+	Default     RateCard
+	plans       map[string]PricePlan
+	assignments map[string][]Assignment
+}
+
+func NewCatalog(rate RateCard) *Catalog {
+	return &Catalog{Default: rate, plans: make(map[string]PricePlan), assignments: make(map[string][]Assignment)}
+}
+
+// UpsertPlan stores a validated plan. The default plan ID is reserved for the rate card.
+func (c *Catalog) UpsertPlan(p PricePlan) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.ID == DefaultPlanID {
+		return fmt.Errorf("plan id %q is reserved; use the rate endpoint", DefaultPlanID)
+	}
+	c.plans[p.ID] = p.normalized()
+	return nil
+}
+
+// Plan resolves a plan by ID, including the default plan.
+func (c *Catalog) Plan(id string) (PricePlan, bool) {
+	if id == DefaultPlanID {
+		return c.Default.Plan(), true
+	}
+	p, ok := c.plans[id]
+	return p, ok
+}
+
+func (c *Catalog) Plans() []PricePlan {
+	out := make([]PricePlan, 0, len(c.plans)+1)
+	out = append(out, c.Default.Plan())
+	for _, p := range c.plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Assign schedules a plan for a tenant. A later assignment at the same instant replaces the earlier one.
+func (c *Catalog) Assign(a Assignment) error {
+	if a.TenantID == "" {
+		return fmt.Errorf("tenant id is empty")
+	}
+	if _, ok := c.Plan(a.PlanID); !ok {
+		return fmt.Errorf("plan %q not found", a.PlanID)
+	}
+	a.EffectiveFrom = a.EffectiveFrom.UTC()
+	list := c.assignments[a.TenantID]
+	for i, existing := range list {
+		if existing.EffectiveFrom.Equal(a.EffectiveFrom) {
+			list[i] = a
+			c.assignments[a.TenantID] = list
+			return nil
+		}
+	}
+	list = append(list, a)
+	sort.Slice(list, func(i, j int) bool { return list[i].EffectiveFrom.Before(list[j].EffectiveFrom) })
+	c.assignments[a.TenantID] = list
+	return nil
+}
+
+func (c *Catalog) Assignments(tenantID string) []Assignment {
+	return append([]Assignment(nil), c.assignments[tenantID]...)
+}
+
+// PlanAt returns the plan in effect for a tenant at the given instant.
+func (c *Catalog) PlanAt(tenantID string, at time.Time) PricePlan {
+	planID := DefaultPlanID
+	for _, a := range c.assignments[tenantID] {
+		if a.EffectiveFrom.After(at) {
+			break
+		}
+		planID = a.PlanID
+	}
+	if p, ok := c.Plan(planID); ok {
+		return p
+	}
+	return c.Default.Plan()
+}
+
+// Invoice rates usage in [start, end) for a tenant into a draft invoice. The
+// period is split at each plan change so usage is priced by the plan in effect
+// when it occurred. Tier positions are tracked per price scope across the whole
+// period, and the minimum commitment of the plan in effect at period end is
+// topped up if usage charges fall short. Every plan in the period must share
+// one currency, which becomes the invoice currency; rounding follows the plan
+// in effect at period end.
+func (c *Catalog) Invoice(tenantID string, start time.Time, end time.Time, usage []UsageRecord) (Invoice, error) {
+	start, end = start.UTC(), end.UTC()
+	bounds := []time.Time{start}
+	for _, a := range c.assignments[tenantID] {
+		if a.EffectiveFrom.After(start) && a.EffectiveFrom.Before(end) {
+			bounds = append(bounds, a.EffectiveFrom)
+		}
+	}
+	bounds = append(bounds, end)
+
+	segments := make([]segment, 0, len(bounds)-1)
+	for i := 0; i < len(bounds)-1; i++ {
+		p := c.PlanAt(tenantID, bounds[i])
+		if n := len(segments); n > 0 && segments[n-1].plan.ID == p.ID {
+			segments[n-1].to = bounds[i+1]
+			continue
+		}
+		segments = append(segments, segment{plan: p, from: bounds[i], to: bounds[i+1]})
+	}
+	closing := segments[len(segments)-1]
+	for _, seg := range segments {
+		if seg.plan.Currency != closing.plan.Currency {
+			return Invoice{}, fmt.Errorf("%w: tenant %q is billed in %s and %s within one period", ErrCurrencyMismatch, tenantID, seg.plan.Currency, closing.plan.Currency)
+		}
+	}
+
+	type usageKey struct {
+		meter Meter
+		model string
+	}
+	bySegment := make([]map[usageKey]int64, len(segments))
+	for i := range bySegment {
+		bySegment[i] = make(map[usageKey]int64)
+	}
+	inv := Invoice{
+		TenantID:    tenantID,
+		Status:      StatusDraft,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Currency:    closing.plan.Currency,
+		Rounding:    closing.plan.Rounding,
+	}
+	for _, u := range usage {
+		at := u.OccurredAt.UTC()
+		if at.Before(start) || !at.Before(end) {
+			continue
+		}
+		idx := len(segments) - 1
+		for i := range segments {
+			if at.Before(segments[i].to) {
+				idx = i
+				break
+			}
+		}
+		for _, m := range Meters {
+			if q := u.Quantity(m); q != 0 {
+				bySegment[idx][usageKey{m, u.Model}] += q
+			}
+		}
+		inv.Invocations += u.Invocations
+		inv.InputTokens += u.InputTokens
+		inv.OutputTokens += u.OutputTokens
+	}
+
+	// Resolve each segment's quantities to a price scope first so volume tiers
+	// see the scope's whole-period total, then rate in temporal order.
+	type ratedKey struct {
+		key   usageKey
+		price MeterPrice
+		ok    bool
+	}
+	resolved := make([][]ratedKey, len(segments))
+	scopeTotals := make(map[usageKey]int64)
+	for i := range segments {
+		keys := make([]usageKey, 0, len(bySegment[i]))
+		for k := range bySegment[i] {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(a, b int) bool {
+			if keys[a].meter != keys[b].meter {
+				return meterIndex(keys[a].meter) < meterIndex(keys[b].meter)
+			}
+			return keys[a].model < keys[b].model
+		})
+		for _, k := range keys {
+			mp, ok := segments[i].plan.priceFor(k.meter, k.model)
+			if ok {
+				scopeTotals[usageKey{mp.Meter, mp.Model}] += bySegment[i][k]
+			}
+			resolved[i] = append(resolved[i], ratedKey{key: k, price: mp, ok: ok})
+		}
+	}
+
+	consumed := make(map[usageKey]int64)
+	places := inv.Currency.MinorUnits()
+	var usageTotal Amount
+	for i, seg := range segments {
+		for _, rk := range resolved[i] {
+			q := bySegment[i][rk.key]
+			base := LineItem{
+				Kind:   LineUsage,
+				PlanID: seg.plan.ID,
+				Meter:  rk.key.meter,
+				Model:  rk.key.model,
+				From:   seg.from,
+				To:     seg.to,
+			}
+			if !rk.ok {
+				line := base
+				line.Quantity = q
+				line.Description = lineDescription(line)
+				inv.Lines = append(inv.Lines, line)
+				continue
+			}
+			scope := usageKey{rk.price.Meter, rk.price.Model}
+			for _, ch := range rk.price.charges(consumed[scope], q, scopeTotals[scope]) {
+				line := base
+				line.Tier = ch.tier
+				line.Quantity = ch.quantity
+				line.PerThousand = ch.perThousand
+				line.Amount = ch.amount
+				if inv.Rounding == RoundPerLine {
+					line.Amount = line.Amount.Round(places)
+				}
+				line.Description = lineDescription(line)
+				inv.Lines = append(inv.Lines, line)
+				usageTotal += line.Amount
+			}
+			consumed[scope] += q
+		}
+	}
+
+	if usageTotal < closing.plan.MinimumMonthly {
+		inv.Lines = append(inv.Lines, LineItem{
+			Kind:        LineMinimumCommitment,
+			Description: fmt.Sprintf("Minimum commitment top-up (%s)", closing.plan.ID),
+			PlanID:      closing.plan.ID,
+			From:        start,
+			To:          end,
+			Amount:      closing.plan.MinimumMonthly - usageTotal,
+		})
+	}
+	inv.Recalculate()
+	return inv, nil
+}
+
+func lineDescription(l LineItem) string {
+	desc := string(l.Meter)
+	if l.Model != "" {
+		desc += " (" + l.Model + ")"
+	}
+	if l.Tier > 0 {
+		desc += fmt.Sprintf(" tier %d", l.Tier)
+	}
+	return desc + " - " + l.PlanID
+}
+
+func meterIndex(m Meter) int {
+	for i, known := range Meters {
+		if known == m {
+			return i
+		}
+	}
+	return len(Meters)
+}
+
+// CatalogState is a Catalog in serializable form, used to share billing
+// configuration between control-plane replicas.
+type CatalogState struct {
+	Default     RateCard                `json:"default"`
+	Plans       []PricePlan             `json:"plans,omitempty"`
+	Assignments map[string][]Assignment `json:"assignments,omitempty"`
+}
+
+func (c *Catalog) State() CatalogState {
+	st := CatalogState{Default: c.Default, Assignments: make(map[string][]Assignment, len(c.assignments))}
+	for _, p := range c.plans {
+		st.Plans = append(st.Plans, p)
+	}
+	sort.Slice(st.Plans, func(i, j int) bool { return st.Plans[i].ID < st.Plans[j].ID })
+	for tenantID, list := range c.assignments {
+		st.Assignments[tenantID] = append([]Assignment(nil), list...)
+	}
+	return st
+}
+
+// Restore replaces the catalog's contents with st.
+func (c *Catalog) Restore(st CatalogState) {
+	c.Default = st.Default
+	c.plans = make(map[string]PricePlan, len(st.Plans))
+	for _, p := range st.Plans {
+		c.plans[p.ID] = p
+	}
+	c.assignments = make(map[string][]Assignment, len(st.Assignments))
+	for tenantID, list := range st.Assignments {
+		c.assignments[tenantID] = append([]Assignment(nil), list...)
+	}
+}
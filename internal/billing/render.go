@@ -0,0 +1,138 @@
+package billing
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenderFormat selects an invoice rendering.
+type RenderFormat string
+
+const (
+	FormatJSON RenderFormat = "json"
+	FormatCSV  RenderFormat = "csv"
+	FormatHTML RenderFormat = "html"
+)
+
+// ParseRenderFormat validates a format name; empty means JSON.
+func ParseRenderFormat(raw string) (RenderFormat, error) {
+	switch f := RenderFormat(strings.ToLower(strings.TrimSpace(raw))); f {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCSV, FormatHTML:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported invoice format %q", raw)
+	}
+}
+
+// ContentType returns the HTTP content type for the format.
+func (f RenderFormat) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Render writes the invoice document in the requested format.
+func Render(w io.Writer, inv Invoice, format RenderFormat) error {
+	switch format {
+	case FormatCSV:
+		return renderCSV(w, inv)
+	case FormatHTML:
+		return invoiceHTML.Execute(w, inv)
+	default:
+		return json.NewEncoder(w).Encode(inv)
+	}
+}
+
+func renderCSV(out io.Writer, inv Invoice) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"invoice_id", "tenant_id", "status", "currency", "kind", "description", "plan_id", "meter", "model", "tier", "from", "to", "quantity", "per_thousand", "amount"}); err != nil {
+		return err
+	}
+	row := func(kind string, desc string, l LineItem, amount string) []string {
+		tier := ""
+		if l.Tier > 0 {
+			tier = strconv.Itoa(l.Tier)
+		}
+		return []string{
+			inv.ID, inv.TenantID, string(inv.Status), string(inv.Currency), kind, desc, l.PlanID, string(l.Meter), l.Model, tier,
+			formatTime(l.From), formatTime(l.To), strconv.FormatInt(l.Quantity, 10),
+			l.PerThousand.String(), amount,
+		}
+	}
+	for _, l := range inv.Lines {
+		if err := w.Write(row(string(l.Kind), l.Description, l, inv.lineAmount(l.Amount))); err != nil {
+			return err
+		}
+	}
+	period := LineItem{From: inv.PeriodStart, To: inv.PeriodEnd}
+	for _, total := range []struct {
+		kind   string
+		amount Amount
+	}{{"subtotal", inv.Subtotal.Amount}, {"credits", -inv.Credits.Amount}, {"tax", inv.Tax.Amount}, {"total", inv.Total.Amount}} {
+		r := row(total.kind, "", period, inv.totalAmount(total.amount))
+		r[12], r[13] = "", ""
+		if err := w.Write(r); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// lineAmount formats a line at billed precision: minor units when lines are
+// rounded, full precision otherwise.
+func (inv Invoice) lineAmount(a Amount) string {
+	if inv.Rounding == RoundPerInvoice {
+		return a.String()
+	}
+	return a.StringFixed(inv.Currency.MinorUnits())
+}
+
+func (inv Invoice) totalAmount(a Amount) string {
+	return a.StringFixed(inv.Currency.MinorUnits())
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+var invoiceHTML = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"line":  func(inv Invoice, a Amount) string { return inv.lineAmount(a) },
+	"total": func(inv Invoice, a Amount) string { return inv.totalAmount(a) },
+	"neg":   func(v Amount) Amount { return -v },
+	"date":  func(t time.Time) string { return formatTime(t) },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Invoice {{.ID}}</title></head>
+<body>
+<h1>Invoice {{if .ID}}{{.ID}}{{else}}(preview){{end}}</h1>
+<p>Tenant: {{.TenantID}}<br>Status: {{.Status}}<br>Period: {{date .PeriodStart}} &ndash; {{date .PeriodEnd}}</p>
+<table>
+<thead><tr><th>Description</th><th>Quantity</th><th>{{.Currency}} / 1000</th><th>Amount ({{.Currency}})</th></tr></thead>
+<tbody>
+{{$inv := .}}{{range .Lines}}<tr><td>{{.Description}}</td><td>{{.Quantity}}</td><td>{{.PerThousand}}</td><td>{{line $inv .Amount}}</td></tr>
+{{end}}</tbody>
+<tfoot>
+<tr><td colspan="3">Subtotal</td><td>{{total . .Subtotal.Amount}}</td></tr>
+<tr><td colspan="3">Credits</td><td>{{total . (neg .Credits.Amount)}}</td></tr>
+{{range .Taxes}}<tr><td colspan="3">{{.Description}}</td><td>{{line $inv .Amount}}</td></tr>
+{{end}}<tr><td colspan="3"><strong>Total</strong></td><td><strong>{{total . .Total.Amount}}</strong></td></tr>
+</tfoot>
+</table>
+</body></html>
+`))
@@ -2,27 +2,35 @@ package billing
 
 import "fmt"
 
-// RateCard defines pricing in USD per 1000 invocations.
+// RateCard defines the default price per 1000 invocations.
 type RateCard struct {
-	USDPerThousand float64
+	PerThousand Money
 }
 
-// Invoice contains basic usage-based billing information.
-type Invoice struct {
-	TenantID       string  `json:"tenant_id"`
-	Invocations    int64   `json:"invocations"`
-	USDPerThousand float64 `json:"usd_per_thousand"`
-	AmountUSD      float64 `json:"amount_usd"`
-}
-
-func NewRateCard(usdPerThousand float64) (RateCard, error) {
-	if usdPerThousand < 0 {
+func NewRateCard(perThousand Money) (RateCard, error) {
+	if perThousand.Amount < 0 {
 		return RateCard{}, fmt.Errorf("negative price is invalid")
 	}
-	return RateCard{USDPerThousand: usdPerThousand}, nil
+	currency, err := ParseCurrency(string(perThousand.Currency))
+	if err != nil {
+		return RateCard{}, err
+	}
+	perThousand.Currency = currency
+	return RateCard{PerThousand: perThousand}, nil
 }
 
+// Invoice prices an all-time invocation count as a single-line draft.
 func (r RateCard) Invoice(tenantID string, invocations int64) Invoice {
-	amount := (float64(invocations) / 1000.0) * r.USDPerThousand
-	return Invoice{TenantID: tenantID, Invocations: invocations, USDPerThousand: r.USDPerThousand, AmountUSD: amount}
+	inv := Invoice{TenantID: tenantID, Status: StatusDraft, Currency: r.PerThousand.Currency, Rounding: RoundPerLine, Invocations: invocations}
+	inv.Lines = []LineItem{{
+		Kind:        LineUsage,
+		Description: "invocations - " + DefaultPlanID,
+		PlanID:      DefaultPlanID,
+		Meter:       MeterInvocations,
+		Quantity:    invocations,
+		PerThousand: r.PerThousand.Amount,
+		Amount:      perThousand(invocations, r.PerThousand.Amount),
+	}}
+	inv.Recalculate()
+	return inv
 }
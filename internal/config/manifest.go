@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/your-org/fluxroute/internal/redact"
 	"github.com/your-org/fluxroute/internal/security"
 	"github.com/your-org/fluxroute/internal/tenant"
 	"gopkg.in/yaml.v3"
@@ -21,6 +22,9 @@ type Manifest struct {
 	Router   RouterSettings `yaml:"router"`
 	Agents   []AgentBinding `yaml:"agents"`
 	Pipeline []PipelineStep `yaml:"pipeline"`
+	// Redaction scrubs the namespace's traces, audit events, logs and
+	// exports before they are written.
+	Redaction redact.Config `yaml:"redaction,omitempty"`
 }
 
 // RouterSettings configures the runtime engine.
@@ -42,9 +46,24 @@ type RBAC struct {
 
 // AgentBinding declares an agent registration entry.
 type AgentBinding struct {
-	ID             string               `yaml:"id"`
+	ID string `yaml:"id"`
+	// Provider backs the agent with an LLM adapter (openai, anthropic or
+	// gemini) instead of the built-in deterministic stub; Model overrides
+	// the provider's default model.
+	Provider       string               `yaml:"provider,omitempty"`
+	Model          string               `yaml:"model,omitempty"`
 	Retry          RetryConfig          `yaml:"retry"`
 	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// Versions registers alternative implementations next to the default
+	// v1, for what-if replays to swap in.
+	Versions map[string]AgentVersion `yaml:"versions,omitempty"`
+}
+
+// AgentVersion declares one alternative version of an agent. Without a
+// Provider it is a deterministic stub tagged with the version.
+type AgentVersion struct {
+	Provider string `yaml:"provider,omitempty"`
+	Model    string `yaml:"model,omitempty"`
 }
 
 // RetryConfig declares retry options for one agent.
@@ -111,6 +130,10 @@ func ValidateManifest(m Manifest) error {
 		}
 	}
 
+	if err := m.Redaction.Validate(); err != nil {
+		return fmt.Errorf("manifest: redaction: %w", err)
+	}
+
 	agents := make(map[string]struct{}, len(m.Agents))
 	for _, a := range m.Agents {
 		if a.ID == "" {
@@ -121,6 +144,17 @@ func ValidateManifest(m Manifest) error {
 		}
 		agents[a.ID] = struct{}{}
 
+		if a.Provider != "" && !KnownProvider(a.Provider) {
+			return fmt.Errorf("manifest: agent %q has unknown provider %q (want openai|anthropic|gemini)", a.ID, a.Provider)
+		}
+		for version, v := range a.Versions {
+			if version == "" || version == "v1" {
+				return fmt.Errorf("manifest: agent %q version %q is reserved (v1 is the agent itself)", a.ID, version)
+			}
+			if v.Provider != "" && !KnownProvider(v.Provider) {
+				return fmt.Errorf("manifest: agent %q version %q has unknown provider %q (want openai|anthropic|gemini)", a.ID, version, v.Provider)
+			}
+		}
 		if a.CircuitBreaker.FailureThreshold < 0 {
 			return fmt.Errorf("manifest: agent %q has negative circuit_breaker.failure_threshold", a.ID)
 		}
@@ -168,6 +202,15 @@ func ValidateManifest(m Manifest) error {
 	return nil
 }
 
+// KnownProvider reports whether name is a supported agent provider.
+func KnownProvider(name string) bool {
+	switch name {
+	case "openai", "anthropic", "gemini":
+		return true
+	}
+	return false
+}
+
 // OrderedPipeline returns topological order of pipeline steps.
 func OrderedPipeline(m Manifest) ([]PipelineStep, error) {
 	stepIndex := make(map[string]int, len(m.Pipeline))
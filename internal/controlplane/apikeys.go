@@ -0,0 +1,473 @@
+package controlplane
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/security"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyExpired  = errors.New("api key expired")
+	ErrAPIKeyRevoked  = errors.New("api key revoked")
+)
+
+// Scope grants access to a group of control-plane operations.
+type Scope string
+
+const (
+	// ScopeUsageRead reads usage, quotas, invoices and webhook logs.
+	ScopeUsageRead Scope = "usage:read"
+	// ScopeUsageWrite reports usage; routers hold this scope.
+	ScopeUsageWrite Scope = "usage:write"
+	// ScopeBillingAdmin manages rates, plans, quotas and invoices. Like
+	// ScopeAdmin it is only granted to keys not bound to a tenant.
+	ScopeBillingAdmin Scope = "billing:admin"
+	// ScopeAdmin grants every scope plus tenant and key management. Only
+	// keys not bound to a tenant may hold it.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopes = []Scope{ScopeUsageRead, ScopeUsageWrite, ScopeBillingAdmin, ScopeAdmin}
+
+func parseScopes(raw []string) ([]Scope, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	seen := make(map[Scope]struct{}, len(raw))
+	out := make([]Scope, 0, len(raw))
+	for _, r := range raw {
+		sc := Scope(strings.ToLower(strings.TrimSpace(r)))
+		known := false
+		for _, k := range scopes {
+			if sc == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown scope %q", r)
+		}
+		if _, dup := seen[sc]; dup {
+			continue
+		}
+		seen[sc] = struct{}{}
+		out = append(out, sc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+// roleForScopes derives the RBAC role a key acts as.
+func roleForScopes(scs []Scope) security.Role {
+	role := security.RoleViewer
+	for _, sc := range scs {
+		switch sc {
+		case ScopeAdmin:
+			return security.RoleAdmin
+		case ScopeBillingAdmin, ScopeUsageWrite:
+			role = security.RoleOperator
+		}
+	}
+	return role
+}
+
+// APIKey is an issued credential. Only the SHA-256 hash of the token is
+// kept; the token itself is returned once, when the key is issued.
+type APIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name,omitempty"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	Scopes      []Scope    `json:"scopes"`
+	Role        string     `json:"role"`
+	Prefix      string     `json:"prefix"`
+	Hash        string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RotatedFrom string     `json:"rotated_from,omitempty"`
+	ReplacedBy  string     `json:"replaced_by,omitempty"`
+}
+
+func (k APIKey) clone() APIKey {
+	k.Scopes = append([]Scope{}, k.Scopes...)
+	return k
+}
+
+func (k APIKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// IssueKeyInput describes a new key. A zero ExpiresAt never expires.
+type IssueKeyInput struct {
+	Name      string
+	TenantID  string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// IssueKey creates a key and returns it with its one-time token.
+func (s *Service) IssueKey(in IssueKeyInput) (APIKey, string, error) {
+	scs, err := parseScopes(in.Scopes)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	in.TenantID = strings.TrimSpace(in.TenantID)
+	if in.TenantID != "" {
+		// Rates, plans and invoices are shared across tenants, so tenant
+		// keys are limited to the usage scopes.
+		for _, sc := range scs {
+			if sc == ScopeAdmin || sc == ScopeBillingAdmin {
+				return APIKey{}, "", fmt.Errorf("tenant keys cannot hold the %s scope", sc)
+			}
+		}
+	}
+	now := time.Now().UTC()
+	if !in.ExpiresAt.IsZero() && !in.ExpiresAt.After(now) {
+		return APIKey{}, "", fmt.Errorf("expires_at must be in the future")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in.TenantID != "" {
+		if _, ok := s.tenants[in.TenantID]; !ok {
+			return APIKey{}, "", fmt.Errorf("%w: %q", ErrTenantNotFound, in.TenantID)
+		}
+	}
+	key := APIKey{Name: strings.TrimSpace(in.Name), TenantID: in.TenantID, Scopes: scs, Role: roleForScopes(scs).String(), CreatedAt: now}
+	if !in.ExpiresAt.IsZero() {
+		exp := in.ExpiresAt.UTC()
+		key.ExpiresAt = &exp
+	}
+	token, err := s.storeKeyLocked(&key)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return key.clone(), token, nil
+}
+
+// storeKeyLocked assigns an unused id and a token to key and stores its hash.
+func (s *Service) storeKeyLocked(key *APIKey) (string, error) {
+	idBytes := make([]byte, 6)
+	secret := make([]byte, 24)
+	for {
+		if _, err := rand.Read(idBytes); err != nil {
+			return "", fmt.Errorf("generate api key: %w", err)
+		}
+		if _, taken := s.apiKeys["key_"+hex.EncodeToString(idBytes)]; !taken {
+			break
+		}
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate api key: %w", err)
+	}
+	key.ID = "key_" + hex.EncodeToString(idBytes)
+	token := "frk_" + hex.EncodeToString(idBytes) + "_" + hex.EncodeToString(secret)
+	key.Prefix = token[:len("frk_")+len(idBytes)*2]
+	key.Hash = hashToken(token)
+	s.apiKeys[key.ID] = key
+	s.changes.touch(recordAPIKey, key.ID)
+	return token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListKeys returns keys, optionally for one tenant, oldest first.
+func (s *Service) ListKeys(tenantID string) []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]APIKey, 0, len(s.apiKeys))
+	for _, k := range s.apiKeys {
+		if tenantID != "" && k.TenantID != tenantID {
+			continue
+		}
+		out = append(out, k.clone())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (s *Service) GetKey(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return APIKey{}, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return k.clone(), nil
+}
+
+// RevokeKey disables a key immediately. Revoking twice is a no-op.
+func (s *Service) RevokeKey(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return APIKey{}, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	if k.RevokedAt == nil {
+		now := time.Now().UTC()
+		k.RevokedAt = &now
+		s.changes.touch(recordAPIKey, id)
+	}
+	return k.clone(), nil
+}
+
+// RotateKey issues a replacement with the same name, tenant, scopes and
+// lifetime. The old key keeps working for grace, then expires; a zero grace
+// revokes it at once.
+func (s *Service) RotateKey(id string, grace time.Duration) (APIKey, string, error) {
+	if grace < 0 {
+		return APIKey{}, "", fmt.Errorf("grace period must be >= 0")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.apiKeys[id]
+	if !ok {
+		return APIKey{}, "", fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	now := time.Now().UTC()
+	if !old.active(now) {
+		return APIKey{}, "", fmt.Errorf("cannot rotate inactive key %s", id)
+	}
+	next := APIKey{Name: old.Name, TenantID: old.TenantID, Scopes: append([]Scope{}, old.Scopes...), Role: old.Role, CreatedAt: now, RotatedFrom: old.ID}
+	if old.ExpiresAt != nil {
+		exp := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		next.ExpiresAt = &exp
+	}
+	token, err := s.storeKeyLocked(&next)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	old.ReplacedBy = next.ID
+	if grace == 0 {
+		old.RevokedAt = &now
+	} else if cutoff := now.Add(grace); old.ExpiresAt == nil || cutoff.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &cutoff
+	}
+	s.changes.touch(recordAPIKey, old.ID)
+	return next.clone(), token, nil
+}
+
+// authenticateKey resolves a token to its key and records its use.
+func (s *Service) authenticateKey(token string) (APIKey, error) {
+	rest, ok := strings.CutPrefix(token, "frk_")
+	if !ok {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	idPart, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.apiKeys["key_"+idPart]
+	if !ok || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashToken(token))) != 1 {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	now := time.Now().UTC()
+	if k.RevokedAt != nil {
+		return APIKey{}, ErrAPIKeyRevoked
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return APIKey{}, ErrAPIKeyExpired
+	}
+	k.LastUsedAt = &now
+	s.changes.touch(recordAPIKey, k.ID)
+	return k.clone(), nil
+}
+
+// hasKeys reports whether any key was ever issued. From then on requests
+// must authenticate with a key even if CONTROLPLANE_API_KEY is unset.
+func (s *Service) hasKeys() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.apiKeys) > 0
+}
+
+func (s *Service) registerKeyRoutes(a *api) {
+	a.register("/keys", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeAdmin) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			page, pageSize := parsePagination(q.Get("page"), q.Get("page_size"))
+			items := s.ListKeys(strings.TrimSpace(q.Get("tenant_id")))
+			total := len(items)
+			items = paginateKeys(items, page, pageSize)
+			writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": pageSize})
+		case http.MethodPost:
+			var req struct {
+				Name      string   `json:"name"`
+				TenantID  string   `json:"tenant_id"`
+				Scopes    []string `json:"scopes"`
+				ExpiresAt string   `json:"expires_at"`
+				TTL       string   `json:"ttl"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			in := IssueKeyInput{Name: req.Name, TenantID: req.TenantID, Scopes: req.Scopes}
+			switch {
+			case strings.TrimSpace(req.ExpiresAt) != "":
+				exp, err := parseEffectiveFrom(req.ExpiresAt)
+				if err != nil {
+					http.Error(w, "invalid expires_at: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				in.ExpiresAt = exp
+			case strings.TrimSpace(req.TTL) != "":
+				ttl, err := time.ParseDuration(strings.TrimSpace(req.TTL))
+				if err != nil || ttl <= 0 {
+					http.Error(w, fmt.Sprintf("invalid ttl %q", req.TTL), http.StatusBadRequest)
+					return
+				}
+				in.ExpiresAt = time.Now().Add(ttl)
+			}
+			auditFrom(r).target("keys", strings.TrimSpace(req.TenantID))
+			key, token, err := s.IssueKey(in)
+			if err != nil {
+				http.Error(w, err.Error(), keyErrorStatus(err))
+				return
+			}
+			auditFrom(r).target("keys/"+key.ID, key.TenantID)
+			auditFrom(r).change(nil, key)
+			writeIssuedKey(w, key, token)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	a.register("/keys/self", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, map[string]any{"key_id": p.keyID, "tenant_id": p.tenantID, "scopes": p.scopes, "role": p.role})
+	})
+	a.register("/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeAdmin) {
+			return
+		}
+		var key APIKey
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			key, err = s.GetKey(r.PathValue("id"))
+		case http.MethodDelete:
+			before, _ := s.GetKey(r.PathValue("id"))
+			auditFrom(r).target("keys/"+r.PathValue("id"), before.TenantID)
+			if key, err = s.RevokeKey(r.PathValue("id")); err == nil {
+				auditFrom(r).change(before, key)
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), keyErrorStatus(err))
+			return
+		}
+		writeJSON(w, key)
+	})
+	a.register("/keys/{id}/rotate", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeAdmin) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			GracePeriod string `json:"grace_period"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var grace time.Duration
+		if raw := strings.TrimSpace(req.GracePeriod); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid grace_period %q", raw), http.StatusBadRequest)
+				return
+			}
+			grace = d
+		}
+		before, _ := s.GetKey(r.PathValue("id"))
+		auditFrom(r).target("keys/"+r.PathValue("id"), before.TenantID)
+		key, token, err := s.RotateKey(r.PathValue("id"), grace)
+		if err != nil {
+			http.Error(w, err.Error(), keyErrorStatus(err))
+			return
+		}
+		after, _ := s.GetKey(r.PathValue("id"))
+		auditFrom(r).change(before, map[string]any{"replaced": after, "replacement": key})
+		writeIssuedKey(w, key, token)
+	})
+}
+
+// writeIssuedKey is the only response that carries a key's token.
+func writeIssuedKey(w http.ResponseWriter, key APIKey, token string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(struct {
+		APIKey
+		Token string `json:"token"`
+	}{APIKey: key, Token: token})
+}
+
+func keyErrorStatus(err error) int {
+	if errors.Is(err, ErrAPIKeyNotFound) || errors.Is(err, ErrTenantNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func paginateKeys(in []APIKey, page int, pageSize int) []APIKey {
+	start := (page - 1) * pageSize
+	if start >= len(in) {
+		return []APIKey{}
+	}
+	end := start + pageSize
+	if end > len(in) {
+		end = len(in)
+	}
+	return in[start:end]
+}
@@ -0,0 +1,287 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/redact"
+	"gopkg.in/yaml.v3"
+)
+
+// Audit outcomes recorded in audit.Event.Status.
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"
+	AuditError   = "error"
+)
+
+// auditActions names mutating routes, keyed by method and route pattern
+// without the /v1 prefix. Unlisted routes fall back to "METHOD pattern".
+var auditActions = map[string]string{
+	"POST /tenants":                            "tenant.create",
+	"PATCH /tenants/{tenant_id}":               "tenant.update",
+	"POST /usage":                              "usage.record",
+	"POST /billing/rates":                      "rate.update",
+	"POST /billing/plans":                      "plan.upsert",
+	"POST /billing/plans/assignments":          "plan.assign",
+	"POST /billing/invoices":                   "invoice.create",
+	"POST /billing/invoices/{id}/finalize":     "invoice.finalize",
+	"POST /billing/invoices/{id}/void":         "invoice.void",
+	"PUT /quotas/{tenant_id}":                  "quota.set",
+	"DELETE /quotas/{tenant_id}":               "quota.delete",
+	"PUT /credits/{tenant_id}":                 "credit.configure",
+	"POST /credits/{tenant_id}/grants":         "credit.grant",
+	"POST /webhooks":                           "webhook.subscribe",
+	"DELETE /webhooks/{id}":                    "webhook.unsubscribe",
+	"POST /webhooks/deliveries/{id}/redeliver": "webhook.redeliver",
+	"POST /keys":                               "key.issue",
+	"DELETE /keys/{id}":                        "key.revoke",
+	"POST /keys/{id}/rotate":                   "key.rotate",
+	"POST /sla/runs":                           "run.report",
+}
+
+// Audit exposes the control plane's audit trail.
+func (s *Service) Audit() *audit.Trail {
+	return s.audit
+}
+
+// SetRedactor makes the audit trail redact events before they are stored,
+// served, shared with other replicas or logged.
+func (s *Service) SetRedactor(r audit.Redactor) {
+	s.audit.SetRedactor(r)
+}
+
+// RedactorFromEnv builds the audit redactor from the redaction: block of
+// the YAML file named by CONTROLPLANE_REDACTION_CONFIG, which may be a
+// manifest. It returns nil when the variable is unset or the block redacts
+// nothing.
+func RedactorFromEnv() (*redact.Redactor, error) {
+	path := strings.TrimSpace(os.Getenv("CONTROLPLANE_REDACTION_CONFIG"))
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read redaction config: %w", err)
+	}
+	var doc struct {
+		Redaction redact.Config `yaml:"redaction"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parse redaction config %q: %w", path, err)
+	}
+	return redact.FromConfig(doc.Redaction)
+}
+
+// auditRecord collects what a handler learns about a mutation while it
+// runs; the audited middleware turns it into an event afterwards.
+type auditRecord struct {
+	actor    string
+	role     string
+	tenantID string
+	resource string
+	before   any
+	after    any
+}
+
+type auditKey struct{}
+
+// auditFrom returns the request's record, or a throwaway one for requests
+// that are not audited, so handlers can always call its setters.
+func auditFrom(r *http.Request) *auditRecord {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		return rec
+	}
+	return &auditRecord{}
+}
+
+// target sets the affected resource and, when known, its tenant.
+func (rec *auditRecord) target(resource string, tenantID string) {
+	rec.resource = resource
+	if tenantID != "" {
+		rec.tenantID = tenantID
+	}
+}
+
+// change records the resource's state before and after the mutation.
+func (rec *auditRecord) change(before any, after any) {
+	rec.before, rec.after = before, after
+}
+
+// auditWriter captures the response status and the start of error bodies.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && len(w.body) < 512 {
+		w.body = append(w.body, b[:min(len(b), 512-len(w.body))]...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// audited records an event for every request that may mutate state,
+// including ones refused by auth. Reads pass through untouched.
+func (a *api) audited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h(w, r)
+			return
+		}
+		requestID := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		rec := &auditRecord{}
+		aw := &auditWriter{ResponseWriter: w}
+		h(aw, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)))
+
+		pattern := r.Method + " " + strings.TrimPrefix(strings.TrimPrefix(r.Pattern, r.Method+" "), "/v1")
+		action, ok := auditActions[pattern]
+		if !ok {
+			action = pattern
+		}
+		ev := audit.Event{
+			Actor:     rec.actor,
+			Role:      rec.role,
+			Action:    action,
+			Resource:  rec.resource,
+			TenantID:  rec.tenantID,
+			SourceIP:  a.sourceIP(r),
+			RequestID: requestID,
+			Status:    AuditSuccess,
+			Before:    auditJSON(rec.before),
+			After:     auditJSON(rec.after),
+		}
+		if ev.Actor == "" {
+			ev.Actor = "unauthenticated"
+		}
+		if ev.Resource == "" {
+			ev.Resource = strings.TrimPrefix(r.URL.Path, "/v1")
+		}
+		if status := aw.status; status >= http.StatusBadRequest {
+			ev.Status = AuditError
+			if status == http.StatusUnauthorized || status == http.StatusForbidden {
+				ev.Status = AuditDenied
+			}
+			ev.Error = strings.TrimSpace(string(aw.body))
+			if ev.Error == "" {
+				ev.Error = http.StatusText(status)
+			}
+		}
+		if _, err := a.svc.audit.Append(ev); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: audit %s: %v\n", action, err)
+		}
+	}
+}
+
+// sourceIP is the peer address, or the first X-Forwarded-For hop when
+// CONTROLPLANE_TRUST_PROXY is set because a proxy fronts the control plane.
+func (a *api) sourceIP(r *http.Request) string {
+	if a.trustProxy {
+		if fwd := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0]); fwd != "" {
+			return fwd
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("req_%d", time.Now().UnixNano())
+	}
+	return "req_" + hex.EncodeToString(b)
+}
+
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+	return b
+}
+
+func (s *Service) registerAuditRoutes(a *api) {
+	a.register("/audit", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeAdmin) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		f := audit.Filter{
+			Actor:     strings.TrimSpace(q.Get("actor")),
+			Action:    strings.TrimSpace(q.Get("action")),
+			Resource:  strings.TrimSpace(q.Get("resource")),
+			TenantID:  strings.TrimSpace(q.Get("tenant_id")),
+			Status:    strings.TrimSpace(q.Get("status")),
+			RequestID: strings.TrimSpace(q.Get("request_id")),
+		}
+		var err error
+		if raw := strings.TrimSpace(q.Get("from")); raw != "" {
+			if f.From, err = parseEffectiveFrom(raw); err != nil {
+				http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if raw := strings.TrimSpace(q.Get("to")); raw != "" {
+			if f.To, err = parseEffectiveFrom(raw); err != nil {
+				http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		page, pageSize := parsePagination(q.Get("page"), q.Get("page_size"))
+		items := s.audit.Query(f)
+		total := len(items)
+		items = paginateAuditEvents(items, page, pageSize)
+		writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": pageSize})
+	})
+}
+
+func paginateAuditEvents(in []audit.Event, page int, pageSize int) []audit.Event {
+	start := (page - 1) * pageSize
+	if start >= len(in) {
+		return []audit.Event{}
+	}
+	end := start + pageSize
+	if end > len(in) {
+		end = len(in)
+	}
+	return in[start:end]
+}
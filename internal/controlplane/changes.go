@@ -0,0 +1,227 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/quota"
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+type recordKind uint8
+
+const (
+	recordTenant recordKind = iota
+	recordAPIKey
+	recordInvoice
+	recordQuota
+	recordCharged
+)
+
+type recordRef struct {
+	kind recordKind
+	id   string
+}
+
+// changeSet tracks what writes changed since the last commit, so an HA
+// leader ships only those records to the shared log. Methods on a nil
+// changeSet do nothing.
+type changeSet struct {
+	records map[recordRef]struct{}
+	catalog bool
+	// usage is how many usage events were already shipped; auditSeq is the
+	// audit trail sequence they reached.
+	usage    int
+	auditSeq int64
+	// compact is the latest cutoff hourly rollups were compacted to.
+	compact int64
+	runs    []RunOutcomeInput
+}
+
+func (c *changeSet) touch(kind recordKind, id string) {
+	if c != nil {
+		c.records[recordRef{kind: kind, id: id}] = struct{}{}
+	}
+}
+
+func (c *changeSet) touchCatalog() {
+	if c != nil {
+		c.catalog = true
+	}
+}
+
+func (c *changeSet) compacted(cutoff int64) {
+	if c != nil {
+		c.compact = max(c.compact, cutoff)
+	}
+}
+
+func (c *changeSet) ran(in RunOutcomeInput) {
+	if c != nil {
+		c.runs = append(c.runs, in)
+	}
+}
+
+// resetChangesLocked forgets tracked changes after the state was replaced.
+func (s *Service) resetChangesLocked() {
+	if s.changes == nil {
+		return
+	}
+	*s.changes = changeSet{
+		records:  make(map[recordRef]struct{}),
+		usage:    len(s.usageEvent),
+		auditSeq: s.audit.Seq(),
+	}
+}
+
+// stateChange is one entry of the shared HA log: the records a write or job
+// pass changed, which followers apply on top of the state they hold. Leader
+// is set on the entry a replica appends when it takes over.
+type stateChange struct {
+	Format        int                                 `json:"format"`
+	Leader        string                              `json:"leader,omitempty"`
+	Tenants       []Tenant                            `json:"tenants,omitempty"`
+	APIKeys       []apiKeyState                       `json:"api_keys,omitempty"`
+	Catalog       *billing.CatalogState               `json:"catalog,omitempty"`
+	UsageEvents   []usageEvent                        `json:"usage_events,omitempty"`
+	CompactBefore int64                               `json:"compact_before,omitempty"`
+	Invoices      []billing.Invoice                   `json:"invoices,omitempty"`
+	InvoiceSeq    int64                               `json:"invoice_seq,omitempty"`
+	Quotas        map[string][]quota.Limit            `json:"quotas,omitempty"`
+	Credits       *billing.CreditLedgerChanges        `json:"credits,omitempty"`
+	Charged       map[string]map[int64]billing.Amount `json:"charged,omitempty"`
+	Webhooks      *webhook.DispatcherChanges          `json:"webhooks,omitempty"`
+	Audit         *audit.TrailState                   `json:"audit,omitempty"`
+	Runs          []RunOutcomeInput                   `json:"runs,omitempty"`
+}
+
+func (ch stateChange) empty() bool {
+	return ch.Leader == "" && len(ch.Tenants) == 0 && len(ch.APIKeys) == 0 && ch.Catalog == nil &&
+		len(ch.UsageEvents) == 0 && ch.CompactBefore == 0 && len(ch.Invoices) == 0 && len(ch.Quotas) == 0 &&
+		ch.Credits == nil && len(ch.Charged) == 0 && ch.Webhooks == nil && ch.Audit == nil && len(ch.Runs) == 0
+}
+
+// takeChangesLocked returns the changes tracked since the last call and
+// starts over.
+func (s *Service) takeChangesLocked() stateChange {
+	c := s.changes
+	ch := stateChange{Format: stateFormat}
+	refs := make([]recordRef, 0, len(c.records))
+	for ref := range c.records {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].kind < refs[j].kind || refs[i].kind == refs[j].kind && refs[i].id < refs[j].id
+	})
+	for _, ref := range refs {
+		switch ref.kind {
+		case recordTenant:
+			if t, ok := s.tenants[ref.id]; ok {
+				ch.Tenants = append(ch.Tenants, t.clone())
+			}
+		case recordAPIKey:
+			if k, ok := s.apiKeys[ref.id]; ok {
+				ch.APIKeys = append(ch.APIKeys, apiKeyState{APIKey: k.clone(), Hash: k.Hash})
+			}
+		case recordInvoice:
+			if inv, ok := s.invoices[ref.id]; ok {
+				ch.Invoices = append(ch.Invoices, inv.Clone())
+				ch.InvoiceSeq = s.invoiceSeq
+			}
+		case recordQuota:
+			if ch.Quotas == nil {
+				ch.Quotas = make(map[string][]quota.Limit)
+			}
+			// A nil list removes the tenant's limits.
+			ch.Quotas[ref.id] = append([]quota.Limit(nil), s.quotas[ref.id]...)
+		case recordCharged:
+			if ch.Charged == nil {
+				ch.Charged = make(map[string]map[int64]billing.Amount)
+			}
+			ch.Charged[ref.id] = maps.Clone(s.charged[ref.id])
+		}
+	}
+	if c.catalog {
+		st := s.catalog.State()
+		ch.Catalog = &st
+	}
+	ch.UsageEvents = append([]usageEvent(nil), s.usageEvent[c.usage:]...)
+	ch.CompactBefore = c.compact
+	ch.Runs = c.runs
+	if credits := s.credits.Changes(); len(credits.Accounts) > 0 {
+		ch.Credits = &credits
+	}
+	if hooks := s.webhooks.Changes(); !hooks.Empty() {
+		ch.Webhooks = &hooks
+	}
+	if trail := s.audit.Since(c.auditSeq); len(trail.Events) > 0 {
+		ch.Audit = &trail
+	}
+	s.resetChangesLocked()
+	return ch
+}
+
+// applyChange applies a log entry written by another replica's
+// takeChangesLocked.
+func (s *Service) applyChange(data []byte) error {
+	var ch stateChange
+	if err := json.Unmarshal(data, &ch); err != nil {
+		return fmt.Errorf("decode state change: %w", err)
+	}
+	if ch.Format != stateFormat {
+		return fmt.Errorf("unsupported state format %d", ch.Format)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range ch.Tenants {
+		t := t.clone()
+		s.tenants[t.ID] = &t
+	}
+	for _, ks := range ch.APIKeys {
+		k := ks.APIKey.clone()
+		k.Hash = ks.Hash
+		s.apiKeys[k.ID] = &k
+	}
+	if ch.Catalog != nil {
+		s.catalog.Restore(*ch.Catalog)
+		clear(s.accruals)
+	}
+	for _, ev := range ch.UsageEvents {
+		s.addUsageLocked(ev)
+	}
+	if ch.CompactBefore != 0 {
+		s.compactLocked(ch.CompactBefore)
+	}
+	for _, inv := range ch.Invoices {
+		s.invoices[inv.ID] = inv
+	}
+	s.invoiceSeq = max(s.invoiceSeq, ch.InvoiceSeq)
+	for tenantID, limits := range ch.Quotas {
+		if len(limits) == 0 {
+			delete(s.quotas, tenantID)
+			continue
+		}
+		s.quotas[tenantID] = limits
+	}
+	if ch.Credits != nil {
+		s.credits.ApplyChanges(*ch.Credits)
+	}
+	for tenantID, charged := range ch.Charged {
+		s.charged[tenantID] = orEmpty(charged)
+	}
+	if ch.Webhooks != nil {
+		s.webhooks.ApplyChanges(*ch.Webhooks)
+	}
+	if ch.Audit != nil {
+		s.audit.Extend(*ch.Audit)
+	}
+	for _, in := range ch.Runs {
+		s.recordRunLocked(in)
+	}
+	s.resetChangesLocked()
+	return nil
+}
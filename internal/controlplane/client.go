@@ -0,0 +1,299 @@
+package controlplane
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+)
+
+// DefaultURL is where a locally started control plane listens.
+const DefaultURL = "http://localhost:8081"
+
+// ClientConfig configures a control-plane API client. Role is sent as
+// X-Role, which only a control plane in insecure local mode honours.
+type ClientConfig struct {
+	BaseURL    string
+	APIKey     string
+	Role       string
+	HTTPClient *http.Client
+}
+
+// Client calls the control-plane HTTP API with API-key auth.
+type Client struct {
+	cfg ClientConfig
+}
+
+// APIError is a non-2xx response from the control plane.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("control plane returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("control plane returned %d: %s", e.StatusCode, e.Message)
+}
+
+func NewClient(cfg ClientConfig) *Client {
+	cfg.BaseURL = strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultURL
+	}
+	cfg.APIKey = strings.TrimSpace(cfg.APIKey)
+	cfg.Role = strings.TrimSpace(cfg.Role)
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{cfg: cfg}
+}
+
+// ClientFromEnv builds a client from CONTROLPLANE_URL, CONTROLPLANE_API_KEY
+// and REQUEST_ROLE, defaulting to DefaultURL.
+func ClientFromEnv() *Client {
+	return NewClient(ClientConfig{
+		BaseURL: os.Getenv("CONTROLPLANE_URL"),
+		APIKey:  os.Getenv("CONTROLPLANE_API_KEY"),
+		Role:    os.Getenv("REQUEST_ROLE"),
+	})
+}
+
+// BaseURL is the API root the client talks to.
+func (c *Client) BaseURL() string {
+	return c.cfg.BaseURL
+}
+
+// Page selects a page of a list endpoint; zero values use server defaults.
+type Page struct {
+	Number int
+	Size   int
+}
+
+func (p Page) apply(q url.Values) {
+	if p.Number > 0 {
+		q.Set("page", strconv.Itoa(p.Number))
+	}
+	if p.Size > 0 {
+		q.Set("page_size", strconv.Itoa(p.Size))
+	}
+}
+
+// TenantList is a page of tenant IDs.
+type TenantList struct {
+	Tenants  []string `json:"tenants"`
+	Total    int      `json:"total"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"page_size"`
+}
+
+// TenantUsage is a tenant's usage totals, broken down by model.
+type TenantUsage struct {
+	TenantID     string              `json:"tenant_id"`
+	Invocations  int64               `json:"invocations"`
+	InputTokens  int64               `json:"input_tokens"`
+	OutputTokens int64               `json:"output_tokens"`
+	ByModel      map[string]UsageRow `json:"by_model"`
+}
+
+// UsageRow is one tenant's or model's usage totals.
+type UsageRow struct {
+	TenantID     string `json:"tenant_id,omitempty"`
+	Invocations  int64  `json:"invocations"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+// UsageList is a page of per-tenant usage totals.
+type UsageList struct {
+	Items    []UsageRow `json:"items"`
+	Total    int        `json:"total"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"page_size"`
+}
+
+// Rate is the default price per thousand invocations.
+type Rate struct {
+	PerThousand billing.Amount   `json:"per_thousand"`
+	Currency    billing.Currency `json:"currency"`
+}
+
+// InvoiceList is a page of stored invoices.
+type InvoiceList struct {
+	Items    []billing.Invoice `json:"items"`
+	Total    int               `json:"total"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+}
+
+func (c *Client) ListTenants(ctx context.Context, q string, page Page) (TenantList, error) {
+	query := url.Values{}
+	if q != "" {
+		query.Set("q", q)
+	}
+	page.apply(query)
+	var out TenantList
+	return out, c.do(ctx, http.MethodGet, "/v1/tenants", query, nil, &out)
+}
+
+func (c *Client) CreateTenant(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/v1/tenants", nil, map[string]string{"id": id}, nil)
+}
+
+func (c *Client) Tenant(ctx context.Context, id string) (Tenant, error) {
+	var out Tenant
+	return out, c.do(ctx, http.MethodGet, "/v1/tenants/"+url.PathEscape(id), nil, nil, &out)
+}
+
+// UpdateTenant suspends or resumes a tenant and merges attributes.
+func (c *Client) UpdateTenant(ctx context.Context, id string, u TenantUpdate) (Tenant, error) {
+	var out Tenant
+	return out, c.do(ctx, http.MethodPatch, "/v1/tenants/"+url.PathEscape(id), nil, u, &out)
+}
+
+func (c *Client) TenantUsage(ctx context.Context, tenantID string) (TenantUsage, error) {
+	var out TenantUsage
+	return out, c.do(ctx, http.MethodGet, "/v1/usage", url.Values{"tenant_id": {tenantID}}, nil, &out)
+}
+
+func (c *Client) ListUsage(ctx context.Context, q string, page Page) (UsageList, error) {
+	query := url.Values{}
+	if q != "" {
+		query.Set("q", q)
+	}
+	page.apply(query)
+	var out UsageList
+	return out, c.do(ctx, http.MethodGet, "/v1/usage", query, nil, &out)
+}
+
+func (c *Client) Rate(ctx context.Context) (Rate, error) {
+	var out Rate
+	return out, c.do(ctx, http.MethodGet, "/v1/billing/rates", nil, nil, &out)
+}
+
+// SetRate changes the default price. An empty currency keeps the server's
+// default of USD.
+func (c *Client) SetRate(ctx context.Context, perThousand billing.Amount, currency billing.Currency) error {
+	return c.do(ctx, http.MethodPost, "/v1/billing/rates", nil, Rate{PerThousand: perThousand, Currency: currency}, nil)
+}
+
+func (c *Client) ListInvoices(ctx context.Context, tenantID string, status billing.InvoiceStatus, page Page) (InvoiceList, error) {
+	query := url.Values{}
+	if tenantID != "" {
+		query.Set("tenant_id", tenantID)
+	}
+	if status != "" {
+		query.Set("status", string(status))
+	}
+	page.apply(query)
+	var out InvoiceList
+	return out, c.do(ctx, http.MethodGet, "/v1/billing/invoices", query, nil, &out)
+}
+
+// CreateInvoice drafts an invoice for a YYYY-MM month.
+func (c *Client) CreateInvoice(ctx context.Context, tenantID string, month string) (billing.Invoice, error) {
+	var out billing.Invoice
+	return out, c.do(ctx, http.MethodPost, "/v1/billing/invoices", nil, map[string]string{"tenant_id": tenantID, "month": month}, &out)
+}
+
+func (c *Client) Invoice(ctx context.Context, id string) (billing.Invoice, error) {
+	var out billing.Invoice
+	return out, c.do(ctx, http.MethodGet, "/v1/billing/invoices/"+url.PathEscape(id), nil, nil, &out)
+}
+
+// RenderInvoice returns a stored invoice rendered as json, csv or html.
+func (c *Client) RenderInvoice(ctx context.Context, id string, format billing.RenderFormat) ([]byte, error) {
+	return c.raw(ctx, "/v1/billing/invoices/"+url.PathEscape(id), url.Values{"format": {string(format)}})
+}
+
+// PreviewInvoice rates a tenant's month without storing an invoice.
+func (c *Client) PreviewInvoice(ctx context.Context, tenantID string, month string) (billing.Invoice, error) {
+	query := url.Values{"tenant_id": {tenantID}}
+	if month != "" {
+		query.Set("month", month)
+	}
+	var out billing.Invoice
+	return out, c.do(ctx, http.MethodGet, "/v1/billing/invoice", query, nil, &out)
+}
+
+func (c *Client) FinalizeInvoice(ctx context.Context, id string) (billing.Invoice, error) {
+	var out billing.Invoice
+	return out, c.do(ctx, http.MethodPost, "/v1/billing/invoices/"+url.PathEscape(id)+"/finalize", nil, nil, &out)
+}
+
+// VoidInvoice voids an invoice and returns its new state.
+func (c *Client) VoidInvoice(ctx context.Context, id string, reason string) (billing.Invoice, error) {
+	if err := c.do(ctx, http.MethodPost, "/v1/billing/invoices/"+url.PathEscape(id)+"/void", nil, map[string]string{"reason": reason}, nil); err != nil {
+		return billing.Invoice{}, err
+	}
+	return c.Invoice(ctx, id)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp, out); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *Client) raw(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	return c.send(ctx, http.MethodGet, path, query, nil)
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body io.Reader) ([]byte, error) {
+	target := c.cfg.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+	if c.cfg.Role != "" {
+		req.Header.Set("X-Role", c.cfg.Role)
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: read response: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	return b, nil
+}
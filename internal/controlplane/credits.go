@@ -0,0 +1,334 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/quota"
+)
+
+// CreditBalance is a tenant's prepaid position.
+type CreditBalance struct {
+	TenantID    string                `json:"tenant_id"`
+	AsOf        time.Time             `json:"as_of"`
+	Balance     billing.Money         `json:"balance"`
+	BlockAtZero bool                  `json:"block_at_zero"`
+	Grants      []billing.CreditGrant `json:"grants"`
+}
+
+// GrantCreditsInput describes a credit grant. A zero ExpiresAt never expires.
+type GrantCreditsInput struct {
+	TenantID  string
+	Kind      billing.CreditKind
+	Amount    billing.Money
+	ExpiresAt time.Time
+	Note      string
+}
+
+// GrantCredits adds prepaid credit. The grant must be in the currency the
+// tenant is billed in now.
+func (s *Service) GrantCredits(in GrantCreditsInput) (billing.CreditGrant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[in.TenantID]; !ok {
+		return billing.CreditGrant{}, fmt.Errorf("%w: %q", ErrTenantNotFound, in.TenantID)
+	}
+	now := time.Now().UTC()
+	if currency := s.catalog.PlanAt(in.TenantID, now).Currency; in.Amount.Currency != currency {
+		return billing.CreditGrant{}, fmt.Errorf("%w: tenant %q is billed in %s, grant is %s", billing.ErrCurrencyMismatch, in.TenantID, currency, in.Amount.Currency)
+	}
+	s.openCreditsLocked(in.TenantID, now)
+	return s.credits.Grant(in.TenantID, in.Kind, in.Amount, in.ExpiresAt, in.Note, now)
+}
+
+// SetCreditBlock sets whether an exhausted balance blocks the tenant's runs.
+func (s *Service) SetCreditBlock(tenantID string, block bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	now := time.Now().UTC()
+	s.openCreditsLocked(tenantID, now)
+	s.credits.SetBlockAtZero(tenantID, block, now)
+	return nil
+}
+
+// openCreditsLocked records the current month's charges when an account is
+// opened, so usage from before it existed is not drawn from credits.
+func (s *Service) openCreditsLocked(tenantID string, now time.Time) {
+	if s.credits.Has(tenantID) {
+		return
+	}
+	start := usageMonth(now)
+	if a, err := s.accrualLocked(tenantID, start); err == nil {
+		s.chargedLocked(tenantID)[start.Unix()] = a.Usage
+		s.changes.touch(recordCharged, tenantID)
+	}
+}
+
+func (s *Service) CreditBalance(tenantID string, at time.Time) (CreditBalance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return CreditBalance{}, fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	return CreditBalance{
+		TenantID:    tenantID,
+		AsOf:        at.UTC(),
+		Balance:     s.creditBalanceLocked(tenantID, at),
+		BlockAtZero: s.credits.BlockAtZero(tenantID),
+		Grants:      s.credits.Grants(tenantID, at),
+	}, nil
+}
+
+// creditBalanceLocked reports the balance in the tenant's billing currency
+// when no credit has been granted yet.
+func (s *Service) creditBalanceLocked(tenantID string, at time.Time) billing.Money {
+	balance := s.credits.Balance(tenantID, at)
+	if balance.Currency == "" {
+		balance.Currency = s.catalog.PlanAt(tenantID, at).Currency
+	}
+	return balance
+}
+
+// CreditLedger returns the tenant's ledger entries, newest first.
+func (s *Service) CreditLedger(tenantID string, kind billing.LedgerEntryKind) ([]billing.LedgerEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	entries := s.credits.Entries(tenantID, time.Now())
+	out := make([]billing.LedgerEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if kind == "" || entries[i].Kind == kind {
+			out = append(out, entries[i])
+		}
+	}
+	return out, nil
+}
+
+// drawCreditsLocked draws the charges accrued for the month of at beyond
+// what was already charged from the tenant's credit. The month's accrual has
+// already priced the new event, so nothing is re-rated. Charges are tracked
+// per month so graduated tiers are drawn at the price actually billed.
+// Minimum commitments are settled on the invoice, not drawn as usage accrues.
+func (s *Service) drawCreditsLocked(tenantID string, at time.Time) {
+	if !s.credits.Has(tenantID) {
+		return
+	}
+	start := usageMonth(at)
+	if start.AddDate(0, 1, 0).Before(s.credits.OpenedAt(tenantID)) {
+		return
+	}
+	a, err := s.accrualLocked(tenantID, start)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: rate %s for credit drawdown: %v\n", tenantID, err)
+		return
+	}
+	charged := s.chargedLocked(tenantID)
+	delta := a.Usage - charged[start.Unix()]
+	if delta <= 0 {
+		return
+	}
+	charged[start.Unix()] = a.Usage
+	s.changes.touch(recordCharged, tenantID)
+	if _, err := s.credits.Draw(tenantID, billing.NewMoney(delta, a.Currency), start, time.Now()); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: credit drawdown for %s: %v\n", tenantID, err)
+	}
+}
+
+func (s *Service) chargedLocked(tenantID string) map[int64]billing.Amount {
+	m, ok := s.charged[tenantID]
+	if !ok {
+		m = make(map[int64]billing.Amount)
+		s.charged[tenantID] = m
+	}
+	return m
+}
+
+// applyCreditsLocked adds a credit line for prepaid credit drawn against
+// usage in the invoice period, capped at the subtotal.
+func (s *Service) applyCreditsLocked(inv *billing.Invoice) {
+	applied := s.credits.Applied(inv.TenantID, inv.Currency, inv.PeriodStart, inv.PeriodEnd)
+	applied = min(applied, inv.Subtotal.Amount)
+	if applied <= 0 {
+		return
+	}
+	inv.Lines = append(inv.Lines, billing.LineItem{
+		Kind:        billing.LineCredit,
+		Description: "prepaid credits applied",
+		From:        inv.PeriodStart,
+		To:          inv.PeriodEnd,
+		Amount:      -applied,
+	})
+	inv.Recalculate()
+}
+
+func (s *Service) registerCreditRoutes(a *api) {
+	a.register("/credits/{tenant_id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		tenantID, ok := a.tenantScope(w, p, r.PathValue("tenant_id"))
+		if !ok {
+			return
+		}
+		auditFrom(r).target("credits/"+tenantID, tenantID)
+		switch r.Method {
+		case http.MethodGet:
+			if !a.requireScope(w, p, ScopeUsageRead) {
+				return
+			}
+		case http.MethodPut:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			var req struct {
+				BlockAtZero bool `json:"block_at_zero"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			before := s.creditBlock(tenantID)
+			if err := s.SetCreditBlock(tenantID, req.BlockAtZero); err != nil {
+				http.Error(w, err.Error(), quotaErrorStatus(err))
+				return
+			}
+			auditFrom(r).change(before, map[string]bool{"block_at_zero": req.BlockAtZero})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		balance, err := s.CreditBalance(tenantID, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		writeJSON(w, balance)
+	})
+	a.register("/credits/{tenant_id}/grants", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.requireScope(w, p, ScopeBillingAdmin) {
+			return
+		}
+		tenantID := r.PathValue("tenant_id")
+		auditFrom(r).target("credits/"+tenantID, tenantID)
+		var req struct {
+			Kind      string          `json:"kind"`
+			Amount    *billing.Amount `json:"amount"`
+			Currency  string          `json:"currency"`
+			ExpiresAt string          `json:"expires_at"`
+			Note      string          `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Amount == nil {
+			http.Error(w, "amount is required", http.StatusBadRequest)
+			return
+		}
+		kind, err := billing.ParseCreditKind(req.Kind)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		currency, err := billing.ParseCurrency(req.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in := GrantCreditsInput{TenantID: tenantID, Kind: kind, Amount: billing.NewMoney(*req.Amount, currency), Note: req.Note}
+		if raw := strings.TrimSpace(req.ExpiresAt); raw != "" {
+			if in.ExpiresAt, err = parseEffectiveFrom(raw); err != nil {
+				http.Error(w, "invalid expires_at: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		grant, err := s.GrantCredits(in)
+		if err != nil {
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		auditFrom(r).target("credits/"+tenantID+"/grants/"+grant.ID, tenantID)
+		auditFrom(r).change(nil, grant)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(grant)
+	})
+	a.register("/credits/{tenant_id}/ledger", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tenantID, ok := a.tenantScope(w, p, r.PathValue("tenant_id"))
+		if !ok {
+			return
+		}
+		q := r.URL.Query()
+		page, pageSize := parsePagination(q.Get("page"), q.Get("page_size"))
+		items, err := s.CreditLedger(tenantID, billing.LedgerEntryKind(strings.TrimSpace(q.Get("kind"))))
+		if err != nil {
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		total := len(items)
+		items = paginateLedgerEntries(items, page, pageSize)
+		writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": pageSize})
+	})
+}
+
+func (s *Service) creditBlock(tenantID string) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.credits.Has(tenantID) {
+		return nil
+	}
+	return map[string]bool{"block_at_zero": s.credits.BlockAtZero(tenantID)}
+}
+
+func paginateLedgerEntries(in []billing.LedgerEntry, page int, pageSize int) []billing.LedgerEntry {
+	start := (page - 1) * pageSize
+	if start >= len(in) {
+		return []billing.LedgerEntry{}
+	}
+	end := start + pageSize
+	if end > len(in) {
+		end = len(in)
+	}
+	return in[start:end]
+}
+
+// creditsStateLocked is the tenant's credit position for quota checks, or
+// nil when the tenant has no credit account.
+func (s *Service) creditsStateLocked(tenantID string, at time.Time) *quota.Credits {
+	if !s.credits.Has(tenantID) {
+		return nil
+	}
+	c := quota.EvaluateCredits(s.creditBalanceLocked(tenantID, at), s.credits.BlockAtZero(tenantID))
+	return &c
+}
@@ -0,0 +1,831 @@
+package controlplane
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/your-org/fluxroute/internal/coordinator"
+)
+
+const (
+	leaderLeaseKey         = "controlplane-leader"
+	defaultLeaseTTL        = 15 * time.Second
+	defaultSyncInterval    = 2 * time.Second
+	defaultCheckpointEvery = 1000
+	// forwardedHeader marks a write a follower passed to the leader, so a
+	// stale leader never forwards it again.
+	forwardedHeader = "X-Fluxroute-Forwarded-By"
+)
+
+var (
+	// ErrStaleVersion reports an append on top of an outdated version:
+	// another replica wrote to the log in the meantime.
+	ErrStaleVersion = errors.New("state log version is stale")
+	// ErrCompacted reports log entries a checkpoint has replaced.
+	ErrCompacted = errors.New("state log entries were compacted")
+)
+
+// StateStore is the state every replica shares: an append-only log of
+// changes and a checkpoint of the state as of some version. Versions number
+// the log entries from 1; zero means nothing is stored.
+type StateStore interface {
+	// Append adds entry as version prev+1 if prev is the latest version and
+	// fails with ErrStaleVersion otherwise, so a replica only writes on top
+	// of everything it has applied.
+	Append(ctx context.Context, prev int64, entry []byte) (int64, error)
+	// Entries returns the entries after version from, oldest first, or
+	// ErrCompacted when a checkpoint past from has dropped them.
+	Entries(ctx context.Context, from int64) ([][]byte, error)
+	// Checkpoint stores the state as of version and drops the entries up to
+	// it. An older checkpoint never replaces a newer one.
+	Checkpoint(ctx context.Context, version int64, data []byte) error
+	// Load returns the latest checkpoint and its version.
+	Load(ctx context.Context) ([]byte, int64, error)
+	Version(ctx context.Context) (int64, error)
+}
+
+// HAConfig runs the service as one of several replicas. The leader, elected
+// through Coordinator, serves writes and runs background jobs; followers
+// serve reads from Store and forward writes to the leader's AdvertiseURL.
+// The leader checkpoints the state every CheckpointEvery log entries.
+type HAConfig struct {
+	Coordinator     coordinator.Coordinator
+	Store           StateStore
+	AdvertiseURL    string
+	LeaseTTL        time.Duration
+	SyncInterval    time.Duration
+	CheckpointEvery int
+}
+
+// HAConfigFromEnv builds an HA config when CONTROLPLANE_HA_ENABLED is true
+// and returns nil otherwise. CONTROLPLANE_HA_MODE selects redis (the
+// default, CONTROLPLANE_HA_REDIS_URL) or file (CONTROLPLANE_HA_DIR, a
+// directory every replica mounts).
+func HAConfigFromEnv() (*HAConfig, error) {
+	if ok, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("CONTROLPLANE_HA_ENABLED"))); !ok {
+		return nil, nil
+	}
+	cfg := &HAConfig{
+		AdvertiseURL: strings.TrimSpace(os.Getenv("CONTROLPLANE_ADVERTISE_URL")),
+		LeaseTTL:     durationFromEnv("CONTROLPLANE_HA_LEASE_TTL", defaultLeaseTTL),
+		SyncInterval: durationFromEnv("CONTROLPLANE_HA_SYNC_INTERVAL", defaultSyncInterval),
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("CONTROLPLANE_HA_CHECKPOINT_EVERY"))); err == nil {
+		cfg.CheckpointEvery = v
+	}
+	if cfg.AdvertiseURL == "" {
+		return nil, fmt.Errorf("CONTROLPLANE_HA_ENABLED requires CONTROLPLANE_ADVERTISE_URL")
+	}
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("CONTROLPLANE_HA_MODE"))); mode {
+	case "", "redis":
+		redisURL := strings.TrimSpace(os.Getenv("CONTROLPLANE_HA_REDIS_URL"))
+		if redisURL == "" {
+			redisURL = strings.TrimSpace(os.Getenv("COORDINATION_REDIS_URL"))
+		}
+		prefix := strings.TrimSpace(os.Getenv("CONTROLPLANE_HA_PREFIX"))
+		if prefix == "" {
+			prefix = "fluxroute:controlplane"
+		}
+		coord, err := coordinator.NewRedisCoordinator(redisURL, prefix)
+		if err != nil {
+			return nil, err
+		}
+		store, err := NewRedisStateStore(redisURL, prefix)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Coordinator, cfg.Store = coord, store
+	case "file":
+		dir := strings.TrimSpace(os.Getenv("CONTROLPLANE_HA_DIR"))
+		if dir == "" {
+			return nil, fmt.Errorf("CONTROLPLANE_HA_MODE=file requires CONTROLPLANE_HA_DIR")
+		}
+		cfg.Coordinator, cfg.Store = coordinator.NewFileCoordinator(dir), NewFileStateStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown CONTROLPLANE_HA_MODE %q (want redis|file)", mode)
+	}
+	return cfg, nil
+}
+
+type haState struct {
+	cfg     HAConfig
+	elector *coordinator.Elector
+	// ready is set once the leader has caught up with the log.
+	ready atomic.Bool
+	// dirty is set when memory may hold changes the log does not, after a
+	// commit failed and could not be rolled back.
+	dirty atomic.Bool
+	// version is the latest log entry reflected in memory.
+	version atomic.Int64
+	// writeMu serializes writes with their commits, so each log entry
+	// holds the changes of one write or job pass.
+	writeMu sync.Mutex
+
+	proxiesMu sync.Mutex
+	proxies   map[string]*httputil.ReverseProxy
+}
+
+// EnableHA makes the service one replica of a highly available control
+// plane and loads the latest shared state. Call it before Handler and Run.
+func (s *Service) EnableHA(cfg HAConfig) error {
+	if cfg.Coordinator == nil || cfg.Store == nil {
+		return fmt.Errorf("ha requires a coordinator and a state store")
+	}
+	if _, err := url.Parse(cfg.AdvertiseURL); err != nil || cfg.AdvertiseURL == "" {
+		return fmt.Errorf("invalid advertise url %q", cfg.AdvertiseURL)
+	}
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = defaultLeaseTTL
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultSyncInterval
+	}
+	if cfg.CheckpointEvery <= 0 {
+		cfg.CheckpointEvery = defaultCheckpointEvery
+	}
+	s.ha = &haState{
+		cfg:     cfg,
+		elector: coordinator.NewElector(cfg.Coordinator, leaderLeaseKey, cfg.AdvertiseURL, cfg.LeaseTTL),
+		proxies: make(map[string]*httputil.ReverseProxy),
+	}
+	s.mu.Lock()
+	s.changes = &changeSet{}
+	s.resetChangesLocked()
+	s.credits.TrackChanges()
+	s.webhooks.TrackChanges()
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.ha.writeMu.Lock()
+	defer s.ha.writeMu.Unlock()
+	if err := s.reload(ctx); err != nil {
+		return fmt.Errorf("load shared state: %w", err)
+	}
+	return nil
+}
+
+// IsLeader reports whether this replica serves writes and runs jobs. It is
+// always true without HA.
+func (s *Service) IsLeader() bool {
+	return s.ha == nil || (s.ha.elector.IsLeader() && s.ha.ready.Load())
+}
+
+// Run runs the background jobs (webhook delivery, monthly invoice
+// finalization and rollup compaction) until ctx is done. With HA enabled it
+// campaigns for leadership, runs the jobs only while leading and otherwise
+// follows the leader's state.
+func (s *Service) Run(ctx context.Context) {
+	cfg := jobConfigFromEnv()
+	if s.ha == nil {
+		s.runJobs(ctx, cfg)
+		return
+	}
+	go s.followState(ctx)
+	s.ha.elector.Run(ctx, func(ctx context.Context) {
+		if err := s.takeOver(ctx); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: leader could not take over the state log: %v\n", err)
+			return
+		}
+		s.ha.ready.Store(true)
+		defer s.ha.ready.Store(false)
+		s.runJobs(ctx, cfg)
+	})
+}
+
+// takeOver catches up with the log and appends an entry naming this
+// replica. A previous leader that still believes it leads is fenced off:
+// its next append is based on an older version and fails.
+func (s *Service) takeOver(ctx context.Context) error {
+	h := s.ha
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	entry, err := json.Marshal(stateChange{Format: stateFormat, Leader: h.cfg.AdvertiseURL})
+	if err != nil {
+		return err
+	}
+	for {
+		if err := s.catchUp(ctx); err != nil {
+			return err
+		}
+		v, err := h.cfg.Store.Append(ctx, h.version.Load(), entry)
+		if errors.Is(err, ErrStaleVersion) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		h.version.Store(v)
+		return nil
+	}
+}
+
+// followState applies the leader's new log entries every SyncInterval.
+func (s *Service) followState(ctx context.Context) {
+	ticker := time.NewTicker(s.ha.cfg.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.syncState(ctx); err != nil && ctx.Err() == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: sync shared state: %v\n", err)
+		}
+	}
+}
+
+// syncState catches a follower up with the log. A ready leader's own
+// commits are the newest entries, so it only reloads when dirty.
+func (s *Service) syncState(ctx context.Context) error {
+	h := s.ha
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	if h.ready.Load() && !h.dirty.Load() {
+		return nil
+	}
+	return s.catchUp(ctx)
+}
+
+// catchUp applies the entries appended since the loaded version. It
+// reloads from the latest checkpoint instead when memory is dirty or the
+// entries were compacted. Callers hold writeMu.
+func (s *Service) catchUp(ctx context.Context) error {
+	h := s.ha
+	if h.dirty.Load() {
+		return s.reload(ctx)
+	}
+	v, err := h.cfg.Store.Version(ctx)
+	if err != nil {
+		return err
+	}
+	loaded := h.version.Load()
+	if v == loaded {
+		return nil
+	}
+	if v < loaded {
+		return s.reload(ctx)
+	}
+	entries, err := h.cfg.Store.Entries(ctx, loaded)
+	if errors.Is(err, ErrCompacted) {
+		return s.reload(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return s.applyEntries(loaded, entries)
+}
+
+// reload replaces memory with the latest checkpoint and the entries after
+// it. Callers hold writeMu.
+func (s *Service) reload(ctx context.Context) error {
+	h := s.ha
+	data, v, err := h.cfg.Store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	entries, err := h.cfg.Store.Entries(ctx, v)
+	if err != nil {
+		return err
+	}
+	if v == 0 {
+		s.restore(emptyState())
+	} else if err := s.Restore(data); err != nil {
+		return err
+	}
+	h.version.Store(v)
+	h.dirty.Store(false)
+	return s.applyEntries(v, entries)
+}
+
+func (s *Service) applyEntries(from int64, entries [][]byte) error {
+	h := s.ha
+	for i, entry := range entries {
+		v := from + int64(i) + 1
+		if err := s.applyChange(entry); err != nil {
+			h.dirty.Store(true)
+			return fmt.Errorf("apply state version %d: %w", v, err)
+		}
+		h.version.Store(v)
+	}
+	return nil
+}
+
+// write runs fn, which may change state. With HA enabled the changes are
+// appended to the shared log before write returns; if that fails, memory is
+// reloaded from the log, undoing them. Callers must not hold s.mu.
+func (s *Service) write(ctx context.Context, fn func()) error {
+	h := s.ha
+	if h == nil {
+		fn()
+		return nil
+	}
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	if h.dirty.Load() {
+		if err := s.reload(ctx); err != nil {
+			return err
+		}
+	}
+	fn()
+	err := s.commit(ctx)
+	if err != nil {
+		h.dirty.Store(true)
+		// The outcome of a failed append can be unknown, so memory is
+		// replaced by whatever the log holds.
+		reloadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if rerr := s.reload(reloadCtx); rerr != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: roll back uncommitted write: %v\n", rerr)
+		}
+	}
+	return err
+}
+
+// commit appends the changes made since the last commit to the log and
+// checkpoints every CheckpointEvery versions. Callers hold writeMu.
+func (s *Service) commit(ctx context.Context) error {
+	h := s.ha
+	s.mu.Lock()
+	ch := s.takeChangesLocked()
+	s.mu.Unlock()
+	if ch.empty() {
+		return nil
+	}
+	entry, err := json.Marshal(ch)
+	if err != nil {
+		return fmt.Errorf("encode state change: %w", err)
+	}
+	v, err := h.cfg.Store.Append(ctx, h.version.Load(), entry)
+	if err != nil {
+		return err
+	}
+	h.version.Store(v)
+	if v%int64(h.cfg.CheckpointEvery) == 0 {
+		// A failed checkpoint only leaves the log longer until the next one.
+		data, err := s.Snapshot()
+		if err == nil {
+			err = h.cfg.Store.Checkpoint(ctx, v, data)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: checkpoint state version %d: %v\n", v, err)
+		}
+	}
+	return nil
+}
+
+// replicated serves reads locally. Writes are applied by the leader, which
+// acknowledges them only once they are in the shared log; followers forward
+// them to the leader and catch up before answering.
+func (s *Service) replicated(next http.Handler) http.Handler {
+	h := s.ha
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if h.dirty.Load() {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "replica is reloading state", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if h.elector.IsLeader() {
+			if !h.ready.Load() {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "leader is loading state", http.StatusServiceUnavailable)
+				return
+			}
+			buf := &bufferedWriter{header: w.Header()}
+			if err := s.write(r.Context(), func() { next.ServeHTTP(buf, r) }); err != nil {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "write not persisted: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			buf.flush(w)
+			return
+		}
+		leader, err := h.elector.Leader(r.Context())
+		if err != nil || leader == "" || leader == h.cfg.AdvertiseURL || r.Header.Get(forwardedHeader) != "" {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "no control-plane leader available", http.StatusServiceUnavailable)
+			return
+		}
+		proxy, err := h.proxy(leader)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		r.Header.Set(forwardedHeader, h.cfg.AdvertiseURL)
+		buf := &bufferedWriter{header: w.Header()}
+		proxy.ServeHTTP(buf, r)
+		// The leader answers once the write is in the log, so catching up
+		// now lets the client read its own write from this replica.
+		if err := s.syncState(r.Context()); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: sync after forwarded write: %v\n", err)
+		}
+		buf.flush(w)
+	})
+}
+
+func (h *haState) proxy(leader string) (*httputil.ReverseProxy, error) {
+	h.proxiesMu.Lock()
+	defer h.proxiesMu.Unlock()
+	if p, ok := h.proxies[leader]; ok {
+		return p, nil
+	}
+	target, err := url.Parse(leader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid leader url %q: %w", leader, err)
+	}
+	p := httputil.NewSingleHostReverseProxy(target)
+	p.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+		http.Error(w, "forward to leader: "+err.Error(), http.StatusBadGateway)
+	}
+	h.proxies[leader] = p
+	return p, nil
+}
+
+// bufferedWriter holds a response until the write behind it is persisted, or
+// until a follower has caught up with it.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header { return w.header }
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) flush(dst http.ResponseWriter) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	dst.WriteHeader(w.status)
+	_, _ = dst.Write(w.body.Bytes())
+}
+
+func (s *Service) registerHARoutes(a *api) {
+	a.register("/ha", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if s.ha == nil {
+			writeJSON(w, map[string]any{"enabled": false, "leader": true})
+			return
+		}
+		leader, err := s.ha.elector.Leader(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"enabled":       true,
+			"replica":       s.ha.cfg.AdvertiseURL,
+			"leader":        s.IsLeader(),
+			"leader_url":    leader,
+			"state_version": s.ha.version.Load(),
+			"sync_interval": s.ha.cfg.SyncInterval.String(),
+			"lease_ttl":     s.ha.cfg.LeaseTTL.String(),
+		})
+	})
+}
+
+// fileStateStore keeps the log and checkpoints in a directory shared by
+// every replica, such as a network volume. Each entry is a file named by its
+// version, hard-linked into place: the link fails when the version exists,
+// which makes appends conditional.
+type fileStateStore struct {
+	dir string
+}
+
+func NewFileStateStore(dir string) StateStore {
+	return &fileStateStore{dir: dir}
+}
+
+func (f *fileStateStore) entryPath(v int64) string {
+	return filepath.Join(f.dir, "log", fmt.Sprintf("%020d.json", v))
+}
+
+func (f *fileStateStore) Append(_ context.Context, prev int64, entry []byte) (int64, error) {
+	dir := filepath.Join(f.dir, "log")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return 0, fmt.Errorf("mkdir state log: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "append.*")
+	if err != nil {
+		return 0, fmt.Errorf("append state: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(entry)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("append state: %w", err)
+	}
+	v := prev + 1
+	if err := os.Link(tmp.Name(), f.entryPath(v)); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return 0, ErrStaleVersion
+		}
+		return 0, fmt.Errorf("append state: %w", err)
+	}
+	// The slot was also free if a checkpoint past prev removed the entry
+	// there; then prev was stale and the file is dropped again.
+	c, err := f.checkpointVersion()
+	if err != nil {
+		return 0, err
+	}
+	if c > prev {
+		_ = os.Remove(f.entryPath(v))
+		return 0, ErrStaleVersion
+	}
+	return v, nil
+}
+
+func (f *fileStateStore) Entries(_ context.Context, from int64) ([][]byte, error) {
+	c, err := f.checkpointVersion()
+	if err != nil {
+		return nil, err
+	}
+	if from < c {
+		return nil, ErrCompacted
+	}
+	var out [][]byte
+	for v := from + 1; ; v++ {
+		b, err := os.ReadFile(f.entryPath(v))
+		if errors.Is(err, fs.ErrNotExist) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read state log: %w", err)
+		}
+		out = append(out, b)
+	}
+}
+
+func (f *fileStateStore) Checkpoint(_ context.Context, version int64, data []byte) error {
+	c, err := f.checkpointVersion()
+	if err != nil || version <= c {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(f.dir, fmt.Sprintf("checkpoint-%020d.json", version)), data); err != nil {
+		return err
+	}
+	// Entries are dropped only after the checkpoint covering them is in
+	// place; Append relies on that order.
+	for _, old := range f.versions(f.dir, "checkpoint-") {
+		if old < version {
+			_ = os.Remove(filepath.Join(f.dir, fmt.Sprintf("checkpoint-%020d.json", old)))
+		}
+	}
+	for _, v := range f.versions(filepath.Join(f.dir, "log"), "") {
+		if v <= version {
+			_ = os.Remove(f.entryPath(v))
+		}
+	}
+	return nil
+}
+
+func (f *fileStateStore) Load(_ context.Context) ([]byte, int64, error) {
+	for {
+		c, err := f.checkpointVersion()
+		if err != nil || c == 0 {
+			return nil, 0, err
+		}
+		data, err := os.ReadFile(filepath.Join(f.dir, fmt.Sprintf("checkpoint-%020d.json", c)))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Replaced by a newer checkpoint while reading.
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read state checkpoint: %w", err)
+		}
+		return data, c, nil
+	}
+}
+
+func (f *fileStateStore) Version(_ context.Context) (int64, error) {
+	c, err := f.checkpointVersion()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range f.versions(filepath.Join(f.dir, "log"), "") {
+		c = max(c, v)
+	}
+	return c, nil
+}
+
+func (f *fileStateStore) checkpointVersion() (int64, error) {
+	if _, err := os.Stat(f.dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("read state dir: %w", err)
+	}
+	var c int64
+	for _, v := range f.versions(f.dir, "checkpoint-") {
+		c = max(c, v)
+	}
+	return c, nil
+}
+
+// versions lists the versions of the files in dir named prefix<version>.json.
+func (f *fileStateStore) versions(dir string, prefix string) []int64 {
+	entries, _ := os.ReadDir(dir)
+	out := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok {
+			continue
+		}
+		name, ok = strings.CutSuffix(name, ".json")
+		if v, err := strconv.ParseInt(name, 10, 64); ok && err == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("mkdir state dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// redisStateStore keeps the log in a list and the checkpoint beside it.
+// Scripts make appends conditional on the version and keep the list
+// aligned with the checkpoint; the keys share a hash tag so that works on
+// Redis Cluster too.
+type redisStateStore struct {
+	client     redis.UniversalClient
+	log        string
+	version    string
+	checkpoint string
+	// base is the version the checkpoint covers; the list starts after it.
+	base string
+}
+
+func NewRedisStateStore(redisURL string, prefix string) (StateStore, error) {
+	client, err := coordinator.NewRedisClient(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = "fluxroute:controlplane"
+	}
+	tag := "{" + prefix + "}"
+	return &redisStateStore{
+		client:     client,
+		log:        tag + ":state:log",
+		version:    tag + ":state:version",
+		checkpoint: tag + ":state:checkpoint",
+		base:       tag + ":state:checkpoint:version",
+	}, nil
+}
+
+var redisAppend = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[2]) or "0") ~= tonumber(ARGV[1]) then
+	return -1
+end
+redis.call("RPUSH", KEYS[1], ARGV[2])
+return redis.call("INCR", KEYS[2])
+`)
+
+var redisEntries = redis.NewScript(`
+local base = tonumber(redis.call("GET", KEYS[2]) or "0")
+local from = tonumber(ARGV[1])
+if from < base then
+	return false
+end
+return redis.call("LRANGE", KEYS[1], from - base, -1)
+`)
+
+var redisCheckpoint = redis.NewScript(`
+local base = tonumber(redis.call("GET", KEYS[3]) or "0")
+local version = tonumber(ARGV[1])
+if version <= base or version > tonumber(redis.call("GET", KEYS[4]) or "0") then
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[2])
+redis.call("SET", KEYS[3], version)
+redis.call("LTRIM", KEYS[1], version - base, -1)
+return 1
+`)
+
+func (r *redisStateStore) Append(ctx context.Context, prev int64, entry []byte) (int64, error) {
+	v, err := redisAppend.Run(ctx, r.client, []string{r.log, r.version}, prev, entry).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("append state: %w", err)
+	}
+	if v < 0 {
+		return 0, ErrStaleVersion
+	}
+	return v, nil
+}
+
+func (r *redisStateStore) Entries(ctx context.Context, from int64) ([][]byte, error) {
+	raw, err := redisEntries.Run(ctx, r.client, []string{r.log, r.base}, from).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCompacted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state log: %w", err)
+	}
+	out := make([][]byte, len(raw))
+	for i, e := range raw {
+		out[i] = []byte(e)
+	}
+	return out, nil
+}
+
+func (r *redisStateStore) Checkpoint(ctx context.Context, version int64, data []byte) error {
+	if err := redisCheckpoint.Run(ctx, r.client, []string{r.log, r.checkpoint, r.base, r.version}, version, data).Err(); err != nil {
+		return fmt.Errorf("checkpoint state: %w", err)
+	}
+	return nil
+}
+
+func (r *redisStateStore) Load(ctx context.Context) ([]byte, int64, error) {
+	var data *redis.StringCmd
+	var version *redis.StringCmd
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		data = p.Get(ctx, r.checkpoint)
+		version = p.Get(ctx, r.base)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("load state: %w", err)
+	}
+	v, err := version.Int64()
+	if err != nil {
+		return nil, 0, fmt.Errorf("load state version: %w", err)
+	}
+	b, err := data.Bytes()
+	if err != nil {
+		return nil, 0, fmt.Errorf("load state: %w", err)
+	}
+	return b, v, nil
+}
+
+func (r *redisStateStore) Version(ctx context.Context) (int64, error) {
+	v, err := r.client.Get(ctx, r.version).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read state version: %w", err)
+	}
+	return v, nil
+}
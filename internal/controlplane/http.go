@@ -0,0 +1,156 @@
+package controlplane
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/your-org/fluxroute/internal/security"
+)
+
+// api carries the shared routing and auth state for control-plane handlers.
+type api struct {
+	svc           *Service
+	mux           *http.ServeMux
+	apiKey        string
+	trustProxy    bool
+	insecureLocal bool
+}
+
+func newAPI(s *Service) *api {
+	return &api{
+		svc:           s,
+		mux:           http.NewServeMux(),
+		apiKey:        strings.TrimSpace(os.Getenv("CONTROLPLANE_API_KEY")),
+		trustProxy:    strings.EqualFold(strings.TrimSpace(os.Getenv("CONTROLPLANE_TRUST_PROXY")), "true"),
+		insecureLocal: strings.EqualFold(strings.TrimSpace(os.Getenv("CONTROLPLANE_INSECURE_LOCAL")), "true"),
+	}
+}
+
+// register mounts h on path and its /v1 alias. Mutating requests are
+// recorded in the audit trail and every request counts toward the
+// endpoint's availability.
+func (a *api) register(path string, h http.HandlerFunc) {
+	h = a.measured(path, a.audited(h))
+	a.mux.HandleFunc(path, h)
+	a.mux.HandleFunc("/v1"+path, h)
+}
+
+// principal is the authenticated caller of a request.
+type principal struct {
+	keyID    string
+	tenantID string
+	scopes   []Scope
+	role     security.Role
+}
+
+func (p principal) has(scope Scope) bool {
+	for _, sc := range p.scopes {
+		if sc == scope || sc == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate resolves the caller from X-API-Key or a bearer token. The
+// CONTROLPLANE_API_KEY bootstrap key acts as admin; issued keys carry their
+// own scopes and tenant. Without either every request is refused, unless
+// CONTROLPLANE_INSECURE_LOCAL is set: then, for local development only, the
+// X-Role header is trusted until the first key is issued.
+func (a *api) authenticate(w http.ResponseWriter, r *http.Request) (principal, bool) {
+	p, ok := a.resolve(w, r)
+	if ok {
+		rec := auditFrom(r)
+		rec.actor, rec.role, rec.tenantID = p.keyID, p.role.String(), p.tenantID
+	}
+	return p, ok
+}
+
+func (a *api) resolve(w http.ResponseWriter, r *http.Request) (principal, bool) {
+	provided := strings.TrimSpace(r.Header.Get("X-API-Key"))
+	if provided == "" {
+		authz := strings.TrimSpace(r.Header.Get("Authorization"))
+		const prefix = "Bearer "
+		if strings.HasPrefix(authz, prefix) {
+			provided = strings.TrimSpace(strings.TrimPrefix(authz, prefix))
+		}
+	}
+	if provided == "" && a.insecureLocal && a.apiKey == "" && !a.svc.hasKeys() {
+		role, err := security.ParseRole(r.Header.Get("X-Role"))
+		if err != nil {
+			role = security.RoleViewer
+		}
+		return principal{keyID: "anonymous", scopes: scopesForRole(role), role: role}, true
+	}
+	if provided == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return principal{}, false
+	}
+	if a.apiKey != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(a.apiKey)) == 1 {
+		return principal{keyID: "bootstrap", scopes: []Scope{ScopeAdmin}, role: security.RoleAdmin}, true
+	}
+	key, err := a.svc.authenticateKey(provided)
+	if err != nil {
+		msg := "unauthorized"
+		if errors.Is(err, ErrAPIKeyExpired) || errors.Is(err, ErrAPIKeyRevoked) {
+			msg = err.Error()
+		}
+		http.Error(w, msg, http.StatusUnauthorized)
+		return principal{}, false
+	}
+	return principal{keyID: key.ID, tenantID: key.TenantID, scopes: key.Scopes, role: roleForScopes(key.Scopes)}, true
+}
+
+// scopesForRole maps a legacy X-Role header onto scopes.
+func scopesForRole(role security.Role) []Scope {
+	switch role {
+	case security.RoleAdmin:
+		return []Scope{ScopeAdmin}
+	case security.RoleOperator:
+		return []Scope{ScopeUsageRead, ScopeUsageWrite}
+	default:
+		return []Scope{ScopeUsageRead}
+	}
+}
+
+func (a *api) requireScope(w http.ResponseWriter, p principal, scope Scope) bool {
+	if !p.has(scope) {
+		http.Error(w, fmt.Sprintf("rbac denied: %s scope required", scope), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// tenantScope returns the tenant a request may act on. Keys bound to a
+// tenant are pinned to it: an empty request defaults to that tenant and any
+// other tenant is refused.
+func (a *api) tenantScope(w http.ResponseWriter, p principal, requested string) (string, bool) {
+	requested = strings.TrimSpace(requested)
+	if p.tenantID == "" {
+		return requested, true
+	}
+	if requested != "" && requested != p.tenantID {
+		http.Error(w, fmt.Sprintf("rbac denied: api key is scoped to tenant %q", p.tenantID), http.StatusForbidden)
+		return "", false
+	}
+	return p.tenantID, true
+}
+
+// requireGlobal refuses tenant-bound keys on endpoints spanning all tenants.
+func (a *api) requireGlobal(w http.ResponseWriter, p principal) bool {
+	if p.tenantID != "" {
+		http.Error(w, fmt.Sprintf("rbac denied: api key is scoped to tenant %q", p.tenantID), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
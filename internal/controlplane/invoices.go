@@ -0,0 +1,430 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrInvoiceExists   = errors.New("invoice already exists for period")
+)
+
+// SetTaxHook installs the tax calculation applied when invoices are finalized.
+func (s *Service) SetTaxHook(fn billing.TaxFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.taxHook = fn
+}
+
+// PreviewInvoice rates a tenant's usage in [start, end) without storing a document.
+func (s *Service) PreviewInvoice(tenantID string, start time.Time, end time.Time) (billing.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rateLocked(tenantID, start, end)
+}
+
+func (s *Service) rateLocked(tenantID string, start time.Time, end time.Time) (billing.Invoice, error) {
+	records := make([]billing.UsageRecord, 0)
+	for _, ev := range s.usageEvent {
+		if ev.TenantID == tenantID {
+			records = append(records, ev.record())
+		}
+	}
+	inv, err := s.catalog.Invoice(tenantID, start, end, records)
+	if err != nil {
+		return billing.Invoice{}, err
+	}
+	s.applyCreditsLocked(&inv)
+	return inv, nil
+}
+
+// accrualLocked returns the running charges of the tenant's usage month
+// starting at start. The month is rated from the event log once, and again
+// after prices change; in between RecordUsage keeps it current event by
+// event.
+func (s *Service) accrualLocked(tenantID string, start time.Time) (*billing.Accrual, error) {
+	if a, ok := s.accruals[tenantID][start.Unix()]; ok {
+		return a, nil
+	}
+	a := s.catalog.NewAccrual(tenantID, start, start.AddDate(0, 1, 0))
+	for _, ev := range s.usageEvent {
+		if ev.TenantID != tenantID {
+			continue
+		}
+		if _, err := s.catalog.Accrue(a, ev.record()); err != nil {
+			return nil, err
+		}
+	}
+	if s.accruals[tenantID] == nil {
+		s.accruals[tenantID] = make(map[int64]*billing.Accrual)
+	}
+	s.accruals[tenantID][start.Unix()] = a
+	return a, nil
+}
+
+// accrueLocked prices a newly recorded event into its month's accrual. A
+// month not rated yet picks the event up from the log when first needed.
+func (s *Service) accrueLocked(ev usageEvent) {
+	start := usageMonth(ev.OccurredAt).Unix()
+	a, ok := s.accruals[ev.TenantID][start]
+	if !ok {
+		return
+	}
+	if _, err := s.catalog.Accrue(a, ev.record()); err != nil {
+		delete(s.accruals[ev.TenantID], start)
+	}
+}
+
+// monthSpendLocked is the month-to-date invoice subtotal as accrued: usage
+// charges topped up to the plan minimum, less prepaid credit applied.
+func (s *Service) monthSpendLocked(tenantID string, start time.Time, end time.Time) (billing.Money, error) {
+	a, err := s.accrualLocked(tenantID, start)
+	if err != nil {
+		return billing.Money{}, err
+	}
+	subtotal := max(a.Usage.Round(a.Currency.MinorUnits()), s.catalog.PlanAt(tenantID, end.Add(-time.Nanosecond)).MinimumMonthly)
+	if applied := min(s.credits.Applied(tenantID, a.Currency, start, end), subtotal); applied > 0 {
+		subtotal -= applied
+	}
+	return billing.NewMoney(subtotal, a.Currency), nil
+}
+
+// usageMonth is the start of the UTC month containing t.
+func usageMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// CreateInvoice stores a draft invoice for a tenant and period. Only one
+// non-void invoice may exist per tenant and period.
+func (s *Service) CreateInvoice(tenantID string, start time.Time, end time.Time) (billing.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return billing.Invoice{}, fmt.Errorf("tenant %q not found", tenantID)
+	}
+	start, end = start.UTC(), end.UTC()
+	for _, existing := range s.invoices {
+		if existing.TenantID == tenantID && existing.Status != billing.StatusVoid &&
+			existing.PeriodStart.Equal(start) && existing.PeriodEnd.Equal(end) {
+			return billing.Invoice{}, fmt.Errorf("%w: %s", ErrInvoiceExists, existing.ID)
+		}
+	}
+
+	inv, err := s.rateLocked(tenantID, start, end)
+	if err != nil {
+		return billing.Invoice{}, err
+	}
+	s.invoiceSeq++
+	inv.ID = fmt.Sprintf("inv_%06d", s.invoiceSeq)
+	inv.CreatedAt = time.Now().UTC()
+	s.invoices[inv.ID] = inv
+	s.changes.touch(recordInvoice, inv.ID)
+	return inv.Clone(), nil
+}
+
+func (s *Service) GetInvoice(id string) (billing.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[id]
+	if !ok {
+		return billing.Invoice{}, fmt.Errorf("%w: %s", ErrInvoiceNotFound, id)
+	}
+	return inv.Clone(), nil
+}
+
+// ListInvoices returns stored invoices filtered by tenant and status, oldest first.
+func (s *Service) ListInvoices(tenantID string, status billing.InvoiceStatus) []billing.Invoice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]billing.Invoice, 0, len(s.invoices))
+	for _, inv := range s.invoices {
+		if tenantID != "" && inv.TenantID != tenantID {
+			continue
+		}
+		if status != "" && inv.Status != status {
+			continue
+		}
+		out = append(out, inv.Clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// FinalizeInvoice re-rates a draft against current usage, applies taxes and locks it.
+func (s *Service) FinalizeInvoice(id string) (billing.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[id]
+	if !ok {
+		return billing.Invoice{}, fmt.Errorf("%w: %s", ErrInvoiceNotFound, id)
+	}
+	if inv.Status != billing.StatusDraft {
+		return billing.Invoice{}, billing.ErrInvoiceImmutable
+	}
+
+	rated, err := s.rateLocked(inv.TenantID, inv.PeriodStart, inv.PeriodEnd)
+	if err != nil {
+		return billing.Invoice{}, err
+	}
+	rated.ID = inv.ID
+	rated.CreatedAt = inv.CreatedAt
+	if err := rated.ApplyTax(s.taxHook); err != nil {
+		return billing.Invoice{}, err
+	}
+	if err := rated.Finalize(time.Now()); err != nil {
+		return billing.Invoice{}, err
+	}
+	s.invoices[id] = rated
+	s.changes.touch(recordInvoice, id)
+	s.publish(webhook.EventInvoiceFinalized, rated.TenantID, rated)
+	return rated.Clone(), nil
+}
+
+func (s *Service) VoidInvoice(id string, reason string) (billing.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[id]
+	if !ok {
+		return billing.Invoice{}, fmt.Errorf("%w: %s", ErrInvoiceNotFound, id)
+	}
+	if err := inv.Void(time.Now(), reason); err != nil {
+		return billing.Invoice{}, err
+	}
+	s.invoices[id] = inv
+	s.changes.touch(recordInvoice, id)
+	return inv.Clone(), nil
+}
+
+func (s *Service) registerInvoiceRoutes(a *api) {
+	a.register("/billing/invoices", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if !a.requireScope(w, p, ScopeUsageRead) {
+				return
+			}
+			q := r.URL.Query()
+			tenantID, ok := a.tenantScope(w, p, q.Get("tenant_id"))
+			if !ok {
+				return
+			}
+			page, pageSize := parsePagination(q.Get("page"), q.Get("page_size"))
+			items := s.ListInvoices(tenantID, billing.InvoiceStatus(strings.TrimSpace(q.Get("status"))))
+			total := len(items)
+			items = paginateInvoices(items, page, pageSize)
+			writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": pageSize})
+		case http.MethodPost:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			var req struct {
+				TenantID string `json:"tenant_id"`
+				Month    string `json:"month"`
+				From     string `json:"from"`
+				To       string `json:"to"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			start, end, err := parsePeriod(req.Month, req.From, req.To)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			auditFrom(r).target("billing/invoices", strings.TrimSpace(req.TenantID))
+			inv, err := s.CreateInvoice(strings.TrimSpace(req.TenantID), start, end)
+			if err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, ErrInvoiceExists) || errors.Is(err, billing.ErrCurrencyMismatch) {
+					status = http.StatusConflict
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			auditFrom(r).target("billing/invoices/"+inv.ID, inv.TenantID)
+			auditFrom(r).change(nil, invoiceAuditView(inv))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(inv)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	a.register("/billing/invoices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		format, err := billing.ParseRenderFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inv, err := s.GetInvoice(r.PathValue("id"))
+		if err == nil && p.tenantID != "" && inv.TenantID != p.tenantID {
+			err = fmt.Errorf("%w: %s", ErrInvoiceNotFound, r.PathValue("id"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeInvoice(w, inv, format)
+	})
+	a.register("/billing/invoices/{id}/finalize", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.requireScope(w, p, ScopeBillingAdmin) {
+			return
+		}
+		before := s.auditInvoice(r, r.PathValue("id"))
+		inv, err := s.FinalizeInvoice(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), invoiceErrorStatus(err))
+			return
+		}
+		auditFrom(r).change(before, invoiceAuditView(inv))
+		writeJSON(w, inv)
+	})
+	a.register("/billing/invoices/{id}/void", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.requireScope(w, p, ScopeBillingAdmin) {
+			return
+		}
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		before := s.auditInvoice(r, r.PathValue("id"))
+		inv, err := s.VoidInvoice(r.PathValue("id"), req.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), invoiceErrorStatus(err))
+			return
+		}
+		auditFrom(r).change(before, invoiceAuditView(inv))
+		writeJSON(w, inv)
+	})
+}
+
+// auditInvoice targets the request's audit record at an invoice and
+// returns the invoice's current state, or nil when it does not exist.
+func (s *Service) auditInvoice(r *http.Request, id string) any {
+	inv, err := s.GetInvoice(id)
+	auditFrom(r).target("billing/invoices/"+id, inv.TenantID)
+	if err != nil {
+		return nil
+	}
+	return invoiceAuditView(inv)
+}
+
+// invoiceAuditView is the part of an invoice recorded in audit events;
+// lines are left out as they follow from usage and the plan.
+func invoiceAuditView(inv billing.Invoice) map[string]any {
+	return map[string]any{
+		"id":           inv.ID,
+		"tenant_id":    inv.TenantID,
+		"status":       inv.Status,
+		"period_start": inv.PeriodStart,
+		"period_end":   inv.PeriodEnd,
+		"total":        inv.Total,
+		"void_reason":  inv.VoidReason,
+	}
+}
+
+func invoiceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvoiceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, billing.ErrInvoiceImmutable), errors.Is(err, billing.ErrInvalidInvoiceStatus),
+		errors.Is(err, billing.ErrCurrencyMismatch):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeInvoice(w http.ResponseWriter, inv billing.Invoice, format billing.RenderFormat) {
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := billing.Render(w, inv, format); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parsePeriod resolves either an explicit [from, to) range or a calendar month.
+func parsePeriod(month string, from string, to string) (time.Time, time.Time, error) {
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if from == "" && to == "" {
+		start, err := parseMonthStart(strings.TrimSpace(month))
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("both from and to are required for a custom period")
+	}
+	start, err := parseEffectiveFrom(from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	end, err := parseEffectiveFrom(to)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("period start must be before end")
+	}
+	return start, end, nil
+}
+
+func paginateInvoices(in []billing.Invoice, page int, pageSize int) []billing.Invoice {
+	start := (page - 1) * pageSize
+	if start >= len(in) {
+		return []billing.Invoice{}
+	}
+	end := start + pageSize
+	if end > len(in) {
+		end = len(in)
+	}
+	return in[start:end]
+}
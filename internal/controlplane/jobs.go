@@ -0,0 +1,172 @@
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+)
+
+// jobConfig schedules the background jobs. With several replicas only the
+// leader runs them.
+type jobConfig struct {
+	webhookInterval time.Duration
+	interval        time.Duration
+	// finalizeAfter is how long after a month ends its invoices are
+	// created and finalized; zero disables monthly finalization.
+	finalizeAfter time.Duration
+	// hourlyRetention is how long hourly rollups are kept; zero keeps them.
+	hourlyRetention time.Duration
+}
+
+func jobConfigFromEnv() jobConfig {
+	return jobConfig{
+		webhookInterval: webhookIntervalFromEnv(),
+		interval:        durationFromEnv("CONTROLPLANE_JOB_INTERVAL", time.Minute),
+		finalizeAfter:   durationFromEnv("CONTROLPLANE_INVOICE_FINALIZE_AFTER", 0),
+		hourlyRetention: durationFromEnv("CONTROLPLANE_HOURLY_ROLLUP_RETENTION", 0),
+	}
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: invalid %s %q; using %s\n", key, raw, fallback)
+		return fallback
+	}
+	return d
+}
+
+// runJobs delivers webhooks and runs maintenance until ctx is done. With HA
+// enabled each pass is committed to the shared log like a write.
+func (s *Service) runJobs(ctx context.Context, cfg jobConfig) {
+	webhooks := time.NewTicker(cfg.webhookInterval)
+	defer webhooks.Stop()
+	maintenance := time.NewTicker(cfg.interval)
+	defer maintenance.Stop()
+	s.runPass(ctx, "maintenance", func() { s.maintain(time.Now(), cfg) })
+	for {
+		// Deliveries run outside the write lock so a slow endpoint does not
+		// hold up writes; the attempts they record go out with the next
+		// commit.
+		res := s.webhooks.Process(ctx)
+		if res.Succeeded+res.Retrying+res.DeadLettered > 0 {
+			s.runPass(ctx, "webhook delivery", func() {})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-webhooks.C:
+		case now := <-maintenance.C:
+			s.runPass(ctx, "maintenance", func() { s.maintain(now, cfg) })
+		}
+	}
+}
+
+func (s *Service) runPass(ctx context.Context, name string, pass func()) {
+	if err := s.write(ctx, pass); err != nil && ctx.Err() == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: commit %s: %v\n", name, err)
+	}
+}
+
+// maintain runs the periodic jobs.
+func (s *Service) maintain(now time.Time, cfg jobConfig) {
+	if cfg.finalizeAfter > 0 {
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if !now.Before(monthStart.Add(cfg.finalizeAfter)) {
+			if _, err := s.FinalizeMonth(monthStart.AddDate(0, -1, 0)); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: monthly invoice finalization: %v\n", err)
+			}
+		}
+	}
+	if cfg.hourlyRetention > 0 {
+		s.CompactRollups(now.Add(-cfg.hourlyRetention))
+	}
+}
+
+// FinalizeMonth creates and finalizes every tenant's invoice for the UTC
+// month starting at month. Tenants whose invoice is already finalized are
+// skipped, so repeated runs are no-ops. It returns the invoices it
+// finalized and the first error encountered.
+func (s *Service) FinalizeMonth(month time.Time) ([]billing.Invoice, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	var out []billing.Invoice
+	var firstErr error
+	for _, tenantID := range s.ListTenants() {
+		id, status := s.invoiceFor(tenantID, start, end)
+		if id == "" {
+			inv, err := s.CreateInvoice(tenantID, start, end)
+			if err != nil {
+				if !errors.Is(err, ErrInvoiceExists) && firstErr == nil {
+					firstErr = fmt.Errorf("tenant %s: %w", tenantID, err)
+				}
+				continue
+			}
+			id, status = inv.ID, inv.Status
+		}
+		if status != billing.StatusDraft {
+			continue
+		}
+		inv, err := s.FinalizeInvoice(id)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("tenant %s: %w", tenantID, err)
+			}
+			continue
+		}
+		out = append(out, inv)
+	}
+	return out, firstErr
+}
+
+func (s *Service) invoiceFor(tenantID string, start time.Time, end time.Time) (string, billing.InvoiceStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, inv := range s.invoices {
+		if inv.TenantID == tenantID && inv.Status != billing.StatusVoid &&
+			inv.PeriodStart.Equal(start) && inv.PeriodEnd.Equal(end) {
+			return inv.ID, inv.Status
+		}
+	}
+	return "", ""
+}
+
+// CompactRollups drops hourly rollups that start before cutoff, rounded down
+// to the hour; day and month rollups are kept. Hourly time series can no
+// longer start before it. It returns the number of buckets removed.
+func (s *Service) CompactRollups(cutoff time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Whole hours only, so the cutoff and what it replicates move hourly.
+	cut := GranularityHour.truncate(cutoff).Unix()
+	if cut > s.hourlyCut {
+		s.changes.compacted(cut)
+	}
+	return s.compactLocked(cut)
+}
+
+func (s *Service) compactLocked(cutoff int64) int {
+	s.hourlyCut = max(s.hourlyCut, cutoff)
+	removed := 0
+	for tenantID, buckets := range s.rollups[GranularityHour] {
+		for b := range buckets {
+			if b.start < cutoff {
+				delete(buckets, b)
+				removed++
+			}
+		}
+		if len(buckets) == 0 {
+			delete(s.rollups[GranularityHour], tenantID)
+		}
+	}
+	return removed
+}
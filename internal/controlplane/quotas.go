@@ -0,0 +1,271 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/quota"
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// SetQuota replaces a tenant's quota limits. An empty list removes them.
+func (s *Service) SetQuota(tenantID string, limits []quota.Limit) error {
+	seen := make(map[quota.Metric]struct{}, len(limits))
+	normalized := make([]quota.Limit, 0, len(limits))
+	for _, l := range limits {
+		metric, err := quota.ParseMetric(string(l.Metric))
+		if err != nil {
+			return err
+		}
+		l.Metric = metric
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		if _, dup := seen[metric]; dup {
+			return fmt.Errorf("duplicate quota metric %q", metric)
+		}
+		seen[metric] = struct{}{}
+		normalized = append(normalized, l)
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].Metric < normalized[j].Metric })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	s.changes.touch(recordQuota, tenantID)
+	if len(normalized) == 0 {
+		delete(s.quotas, tenantID)
+		return nil
+	}
+	s.quotas[tenantID] = normalized
+	return nil
+}
+
+func (s *Service) Quota(tenantID string) ([]quota.Limit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	return append([]quota.Limit{}, s.quotas[tenantID]...), nil
+}
+
+// QuotaStatus evaluates a tenant's limits against usage in the windows
+// containing at. Spend is the month-to-date invoice subtotal, accrued as
+// usage is recorded rather than re-rated on every check. Tenants with
+// prepaid credit also get their credit position.
+func (s *Service) QuotaStatus(tenantID string, at time.Time) (quota.Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return quota.Status{}, fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	return s.quotaStatusLocked(tenantID, at)
+}
+
+func (s *Service) quotaStatusLocked(tenantID string, at time.Time) (quota.Status, error) {
+	limits := s.quotas[tenantID]
+	checks := make([]quota.Check, 0, len(limits))
+	for _, l := range limits {
+		start, end := l.Metric.Window(at)
+		var used billing.Amount
+		var currency billing.Currency
+		switch l.Metric {
+		case quota.InvocationsPerDay, quota.InvocationsPerMonth:
+			used = billing.AmountFromInt(s.windowUsageLocked(tenantID, l.Metric, start).Invocations)
+		case quota.TokensPerDay, quota.TokensPerMonth:
+			row := s.windowUsageLocked(tenantID, l.Metric, start)
+			used = billing.AmountFromInt(row.InputTokens + row.OutputTokens)
+		case quota.SpendPerMonth:
+			spend, err := s.monthSpendLocked(tenantID, start, end)
+			if err != nil {
+				return quota.Status{}, err
+			}
+			used, currency = spend.Amount, spend.Currency
+		}
+		checks = append(checks, quota.Evaluate(l, used, currency, end))
+	}
+	status := quota.NewStatus(tenantID, at, checks)
+	if credits := s.creditsStateLocked(tenantID, at); credits != nil {
+		status = status.WithCredits(*credits)
+	}
+	return status, nil
+}
+
+// creditsStateKey holds the credit state in quotaStatesLocked snapshots.
+const creditsStateKey quota.Metric = "credits"
+
+// quotaStatesLocked snapshots the current state per metric so a usage write
+// can detect threshold crossings. It is nil when the tenant has neither
+// quotas nor credit.
+func (s *Service) quotaStatesLocked(tenantID string) map[quota.Metric]quota.State {
+	if len(s.quotas[tenantID]) == 0 && !s.credits.Has(tenantID) {
+		return nil
+	}
+	status, err := s.quotaStatusLocked(tenantID, time.Now())
+	if err != nil {
+		return nil
+	}
+	out := make(map[quota.Metric]quota.State, len(status.Checks))
+	for _, c := range status.Checks {
+		out[c.Metric] = c.State
+	}
+	if status.Credits != nil {
+		out[creditsStateKey] = status.Credits.State
+	}
+	return out
+}
+
+// publishQuotaCrossingsLocked emits usage.threshold_crossed when a soft
+// threshold is newly reached and quota.exceeded when a hard one is.
+func (s *Service) publishQuotaCrossingsLocked(tenantID string, before map[quota.Metric]quota.State) {
+	if before == nil {
+		return
+	}
+	status, err := s.quotaStatusLocked(tenantID, time.Now())
+	if err != nil {
+		return
+	}
+	for _, c := range status.Checks {
+		prev := before[c.Metric]
+		payload := map[string]any{"tenant_id": tenantID, "check": c}
+		if c.Soft > 0 && prev == quota.StateOK && c.State != quota.StateOK {
+			s.publish(webhook.EventUsageThresholdCrossed, tenantID, payload)
+		}
+		if c.State == quota.StateExceeded && prev != quota.StateExceeded {
+			s.publish(webhook.EventQuotaExceeded, tenantID, payload)
+		}
+	}
+	// A blocking credit account that runs dry stops the tenant like a quota.
+	if c := status.Credits; c != nil && c.State == quota.StateExceeded && before[creditsStateKey] != quota.StateExceeded {
+		s.publish(webhook.EventQuotaExceeded, tenantID, map[string]any{"tenant_id": tenantID, "credits": c})
+	}
+}
+
+// windowUsageLocked sums the tenant's day or month rollup bucket starting at start.
+func (s *Service) windowUsageLocked(tenantID string, metric quota.Metric, start time.Time) usageRow {
+	g := GranularityMonth
+	if metric == quota.InvocationsPerDay || metric == quota.TokensPerDay {
+		g = GranularityDay
+	}
+	var total usageRow
+	for key, row := range s.rollups[g][tenantID] {
+		if key.start == start.Unix() {
+			total.Invocations += row.Invocations
+			total.InputTokens += row.InputTokens
+			total.OutputTokens += row.OutputTokens
+		}
+	}
+	return total
+}
+
+func (s *Service) registerQuotaRoutes(a *api) {
+	a.register("/quotas/{tenant_id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		tenantID, ok := a.tenantScope(w, p, r.PathValue("tenant_id"))
+		if !ok {
+			return
+		}
+		auditFrom(r).target("quotas/"+tenantID, tenantID)
+		switch r.Method {
+		case http.MethodGet:
+			if !a.requireScope(w, p, ScopeUsageRead) {
+				return
+			}
+		case http.MethodPut:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			var req struct {
+				Limits []quota.Limit `json:"limits"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			before, _ := s.Quota(tenantID)
+			if err := s.SetQuota(tenantID, req.Limits); err != nil {
+				http.Error(w, err.Error(), quotaErrorStatus(err))
+				return
+			}
+			after, _ := s.Quota(tenantID)
+			auditFrom(r).change(before, after)
+		case http.MethodDelete:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			before, _ := s.Quota(tenantID)
+			if err := s.SetQuota(tenantID, nil); err != nil {
+				http.Error(w, err.Error(), quotaErrorStatus(err))
+				return
+			}
+			auditFrom(r).change(before, nil)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		limits, err := s.Quota(tenantID)
+		if err != nil {
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		writeJSON(w, map[string]any{"tenant_id": tenantID, "limits": limits})
+	})
+	a.register("/quotas/{tenant_id}/status", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		at := time.Now().UTC()
+		if raw := strings.TrimSpace(r.URL.Query().Get("at")); raw != "" {
+			var err error
+			if at, err = parseEffectiveFrom(raw); err != nil {
+				http.Error(w, "invalid at: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		tenantID, ok := a.tenantScope(w, p, r.PathValue("tenant_id"))
+		if !ok {
+			return
+		}
+		status, err := s.QuotaStatus(tenantID, at)
+		if err != nil {
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		writeJSON(w, status)
+	})
+}
+
+func quotaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTenantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, billing.ErrCurrencyMismatch):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
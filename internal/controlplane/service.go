@@ -1,11 +1,10 @@
 package controlplane
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -17,52 +16,140 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/your-org/fluxroute/internal/audit"
 	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/quota"
 	"github.com/your-org/fluxroute/internal/security"
+	"github.com/your-org/fluxroute/internal/slo"
+	"github.com/your-org/fluxroute/internal/webhook"
 )
 
+// ErrDuplicateUsageEvent reports a usage event ID that was already recorded.
+var ErrDuplicateUsageEvent = errors.New("duplicate usage event")
+
+// UsageInput is one metered usage report for a tenant. EventID, when set,
+// makes the report idempotent: a repeated ID is acknowledged without being
+// counted again.
+type UsageInput struct {
+	EventID      string    `json:"event_id,omitempty"`
+	TenantID     string    `json:"tenant_id"`
+	Namespace    string    `json:"namespace,omitempty"`
+	RunID        string    `json:"run_id,omitempty"`
+	Agent        string    `json:"agent,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Invocations  int64     `json:"invocations"`
+	InputTokens  int64     `json:"input_tokens,omitempty"`
+	OutputTokens int64     `json:"output_tokens,omitempty"`
+	OccurredAt   time.Time `json:"occurred_at,omitempty"`
+}
+
 type usageEvent struct {
-	TenantID    string
-	Invocations int64
-	OccurredAt  time.Time
+	EventID      string
+	TenantID     string
+	Namespace    string
+	RunID        string
+	Agent        string
+	Model        string
+	Invocations  int64
+	InputTokens  int64
+	OutputTokens int64
+	OccurredAt   time.Time
 }
 
 type usageRow struct {
-	TenantID    string `json:"tenant_id"`
-	Invocations int64  `json:"invocations"`
+	TenantID     string `json:"tenant_id"`
+	Invocations  int64  `json:"invocations"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
 }
 
 type billSummaryRow struct {
-	TenantID    string `json:"tenant_id"`
-	Invocations int64  `json:"invocations"`
+	TenantID     string        `json:"tenant_id"`
+	Invocations  int64         `json:"invocations"`
+	InputTokens  int64         `json:"input_tokens"`
+	OutputTokens int64         `json:"output_tokens"`
+	Amount       billing.Money `json:"amount"`
+}
+
+func (ev usageEvent) record() billing.UsageRecord {
+	return billing.UsageRecord{
+		Model:        ev.Model,
+		Invocations:  ev.Invocations,
+		InputTokens:  ev.InputTokens,
+		OutputTokens: ev.OutputTokens,
+		OccurredAt:   ev.OccurredAt,
+	}
+}
+
+func (r *usageRow) add(ev usageEvent) {
+	r.Invocations += ev.Invocations
+	r.InputTokens += ev.InputTokens
+	r.OutputTokens += ev.OutputTokens
 }
 
 type Service struct {
 	mu         sync.Mutex
-	tenants    map[string]struct{}
-	usage      map[string]int64
+	tenants    map[string]*Tenant
+	usage      map[string]usageRow
 	usageEvent []usageEvent
-	rate       billing.RateCard
+	eventIDs   map[string]struct{}
+	rollups    rollups
+	// hourlyCut is the unix time before which hourly rollups were compacted.
+	hourlyCut  int64
+	catalog    *billing.Catalog
+	invoices   map[string]billing.Invoice
+	invoiceSeq int64
+	taxHook    billing.TaxFunc
+	quotas     map[string][]quota.Limit
+	credits    *billing.CreditLedger
+	charged    map[string]map[int64]billing.Amount
+	accruals   map[string]map[int64]*billing.Accrual
+	webhooks   *webhook.Dispatcher
+	apiKeys    map[string]*APIKey
+	audit      *audit.Trail
+	endpoints  *slo.Tracker
+	runs       *slo.Tracker
+	runIDs     map[string]time.Time
+	runsPruned time.Time
+	objective  float64
+	changes    *changeSet
+	ha         *haState
 	started    time.Time
 	reqs       int64
 }
 
+// defaultRate prices the default plan at 1 USD per 1000 invocations.
+func defaultRate() billing.RateCard {
+	rate, _ := billing.NewRateCard(billing.NewMoney(billing.MustParseAmount("1"), billing.USD))
+	return rate
+}
+
 func NewService() *Service {
-	rate, _ := billing.NewRateCard(1.0)
-	return &Service{tenants: make(map[string]struct{}), usage: make(map[string]int64), rate: rate, started: time.Now()}
+	return &Service{
+		tenants:   make(map[string]*Tenant),
+		usage:     make(map[string]usageRow),
+		eventIDs:  make(map[string]struct{}),
+		rollups:   newRollups(),
+		catalog:   billing.NewCatalog(defaultRate()),
+		invoices:  make(map[string]billing.Invoice),
+		quotas:    make(map[string][]quota.Limit),
+		credits:   billing.NewCreditLedger(),
+		charged:   make(map[string]map[int64]billing.Amount),
+		accruals:  make(map[string]map[int64]*billing.Accrual),
+		webhooks:  webhook.NewDispatcher(webhookConfigFromEnv()),
+		apiKeys:   make(map[string]*APIKey),
+		audit:     audit.NewTrail(audit.NewLogger(strings.TrimSpace(os.Getenv("CONTROLPLANE_AUDIT_LOG_PATH"))), 0),
+		endpoints: slo.NewTracker(),
+		runs:      slo.NewTracker(),
+		runIDs:    make(map[string]time.Time),
+		objective: sloObjectiveFromEnv(),
+		started:   time.Now(),
+	}
 }
 
 func (s *Service) AddTenant(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if id == "" {
-		return fmt.Errorf("tenant id is empty")
-	}
-	if _, exists := s.tenants[id]; exists {
-		return fmt.Errorf("tenant %q already exists", id)
-	}
-	s.tenants[id] = struct{}{}
-	return nil
+	_, err := s.CreateTenant(id, nil)
+	return err
 }
 
 func (s *Service) ListTenants() []string {
@@ -81,57 +168,183 @@ func (s *Service) AddUsage(tenantID string, invocations int64) error {
 }
 
 func (s *Service) AddUsageAt(tenantID string, invocations int64, at time.Time) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if tenantID == "" {
+	return s.RecordUsage(UsageInput{TenantID: tenantID, Invocations: invocations, OccurredAt: at})
+}
+
+// RecordUsage stores a metered usage event. OccurredAt defaults to now.
+func (s *Service) RecordUsage(in UsageInput) error {
+	if in.TenantID == "" {
 		return fmt.Errorf("tenant id is empty")
 	}
-	if invocations <= 0 {
+	if in.Invocations <= 0 {
 		return fmt.Errorf("invocations must be > 0")
 	}
-	if _, ok := s.tenants[tenantID]; !ok {
-		return fmt.Errorf("tenant %q not found", tenantID)
+	if in.InputTokens < 0 || in.OutputTokens < 0 {
+		return fmt.Errorf("token counts must be >= 0")
+	}
+	if in.OccurredAt.IsZero() {
+		in.OccurredAt = time.Now()
 	}
-	s.usage[tenantID] += invocations
-	s.usageEvent = append(s.usageEvent, usageEvent{TenantID: tenantID, Invocations: invocations, OccurredAt: at.UTC()})
+
+	in.EventID = strings.TrimSpace(in.EventID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in.EventID != "" {
+		if _, seen := s.eventIDs[in.EventID]; seen {
+			return fmt.Errorf("%w: %s", ErrDuplicateUsageEvent, in.EventID)
+		}
+	}
+	if _, ok := s.tenants[in.TenantID]; !ok {
+		return fmt.Errorf("tenant %q not found", in.TenantID)
+	}
+	before := s.quotaStatesLocked(in.TenantID)
+	ev := usageEvent{
+		EventID:      in.EventID,
+		TenantID:     in.TenantID,
+		Namespace:    strings.TrimSpace(in.Namespace),
+		RunID:        strings.TrimSpace(in.RunID),
+		Agent:        strings.TrimSpace(in.Agent),
+		Model:        strings.TrimSpace(in.Model),
+		Invocations:  in.Invocations,
+		InputTokens:  in.InputTokens,
+		OutputTokens: in.OutputTokens,
+		OccurredAt:   in.OccurredAt.UTC(),
+	}
+	s.addUsageLocked(ev)
+	s.drawCreditsLocked(in.TenantID, ev.OccurredAt)
+	s.publishQuotaCrossingsLocked(in.TenantID, before)
 	return nil
 }
 
+// addUsageLocked counts ev toward the tenant's totals, rollups and accrued
+// charges.
+func (s *Service) addUsageLocked(ev usageEvent) {
+	row := s.usage[ev.TenantID]
+	row.TenantID = ev.TenantID
+	row.add(ev)
+	s.usage[ev.TenantID] = row
+	s.usageEvent = append(s.usageEvent, ev)
+	s.rollups.add(ev)
+	s.accrueLocked(ev)
+	if ev.EventID != "" {
+		s.eventIDs[ev.EventID] = struct{}{}
+	}
+}
+
 func (s *Service) Usage(tenantID string) int64 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.usage[tenantID]
+	return s.usage[tenantID].Invocations
+}
+
+// UsageByModel returns all-time meter totals for a tenant keyed by model ("" for unattributed usage).
+func (s *Service) UsageByModel(tenantID string) map[string]usageRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]usageRow)
+	for _, ev := range s.usageEvent {
+		if ev.TenantID != tenantID {
+			continue
+		}
+		row := out[ev.Model]
+		row.TenantID = tenantID
+		row.add(ev)
+		out[ev.Model] = row
+	}
+	return out
+}
+
+// usageTotals returns a tenant's lifetime usage counters.
+func (s *Service) usageTotals(tenantID string) usageRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row := s.usage[tenantID]
+	row.TenantID = tenantID
+	return row
 }
 
 func (s *Service) UsageRows(query string) []usageRow {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	rows := make([]usageRow, 0, len(s.usage))
-	for tenantID, invocations := range s.usage {
+	for tenantID, row := range s.usage {
 		if query != "" && !strings.Contains(strings.ToLower(tenantID), strings.ToLower(query)) {
 			continue
 		}
-		rows = append(rows, usageRow{TenantID: tenantID, Invocations: invocations})
+		rows = append(rows, row)
 	}
 	sort.Slice(rows, func(i, j int) bool { return rows[i].TenantID < rows[j].TenantID })
 	return rows
 }
 
-func (s *Service) SetRate(usdPerThousand float64) error {
-	rate, err := billing.NewRateCard(usdPerThousand)
+// SetRate replaces the default plan price per 1000 invocations.
+func (s *Service) SetRate(perThousand billing.Money) error {
+	rate, err := billing.NewRateCard(perThousand)
 	if err != nil {
 		return err
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.rate = rate
+	s.catalog.Default = rate
+	s.changes.touchCatalog()
+	clear(s.accruals)
+	return nil
+}
+
+func (s *Service) Rate() billing.RateCard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.catalog.Default
+}
+
+func (s *Service) UpsertPlan(plan billing.PricePlan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.catalog.UpsertPlan(plan); err != nil {
+		return err
+	}
+	s.changes.touchCatalog()
+	clear(s.accruals)
+	return nil
+}
+
+// plan returns a stored plan, or nil when id is unknown.
+func (s *Service) plan(id string) *billing.PricePlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.catalog.Plan(id)
+	if !ok {
+		return nil
+	}
+	return &p
+}
+
+func (s *Service) Plans() []billing.PricePlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.catalog.Plans()
+}
+
+// AssignPlan moves a tenant onto a plan from effectiveFrom onwards.
+func (s *Service) AssignPlan(tenantID string, planID string, effectiveFrom time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[tenantID]; !ok {
+		return fmt.Errorf("tenant %q not found", tenantID)
+	}
+	if err := s.catalog.Assign(billing.Assignment{TenantID: tenantID, PlanID: planID, EffectiveFrom: effectiveFrom}); err != nil {
+		return err
+	}
+	s.changes.touchCatalog()
+	delete(s.accruals, tenantID)
 	return nil
 }
 
-func (s *Service) Invoice(tenantID string) billing.Invoice {
+func (s *Service) PlanAssignments(tenantID string) []billing.Assignment {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.rate.Invoice(tenantID, s.usage[tenantID])
+	return s.catalog.Assignments(tenantID)
 }
 
 func (s *Service) MonthlyUsageRows(month string) ([]billSummaryRow, string, error) {
@@ -144,89 +357,49 @@ func (s *Service) MonthlyUsageRows(month string) ([]billSummaryRow, string, erro
 	}
 	monthEnd := monthStart.AddDate(0, 1, 0)
 
-	totals := map[string]int64{}
+	totals := map[string]usageRow{}
 	for _, ev := range s.usageEvent {
 		if !ev.OccurredAt.Before(monthStart) && ev.OccurredAt.Before(monthEnd) {
-			totals[ev.TenantID] += ev.Invocations
+			row := totals[ev.TenantID]
+			row.add(ev)
+			totals[ev.TenantID] = row
 		}
 	}
 
 	rows := make([]billSummaryRow, 0, len(totals))
-	for tenantID, invocations := range totals {
-		rows = append(rows, billSummaryRow{TenantID: tenantID, Invocations: invocations})
+	for tenantID, t := range totals {
+		inv, err := s.rateLocked(tenantID, monthStart, monthEnd)
+		if err != nil {
+			return nil, "", err
+		}
+		rows = append(rows, billSummaryRow{
+			TenantID:     tenantID,
+			Invocations:  t.Invocations,
+			InputTokens:  t.InputTokens,
+			OutputTokens: t.OutputTokens,
+			Amount:       inv.Subtotal,
+		})
 	}
 	sort.Slice(rows, func(i, j int) bool { return rows[i].TenantID < rows[j].TenantID })
 	return rows, monthStart.Format("2006-01"), nil
 }
 
 func (s *Service) Handler() http.Handler {
-	policy := security.DefaultPolicy()
-	apiKey := strings.TrimSpace(os.Getenv("CONTROLPLANE_API_KEY"))
-
-	requireAPIKey := func(w http.ResponseWriter, r *http.Request) bool {
-		if apiKey == "" {
-			return true
-		}
-		provided := strings.TrimSpace(r.Header.Get("X-API-Key"))
-		if provided == "" {
-			authz := strings.TrimSpace(r.Header.Get("Authorization"))
-			const prefix = "Bearer "
-			if strings.HasPrefix(authz, prefix) {
-				provided = strings.TrimSpace(strings.TrimPrefix(authz, prefix))
-			}
-		}
-		if provided != apiKey {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return false
-		}
-		return true
-	}
-
-	requireAdmin := func(w http.ResponseWriter, r *http.Request) bool {
-		role, err := security.ParseRole(r.Header.Get("X-Role"))
-		if err != nil {
-			role = security.RoleViewer
-		}
-		if !policy.IsAllowed(role, security.ActionAdmin) {
-			http.Error(w, "rbac denied", http.StatusForbidden)
-			return false
-		}
-		return true
-	}
-
-	writeJSON := func(w http.ResponseWriter, v any) {
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(v)
-	}
-
-	register := func(mux *http.ServeMux, path string, h http.HandlerFunc) {
-		mux.HandleFunc(path, h)
-		mux.HandleFunc("/v1"+path, h)
-	}
-
-	mux := http.NewServeMux()
-	register(mux, "/healthz", func(w http.ResponseWriter, _ *http.Request) {
+	a := newAPI(s)
+	a.register("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
-	register(mux, "/readyz", func(w http.ResponseWriter, _ *http.Request) {
+	a.register("/readyz", func(w http.ResponseWriter, _ *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ready"))
 	})
-	register(mux, "/sla", func(w http.ResponseWriter, _ *http.Request) {
-		atomic.AddInt64(&s.reqs, 1)
-		uptime := int64(time.Since(s.started).Seconds())
-		writeJSON(w, map[string]any{
-			"uptime_seconds": uptime,
-			"total_requests": atomic.LoadInt64(&s.reqs),
-			"slo_target":     "99.9%",
-		})
-	})
-	register(mux, "/tenants", func(w http.ResponseWriter, r *http.Request) {
+	a.register("/tenants", func(w http.ResponseWriter, r *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
-		if !requireAPIKey(w, r) {
+		p, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
 		switch r.Method {
@@ -239,42 +412,73 @@ func (s *Service) Handler() http.Handler {
 				if q != "" && !strings.Contains(strings.ToLower(id), strings.ToLower(q)) {
 					continue
 				}
+				if p.tenantID != "" && id != p.tenantID {
+					continue
+				}
 				filtered = append(filtered, id)
 			}
 			total := len(filtered)
 			filtered = paginateStrings(filtered, page, pageSize)
 			writeJSON(w, map[string]any{"tenants": filtered, "total": total, "page": page, "page_size": pageSize})
 		case http.MethodPost:
-			if !requireAdmin(w, r) {
+			if !a.requireScope(w, p, ScopeAdmin) {
 				return
 			}
 			var req struct {
-				ID string `json:"id"`
+				ID         string            `json:"id"`
+				Attributes map[string]string `json:"attributes"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if err := s.AddTenant(req.ID); err != nil {
+			auditFrom(r).target("tenants/"+req.ID, req.ID)
+			t, err := s.CreateTenant(req.ID, req.Attributes)
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			auditFrom(r).change(nil, t)
 			w.WriteHeader(http.StatusCreated)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	register(mux, "/usage", func(w http.ResponseWriter, r *http.Request) {
+	a.register("/usage", func(w http.ResponseWriter, r *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
-		if !requireAPIKey(w, r) {
+		p, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
 		switch r.Method {
 		case http.MethodGet:
-			tenantID := strings.TrimSpace(r.URL.Query().Get("tenant_id"))
+			if !a.requireScope(w, p, ScopeUsageRead) {
+				return
+			}
+			tenantID, ok := a.tenantScope(w, p, r.URL.Query().Get("tenant_id"))
+			if !ok {
+				return
+			}
 			if tenantID != "" {
-				writeJSON(w, map[string]any{"tenant_id": tenantID, "invocations": s.Usage(tenantID)})
+				byModel := s.UsageByModel(tenantID)
+				total := usageRow{TenantID: tenantID}
+				models := make(map[string]usageRow, len(byModel))
+				for model, row := range byModel {
+					total.Invocations += row.Invocations
+					total.InputTokens += row.InputTokens
+					total.OutputTokens += row.OutputTokens
+					if model != "" {
+						models[model] = row
+					}
+				}
+				writeJSON(w, map[string]any{
+					"tenant_id":     tenantID,
+					"invocations":   total.Invocations,
+					"input_tokens":  total.InputTokens,
+					"output_tokens": total.OutputTokens,
+					"by_model":      models,
+				})
 				return
 			}
 			q := strings.TrimSpace(r.URL.Query().Get("q"))
@@ -284,84 +488,196 @@ func (s *Service) Handler() http.Handler {
 			rows = paginateUsageRows(rows, page, pageSize)
 			writeJSON(w, map[string]any{"items": rows, "total": total, "page": page, "page_size": pageSize})
 		case http.MethodPost:
-			if !requireAdmin(w, r) {
+			if !a.requireScope(w, p, ScopeUsageWrite) {
 				return
 			}
-			var req struct {
-				TenantID    string `json:"tenant_id"`
-				Invocations int64  `json:"invocations"`
-			}
+			var req UsageInput
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if err := s.AddUsage(req.TenantID, req.Invocations); err != nil {
+			if req.TenantID, ok = a.tenantScope(w, p, req.TenantID); !ok {
+				return
+			}
+			rec := auditFrom(r)
+			rec.target("usage/"+req.TenantID, req.TenantID)
+			before := s.usageTotals(req.TenantID)
+			if err := s.RecordUsage(req); err != nil {
+				if errors.Is(err, ErrDuplicateUsageEvent) {
+					writeJSON(w, map[string]any{"event_id": req.EventID, "duplicate": true})
+					return
+				}
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			rec.change(before, s.usageTotals(req.TenantID))
 			w.WriteHeader(http.StatusAccepted)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	register(mux, "/billing/rates", func(w http.ResponseWriter, r *http.Request) {
+	a.register("/billing/rates", func(w http.ResponseWriter, r *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
-		if !requireAPIKey(w, r) {
+		p, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
 		switch r.Method {
 		case http.MethodGet:
-			s.mu.Lock()
-			rate := s.rate.USDPerThousand
-			s.mu.Unlock()
-			writeJSON(w, map[string]any{"usd_per_thousand": rate})
+			rate := s.Rate().PerThousand
+			writeJSON(w, map[string]any{"per_thousand": rate.Amount, "currency": rate.Currency})
 		case http.MethodPost:
-			if !requireAdmin(w, r) {
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
 				return
 			}
+			// usd_per_thousand is the pre-currency request shape and implies USD.
 			var req struct {
-				USDPerThousand float64 `json:"usd_per_thousand"`
+				PerThousand    *billing.Amount `json:"per_thousand"`
+				Currency       string          `json:"currency"`
+				USDPerThousand *billing.Amount `json:"usd_per_thousand"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if err := s.SetRate(req.USDPerThousand); err != nil {
+			price := billing.Money{Currency: billing.Currency(req.Currency)}
+			switch {
+			case req.PerThousand != nil:
+				price.Amount = *req.PerThousand
+			case req.USDPerThousand != nil:
+				price = billing.NewMoney(*req.USDPerThousand, billing.USD)
+			default:
+				http.Error(w, "per_thousand is required", http.StatusBadRequest)
+				return
+			}
+			auditFrom(r).target("billing/rates", "")
+			before := s.Rate().PerThousand
+			if err := s.SetRate(price); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			auditFrom(r).change(before, s.Rate().PerThousand)
 			w.WriteHeader(http.StatusAccepted)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	register(mux, "/billing/invoice", func(w http.ResponseWriter, r *http.Request) {
+	a.register("/billing/plans", func(w http.ResponseWriter, r *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
-		if !requireAPIKey(w, r) {
+		p, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, map[string]any{"plans": s.Plans()})
+		case http.MethodPost:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			var plan billing.PricePlan
+			if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			auditFrom(r).target("billing/plans/"+plan.ID, "")
+			before := s.plan(plan.ID)
+			if err := s.UpsertPlan(plan); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			auditFrom(r).change(before, s.plan(plan.ID))
+			w.WriteHeader(http.StatusAccepted)
+		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	a.register("/billing/plans/assignments", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
-		tenantID := strings.TrimSpace(r.URL.Query().Get("tenant_id"))
-		invoice := s.Invoice(tenantID)
-		if strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("format")), "csv") {
-			csvBytes, err := invoiceCSV(invoice)
+		switch r.Method {
+		case http.MethodGet:
+			if !a.requireScope(w, p, ScopeUsageRead) {
+				return
+			}
+			tenantID, ok := a.tenantScope(w, p, r.URL.Query().Get("tenant_id"))
+			if !ok {
+				return
+			}
+			if tenantID == "" {
+				http.Error(w, "tenant_id is required", http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, map[string]any{"tenant_id": tenantID, "assignments": s.PlanAssignments(tenantID)})
+		case http.MethodPost:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			var req struct {
+				TenantID      string `json:"tenant_id"`
+				PlanID        string `json:"plan_id"`
+				EffectiveFrom string `json:"effective_from"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			effectiveFrom, err := parseEffectiveFrom(req.EffectiveFrom)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, "invalid effective_from: "+err.Error(), http.StatusBadRequest)
 				return
 			}
-			w.Header().Set("Content-Type", "text/csv")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write(csvBytes)
+			auditFrom(r).target("billing/plans/assignments/"+req.TenantID, req.TenantID)
+			before := s.PlanAssignments(req.TenantID)
+			if err := s.AssignPlan(req.TenantID, req.PlanID, effectiveFrom); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			auditFrom(r).change(before, s.PlanAssignments(req.TenantID))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	a.register("/billing/invoice", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		format, err := billing.ParseRenderFormat(q.Get("format"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		writeJSON(w, invoice)
+		start, end, err := parsePeriod(q.Get("month"), q.Get("from"), q.Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tenantID, ok := a.tenantScope(w, p, q.Get("tenant_id"))
+		if !ok {
+			return
+		}
+		inv, err := s.PreviewInvoice(tenantID, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeInvoice(w, inv, format)
 	})
-	register(mux, "/billing/summary", func(w http.ResponseWriter, r *http.Request) {
+	a.register("/billing/summary", func(w http.ResponseWriter, r *http.Request) {
 		atomic.AddInt64(&s.reqs, 1)
-		if !requireAPIKey(w, r) {
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) || !a.requireGlobal(w, p) {
 			return
 		}
 		if r.Method != http.MethodGet {
@@ -373,17 +689,42 @@ func (s *Service) Handler() http.Handler {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		grand := int64(0)
+		var grand usageRow
+		byCurrency := map[billing.Currency]billing.Amount{}
 		for _, row := range rows {
-			grand += row.Invocations
+			grand.Invocations += row.Invocations
+			grand.InputTokens += row.InputTokens
+			grand.OutputTokens += row.OutputTokens
+			byCurrency[row.Amount.Currency] += row.Amount.Amount
 		}
+		grandAmounts := make([]billing.Money, 0, len(byCurrency))
+		for currency, amount := range byCurrency {
+			grandAmounts = append(grandAmounts, billing.NewMoney(amount, currency))
+		}
+		sort.Slice(grandAmounts, func(i, j int) bool { return grandAmounts[i].Currency < grandAmounts[j].Currency })
 		writeJSON(w, map[string]any{
-			"month":                   month,
-			"totals":                  rows,
-			"grand_total_invocations": grand,
+			"month":                     month,
+			"totals":                    rows,
+			"grand_total_invocations":   grand.Invocations,
+			"grand_total_input_tokens":  grand.InputTokens,
+			"grand_total_output_tokens": grand.OutputTokens,
+			"grand_total_amounts":       grandAmounts,
 		})
 	})
-	return mux
+	s.registerInvoiceRoutes(a)
+	s.registerQuotaRoutes(a)
+	s.registerCreditRoutes(a)
+	s.registerWebhookRoutes(a)
+	s.registerKeyRoutes(a)
+	s.registerAuditRoutes(a)
+	s.registerTimeseriesRoutes(a)
+	s.registerSLARoutes(a)
+	s.registerTenantRoutes(a)
+	s.registerHARoutes(a)
+	if s.ha != nil {
+		return s.replicated(a.mux)
+	}
+	return a.mux
 }
 
 func StartServer(ctx context.Context, addr string, svc *Service) error {
@@ -391,6 +732,7 @@ func StartServer(ctx context.Context, addr string, svc *Service) error {
 		addr = ":8081"
 	}
 	s := &http.Server{Addr: addr, Handler: svc.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go svc.Run(ctx)
 	go func() {
 		<-ctx.Done()
 		_ = s.Shutdown(context.Background())
@@ -413,6 +755,7 @@ func StartServerTLS(ctx context.Context, addr string, svc *Service, certFile str
 	}
 	tlsListener := tls.NewListener(ln, tlsCfg)
 	s := &http.Server{Addr: ln.Addr().String(), Handler: svc.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go svc.Run(ctx)
 	go func() {
 		<-ctx.Done()
 		_ = s.Shutdown(context.Background())
@@ -471,23 +814,17 @@ func parseMonthStart(month string) (time.Time, error) {
 	return t.UTC(), nil
 }
 
-func invoiceCSV(invoice billing.Invoice) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	w := csv.NewWriter(buf)
-	if err := w.Write([]string{"tenant_id", "invocations", "usd_per_thousand", "amount_usd"}); err != nil {
-		return nil, err
+// parseEffectiveFrom accepts RFC3339 or YYYY-MM-DD; empty means now.
+func parseEffectiveFrom(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Now().UTC(), nil
 	}
-	if err := w.Write([]string{
-		invoice.TenantID,
-		strconv.FormatInt(invoice.Invocations, 10),
-		fmt.Sprintf("%.4f", invoice.USDPerThousand),
-		fmt.Sprintf("%.4f", invoice.AmountUSD),
-	}); err != nil {
-		return nil, err
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
 	}
-	w.Flush()
-	if err := w.Error(); err != nil {
-		return nil, err
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t.UTC(), nil
 	}
-	return buf.Bytes(), nil
+	return time.Time{}, fmt.Errorf("expected RFC3339 or YYYY-MM-DD, got %q", raw)
 }
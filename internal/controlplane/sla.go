@@ -0,0 +1,247 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/slo"
+)
+
+// ErrDuplicateRunOutcome reports a run outcome that was already recorded.
+var ErrDuplicateRunOutcome = errors.New("duplicate run outcome")
+
+// ErrStaleRunOutcome reports a run outcome that ended before the SLA
+// window, where it can no longer count and its ID is no longer remembered.
+var ErrStaleRunOutcome = errors.New("run outcome is older than the SLA window")
+
+// RunOutcomeInput is a router's report of how one run ended. A run fails
+// when any of its invocations failed after retries.
+type RunOutcomeInput struct {
+	RunID        string    `json:"run_id"`
+	TenantID     string    `json:"tenant_id"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Succeeded    bool      `json:"succeeded"`
+	Invocations  int64     `json:"invocations,omitempty"`
+	FailedAgents int64     `json:"failed_agents,omitempty"`
+	DurationMS   int64     `json:"duration_ms"`
+	OccurredAt   time.Time `json:"occurred_at,omitempty"`
+}
+
+// sloObjectiveFromEnv reads CONTROLPLANE_SLO_OBJECTIVE, falling back to the
+// default with a warning when it is malformed.
+func sloObjectiveFromEnv() float64 {
+	objective, err := slo.ParseObjective(os.Getenv("CONTROLPLANE_SLO_OBJECTIVE"))
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: CONTROLPLANE_SLO_OBJECTIVE: %v; using %s\n", err, formatObjective(slo.DefaultObjective))
+		return slo.DefaultObjective
+	}
+	return objective
+}
+
+func formatObjective(objective float64) string {
+	return strconv.FormatFloat(objective*100, 'f', -1, 64) + "%"
+}
+
+// Objective is the availability target reports are measured against.
+func (s *Service) Objective() float64 {
+	return s.objective
+}
+
+// EndpointSLA reports each control-plane endpoint, keyed "METHOD /path".
+func (s *Service) EndpointSLA(now time.Time) []slo.Report {
+	keys := s.endpoints.Keys()
+	out := make([]slo.Report, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, s.endpoints.Report(k, s.objective, now))
+	}
+	return out
+}
+
+// RecordRunOutcome counts a router run toward its tenant's availability.
+// Outcomes are idempotent by run ID within slo.Retention; older outcomes
+// are rejected.
+func (s *Service) RecordRunOutcome(in RunOutcomeInput) error {
+	in.RunID = strings.TrimSpace(in.RunID)
+	if in.RunID == "" {
+		return fmt.Errorf("run id is empty")
+	}
+	if in.TenantID == "" {
+		return fmt.Errorf("tenant id is empty")
+	}
+	if in.DurationMS < 0 {
+		return fmt.Errorf("duration_ms must be >= 0")
+	}
+	now := time.Now()
+	if in.OccurredAt.IsZero() {
+		in.OccurredAt = now
+	}
+	if in.OccurredAt.Before(now.Add(-slo.Retention)) {
+		return fmt.Errorf("%w: %s occurred at %s", ErrStaleRunOutcome, in.RunID, in.OccurredAt.UTC().Format(time.RFC3339))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[in.TenantID]; !ok {
+		return fmt.Errorf("%w: %q", ErrTenantNotFound, in.TenantID)
+	}
+	if _, seen := s.runIDs[in.RunID]; seen {
+		return fmt.Errorf("%w: %s", ErrDuplicateRunOutcome, in.RunID)
+	}
+	s.recordRunLocked(in)
+	s.changes.ran(in)
+	return nil
+}
+
+func (s *Service) recordRunLocked(in RunOutcomeInput) {
+	s.pruneRunIDsLocked(time.Now())
+	s.runIDs[in.RunID] = in.OccurredAt
+	s.runs.Record(in.TenantID, in.OccurredAt, time.Duration(in.DurationMS)*time.Millisecond, in.Succeeded)
+}
+
+// pruneRunIDsLocked forgets run IDs that occurred before the SLA window,
+// scanning at most once per slo.Resolution bucket. Outcomes that old are
+// rejected as stale, so they no longer need deduping.
+func (s *Service) pruneRunIDsLocked(now time.Time) {
+	bucket := now.Truncate(slo.Resolution)
+	if !bucket.After(s.runsPruned) {
+		return
+	}
+	s.runsPruned = bucket
+	cutoff := now.Add(-slo.Retention)
+	for id, at := range s.runIDs {
+		if at.Before(cutoff) {
+			delete(s.runIDs, id)
+		}
+	}
+}
+
+// TenantSLA reports a tenant's router runs against objective, or the
+// service objective when it is zero.
+func (s *Service) TenantSLA(tenantID string, objective float64, now time.Time) (slo.Report, error) {
+	s.mu.Lock()
+	_, ok := s.tenants[tenantID]
+	s.mu.Unlock()
+	if !ok {
+		return slo.Report{}, fmt.Errorf("%w: %q", ErrTenantNotFound, tenantID)
+	}
+	if objective == 0 {
+		objective = s.objective
+	}
+	return s.runs.Report(tenantID, objective, now), nil
+}
+
+// slaWriter captures the response status for endpoint accounting.
+type slaWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *slaWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *slaWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// measured counts every request to path toward its endpoint's availability.
+// Only server errors spend the error budget; client errors are the caller's.
+func (a *api) measured(path string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &slaWriter{ResponseWriter: w}
+		h(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		a.svc.endpoints.Record(r.Method+" "+path, start, time.Since(start), sw.status < http.StatusInternalServerError)
+	}
+}
+
+func (s *Service) registerSLARoutes(a *api) {
+	a.register("/sla", func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		now := time.Now()
+		uptime := int64(now.Sub(s.started).Seconds())
+		writeJSON(w, map[string]any{
+			"uptime_seconds": uptime,
+			"total_requests": atomic.LoadInt64(&s.reqs),
+			"slo_target":     formatObjective(s.objective),
+			"objective":      s.objective,
+			"availability":   s.endpoints.Summary("controlplane", s.objective, now),
+			"endpoints":      s.EndpointSLA(now),
+		})
+	})
+	a.register("/sla/runs", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageWrite) {
+			return
+		}
+		var req RunOutcomeInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.TenantID, ok = a.tenantScope(w, p, req.TenantID); !ok {
+			return
+		}
+		auditFrom(r).target("sla/"+req.TenantID, req.TenantID)
+		if err := s.RecordRunOutcome(req); err != nil {
+			if errors.Is(err, ErrDuplicateRunOutcome) {
+				writeJSON(w, map[string]any{"run_id": req.RunID, "duplicate": true})
+				return
+			}
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		auditFrom(r).change(nil, req)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	a.register("/sla/tenants/{tenant_id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		tenantID, ok := a.tenantScope(w, p, r.PathValue("tenant_id"))
+		if !ok {
+			return
+		}
+		var objective float64
+		if raw := r.URL.Query().Get("objective"); raw != "" {
+			var err error
+			if objective, err = slo.ParseObjective(raw); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		report, err := s.TenantSLA(tenantID, objective, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), quotaErrorStatus(err))
+			return
+		}
+		writeJSON(w, report)
+	})
+}
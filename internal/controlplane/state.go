@@ -0,0 +1,181 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/quota"
+	"github.com/your-org/fluxroute/internal/slo"
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+// stateFormat versions the snapshot layout.
+const stateFormat = 1
+
+// apiKeyState keeps the hash that APIKey never serializes.
+type apiKeyState struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+type rollupState struct {
+	Granularity Granularity `json:"granularity"`
+	TenantID    string      `json:"tenant_id"`
+	Start       int64       `json:"start"`
+	Agent       string      `json:"agent,omitempty"`
+	Model       string      `json:"model,omitempty"`
+	Row         usageRow    `json:"row"`
+}
+
+// serviceState is everything a replica needs to serve the API. Endpoint SLA
+// counters and request totals stay per replica.
+type serviceState struct {
+	Format      int                                 `json:"format"`
+	Tenants     map[string]*Tenant                  `json:"tenants"`
+	Usage       map[string]usageRow                 `json:"usage"`
+	UsageEvents []usageEvent                        `json:"usage_events"`
+	EventIDs    []string                            `json:"event_ids"`
+	Rollups     []rollupState                       `json:"rollups"`
+	HourlyCut   int64                               `json:"hourly_cut,omitempty"`
+	Catalog     billing.CatalogState                `json:"catalog"`
+	Invoices    map[string]billing.Invoice          `json:"invoices"`
+	InvoiceSeq  int64                               `json:"invoice_seq"`
+	Quotas      map[string][]quota.Limit            `json:"quotas"`
+	Credits     billing.CreditLedgerState           `json:"credits"`
+	Charged     map[string]map[int64]billing.Amount `json:"charged"`
+	Webhooks    webhook.DispatcherState             `json:"webhooks"`
+	APIKeys     []apiKeyState                       `json:"api_keys"`
+	Audit       audit.TrailState                    `json:"audit"`
+	Runs        slo.TrackerState                    `json:"runs"`
+	RunIDs      map[string]time.Time                `json:"run_ids_at"`
+}
+
+// Snapshot serializes the service's state, including secrets such as API
+// key hashes and webhook signing secrets.
+func (s *Service) Snapshot() ([]byte, error) {
+	s.mu.Lock()
+	st := serviceState{
+		Format:      stateFormat,
+		Tenants:     s.tenants,
+		Usage:       s.usage,
+		UsageEvents: s.usageEvent,
+		EventIDs:    sortedKeys(s.eventIDs),
+		Catalog:     s.catalog.State(),
+		Invoices:    s.invoices,
+		InvoiceSeq:  s.invoiceSeq,
+		Quotas:      s.quotas,
+		Credits:     s.credits.State(),
+		Charged:     s.charged,
+		Webhooks:    s.webhooks.State(),
+		Audit:       s.audit.State(),
+		Runs:        s.runs.State(),
+		RunIDs:      s.runIDs,
+		HourlyCut:   s.hourlyCut,
+	}
+	for g, byTenant := range s.rollups {
+		for tenantID, buckets := range byTenant {
+			for b, row := range buckets {
+				st.Rollups = append(st.Rollups, rollupState{Granularity: g, TenantID: tenantID, Start: b.start, Agent: b.agent, Model: b.model, Row: row})
+			}
+		}
+	}
+	for _, k := range s.apiKeys {
+		st.APIKeys = append(st.APIKeys, apiKeyState{APIKey: k.clone(), Hash: k.Hash})
+	}
+	// Marshal under the lock: the maps above are shared, not copied.
+	b, err := json.Marshal(st)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("encode state: %w", err)
+	}
+	return b, nil
+}
+
+// Restore replaces the service's state with a snapshot.
+func (s *Service) Restore(data []byte) error {
+	var st serviceState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("decode state: %w", err)
+	}
+	if st.Format != stateFormat {
+		return fmt.Errorf("unsupported state format %d", st.Format)
+	}
+	s.restore(st)
+	return nil
+}
+
+// emptyState is the state of a new service.
+func emptyState() serviceState {
+	return serviceState{Format: stateFormat, Catalog: billing.NewCatalog(defaultRate()).State()}
+}
+
+func (s *Service) restore(st serviceState) {
+	r := newRollups()
+	for _, rs := range st.Rollups {
+		byTenant, ok := r[rs.Granularity]
+		if !ok {
+			continue
+		}
+		if byTenant[rs.TenantID] == nil {
+			byTenant[rs.TenantID] = make(map[rollupBucket]usageRow)
+		}
+		byTenant[rs.TenantID][rollupBucket{start: rs.Start, agent: rs.Agent, model: rs.Model}] = rs.Row
+	}
+	keys := make(map[string]*APIKey, len(st.APIKeys))
+	for _, ks := range st.APIKeys {
+		k := ks.APIKey.clone()
+		k.Hash = ks.Hash
+		keys[k.ID] = &k
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tenants = orEmpty(st.Tenants)
+	s.usage = orEmpty(st.Usage)
+	s.usageEvent = st.UsageEvents
+	s.eventIDs = keySet(st.EventIDs)
+	s.rollups = r
+	s.hourlyCut = st.HourlyCut
+	s.catalog.Restore(st.Catalog)
+	s.accruals = make(map[string]map[int64]*billing.Accrual)
+	s.invoices = orEmpty(st.Invoices)
+	s.invoiceSeq = st.InvoiceSeq
+	s.quotas = orEmpty(st.Quotas)
+	s.credits.Restore(st.Credits)
+	s.charged = orEmpty(st.Charged)
+	s.webhooks.Restore(st.Webhooks)
+	s.apiKeys = keys
+	s.audit.Restore(st.Audit)
+	s.runs.Restore(st.Runs)
+	s.runIDs = orEmpty(st.RunIDs)
+	s.runsPruned = time.Time{}
+	s.resetChangesLocked()
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func keySet(keys []string) map[string]struct{} {
+	out := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		out[k] = struct{}{}
+	}
+	return out
+}
+
+func orEmpty[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return make(map[K]V)
+	}
+	return m
+}
@@ -0,0 +1,233 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+// TenantStatus controls whether routers may run for a tenant.
+type TenantStatus string
+
+const (
+	TenantActive    TenantStatus = "active"
+	TenantSuspended TenantStatus = "suspended"
+)
+
+func ParseTenantStatus(raw string) (TenantStatus, error) {
+	switch st := TenantStatus(raw); st {
+	case TenantActive, TenantSuspended:
+		return st, nil
+	default:
+		return "", fmt.Errorf("unknown tenant status %q", raw)
+	}
+}
+
+// Limits on tenant attributes, which routers attach to traces and metric
+// labels.
+const (
+	maxTenantAttributes     = 16
+	maxTenantAttributeValue = 128
+)
+
+var tenantAttributeKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Tenant is a provisioned tenant. Attributes are free-form labels such as
+// tier or region.
+type Tenant struct {
+	ID          string            `json:"id"`
+	Status      TenantStatus      `json:"status"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	SuspendedAt *time.Time        `json:"suspended_at,omitempty"`
+}
+
+func (t *Tenant) clone() Tenant {
+	out := *t
+	if t.Attributes != nil {
+		out.Attributes = make(map[string]string, len(t.Attributes))
+		for k, v := range t.Attributes {
+			out.Attributes[k] = v
+		}
+	}
+	if t.SuspendedAt != nil {
+		at := *t.SuspendedAt
+		out.SuspendedAt = &at
+	}
+	return out
+}
+
+// TenantUpdate changes a tenant's status and merges attributes; an empty
+// attribute value removes the attribute.
+type TenantUpdate struct {
+	Status     *TenantStatus     `json:"status,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func validateTenantAttributes(attrs map[string]string) error {
+	for k, v := range attrs {
+		if !tenantAttributeKey.MatchString(k) {
+			return fmt.Errorf("invalid tenant attribute %q: keys are lowercase letters, digits and _", k)
+		}
+		if len(v) > maxTenantAttributeValue {
+			return fmt.Errorf("tenant attribute %q exceeds %d characters", k, maxTenantAttributeValue)
+		}
+	}
+	return nil
+}
+
+// CreateTenant provisions an active tenant with optional attributes.
+func (s *Service) CreateTenant(id string, attrs map[string]string) (Tenant, error) {
+	if err := validateTenantAttributes(attrs); err != nil {
+		return Tenant{}, err
+	}
+	if len(attrs) > maxTenantAttributes {
+		return Tenant{}, fmt.Errorf("at most %d tenant attributes are allowed", maxTenantAttributes)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == "" {
+		return Tenant{}, fmt.Errorf("tenant id is empty")
+	}
+	if _, exists := s.tenants[id]; exists {
+		return Tenant{}, fmt.Errorf("tenant %q already exists", id)
+	}
+	t := &Tenant{ID: id, Status: TenantActive, CreatedAt: time.Now().UTC()}
+	for k, v := range attrs {
+		if v == "" {
+			continue
+		}
+		if t.Attributes == nil {
+			t.Attributes = make(map[string]string, len(attrs))
+		}
+		t.Attributes[k] = v
+	}
+	s.tenants[id] = t
+	s.changes.touch(recordTenant, id)
+	s.publish(webhook.EventTenantCreated, id, map[string]any{"tenant_id": id})
+	return t.clone(), nil
+}
+
+func (s *Service) Tenant(id string) (Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return Tenant{}, fmt.Errorf("%w: %q", ErrTenantNotFound, id)
+	}
+	return t.clone(), nil
+}
+
+// UpdateTenant applies a status change or attribute merge.
+func (s *Service) UpdateTenant(id string, u TenantUpdate) (Tenant, error) {
+	if u.Status != nil {
+		if _, err := ParseTenantStatus(string(*u.Status)); err != nil {
+			return Tenant{}, err
+		}
+	}
+	if err := validateTenantAttributes(u.Attributes); err != nil {
+		return Tenant{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return Tenant{}, fmt.Errorf("%w: %q", ErrTenantNotFound, id)
+	}
+	attrs := make(map[string]string, len(t.Attributes)+len(u.Attributes))
+	for k, v := range t.Attributes {
+		attrs[k] = v
+	}
+	for k, v := range u.Attributes {
+		if v == "" {
+			delete(attrs, k)
+			continue
+		}
+		attrs[k] = v
+	}
+	if len(attrs) > maxTenantAttributes {
+		return Tenant{}, fmt.Errorf("at most %d tenant attributes are allowed", maxTenantAttributes)
+	}
+	t.Attributes = attrs
+	if len(attrs) == 0 {
+		t.Attributes = nil
+	}
+	if u.Status != nil && *u.Status != t.Status {
+		t.Status = *u.Status
+		t.SuspendedAt = nil
+		if t.Status == TenantSuspended {
+			now := time.Now().UTC()
+			t.SuspendedAt = &now
+		}
+	}
+	s.changes.touch(recordTenant, id)
+	return t.clone(), nil
+}
+
+// Tenants returns every tenant, ordered by ID.
+func (s *Service) Tenants() []Tenant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		out = append(out, t.clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (s *Service) registerTenantRoutes(a *api) {
+	a.register("/tenants/{tenant_id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		tenantID, ok := a.tenantScope(w, p, r.PathValue("tenant_id"))
+		if !ok {
+			return
+		}
+		auditFrom(r).target("tenants/"+tenantID, tenantID)
+		switch r.Method {
+		case http.MethodGet:
+			if !a.requireScope(w, p, ScopeUsageRead) {
+				return
+			}
+			t, err := s.Tenant(tenantID)
+			if err != nil {
+				http.Error(w, err.Error(), quotaErrorStatus(err))
+				return
+			}
+			writeJSON(w, t)
+		case http.MethodPatch:
+			if !a.requireScope(w, p, ScopeAdmin) {
+				return
+			}
+			var req TenantUpdate
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			before, err := s.Tenant(tenantID)
+			if err != nil {
+				http.Error(w, err.Error(), quotaErrorStatus(err))
+				return
+			}
+			after, err := s.UpdateTenant(tenantID, req)
+			if err != nil {
+				http.Error(w, err.Error(), quotaErrorStatus(err))
+				return
+			}
+			auditFrom(r).change(before, after)
+			writeJSON(w, after)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,319 @@
+package controlplane
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHourlyCompacted reports an hourly time series reaching back past the
+// hourly rollups CompactRollups dropped.
+var ErrHourlyCompacted = errors.New("hourly rollups were compacted")
+
+// maxTimeseriesBuckets bounds one query so a wide range at hourly
+// granularity cannot produce an unbounded response.
+const maxTimeseriesBuckets = 5000
+
+// Granularity is the bucket width of a usage time series. Buckets are UTC.
+type Granularity string
+
+const (
+	GranularityHour  Granularity = "hour"
+	GranularityDay   Granularity = "day"
+	GranularityMonth Granularity = "month"
+)
+
+var granularities = []Granularity{GranularityHour, GranularityDay, GranularityMonth}
+
+func parseGranularity(raw string) (Granularity, error) {
+	switch g := Granularity(strings.ToLower(strings.TrimSpace(raw))); g {
+	case "":
+		return GranularityDay, nil
+	case GranularityHour, GranularityDay, GranularityMonth:
+		return g, nil
+	default:
+		return "", fmt.Errorf("invalid granularity %q, expected hour, day or month", raw)
+	}
+}
+
+func (g Granularity) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case GranularityHour:
+		return t.Truncate(time.Hour)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func (g Granularity) next(t time.Time) time.Time {
+	switch g {
+	case GranularityHour:
+		return t.Add(time.Hour)
+	case GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// defaultSpan is the lookback used when from is omitted.
+func (g Granularity) defaultSpan(to time.Time) time.Time {
+	switch g {
+	case GranularityHour:
+		return to.Add(-24 * time.Hour)
+	case GranularityMonth:
+		return to.AddDate(-1, 0, 0)
+	default:
+		return to.AddDate(0, 0, -30)
+	}
+}
+
+// GroupBy splits a time series into one series per dimension value.
+type GroupBy string
+
+const (
+	GroupByNone  GroupBy = ""
+	GroupByAgent GroupBy = "agent"
+	GroupByModel GroupBy = "model"
+)
+
+func parseGroupBy(raw string) (GroupBy, error) {
+	switch g := GroupBy(strings.ToLower(strings.TrimSpace(raw))); g {
+	case GroupByNone, GroupByAgent, GroupByModel:
+		return g, nil
+	default:
+		return "", fmt.Errorf("invalid group_by %q, expected agent or model", raw)
+	}
+}
+
+type rollupBucket struct {
+	start int64
+	agent string
+	model string
+}
+
+// rollups pre-aggregates usage per tenant into hour, day and month buckets
+// split by agent and model, so time-series queries scan buckets instead of
+// raw events. Callers hold Service.mu.
+type rollups map[Granularity]map[string]map[rollupBucket]usageRow
+
+func newRollups() rollups {
+	r := make(rollups, len(granularities))
+	for _, g := range granularities {
+		r[g] = make(map[string]map[rollupBucket]usageRow)
+	}
+	return r
+}
+
+func (r rollups) add(ev usageEvent) {
+	for _, g := range granularities {
+		byTenant := r[g][ev.TenantID]
+		if byTenant == nil {
+			byTenant = make(map[rollupBucket]usageRow)
+			r[g][ev.TenantID] = byTenant
+		}
+		key := rollupBucket{start: g.truncate(ev.OccurredAt).Unix(), agent: ev.Agent, model: ev.Model}
+		row := byTenant[key]
+		row.add(ev)
+		byTenant[key] = row
+	}
+}
+
+// TimeseriesQuery selects usage for one tenant in [From, To).
+type TimeseriesQuery struct {
+	TenantID    string
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+	GroupBy     GroupBy
+}
+
+type TimeseriesPoint struct {
+	Start        time.Time `json:"start"`
+	Invocations  int64     `json:"invocations"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+}
+
+// TimeseriesSeries is one group's zero-filled points. Group is empty when
+// the query is not grouped or usage carried no agent/model.
+type TimeseriesSeries struct {
+	Group  string            `json:"group"`
+	Points []TimeseriesPoint `json:"points"`
+}
+
+type Timeseries struct {
+	TenantID    string             `json:"tenant_id"`
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	Granularity Granularity        `json:"granularity"`
+	GroupBy     GroupBy            `json:"group_by,omitempty"`
+	Series      []TimeseriesSeries `json:"series"`
+}
+
+// UsageTimeseries returns zero-filled usage buckets for a tenant. From is
+// aligned down and To up to bucket boundaries. Hourly series fail with
+// ErrHourlyCompacted when From is before the hourly compaction cutoff,
+// rather than reporting the compacted hours as zero.
+func (s *Service) UsageTimeseries(q TimeseriesQuery) (Timeseries, error) {
+	if q.TenantID == "" {
+		return Timeseries{}, fmt.Errorf("tenant_id is required")
+	}
+	from := q.Granularity.truncate(q.From)
+	to := q.Granularity.truncate(q.To)
+	if to.Before(q.To.UTC()) {
+		to = q.Granularity.next(to)
+	}
+	if !from.Before(to) {
+		return Timeseries{}, fmt.Errorf("from must be before to")
+	}
+
+	starts := make([]time.Time, 0)
+	index := make(map[int64]int)
+	for t := from; t.Before(to); t = q.Granularity.next(t) {
+		if len(starts) == maxTimeseriesBuckets {
+			return Timeseries{}, fmt.Errorf("range spans more than %d %s buckets; narrow it or use a coarser granularity", maxTimeseriesBuckets, q.Granularity)
+		}
+		index[t.Unix()] = len(starts)
+		starts = append(starts, t)
+	}
+
+	s.mu.Lock()
+	if q.Granularity == GranularityHour && from.Unix() < s.hourlyCut {
+		cut := time.Unix(s.hourlyCut, 0).UTC()
+		s.mu.Unlock()
+		return Timeseries{}, fmt.Errorf("%w before %s; start from there or use day granularity", ErrHourlyCompacted, cut.Format(time.RFC3339))
+	}
+	groups := make(map[string][]TimeseriesPoint)
+	for key, row := range s.rollups[q.Granularity][q.TenantID] {
+		i, ok := index[key.start]
+		if !ok {
+			continue
+		}
+		group := ""
+		switch q.GroupBy {
+		case GroupByAgent:
+			group = key.agent
+		case GroupByModel:
+			group = key.model
+		}
+		points, ok := groups[group]
+		if !ok {
+			points = make([]TimeseriesPoint, len(starts))
+			for j, start := range starts {
+				points[j].Start = start
+			}
+			groups[group] = points
+		}
+		points[i].Invocations += row.Invocations
+		points[i].InputTokens += row.InputTokens
+		points[i].OutputTokens += row.OutputTokens
+	}
+	s.mu.Unlock()
+
+	out := Timeseries{TenantID: q.TenantID, From: from, To: to, Granularity: q.Granularity, GroupBy: q.GroupBy, Series: make([]TimeseriesSeries, 0, len(groups))}
+	for group, points := range groups {
+		out.Series = append(out.Series, TimeseriesSeries{Group: group, Points: points})
+	}
+	sort.Slice(out.Series, func(i, j int) bool { return out.Series[i].Group < out.Series[j].Group })
+	if len(out.Series) == 0 {
+		points := make([]TimeseriesPoint, len(starts))
+		for j, start := range starts {
+			points[j].Start = start
+		}
+		out.Series = append(out.Series, TimeseriesSeries{Points: points})
+	}
+	return out, nil
+}
+
+func (s *Service) registerTimeseriesRoutes(a *api) {
+	a.register("/usage/timeseries", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		granularity, err := parseGranularity(q.Get("granularity"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		groupBy, err := parseGroupBy(q.Get("group_by"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to := time.Now().UTC()
+		if raw := strings.TrimSpace(q.Get("to")); raw != "" {
+			if to, err = parseEffectiveFrom(raw); err != nil {
+				http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		from := granularity.defaultSpan(to)
+		if raw := strings.TrimSpace(q.Get("from")); raw != "" {
+			if from, err = parseEffectiveFrom(raw); err != nil {
+				http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		tenantID, ok := a.tenantScope(w, p, q.Get("tenant_id"))
+		if !ok {
+			return
+		}
+		series, err := s.UsageTimeseries(TimeseriesQuery{
+			TenantID:    tenantID,
+			From:        from,
+			To:          to,
+			Granularity: granularity,
+			GroupBy:     groupBy,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.EqualFold(q.Get("format"), "csv") {
+			w.Header().Set("Content-Type", "text/csv")
+			_ = writeTimeseriesCSV(w, series)
+			return
+		}
+		writeJSON(w, series)
+	})
+}
+
+func writeTimeseriesCSV(w http.ResponseWriter, ts Timeseries) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"tenant_id", "start", "group", "invocations", "input_tokens", "output_tokens"}); err != nil {
+		return err
+	}
+	for _, series := range ts.Series {
+		for _, p := range series.Points {
+			if err := cw.Write([]string{
+				ts.TenantID,
+				p.Start.Format(time.RFC3339),
+				series.Group,
+				strconv.FormatInt(p.Invocations, 10),
+				strconv.FormatInt(p.InputTokens, 10),
+				strconv.FormatInt(p.OutputTokens, 10),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,281 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+// Webhooks exposes the dispatcher so embedders and tests can drive delivery.
+func (s *Service) Webhooks() *webhook.Dispatcher {
+	return s.webhooks
+}
+
+// publish enqueues an event for subscribers. Delivery happens outside the
+// service lock, so it is safe to call while holding s.mu.
+func (s *Service) publish(eventType string, tenantID string, data any) {
+	if _, err := s.webhooks.Publish(eventType, tenantID, data); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "controlplane: warning: publish %s: %v\n", eventType, err)
+	}
+}
+
+// webhookConfigFromEnv reads WEBHOOK_MAX_ATTEMPTS, WEBHOOK_BASE_BACKOFF,
+// WEBHOOK_MAX_BACKOFF, WEBHOOK_MAX_DELIVERIES and
+// WEBHOOK_ALLOW_PRIVATE_TARGETS; unset or invalid values keep the defaults.
+func webhookConfigFromEnv() webhook.Config {
+	var cfg webhook.Config
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))); err == nil {
+		cfg.MaxAttempts = v
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WEBHOOK_MAX_DELIVERIES"))); err == nil {
+		cfg.MaxDeliveries = v
+	}
+	if v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS"))); err == nil {
+		cfg.AllowPrivateTargets = v
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("WEBHOOK_BASE_BACKOFF"))); err == nil {
+		cfg.BaseBackoff = d
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("WEBHOOK_MAX_BACKOFF"))); err == nil {
+		cfg.MaxBackoff = d
+	}
+	return cfg
+}
+
+func webhookIntervalFromEnv() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("WEBHOOK_DELIVERY_INTERVAL"))); err == nil && d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+// createdSubscription is the create response; it is the only time the
+// signing secret is returned.
+type createdSubscription struct {
+	webhook.Subscription
+	Secret string `json:"secret"`
+}
+
+func (s *Service) registerWebhookRoutes(a *api) {
+	a.register("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			page, pageSize := parsePagination(q.Get("page"), q.Get("page_size"))
+			tenantID, ok := a.tenantScope(w, p, q.Get("tenant_id"))
+			if !ok {
+				return
+			}
+			items := s.webhooks.Subscriptions(tenantID)
+			total := len(items)
+			items = paginateSubscriptions(items, page, pageSize)
+			writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": pageSize})
+		case http.MethodPost:
+			// Subscribing decides where tenant events are sent.
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			var req struct {
+				TenantID string   `json:"tenant_id"`
+				URL      string   `json:"url"`
+				Events   []string `json:"events"`
+				Secret   string   `json:"secret"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.TenantID, ok = a.tenantScope(w, p, req.TenantID); !ok {
+				return
+			}
+			if req.TenantID == "" {
+				// Subscriptions spanning all tenants are admin-only.
+				if !a.requireScope(w, p, ScopeAdmin) {
+					return
+				}
+			} else if !s.hasTenant(req.TenantID) {
+				http.Error(w, fmt.Sprintf("tenant %q not found", req.TenantID), http.StatusNotFound)
+				return
+			}
+			auditFrom(r).target("webhooks", req.TenantID)
+			sub, err := s.webhooks.Subscribe(webhook.Subscription{TenantID: req.TenantID, URL: req.URL, Events: req.Events, Secret: req.Secret})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			auditFrom(r).target("webhooks/"+sub.ID, sub.TenantID)
+			auditFrom(r).change(nil, sub)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(createdSubscription{Subscription: sub, Secret: sub.Secret})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	a.register("/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		id := r.PathValue("id")
+		auditFrom(r).target("webhooks/"+id, "")
+		sub, err := s.webhooks.Subscription(id)
+		if err == nil && p.tenantID != "" && sub.TenantID != p.tenantID {
+			err = fmt.Errorf("%w: %s", webhook.ErrSubscriptionNotFound, id)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), webhookErrorStatus(err))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, sub)
+		case http.MethodDelete:
+			if !a.requireScope(w, p, ScopeBillingAdmin) {
+				return
+			}
+			if sub.TenantID == "" && !a.requireScope(w, p, ScopeAdmin) {
+				return
+			}
+			auditFrom(r).target("webhooks/"+id, sub.TenantID)
+			if err := s.webhooks.Unsubscribe(id); err != nil {
+				http.Error(w, err.Error(), webhookErrorStatus(err))
+				return
+			}
+			auditFrom(r).change(sub, nil)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	a.register("/webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		tenantID, ok := a.tenantScope(w, p, q.Get("tenant_id"))
+		if !ok {
+			return
+		}
+		page, pageSize := parsePagination(q.Get("page"), q.Get("page_size"))
+		items := s.webhooks.Deliveries(webhook.DeliveryFilter{
+			SubscriptionID: strings.TrimSpace(q.Get("subscription_id")),
+			TenantID:       tenantID,
+			EventType:      strings.TrimSpace(q.Get("event")),
+			Status:         webhook.DeliveryStatus(strings.TrimSpace(q.Get("status"))),
+		})
+		total := len(items)
+		items = paginateDeliveries(items, page, pageSize)
+		writeJSON(w, map[string]any{"items": items, "total": total, "page": page, "page_size": pageSize})
+	})
+	a.register("/webhooks/deliveries/{id}", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok || !a.requireScope(w, p, ScopeUsageRead) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		del, err := s.webhooks.Delivery(r.PathValue("id"))
+		if err == nil && p.tenantID != "" && del.TenantID != p.tenantID {
+			err = fmt.Errorf("%w: %s", webhook.ErrDeliveryNotFound, r.PathValue("id"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), webhookErrorStatus(err))
+			return
+		}
+		writeJSON(w, del)
+	})
+	a.register("/webhooks/deliveries/{id}/redeliver", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.reqs, 1)
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.requireScope(w, p, ScopeAdmin) {
+			return
+		}
+		auditFrom(r).target("webhooks/deliveries/"+r.PathValue("id"), "")
+		before, _ := s.webhooks.Delivery(r.PathValue("id"))
+		del, err := s.webhooks.Redeliver(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), webhookErrorStatus(err))
+			return
+		}
+		auditFrom(r).target("webhooks/deliveries/"+del.ID, del.TenantID)
+		auditFrom(r).change(deliveryAuditView(before), deliveryAuditView(del))
+		writeJSON(w, del)
+	})
+}
+
+// deliveryAuditView leaves the event payload out of audit events.
+func deliveryAuditView(d webhook.Delivery) map[string]any {
+	if d.ID == "" {
+		return nil
+	}
+	return map[string]any{"id": d.ID, "subscription_id": d.SubscriptionID, "status": d.Status, "attempt_count": d.AttemptCount}
+}
+
+func (s *Service) hasTenant(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tenants[id]
+	return ok
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, webhook.ErrSubscriptionNotFound) || errors.Is(err, webhook.ErrDeliveryNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func paginateSubscriptions(in []webhook.Subscription, page int, pageSize int) []webhook.Subscription {
+	start := (page - 1) * pageSize
+	if start >= len(in) {
+		return []webhook.Subscription{}
+	}
+	end := start + pageSize
+	if end > len(in) {
+		end = len(in)
+	}
+	return in[start:end]
+}
+
+func paginateDeliveries(in []webhook.Delivery, page int, pageSize int) []webhook.Delivery {
+	start := (page - 1) * pageSize
+	if start >= len(in) {
+		return []webhook.Delivery{}
+	}
+	end := start + pageSize
+	if end > len(in) {
+		end = len(in)
+	}
+	return in[start:end]
+}
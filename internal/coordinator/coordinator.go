@@ -2,62 +2,128 @@ package coordinator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
+// ErrLeaseLost reports a renewal for a lease that expired or was taken over.
+var ErrLeaseLost = errors.New("lease lost")
+
 type Lease interface {
+	// Renew extends the lease by ttl, or returns ErrLeaseLost.
+	Renew(ctx context.Context, ttl time.Duration) error
 	Release(context.Context) error
 }
 
 type Coordinator interface {
+	// Acquire blocks until the lease is free or ctx is done.
 	Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error)
+	// TryAcquire takes the lease for holder if it is free and reports
+	// whether it did, without waiting.
+	TryAcquire(ctx context.Context, key string, holder string, ttl time.Duration) (Lease, bool, error)
+	// Holder returns who holds the lease, or "" when it is free.
+	Holder(ctx context.Context, key string) (string, error)
+}
+
+// acquire polls TryAcquire until the lease is free.
+func acquire(ctx context.Context, c Coordinator, key string, ttl time.Duration, poll time.Duration) (Lease, error) {
+	for {
+		lease, ok, err := c.TryAcquire(ctx, key, "", ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return lease, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("acquire lease: %w", ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
+
+func defaultTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 2 * time.Minute
+	}
+	return ttl
+}
+
+type memoryLock struct {
+	token   string
+	holder  string
+	expires time.Time
 }
 
 type memoryCoordinator struct {
 	mu    sync.Mutex
-	locks map[string]time.Time
+	locks map[string]memoryLock
 }
 
 type memoryLease struct {
-	key string
-	c   *memoryCoordinator
+	key   string
+	token string
+	c     *memoryCoordinator
 }
 
 func NewMemoryCoordinator() Coordinator {
-	return &memoryCoordinator{locks: make(map[string]time.Time)}
+	return &memoryCoordinator{locks: make(map[string]memoryLock)}
 }
 
 func (c *memoryCoordinator) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
-	if ttl <= 0 {
-		ttl = 2 * time.Minute
+	return acquire(ctx, c, key, ttl, 20*time.Millisecond)
+}
+
+func (c *memoryCoordinator) TryAcquire(_ context.Context, key string, holder string, ttl time.Duration) (Lease, bool, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, false, err
 	}
-	for {
-		c.mu.Lock()
-		exp, exists := c.locks[key]
-		now := time.Now()
-		if !exists || now.After(exp) {
-			c.locks[key] = now.Add(ttl)
-			c.mu.Unlock()
-			return &memoryLease{key: key, c: c}, nil
-		}
-		c.mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if lock, exists := c.locks[key]; exists && !now.After(lock.expires) {
+		return nil, false, nil
+	}
+	c.locks[key] = memoryLock{token: token, holder: holder, expires: now.Add(defaultTTL(ttl))}
+	return &memoryLease{key: key, token: token, c: c}, true, nil
+}
 
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("acquire lease: %w", ctx.Err())
-		case <-time.After(20 * time.Millisecond):
-		}
+func (c *memoryCoordinator) Holder(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lock, exists := c.locks[key]
+	if !exists || time.Now().After(lock.expires) {
+		return "", nil
 	}
+	return lock.holder, nil
+}
+
+func (l *memoryLease) Renew(_ context.Context, ttl time.Duration) error {
+	l.c.mu.Lock()
+	defer l.c.mu.Unlock()
+	lock, exists := l.c.locks[l.key]
+	now := time.Now()
+	if !exists || lock.token != l.token || now.After(lock.expires) {
+		return ErrLeaseLost
+	}
+	lock.expires = now.Add(defaultTTL(ttl))
+	l.c.locks[l.key] = lock
+	return nil
 }
 
 func (l *memoryLease) Release(_ context.Context) error {
 	l.c.mu.Lock()
 	defer l.c.mu.Unlock()
-	delete(l.c.locks, l.key)
+	if lock, exists := l.c.locks[l.key]; exists && lock.token == l.token {
+		delete(l.c.locks, l.key)
+	}
 	return nil
 }
 
@@ -66,7 +132,8 @@ type fileCoordinator struct {
 }
 
 type fileLease struct {
-	path string
+	path  string
+	token string
 }
 
 func NewFileCoordinator(dir string) Coordinator {
@@ -77,55 +144,105 @@ func NewFileCoordinator(dir string) Coordinator {
 }
 
 func (c *fileCoordinator) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
-	if ttl <= 0 {
-		ttl = 2 * time.Minute
-	}
+	return acquire(ctx, c, key, ttl, 25*time.Millisecond)
+}
+
+// TryAcquire creates <dir>/<key>.lock exclusively. The file holds the expiry,
+// the holder and a token identifying this lease, one per line.
+func (c *fileCoordinator) TryAcquire(_ context.Context, key string, holder string, ttl time.Duration) (Lease, bool, error) {
 	if err := os.MkdirAll(c.dir, 0o755); err != nil {
-		return nil, fmt.Errorf("mkdir coordinator dir: %w", err)
+		return nil, false, fmt.Errorf("mkdir coordinator dir: %w", err)
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, false, err
 	}
 	path := filepath.Join(c.dir, key+".lock")
-
 	for {
 		now := time.Now()
-		expires := now.Add(ttl)
 		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
 		if err == nil {
-			_, _ = f.WriteString(expires.Format(time.RFC3339Nano))
+			_, _ = f.WriteString(fileLockContent(now.Add(defaultTTL(ttl)), holder, token))
 			_ = f.Close()
-			return &fileLease{path: path}, nil
+			return &fileLease{path: path, token: token}, true, nil
 		}
 		if !os.IsExist(err) {
-			return nil, fmt.Errorf("acquire file lease: %w", err)
+			return nil, false, fmt.Errorf("acquire file lease: %w", err)
 		}
-
-		if expired(path, now) {
-			_ = os.Remove(path)
-			continue
+		if !expired(path, now) {
+			return nil, false, nil
 		}
+		_ = os.Remove(path)
+	}
+}
 
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("acquire file lease: %w", ctx.Err())
-		case <-time.After(25 * time.Millisecond):
-		}
+func (c *fileCoordinator) Holder(_ context.Context, key string) (string, error) {
+	path := filepath.Join(c.dir, key+".lock")
+	lock, err := readFileLock(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read file lease: %w", err)
+	}
+	if time.Now().After(lock.expires) {
+		return "", nil
 	}
+	return lock.holder, nil
+}
+
+func (l *fileLease) Renew(_ context.Context, ttl time.Duration) error {
+	lock, err := readFileLock(l.path)
+	now := time.Now()
+	if err != nil || lock.token != l.token || now.After(lock.expires) {
+		return ErrLeaseLost
+	}
+	tmp := l.path + "." + l.token
+	if err := os.WriteFile(tmp, []byte(fileLockContent(now.Add(defaultTTL(ttl)), lock.holder, l.token)), 0o644); err != nil {
+		return fmt.Errorf("renew file lease: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("renew file lease: %w", err)
+	}
+	return nil
 }
 
 func (l *fileLease) Release(_ context.Context) error {
+	if lock, err := readFileLock(l.path); err == nil && lock.token != l.token {
+		return nil
+	}
 	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("release file lease: %w", err)
 	}
 	return nil
 }
 
-func expired(path string, now time.Time) bool {
+func fileLockContent(expires time.Time, holder string, token string) string {
+	return expires.Format(time.RFC3339Nano) + "\n" + holder + "\n" + token
+}
+
+func readFileLock(path string) (memoryLock, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
-		return true
+		return memoryLock{}, err
+	}
+	lines := strings.SplitN(string(b), "\n", 3)
+	t, err := time.Parse(time.RFC3339Nano, lines[0])
+	if err != nil {
+		return memoryLock{}, err
 	}
-	t, err := time.Parse(time.RFC3339Nano, string(b))
+	lock := memoryLock{expires: t}
+	if len(lines) == 3 {
+		lock.holder, lock.token = lines[1], lines[2]
+	}
+	return lock, nil
+}
+
+func expired(path string, now time.Time) bool {
+	lock, err := readFileLock(path)
 	if err != nil {
 		return true
 	}
-	return now.After(t)
+	return now.After(lock.expires)
 }
@@ -0,0 +1,96 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Elector campaigns for a lease and renews it while leading, so that one of
+// several replicas runs singleton work. Leadership is lost when a renewal
+// fails; the lease then expires after its TTL and another replica takes it.
+type Elector struct {
+	coord   Coordinator
+	key     string
+	id      string
+	ttl     time.Duration
+	leading atomic.Bool
+}
+
+// NewElector campaigns for key as id, which other replicas read through
+// Leader. The lease is renewed every ttl/3.
+func NewElector(coord Coordinator, key string, id string, ttl time.Duration) *Elector {
+	return &Elector{coord: coord, key: key, id: id, ttl: defaultTTL(ttl)}
+}
+
+// ID is the identity this elector campaigns as.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this elector currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Leader returns the current leader's ID, or "" when there is none.
+func (e *Elector) Leader(ctx context.Context) (string, error) {
+	return e.coord.Holder(ctx, e.key)
+}
+
+// Run campaigns until ctx is done. Each time leadership is won, lead runs
+// with a context that is cancelled when leadership is lost; Run waits for it
+// to return before campaigning again.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	interval := e.ttl / 3
+	for {
+		lease, ok, err := e.coord.TryAcquire(ctx, e.key, e.id, e.ttl)
+		if err != nil && ctx.Err() == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "coordinator: warning: campaign for %s: %v\n", e.key, err)
+		}
+		if ok {
+			e.hold(ctx, lease, interval, lead)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (e *Elector) hold(ctx context.Context, lease Lease, interval time.Duration, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.leading.Store(true)
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for renewing := true; renewing; {
+		select {
+		case <-ctx.Done():
+			renewing = false
+		case <-done:
+			renewing = false
+		case <-ticker.C:
+			if err := lease.Renew(ctx, e.ttl); err != nil {
+				if ctx.Err() == nil {
+					_, _ = fmt.Fprintf(os.Stderr, "coordinator: warning: stepping down as %s leader: %v\n", e.key, err)
+				}
+				renewing = false
+			}
+		}
+	}
+	e.leading.Store(false)
+	cancel()
+	<-done
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelRelease()
+	_ = lease.Release(releaseCtx)
+}
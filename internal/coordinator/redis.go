@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -16,6 +17,8 @@ type redisCoordinator struct {
 	prefix string
 }
 
+// redisLease owns its key while the stored value is still its token, which
+// is "<random>|<holder>".
 type redisLease struct {
 	client redis.UniversalClient
 	key    string
@@ -23,13 +26,21 @@ type redisLease struct {
 }
 
 func NewRedisCoordinator(redisURL string, prefix string) (Coordinator, error) {
-	if strings.TrimSpace(redisURL) == "" {
-		return nil, fmt.Errorf("redis url is empty")
+	client, err := NewRedisClient(redisURL)
+	if err != nil {
+		return nil, err
 	}
 	if prefix == "" {
 		prefix = "fluxroute"
 	}
+	return &redisCoordinator{client: client, prefix: prefix}, nil
+}
 
+// NewRedisClient parses redisURL and checks the server answers.
+func NewRedisClient(redisURL string) (redis.UniversalClient, error) {
+	if strings.TrimSpace(redisURL) == "" {
+		return nil, fmt.Errorf("redis url is empty")
+	}
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse redis url: %w", err)
@@ -38,34 +49,57 @@ func NewRedisCoordinator(redisURL string, prefix string) (Coordinator, error) {
 	if err := client.Ping(context.Background()).Err(); err != nil {
 		return nil, fmt.Errorf("redis ping failed: %w", err)
 	}
-	return &redisCoordinator{client: client, prefix: prefix}, nil
+	return client, nil
 }
 
 func (c *redisCoordinator) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
-	if ttl <= 0 {
-		ttl = 2 * time.Minute
-	}
+	return acquire(ctx, c, key, ttl, 30*time.Millisecond)
+}
+
+func (c *redisCoordinator) TryAcquire(ctx context.Context, key string, holder string, ttl time.Duration) (Lease, bool, error) {
 	fullKey := c.prefix + ":" + key
 	token, err := randomToken()
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	token += "|" + holder
+	ok, err := c.client.SetNX(ctx, fullKey, token, defaultTTL(ttl)).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("redis setnx failed: %w", err)
+	}
+	if !ok {
+		return nil, false, nil
 	}
+	return &redisLease{client: c.client, key: fullKey, token: token}, true, nil
+}
 
-	for {
-		ok, err := c.client.SetNX(ctx, fullKey, token, ttl).Result()
-		if err != nil {
-			return nil, fmt.Errorf("redis setnx failed: %w", err)
-		}
-		if ok {
-			return &redisLease{client: c.client, key: fullKey, token: token}, nil
-		}
+func (c *redisCoordinator) Holder(ctx context.Context, key string) (string, error) {
+	v, err := c.client.Get(ctx, c.prefix+":"+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("redis get lease holder: %w", err)
+	}
+	_, holder, _ := strings.Cut(v, "|")
+	return holder, nil
+}
 
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("acquire redis lease: %w", ctx.Err())
-		case <-time.After(30 * time.Millisecond):
-		}
+func (l *redisLease) Renew(ctx context.Context, ttl time.Duration) error {
+	const script = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`
+	n, err := l.client.Eval(ctx, script, []string{l.key}, l.token, defaultTTL(ttl).Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("renew redis lease: %w", err)
+	}
+	if n == 0 {
+		return ErrLeaseLost
 	}
+	return nil
 }
 
 func (l *redisLease) Release(ctx context.Context) error {
@@ -0,0 +1,150 @@
+// Package jsonpath parses, formats and matches the JSONPath-like patterns
+// used to address values in agent payloads: $.meta.ts matches exactly, *
+// matches one key or index ($.items[*].id), ** any number of them, and a
+// pattern without a leading $ matches at any depth (timestamp is
+// **.timestamp).
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Seg is one step of a path: an object key or an array index. In patterns,
+// key "*" matches any one step and "**" any number of steps.
+type Seg struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Key returns an object key step.
+func Key(k string) Seg { return Seg{Key: k} }
+
+// Index returns an array index step.
+func Index(i int) Seg { return Seg{Index: i, IsIndex: true} }
+
+// Append returns a copy of path with s appended, leaving path untouched.
+func Append(path []Seg, s Seg) []Seg {
+	out := make([]Seg, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, s)
+}
+
+// Format renders path as $.key[0]["odd key"].
+func Format(path []Seg) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, s := range path {
+		switch {
+		case s.IsIndex:
+			fmt.Fprintf(&b, "[%d]", s.Index)
+		case isIdentifier(s.Key):
+			b.WriteString("." + s.Key)
+		default:
+			fmt.Fprintf(&b, "[%s]", strconv.Quote(s.Key))
+		}
+	}
+	return b.String()
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || s == "*" || s == "**" {
+		return false
+	}
+	for i, r := range s {
+		if r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Parse parses a path pattern into steps.
+func Parse(p string) ([]Seg, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var segs []Seg
+	if strings.HasPrefix(p, "$") {
+		p = p[1:]
+	} else {
+		segs = append(segs, Key("**"))
+		p = "." + p
+	}
+	for p != "" {
+		switch p[0] {
+		case '.':
+			end := strings.IndexAny(p[1:], ".[")
+			if end < 0 {
+				end = len(p) - 1
+			}
+			key := p[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key")
+			}
+			segs = append(segs, Key(key))
+			p = p[end+1:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			inner := p[1:end]
+			switch {
+			case inner == "*":
+				segs = append(segs, Key("*"))
+			case strings.HasPrefix(inner, `"`):
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("bad quoted key %s", inner)
+				}
+				segs = append(segs, Key(key))
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("bad index [%s]", inner)
+				}
+				segs = append(segs, Index(n))
+			}
+			p = p[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", p[0])
+		}
+	}
+	return segs, nil
+}
+
+// Match reports whether pattern matches path or one of its ancestors, so a
+// pattern addressing an object also covers everything inside it.
+func Match(pattern []Seg, path []Seg) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	head := pattern[0]
+	if !head.IsIndex && head.Key == "**" {
+		for i := 0; i <= len(path); i++ {
+			if Match(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	seg := path[0]
+	switch {
+	case !head.IsIndex && head.Key == "*":
+	case head.IsIndex != seg.IsIndex:
+		return false
+	case head.IsIndex && head.Index != seg.Index:
+		return false
+	case !head.IsIndex && head.Key != seg.Key:
+		return false
+	}
+	return Match(pattern[1:], path[1:])
+}
@@ -22,27 +22,51 @@ type PrometheusRecorder struct {
 }
 
 func NewPrometheusRecorder(registry *prometheus.Registry) (*PrometheusRecorder, error) {
+	return NewPrometheusRecorderWithLabels(registry, nil)
+}
+
+// NewPrometheusRecorderWithLabels attaches labels to every series, such as
+// the tenant a run belongs to. Dotted keys become underscores, so tenant.id
+// is exported as tenant_id; keys that would share a label name are rejected.
+func NewPrometheusRecorderWithLabels(registry *prometheus.Registry, labels map[string]string) (*PrometheusRecorder, error) {
 	if registry == nil {
 		return nil, fmt.Errorf("prometheus registry is nil")
 	}
+	constLabels := prometheus.Labels{}
+	keys := make(map[string]string, len(labels))
+	for k, v := range labels {
+		name := labelName(k)
+		if other, dup := keys[name]; dup {
+			if other > k {
+				other, k = k, other
+			}
+			return nil, fmt.Errorf("labels %q and %q both export as %s", other, k, name)
+		}
+		keys[name] = k
+		constLabels[name] = v
+	}
 
 	r := &PrometheusRecorder{
 		invocations: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "fluxroute_invocations_total",
-			Help: "Total number of agent invocations by status",
+			Name:        "fluxroute_invocations_total",
+			Help:        "Total number of agent invocations by status",
+			ConstLabels: constLabels,
 		}, []string{"agent_id", "status"}),
 		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name:    "fluxroute_invocation_duration_seconds",
-			Help:    "Agent invocation latency in seconds",
-			Buckets: prometheus.DefBuckets,
+			Name:        "fluxroute_invocation_duration_seconds",
+			Help:        "Agent invocation latency in seconds",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.DefBuckets,
 		}, []string{"agent_id"}),
 		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "fluxroute_retry_attempts_total",
-			Help: "Total retry attempts by agent",
+			Name:        "fluxroute_retry_attempts_total",
+			Help:        "Total retry attempts by agent",
+			ConstLabels: constLabels,
 		}, []string{"agent_id"}),
 		circuitOpen: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "fluxroute_circuit_breaks_total",
-			Help: "Total circuit breaker open events by agent",
+			Name:        "fluxroute_circuit_breaks_total",
+			Help:        "Total circuit breaker open events by agent",
+			ConstLabels: constLabels,
 		}, []string{"agent_id"}),
 	}
 
@@ -126,3 +150,17 @@ func StopServer(ctx context.Context, srv *http.Server) error {
 	}
 	return srv.Shutdown(ctx)
 }
+
+// labelName maps an attribute key onto the Prometheus label charset.
+func labelName(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
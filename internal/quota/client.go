@@ -0,0 +1,143 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheTTL = 30 * time.Second
+
+// ClientConfig configures quota lookups against the control plane.
+type ClientConfig struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	CacheTTL   time.Duration
+}
+
+type cachedStatus struct {
+	status    Status
+	fetchedAt time.Time
+}
+
+// Client serves tenant quota status from a local cache, refreshing it from
+// the control plane after CacheTTL. Usage observed locally is applied to the
+// cached view so back-to-back runs cannot overshoot a limit between refreshes.
+type Client struct {
+	cfg ClientConfig
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedStatus
+}
+
+func NewClient(cfg ClientConfig) (*Client, error) {
+	cfg.BaseURL = strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("control plane url is empty")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	return &Client{cfg: cfg, now: time.Now, cache: make(map[string]cachedStatus)}, nil
+}
+
+// ClientFromEnv builds a client when CONTROLPLANE_URL is set and returns nil
+// otherwise. QUOTA_CACHE_TTL overrides the cache lifetime.
+func ClientFromEnv() (*Client, error) {
+	baseURL := strings.TrimSpace(os.Getenv("CONTROLPLANE_URL"))
+	if baseURL == "" {
+		return nil, nil
+	}
+	var ttl time.Duration
+	if v := strings.TrimSpace(os.Getenv("QUOTA_CACHE_TTL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUOTA_CACHE_TTL: %w", err)
+		}
+		ttl = d
+	}
+	return NewClient(ClientConfig{
+		BaseURL:  baseURL,
+		APIKey:   strings.TrimSpace(os.Getenv("CONTROLPLANE_API_KEY")),
+		CacheTTL: ttl,
+	})
+}
+
+// Status returns the tenant's quota status. A fresh cache entry is served
+// without a request. When the control plane is unreachable a stale entry is
+// returned alongside the error so callers can decide whether to fail open.
+func (c *Client) Status(ctx context.Context, tenantID string) (Status, error) {
+	c.mu.Lock()
+	entry, ok := c.cache[tenantID]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.fetchedAt) < c.cfg.CacheTTL {
+		return entry.status, nil
+	}
+
+	status, err := c.fetch(ctx, tenantID)
+	if err != nil {
+		if ok {
+			return entry.status, err
+		}
+		return Status{}, err
+	}
+	c.mu.Lock()
+	c.cache[tenantID] = cachedStatus{status: status, fetchedAt: c.now()}
+	c.mu.Unlock()
+	return status, nil
+}
+
+// Consume records usage of a completed run against the cached status.
+func (c *Client) Consume(tenantID string, invocations int64, tokens int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[tenantID]
+	if !ok {
+		return
+	}
+	entry.status = entry.status.Consume(invocations, tokens)
+	c.cache[tenantID] = entry
+}
+
+// Invalidate drops the cached status so the next lookup refreshes it.
+func (c *Client) Invalidate(tenantID string) {
+	c.mu.Lock()
+	delete(c.cache, tenantID)
+	c.mu.Unlock()
+}
+
+func (c *Client) fetch(ctx context.Context, tenantID string) (Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.BaseURL+"/v1/quotas/"+url.PathEscape(tenantID)+"/status", nil)
+	if err != nil {
+		return Status{}, err
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", c.cfg.APIKey)
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return Status{}, fmt.Errorf("fetch quota status for %s: %w", tenantID, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("fetch quota status for %s: status %d: %s", tenantID, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var status Status
+	if err := json.Unmarshal(body, &status); err != nil {
+		return Status{}, fmt.Errorf("decode quota status for %s: %w", tenantID, err)
+	}
+	return status, nil
+}
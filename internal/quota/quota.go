@@ -0,0 +1,249 @@
+// Package quota defines per-tenant usage limits and the router-side client
+// that enforces them before a run.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Metric names a quota dimension and its reset window. Windows are UTC
+// calendar days and months.
+type Metric string
+
+const (
+	InvocationsPerDay   Metric = "invocations_per_day"
+	InvocationsPerMonth Metric = "invocations_per_month"
+	TokensPerDay        Metric = "tokens_per_day"
+	TokensPerMonth      Metric = "tokens_per_month"
+	// SpendPerMonth caps month-to-date pre-tax charges in the tenant's
+	// invoice currency.
+	SpendPerMonth Metric = "spend_per_month"
+)
+
+var Metrics = []Metric{InvocationsPerDay, InvocationsPerMonth, TokensPerDay, TokensPerMonth, SpendPerMonth}
+
+func ParseMetric(raw string) (Metric, error) {
+	m := Metric(strings.ToLower(strings.TrimSpace(raw)))
+	for _, known := range Metrics {
+		if m == known {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown quota metric %q", raw)
+}
+
+// Window returns the [start, end) window containing at.
+func (m Metric) Window(at time.Time) (time.Time, time.Time) {
+	at = at.UTC()
+	if m == InvocationsPerDay || m == TokensPerDay {
+		start := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+	start := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// countsInvocations reports whether the metric counts invocations.
+func (m Metric) countsInvocations() bool {
+	return m == InvocationsPerDay || m == InvocationsPerMonth
+}
+
+func (m Metric) countsTokens() bool {
+	return m == TokensPerDay || m == TokensPerMonth
+}
+
+// Limit is a soft (warn) and hard (block) threshold for one metric. A zero
+// threshold is not enforced.
+type Limit struct {
+	Metric Metric         `json:"metric"`
+	Soft   billing.Amount `json:"soft,omitempty"`
+	Hard   billing.Amount `json:"hard,omitempty"`
+}
+
+func (l Limit) Validate() error {
+	if _, err := ParseMetric(string(l.Metric)); err != nil {
+		return err
+	}
+	if l.Soft < 0 || l.Hard < 0 {
+		return fmt.Errorf("quota %s: thresholds must be >= 0", l.Metric)
+	}
+	if l.Soft == 0 && l.Hard == 0 {
+		return fmt.Errorf("quota %s: soft or hard threshold is required", l.Metric)
+	}
+	if l.Soft > 0 && l.Hard > 0 && l.Soft > l.Hard {
+		return fmt.Errorf("quota %s: soft threshold exceeds hard threshold", l.Metric)
+	}
+	if l.Metric != SpendPerMonth && (l.Soft.Round(0) != l.Soft || l.Hard.Round(0) != l.Hard) {
+		return fmt.Errorf("quota %s: thresholds must be whole numbers", l.Metric)
+	}
+	return nil
+}
+
+// State is the outcome of evaluating usage against limits.
+type State string
+
+const (
+	StateOK       State = "ok"
+	StateWarn     State = "warn"
+	StateExceeded State = "exceeded"
+)
+
+func (s State) rank() int {
+	switch s {
+	case StateExceeded:
+		return 2
+	case StateWarn:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Check is one limit evaluated against current usage. Remaining is measured
+// against the hard threshold and is omitted when there is none.
+type Check struct {
+	Limit
+	Used      billing.Amount   `json:"used"`
+	Remaining *billing.Amount  `json:"remaining,omitempty"`
+	Currency  billing.Currency `json:"currency,omitempty"`
+	State     State            `json:"state"`
+	ResetsAt  time.Time        `json:"resets_at"`
+}
+
+// Evaluate derives a check's state from its usage.
+func Evaluate(l Limit, used billing.Amount, currency billing.Currency, resetsAt time.Time) Check {
+	c := Check{Limit: l, Used: used, State: StateOK, ResetsAt: resetsAt}
+	if l.Metric == SpendPerMonth {
+		c.Currency = currency
+	}
+	if l.Hard > 0 {
+		remaining := l.Hard - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Remaining = &remaining
+		if used >= l.Hard {
+			c.State = StateExceeded
+			return c
+		}
+	}
+	if l.Soft > 0 && used >= l.Soft {
+		c.State = StateWarn
+	}
+	return c
+}
+
+// Credits is a prepaid tenant's credit position. With BlockAtZero an empty
+// balance is exceeded; otherwise it only warns, as usage is billed instead.
+type Credits struct {
+	Balance     billing.Money `json:"balance"`
+	BlockAtZero bool          `json:"block_at_zero"`
+	State       State         `json:"state"`
+}
+
+// EvaluateCredits derives the credit state from a balance.
+func EvaluateCredits(balance billing.Money, blockAtZero bool) Credits {
+	c := Credits{Balance: balance, BlockAtZero: blockAtZero, State: StateOK}
+	if balance.Amount <= 0 {
+		c.State = StateWarn
+		if blockAtZero {
+			c.State = StateExceeded
+		}
+	}
+	return c
+}
+
+// Status is a tenant's quota position at AsOf. State is the worst state of
+// its checks and credits.
+type Status struct {
+	TenantID string    `json:"tenant_id"`
+	AsOf     time.Time `json:"as_of"`
+	State    State     `json:"state"`
+	Checks   []Check   `json:"checks"`
+	Credits  *Credits  `json:"credits,omitempty"`
+}
+
+// NewStatus builds a status and derives its overall state.
+func NewStatus(tenantID string, asOf time.Time, checks []Check) Status {
+	s := Status{TenantID: tenantID, AsOf: asOf.UTC(), State: StateOK, Checks: checks}
+	if s.Checks == nil {
+		s.Checks = []Check{}
+	}
+	for _, c := range checks {
+		if c.State.rank() > s.State.rank() {
+			s.State = c.State
+		}
+	}
+	return s
+}
+
+// WithCredits attaches a credit position and folds it into State.
+func (s Status) WithCredits(c Credits) Status {
+	s.Credits = &c
+	if c.State.rank() > s.State.rank() {
+		s.State = c.State
+	}
+	return s
+}
+
+// Admit reports whether a run of the given invocation count fits within hard
+// limits. Invocation quotas must have room for the whole run; token and spend
+// quotas block once exhausted since their cost is not known up front.
+func (s Status) Admit(invocations int64) error {
+	if s.Credits != nil && s.Credits.State == StateExceeded {
+		return fmt.Errorf("%w: tenant %q prepaid credit balance is %s", ErrQuotaExceeded, s.TenantID, s.Credits.Balance)
+	}
+	for _, c := range s.Checks {
+		if c.Hard == 0 {
+			continue
+		}
+		blocked := c.State == StateExceeded
+		if c.Metric.countsInvocations() && c.Used+billing.AmountFromInt(invocations) > c.Hard {
+			blocked = true
+		}
+		if blocked {
+			return fmt.Errorf("%w: tenant %q %s used %s of hard limit %s, run needs %d invocation(s); resets at %s",
+				ErrQuotaExceeded, s.TenantID, c.Metric, c.Used, c.Hard, invocations, c.ResetsAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Warnings returns checks past their soft threshold.
+func (s Status) Warnings() []Check {
+	out := make([]Check, 0)
+	for _, c := range s.Checks {
+		if c.State == StateWarn {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Consume adds locally observed usage so a cached status stays conservative
+// until it is refreshed. Spend and credit drawdown are not estimated locally.
+func (s Status) Consume(invocations int64, tokens int64) Status {
+	checks := make([]Check, 0, len(s.Checks))
+	for _, c := range s.Checks {
+		used := c.Used
+		switch {
+		case c.Metric.countsInvocations():
+			used += billing.AmountFromInt(invocations)
+		case c.Metric.countsTokens():
+			used += billing.AmountFromInt(tokens)
+		}
+		checks = append(checks, Evaluate(c.Limit, used, c.Currency, c.ResetsAt))
+	}
+	out := NewStatus(s.TenantID, s.AsOf, checks)
+	if s.Credits != nil {
+		out = out.WithCredits(*s.Credits)
+	}
+	return out
+}
@@ -0,0 +1,331 @@
+// Package redact scrubs personal data and secrets from what FluxRoute
+// persists: trace payloads, metadata and errors, audit events, logs and
+// exports. Values are found by JSON path rules and by regex detectors, and
+// are either masked or replaced by tokens that the holder of the local key
+// can reveal again.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/your-org/fluxroute/internal/jsonpath"
+)
+
+// Modes of replacing a sensitive value.
+const (
+	// ModeMask replaces values with [redacted:<rule>].
+	ModeMask = "mask"
+	// ModeTokenize replaces values with [tok:<rule>:<ciphertext>], which
+	// Reveal turns back into the value given the key.
+	ModeTokenize = "tokenize"
+)
+
+// Built-in detectors.
+const (
+	DetectorEmail  = "email"
+	DetectorAPIKey = "api_key"
+	DetectorCard   = "card"
+)
+
+// fieldRule names values redacted by a field path rather than a detector.
+const fieldRule = "field"
+
+// Pattern is a custom regex detector. Name labels its replacements.
+type Pattern struct {
+	Name  string `yaml:"name"`
+	Regex string `yaml:"regex"`
+}
+
+// Config is the redaction section of a manifest, applying to everything
+// recorded for the manifest's namespace. Fields are jsonpath patterns into
+// agent payloads whose whole value is redacted; Detectors and Patterns are
+// matched in every payload string, metadata value and error message.
+type Config struct {
+	Fields    []string  `yaml:"fields,omitempty"`
+	Detectors []string  `yaml:"detectors,omitempty"`
+	Patterns  []Pattern `yaml:"patterns,omitempty"`
+	// Mode is mask (default) or tokenize.
+	Mode string `yaml:"mode,omitempty"`
+	// KeyFile holds the tokenization key; REDACTION_KEY_FILE and
+	// REDACTION_KEY are used when empty.
+	KeyFile string `yaml:"key_file,omitempty"`
+}
+
+// Enabled reports whether the config redacts anything.
+func (c Config) Enabled() bool {
+	return len(c.Fields) > 0 || len(c.Detectors) > 0 || len(c.Patterns) > 0
+}
+
+var ruleName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Validate checks rule syntax without loading the key.
+func (c Config) Validate() error {
+	switch c.Mode {
+	case "", ModeMask, ModeTokenize:
+	default:
+		return fmt.Errorf("invalid mode %q (want mask|tokenize)", c.Mode)
+	}
+	for _, f := range c.Fields {
+		if _, err := jsonpath.Parse(f); err != nil {
+			return fmt.Errorf("field %q: %w", f, err)
+		}
+	}
+	for _, d := range c.Detectors {
+		if _, ok := builtins[d]; !ok {
+			return fmt.Errorf("unknown detector %q (want email|api_key|card)", d)
+		}
+	}
+	for _, p := range c.Patterns {
+		if !ruleName.MatchString(p.Name) || p.Name == fieldRule {
+			return fmt.Errorf("pattern name %q must be lowercase letters, digits and _ (and not %q)", p.Name, fieldRule)
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("pattern %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+var builtins = map[string]detector{
+	DetectorEmail: {name: DetectorEmail, re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	DetectorAPIKey: {name: DetectorAPIKey, re: regexp.MustCompile(
+		`\b(?:sk-[A-Za-z0-9_-]{16,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abposr]-[A-Za-z0-9-]{10,})|(?i:\bbearer\s+[A-Za-z0-9._~+/=-]{16,})`)},
+	DetectorCard: {name: DetectorCard, re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum, which card
+// numbers do and most other long digit runs do not.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Redactor applies one Config. A nil Redactor leaves everything unchanged.
+type Redactor struct {
+	fields    [][]jsonpath.Seg
+	detectors []detector
+	tokens    *tokenizer
+}
+
+// New builds a Redactor from cfg. key is required in tokenize mode and
+// ignored otherwise. It returns nil when cfg redacts nothing.
+func New(cfg Config, key []byte) (*Redactor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("redact: %w", err)
+	}
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	r := &Redactor{}
+	for _, f := range cfg.Fields {
+		segs, _ := jsonpath.Parse(f)
+		r.fields = append(r.fields, segs)
+	}
+	for _, d := range cfg.Detectors {
+		r.detectors = append(r.detectors, builtins[d])
+	}
+	for _, p := range cfg.Patterns {
+		r.detectors = append(r.detectors, detector{name: p.Name, re: regexp.MustCompile(p.Regex)})
+	}
+	if cfg.Mode == ModeTokenize {
+		t, err := newTokenizer(key)
+		if err != nil {
+			return nil, err
+		}
+		r.tokens = t
+	}
+	return r, nil
+}
+
+// FromConfig builds a Redactor from cfg, loading the key in tokenize mode.
+func FromConfig(cfg Config) (*Redactor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("redact: %w", err)
+	}
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	var key []byte
+	if cfg.Mode == ModeTokenize {
+		var err error
+		if key, err = LoadKey(cfg.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+	return New(cfg, key)
+}
+
+// replace masks or tokenizes one value found by rule.
+func (r *Redactor) replace(rule string, value string) string {
+	if r.tokens == nil {
+		return "[redacted:" + rule + "]"
+	}
+	return r.tokens.token(rule, value)
+}
+
+// RedactText replaces every detector match in s. Tokens and masks already
+// in s are left alone, so redacting twice changes nothing.
+func (r *Redactor) RedactText(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, d := range r.detectors {
+		s = outsideReplacements(s, func(part string) string {
+			return d.re.ReplaceAllStringFunc(part, func(m string) string {
+				if d.valid != nil && !d.valid(m) {
+					return m
+				}
+				return r.replace(d.name, m)
+			})
+		})
+	}
+	return s
+}
+
+// outsideReplacements applies fn to the parts of s between masks and tokens.
+func outsideReplacements(s string, fn func(string) string) string {
+	spans := replacementIn.FindAllStringIndex(s, -1)
+	if len(spans) == 0 {
+		return fn(s)
+	}
+	var b strings.Builder
+	last := 0
+	for _, sp := range spans {
+		b.WriteString(fn(s[last:sp[0]]))
+		b.WriteString(s[sp[0]:sp[1]])
+		last = sp[1]
+	}
+	b.WriteString(fn(s[last:]))
+	return b.String()
+}
+
+// RedactPayload redacts an agent payload. JSON payloads have the values at
+// field paths replaced whole and detectors applied to every string; any
+// other payload is redacted as text. Payloads with nothing to redact are
+// returned as they were, byte for byte.
+func (r *Redactor) RedactPayload(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	v, ok := decodeJSON(b)
+	if !ok {
+		if s := r.RedactText(string(b)); s != string(b) {
+			return []byte(s)
+		}
+		return b
+	}
+	out, changed := r.redactValue(nil, v)
+	if !changed {
+		return b
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(out); err != nil {
+		return b
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+func (r *Redactor) redactValue(path []jsonpath.Seg, v any) (any, bool) {
+	if len(path) > 0 && slices.ContainsFunc(r.fields, func(f []jsonpath.Seg) bool { return jsonpath.Match(f, path) }) {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return v, false
+		}
+		text := string(raw)
+		if s, ok := v.(string); ok {
+			text = s
+			if isReplacement(s) {
+				return v, false
+			}
+		}
+		return r.replace(fieldRule, text), true
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		changed := false
+		for k, child := range t {
+			if nv, c := r.redactValue(jsonpath.Append(path, jsonpath.Key(k)), child); c {
+				t[k], changed = nv, true
+			}
+		}
+		return t, changed
+	case []any:
+		changed := false
+		for i, child := range t {
+			if nv, c := r.redactValue(jsonpath.Append(path, jsonpath.Index(i)), child); c {
+				t[i], changed = nv, true
+			}
+		}
+		return t, changed
+	case string:
+		if s := r.RedactText(t); s != t {
+			return s, true
+		}
+	}
+	return v, false
+}
+
+// RedactMap returns m with every value redacted as text; m is not modified.
+func (r *Redactor) RedactMap(m map[string]string) map[string]string {
+	if r == nil || m == nil {
+		return m
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = r.RedactText(v)
+	}
+	return out
+}
+
+var replacementIn = regexp.MustCompile(`\[(?:redacted:[a-z0-9_]+|tok:[a-z0-9_]+:[A-Za-z0-9_-]+)\]`)
+
+// Redacted reports whether s holds a mask or token.
+func Redacted(s string) bool {
+	return replacementIn.MatchString(s)
+}
+
+func isReplacement(s string) bool {
+	loc := replacementIn.FindStringIndex(s)
+	return loc != nil && loc[0] == 0 && loc[1] == len(s)
+}
+
+func decodeJSON(b []byte) (any, bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' && b[0] != '[' {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
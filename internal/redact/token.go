@@ -0,0 +1,225 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// KeySize is the length of a tokenization key in bytes.
+const KeySize = 32
+
+// ErrNoKey is returned when tokenization or Reveal has no key configured.
+var ErrNoKey = errors.New("redact: no key (set key_file, REDACTION_KEY_FILE or REDACTION_KEY)")
+
+// tokenizer encrypts values deterministically: the nonce is derived from
+// the value, so equal values get equal tokens and traces recorded with the
+// same key still diff cleanly. The price is that equality of two redacted
+// values is visible.
+type tokenizer struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+func newTokenizer(key []byte) (*tokenizer, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("redact: key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(derive(key, "fluxroute redact encryption"))
+	if err != nil {
+		return nil, fmt.Errorf("redact: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("redact: %w", err)
+	}
+	return &tokenizer{aead: aead, macKey: derive(key, "fluxroute redact nonce")}, nil
+}
+
+func derive(key []byte, purpose string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(purpose))
+	return m.Sum(nil)
+}
+
+// token encrypts value, binding the rule name as additional data.
+func (t *tokenizer) token(rule string, value string) string {
+	m := hmac.New(sha256.New, t.macKey)
+	m.Write([]byte(rule))
+	m.Write([]byte{0})
+	m.Write([]byte(value))
+	nonce := m.Sum(nil)[:t.aead.NonceSize()]
+	sealed := t.aead.Seal(nonce, nonce, []byte(value), []byte(rule))
+	return "[tok:" + rule + ":" + base64.RawURLEncoding.EncodeToString(sealed) + "]"
+}
+
+// open decrypts a token's ciphertext.
+func (t *tokenizer) open(rule string, encoded string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < t.aead.NonceSize() {
+		return "", fmt.Errorf("redact: malformed %s token", rule)
+	}
+	n := t.aead.NonceSize()
+	plain, err := t.aead.Open(nil, sealed[:n], sealed[n:], []byte(rule))
+	if err != nil {
+		return "", fmt.Errorf("redact: %s token was not created with this key", rule)
+	}
+	return string(plain), nil
+}
+
+var tokenRe = regexp.MustCompile(`\[tok:([a-z0-9_]+):([A-Za-z0-9_-]+)\]`)
+
+// Revealer turns tokens back into the values they stand for. Its methods
+// mirror Redactor's, so it applies wherever a Redactor does, for example
+// to a whole trace through trace.Redact. Masked values cannot be revealed.
+type Revealer struct {
+	t   *tokenizer
+	n   int
+	err error
+}
+
+// NewRevealer returns a Revealer for tokens created with key.
+func NewRevealer(key []byte) (*Revealer, error) {
+	t, err := newTokenizer(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Revealer{t: t}, nil
+}
+
+// Revealed is the number of tokens revealed so far.
+func (v *Revealer) Revealed() int { return v.n }
+
+// Err is the first token that failed to decrypt, if any.
+func (v *Revealer) Err() error { return v.err }
+
+// RedactText reveals the tokens in s.
+func (v *Revealer) RedactText(s string) string {
+	return tokenRe.ReplaceAllStringFunc(s, func(tok string) string {
+		m := tokenRe.FindStringSubmatch(tok)
+		plain, err := v.t.open(m[1], m[2])
+		if err != nil {
+			if v.err == nil {
+				v.err = err
+			}
+			return tok
+		}
+		v.n++
+		return plain
+	})
+}
+
+// RedactPayload reveals the tokens in a payload. In JSON payloads each
+// string is revealed on its own, so the result stays valid JSON.
+func (v *Revealer) RedactPayload(b []byte) []byte {
+	if !tokenRe.Match(b) {
+		return b
+	}
+	doc, ok := decodeJSON(b)
+	if !ok {
+		return []byte(v.RedactText(string(b)))
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(mapStrings(doc, v.RedactText)); err != nil {
+		return b
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// RedactMap reveals the tokens in every value of m.
+func (v *Revealer) RedactMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, s := range m {
+		out[k] = v.RedactText(s)
+	}
+	return out
+}
+
+// mapStrings applies fn to every string in a decoded JSON document.
+func mapStrings(doc any, fn func(string) string) any {
+	switch t := doc.(type) {
+	case map[string]any:
+		for k, child := range t {
+			t[k] = mapStrings(child, fn)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = mapStrings(child, fn)
+		}
+	case string:
+		return fn(t)
+	}
+	return doc
+}
+
+// Reveal replaces every token in s with the value it stands for and
+// returns how many it replaced.
+func Reveal(s string, key []byte) (string, int, error) {
+	v, err := NewRevealer(key)
+	if err != nil {
+		return "", 0, err
+	}
+	out := v.RedactText(s)
+	if v.err != nil {
+		return "", 0, v.err
+	}
+	return out, v.n, nil
+}
+
+// LoadKey reads the tokenization key from path, or when path is empty from
+// the file named by REDACTION_KEY_FILE or the REDACTION_KEY variable. Keys
+// are 32 bytes written as hex or base64.
+func LoadKey(path string) ([]byte, error) {
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("REDACTION_KEY_FILE"))
+	}
+	text := ""
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("redact: read key: %w", err)
+		}
+		text = string(b)
+	} else {
+		text = os.Getenv("REDACTION_KEY")
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrNoKey
+	}
+	if key, err := hex.DecodeString(text); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("redact: key must be %d bytes as hex or base64", KeySize)
+}
+
+// GenerateKey returns a new random key, hex encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("redact: generate key: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
@@ -91,3 +91,21 @@ func (cb *CircuitBreaker) RecordFailure(agentID string, policy agentfunc.Circuit
 	}
 	cb.states[agentID] = s
 }
+
+// State reports an agent's breaker state as "closed", "open" or
+// "half_open". An open breaker whose reset timeout has passed stays "open"
+// until Allow admits the probe.
+func (cb *CircuitBreaker) State(agentID string) string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	s := cb.states[agentID]
+	switch {
+	case s.halfOpenProbeActive:
+		return "half_open"
+	case !s.openUntil.IsZero():
+		return "open"
+	default:
+		return "closed"
+	}
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/your-org/fluxroute/internal/agent"
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+// ErrTraceWithoutPolicy marks traces recorded before invocations carried
+// their retry and breaker policy; they can only be replayed output by output.
+var ErrTraceWithoutPolicy = errors.New("trace does not record invocation policies")
+
+// errReplayRetryable is the only retryable error of a replayed plan; replayed
+// agent errors match it when the recorded error was retryable.
+var errReplayRetryable = errors.New("replay: retryable")
+
+// replayedError reproduces a recorded agent error: the same message, and the
+// same retry eligibility the engine classified it with.
+type replayedError struct {
+	msg       string
+	retryable bool
+}
+
+func (e replayedError) Error() string { return e.msg }
+
+func (e replayedError) Is(target error) bool {
+	return e.retryable && target == errReplayRetryable
+}
+
+// PlanFromTrace rebuilds the plan recorded in tr: its invocations, inputs,
+// dependencies and the retry and breaker policy each invocation ran with.
+func PlanFromTrace(tr trace.ExecutionTrace) (ExecutionPlan, error) {
+	return planFromTrace(tr, true)
+}
+
+// planFromTrace rebuilds the recorded plan. Without requirePolicy,
+// invocations recorded without a policy get the engine defaults.
+func planFromTrace(tr trace.ExecutionTrace, requirePolicy bool) (ExecutionPlan, error) {
+	first := make(map[string]trace.Step)
+	policies := make(map[string]*trace.Policy)
+	for _, s := range tr.Steps {
+		if s.AgentID == "router" && s.InvocationID == "plan_validation" {
+			return ExecutionPlan{}, fmt.Errorf("trace records a plan that failed validation: %s", s.Error)
+		}
+		if f, ok := first[s.InvocationID]; !ok || s.Attempt < f.Attempt {
+			first[s.InvocationID] = s
+		}
+		if s.Policy != nil {
+			policies[s.InvocationID] = s.Policy
+		}
+	}
+	if len(first) == 0 {
+		return ExecutionPlan{}, errors.New("trace has no steps")
+	}
+
+	nodes := make([]PlanNode, 0, len(first))
+	for id, s := range first {
+		p, ok := policies[id]
+		if !ok {
+			if requirePolicy {
+				return ExecutionPlan{}, fmt.Errorf("%w: invocation %s", ErrTraceWithoutPolicy, id)
+			}
+			p = &trace.Policy{}
+		}
+		nodes = append(nodes, PlanNode{
+			Invocation: AgentInvocation{ID: id, AgentID: s.AgentID, Version: s.AgentVersion, Input: s.Input},
+			DependsOn:  append([]string(nil), s.DependsOn...),
+			RetryPolicy: agentfunc.RetryPolicy{
+				MaxAttempts: p.MaxAttempts,
+				Backoff:     p.Backoff,
+			},
+			CircuitBreakerPolicy: agentfunc.CircuitBreakerPolicy{
+				FailureThreshold: p.FailureThreshold,
+				ResetTimeout:     p.ResetTimeout,
+				ProbeTimeout:     p.ProbeTimeout,
+			},
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := first[nodes[i].Invocation.ID], first[nodes[j].Invocation.ID]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		return a.InvocationID < b.InvocationID
+	})
+	return ExecutionPlan{TaskID: tr.TaskID, Nodes: nodes}, nil
+}
+
+// Replay re-runs the plan recorded in tr through an Engine on a virtual
+// clock starting at the trace's start time. Every agent answers each attempt
+// the way it did in the recording, taking the recorded duration of virtual
+// time, so the engine's own decisions (retries, backoff, breaker admission
+// and transitions, dependency skips) are what gets checked. It returns the
+// replayed trace and its attempt-by-attempt divergences from tr.
+func Replay(ctx context.Context, tr trace.ExecutionTrace) (trace.ExecutionTrace, []trace.Divergence, error) {
+	plan, err := PlanFromTrace(tr)
+	if err != nil {
+		return trace.ExecutionTrace{}, nil, err
+	}
+	for i := range plan.Nodes {
+		plan.Nodes[i].RetryPolicy.RetryableErrs = []error{errReplayRetryable}
+	}
+	clock := NewVirtualClock(tr.StartTime)
+	registry, err := replayRegistry(tr, clock)
+	if err != nil {
+		return trace.ExecutionTrace{}, nil, err
+	}
+
+	engine := NewEngine(registry, agentfunc.RouterConfig{WorkerPoolSize: len(plan.Nodes)})
+	engine.SetClock(clock)
+	engine.SetAttributes(tr.Attributes)
+	_, replayed := engine.RunPlan(ctx, plan)
+	return replayed, trace.CompareAttempts(tr, replayed), nil
+}
+
+// replayRegistry registers, for every agent version the recording called, a
+// stub that plays back its recorded attempts per request in order. Agents
+// the recording found unregistered stay unregistered.
+func replayRegistry(tr trace.ExecutionTrace, clock *VirtualClock) (*agent.Registry, error) {
+	type key struct{ agentID, requestID string }
+	var mu sync.Mutex
+	recorded := make(map[key][]trace.Step)
+	versions := make(map[string]map[string]bool)
+	for _, s := range tr.Steps {
+		if strings.HasPrefix(s.Error, "agent not registered:") {
+			continue
+		}
+		if versions[s.AgentID] == nil {
+			versions[s.AgentID] = make(map[string]bool)
+		}
+		versions[s.AgentID][s.AgentVersion] = true
+		if s.Attempt > 0 && !s.BreakerRejected {
+			k := key{s.AgentID, s.Input.RequestID}
+			recorded[k] = append(recorded[k], s)
+		}
+	}
+	for _, steps := range recorded {
+		sort.SliceStable(steps, func(i, j int) bool {
+			if !steps[i].StartTime.Equal(steps[j].StartTime) {
+				return steps[i].StartTime.Before(steps[j].StartTime)
+			}
+			return steps[i].Seq < steps[j].Seq
+		})
+	}
+
+	registry := agent.NewRegistry()
+	for agentID, agentVersions := range versions {
+		stub := func(_ context.Context, in agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+			k := key{agentID, in.RequestID}
+			mu.Lock()
+			queue := recorded[k]
+			if len(queue) == 0 {
+				mu.Unlock()
+				return agentfunc.AgentOutput{}, replayedError{msg: fmt.Sprintf("replay: no recorded attempt left for %s request %s", agentID, in.RequestID)}
+			}
+			s := queue[0]
+			recorded[k] = queue[1:]
+			mu.Unlock()
+
+			clock.Advance(s.Duration)
+			if s.Error != "" {
+				return agentfunc.AgentOutput{}, replayedError{msg: s.Error, retryable: s.Retryable}
+			}
+			return s.Output, nil
+		}
+		for version := range agentVersions {
+			if err := registry.RegisterVersion(agentID, version, stub); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return registry, nil
+}
@@ -19,10 +19,15 @@ import (
 	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
+// ErrDependencyFailed marks invocations skipped because an upstream node failed.
+var ErrDependencyFailed = errors.New("dependency failed")
+
 // AgentInvocation represents a single scheduled agent call.
 type AgentInvocation struct {
 	ID      string
 	AgentID string
+	// Version selects a registered agent version; empty means v1.
+	Version string
 	Input   agentfunc.AgentInput
 }
 
@@ -54,6 +59,9 @@ type Engine struct {
 	metrics  metrics.Recorder
 	breaker  *retry.CircuitBreaker
 	tracer   oteltrace.Tracer
+	attrs    map[string]string
+	clock    Clock
+	redactor trace.Redactor
 }
 
 func NewEngine(registry *agent.Registry, cfg agentfunc.RouterConfig) *Engine {
@@ -87,6 +95,7 @@ func NewEngine(registry *agent.Registry, cfg agentfunc.RouterConfig) *Engine {
 		metrics:  metrics.NoopRecorder{},
 		breaker:  retry.NewCircuitBreaker(),
 		tracer:   otel.Tracer("fluxroute"),
+		clock:    realClock{},
 	}
 }
 
@@ -106,6 +115,31 @@ func (e *Engine) SetTracer(t oteltrace.Tracer) {
 	e.tracer = t
 }
 
+// SetClock replaces the wall clock, for example with a VirtualClock when
+// replaying a trace.
+func (e *Engine) SetClock(c Clock) {
+	if c == nil {
+		e.clock = realClock{}
+		return
+	}
+	e.clock = c
+}
+
+// SetAttributes labels every span and the execution trace of later runs,
+// for example with the tenant the run belongs to.
+func (e *Engine) SetAttributes(attrs map[string]string) {
+	e.attrs = make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		e.attrs[k] = v
+	}
+}
+
+// SetRedactor redacts the payloads, metadata and errors of every step
+// recorded in later runs' traces. Agents still see the real values.
+func (e *Engine) SetRedactor(r trace.Redactor) {
+	e.redactor = r
+}
+
 // Run executes invocations concurrently and returns deterministic ordering by invocation ID.
 func (e *Engine) Run(ctx context.Context, invocations []AgentInvocation) []AgentResult {
 	nodes := make([]PlanNode, 0, len(invocations))
@@ -118,8 +152,12 @@ func (e *Engine) Run(ctx context.Context, invocations []AgentInvocation) []Agent
 
 // RunPlan executes a dependency-aware plan with retries and full execution trace.
 func (e *Engine) RunPlan(ctx context.Context, plan ExecutionPlan) ([]AgentResult, trace.ExecutionTrace) {
-	start := time.Now()
+	start := e.clock.Now()
 	recorder := trace.NewRecorder(plan.TaskID, start)
+	recorder.SetAttributes(e.attrs)
+	if e.redactor != nil {
+		recorder.SetRedactor(e.redactor)
+	}
 
 	graph, err := buildGraph(plan)
 	if err != nil {
@@ -129,13 +167,14 @@ func (e *Engine) RunPlan(ctx context.Context, plan ExecutionPlan) ([]AgentResult
 			RequestID:    "",
 			Error:        err.Error(),
 			Attempt:      0,
+			EndTime:      e.clock.Now(),
 		})
-		return []AgentResult{{Err: err}}, recorder.Finalize(time.Now())
+		return []AgentResult{{Err: err}}, recorder.Finalize(e.clock.Now())
 	}
 
 	resultsByID := make(map[string]AgentResult, len(graph.nodes))
-	for _, level := range graph.levels {
-		levelResults := e.executeLevel(ctx, level, graph, resultsByID, recorder)
+	for depth, level := range graph.levels {
+		levelResults := e.executeLevel(ctx, depth, level, graph, resultsByID, recorder)
 		for _, r := range levelResults {
 			resultsByID[r.Invocation.ID] = r
 		}
@@ -149,11 +188,12 @@ func (e *Engine) RunPlan(ctx context.Context, plan ExecutionPlan) ([]AgentResult
 		return results[i].Invocation.ID < results[j].Invocation.ID
 	})
 
-	return results, recorder.Finalize(time.Now())
+	return results, recorder.Finalize(e.clock.Now())
 }
 
 func (e *Engine) executeLevel(
 	ctx context.Context,
+	depth int,
 	level []string,
 	graph planGraph,
 	resultsByID map[string]AgentResult,
@@ -167,14 +207,10 @@ func (e *Engine) executeLevel(
 		node := graph.nodesByID[nodeID]
 		if depErr := dependencyError(node, graph, resultsByID); depErr != nil {
 			r := AgentResult{Invocation: node.Invocation, Err: depErr}
-			recorder.AddStep(trace.Step{
-				InvocationID: node.Invocation.ID,
-				AgentID:      node.Invocation.AgentID,
-				RequestID:    node.Invocation.Input.RequestID,
-				Input:        node.Invocation.Input,
-				Error:        depErr.Error(),
-				Attempt:      0,
-			})
+			step := e.nodeStep(node, depth)
+			step.Error = depErr.Error()
+			step.EndTime = e.clock.Now()
+			recorder.AddStep(step)
 			resultCh <- r
 			continue
 		}
@@ -184,7 +220,7 @@ func (e *Engine) executeLevel(
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
-			resultCh <- e.executeNode(ctx, n, recorder)
+			resultCh <- e.executeNode(ctx, n, depth, recorder)
 		}(node)
 	}
 
@@ -201,7 +237,30 @@ func (e *Engine) executeLevel(
 	return levelResults
 }
 
-func (e *Engine) executeNode(ctx context.Context, node PlanNode, recorder *trace.Recorder) AgentResult {
+// nodeStep starts a trace step for node at the given plan depth.
+func (e *Engine) nodeStep(node PlanNode, depth int) trace.Step {
+	policy, cbPolicy := e.policies(node)
+	return trace.Step{
+		InvocationID: node.Invocation.ID,
+		AgentID:      node.Invocation.AgentID,
+		AgentVersion: node.Invocation.Version,
+		RequestID:    node.Invocation.Input.RequestID,
+		Input:        node.Invocation.Input,
+		DependsOn:    node.DependsOn,
+		Level:        depth,
+		Policy: &trace.Policy{
+			MaxAttempts:      policy.MaxAttempts,
+			Backoff:          policy.Backoff,
+			FailureThreshold: cbPolicy.FailureThreshold,
+			ResetTimeout:     cbPolicy.ResetTimeout,
+			ProbeTimeout:     cbPolicy.ProbeTimeout,
+		},
+	}
+}
+
+// policies resolves the retry and breaker policy node runs with, falling
+// back to the engine defaults.
+func (e *Engine) policies(node PlanNode) (agentfunc.RetryPolicy, agentfunc.CircuitBreakerPolicy) {
 	policy := node.RetryPolicy
 	if policy.MaxAttempts <= 0 {
 		policy = e.cfg.RetryPolicy
@@ -223,39 +282,48 @@ func (e *Engine) executeNode(ctx context.Context, node PlanNode, recorder *trace
 	if cbPolicy.ProbeTimeout <= 0 {
 		cbPolicy.ProbeTimeout = 5 * time.Second
 	}
+	return policy, cbPolicy
+}
+
+func (e *Engine) executeNode(ctx context.Context, node PlanNode, depth int, recorder *trace.Recorder) AgentResult {
+	policy, cbPolicy := e.policies(node)
 
-	fn, ok := e.registry.Get(node.Invocation.AgentID)
+	fn, ok := e.registry.GetVersion(node.Invocation.AgentID, node.Invocation.Version)
 	if !ok {
-		err := fmt.Errorf("agent not registered: %s", node.Invocation.AgentID)
+		name := node.Invocation.AgentID
+		if node.Invocation.Version != "" {
+			name = agent.VersionedID(name, node.Invocation.Version)
+		}
+		err := fmt.Errorf("agent not registered: %s", name)
 		e.metrics.ObserveInvocation(node.Invocation.AgentID, "error", 0)
-		recorder.AddStep(trace.Step{
-			InvocationID: node.Invocation.ID,
-			AgentID:      node.Invocation.AgentID,
-			RequestID:    node.Invocation.Input.RequestID,
-			Input:        node.Invocation.Input,
-			Error:        err.Error(),
-			Attempt:      1,
-		})
+		step := e.nodeStep(node, depth)
+		step.Error = err.Error()
+		step.Attempt = 1
+		step.EndTime = e.clock.Now()
+		recorder.AddStep(step)
 		return AgentResult{Invocation: node.Invocation, Err: err}
 	}
 
 	var lastErr error
+	var waited time.Duration
 	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
-		allow, halfOpenProbe := e.breaker.Allow(node.Invocation.AgentID, cbPolicy, time.Now())
+		step := e.nodeStep(node, depth)
+		step.Attempt = attempt
+		step.BackoffWaited = waited
+		step.CircuitState = e.breaker.State(node.Invocation.AgentID)
+		allow, halfOpenProbe := e.breaker.Allow(node.Invocation.AgentID, cbPolicy, e.clock.Now())
 		if !allow {
 			err := retry.NonRetryable(fmt.Errorf("%w: %s", retry.ErrCircuitOpen, node.Invocation.AgentID))
 			e.metrics.ObserveInvocation(node.Invocation.AgentID, "circuit_open", 0)
 			e.metrics.ObserveCircuitOpen(node.Invocation.AgentID)
-			recorder.AddStep(trace.Step{
-				InvocationID: node.Invocation.ID,
-				AgentID:      node.Invocation.AgentID,
-				RequestID:    node.Invocation.Input.RequestID,
-				Input:        node.Invocation.Input,
-				Error:        err.Error(),
-				Attempt:      attempt,
-			})
+			step.Error = err.Error()
+			step.BreakerRejected = true
+			step.CircuitAfter = e.breaker.State(node.Invocation.AgentID)
+			step.EndTime = e.clock.Now()
+			recorder.AddStep(step)
 			return AgentResult{Invocation: node.Invocation, Err: err}
 		}
+		step.Probe = halfOpenProbe
 
 		timeout := e.cfg.DefaultTimeout
 		if halfOpenProbe && cbPolicy.ProbeTimeout > 0 && cbPolicy.ProbeTimeout < timeout {
@@ -270,12 +338,17 @@ func (e *Engine) executeNode(ctx context.Context, node PlanNode, recorder *trace
 				attribute.String("agent.id", node.Invocation.AgentID),
 				attribute.Int("agent.attempt", attempt),
 			),
+			oteltrace.WithAttributes(e.spanAttributes()...),
 		)
-		started := time.Now()
+		started := e.clock.Now()
 		out, err := safeCall(fn, runCtx, node.Invocation.Input)
 		cancel()
-		duration := time.Since(started)
+		ended := e.clock.Now()
+		duration := ended.Sub(started)
 		err = normalizeInvocationError(err)
+		step.StartTime, step.EndTime = started, ended
+		step.Output = out
+		step.Duration = duration
 
 		if err == nil {
 			if out.Duration == 0 {
@@ -283,47 +356,38 @@ func (e *Engine) executeNode(ctx context.Context, node PlanNode, recorder *trace
 			}
 			e.breaker.RecordSuccess(node.Invocation.AgentID)
 			e.metrics.ObserveInvocation(node.Invocation.AgentID, "success", out.Duration)
-			recorder.AddStep(trace.Step{
-				InvocationID: node.Invocation.ID,
-				AgentID:      node.Invocation.AgentID,
-				RequestID:    node.Invocation.Input.RequestID,
-				Input:        node.Invocation.Input,
-				Output:       out,
-				Duration:     duration,
-				Attempt:      attempt,
-			})
+			step.Output = out
+			step.CircuitAfter = e.breaker.State(node.Invocation.AgentID)
+			recorder.AddStep(step)
 			span.SetAttributes(attribute.String("status", "success"))
 			span.End()
 			return AgentResult{Invocation: node.Invocation, Output: out}
 		}
 
 		lastErr = err
-		e.breaker.RecordFailure(node.Invocation.AgentID, cbPolicy, time.Now())
+		e.breaker.RecordFailure(node.Invocation.AgentID, cbPolicy, e.clock.Now())
 		e.metrics.ObserveInvocation(node.Invocation.AgentID, "error", duration)
-		recorder.AddStep(trace.Step{
-			InvocationID: node.Invocation.ID,
-			AgentID:      node.Invocation.AgentID,
-			RequestID:    node.Invocation.Input.RequestID,
-			Input:        node.Invocation.Input,
-			Output:       out,
-			Error:        err.Error(),
-			Duration:     duration,
-			Attempt:      attempt,
-		})
+		retryable := shouldRetry(err, policy)
+		retrying := attempt < policy.MaxAttempts && retryable
+		step.Error = err.Error()
+		step.CircuitAfter = e.breaker.State(node.Invocation.AgentID)
+		step.Retried = retrying
+		step.Retryable = retryable
+		recorder.AddStep(step)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		span.SetAttributes(attribute.String("status", "error"))
 		span.End()
 
-		if attempt == policy.MaxAttempts || !shouldRetry(err, policy) {
+		if !retrying {
 			break
 		}
 		e.metrics.ObserveRetry(node.Invocation.AgentID)
-		select {
-		case <-ctx.Done():
-			return AgentResult{Invocation: node.Invocation, Err: ctx.Err()}
-		case <-time.After(retry.BackoffDuration(policy.Backoff, attempt)):
+		backoffStart := e.clock.Now()
+		if err := e.clock.Sleep(ctx, retry.BackoffDuration(policy.Backoff, attempt)); err != nil {
+			return AgentResult{Invocation: node.Invocation, Err: err}
 		}
+		waited = e.clock.Now().Sub(backoffStart)
 	}
 
 	return AgentResult{Invocation: node.Invocation, Err: lastErr}
@@ -380,7 +444,7 @@ func dependencyError(node PlanNode, graph planGraph, results map[string]AgentRes
 			return fmt.Errorf("dependency result missing: %s", depID)
 		}
 		if depResult.Err != nil {
-			return fmt.Errorf("dependency failed: %s: %v", depID, depResult.Err)
+			return fmt.Errorf("%w: %s: %v", ErrDependencyFailed, depID, depResult.Err)
 		}
 		if _, exists := graph.nodesByID[depID]; !exists {
 			return fmt.Errorf("dependency missing in graph: %s", depID)
@@ -470,3 +534,16 @@ func inferTaskID(invocations []AgentInvocation) string {
 	}
 	return "task_default"
 }
+
+func (e *Engine) spanAttributes() []attribute.KeyValue {
+	keys := make([]string, 0, len(e.attrs))
+	for k := range e.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, attribute.String(k, e.attrs[k]))
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/your-org/fluxroute/internal/agent"
+	"github.com/your-org/fluxroute/internal/redact"
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+// ErrUnknownInvocation is returned when a what-if replay starts from an
+// invocation the trace does not contain.
+var ErrUnknownInvocation = errors.New("invocation not in trace")
+
+// ErrRedactedInput is returned when an invocation a what-if replay would
+// re-execute recorded its input with masked or tokenized values, which the
+// agent would receive instead of the originals.
+var ErrRedactedInput = errors.New("invocation input is redacted")
+
+// reusedVersion is the registry version a what-if replay serves an
+// invocation's recorded outcome under.
+const reusedVersion = "recorded:"
+
+// WhatIf describes a counterfactual replay: starting at invocation From,
+// run AgentVersion of its agent instead of the recorded version, and/or
+// feed it Payload instead of its recorded input payload.
+type WhatIf struct {
+	From         string
+	AgentVersion string
+	Payload      []byte
+}
+
+// ReplayFrom re-runs the plan recorded in tr with the change described by
+// w. Invocations outside From and its descendants are not executed: each
+// returns its recorded final outcome and is marked Reused in the new trace.
+// From and its descendants run the recorded versions of the agents in
+// registry, From with the overridden version or payload. Their inputs must
+// not be redacted: reveal tokens in tr first (see redact.Revealer).
+func ReplayFrom(ctx context.Context, tr trace.ExecutionTrace, registry *agent.Registry, w WhatIf) (trace.ExecutionTrace, error) {
+	plan, err := planFromTrace(tr, false)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	rerun, err := descendants(plan, w.From)
+	if err != nil {
+		return trace.ExecutionTrace{}, err
+	}
+	final := finalSteps(tr)
+
+	dispatch := agent.NewRegistry()
+	registered := make(map[string]bool)
+	for i := range plan.Nodes {
+		node := &plan.Nodes[i]
+		id, agentID := node.Invocation.ID, node.Invocation.AgentID
+		if !rerun[id] {
+			node.Invocation.Version = reusedVersion + id
+			node.RetryPolicy = agentfunc.RetryPolicy{MaxAttempts: 1}
+			node.CircuitBreakerPolicy = agentfunc.CircuitBreakerPolicy{}
+			if err := dispatch.RegisterVersion(agentID, node.Invocation.Version, recordedOutcome(final[id])); err != nil {
+				return trace.ExecutionTrace{}, err
+			}
+			continue
+		}
+
+		if id == w.From {
+			if w.AgentVersion != "" {
+				node.Invocation.Version = w.AgentVersion
+			}
+			if w.Payload != nil {
+				node.Invocation.Input.Payload = append([]byte(nil), w.Payload...)
+			}
+		}
+		if redactedInput(node.Invocation.Input) {
+			return trace.ExecutionTrace{}, fmt.Errorf("%w: %s", ErrRedactedInput, id)
+		}
+		versioned := agent.VersionedID(agentID, node.Invocation.Version)
+		if registered[versioned] {
+			continue
+		}
+		fn, ok := registry.GetVersion(agentID, node.Invocation.Version)
+		if !ok {
+			if id == w.From && w.AgentVersion != "" {
+				return trace.ExecutionTrace{}, fmt.Errorf("agent version not registered: %s", versioned)
+			}
+			continue
+		}
+		if err := dispatch.RegisterVersion(agentID, node.Invocation.Version, fn); err != nil {
+			return trace.ExecutionTrace{}, err
+		}
+		registered[versioned] = true
+	}
+
+	engine := NewEngine(dispatch, agentfunc.RouterConfig{WorkerPoolSize: len(plan.Nodes)})
+	engine.SetAttributes(tr.Attributes)
+	_, replayed := engine.RunPlan(ctx, plan)
+	for i := range replayed.Steps {
+		s := &replayed.Steps[i]
+		if !rerun[s.InvocationID] {
+			s.Reused = true
+			s.AgentVersion = ""
+			s.Duration = final[s.InvocationID].Duration
+		}
+	}
+	return replayed, nil
+}
+
+// descendants returns from and every invocation that transitively depends
+// on it.
+func descendants(plan ExecutionPlan, from string) (map[string]bool, error) {
+	children := make(map[string][]string)
+	known := false
+	for _, n := range plan.Nodes {
+		if n.Invocation.ID == from {
+			known = true
+		}
+		for _, dep := range n.DependsOn {
+			children[dep] = append(children[dep], n.Invocation.ID)
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownInvocation, from)
+	}
+	out := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, c := range children[id] {
+			if !out[c] {
+				out[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+	return out, nil
+}
+
+func redactedInput(in agentfunc.AgentInput) bool {
+	if redact.Redacted(string(in.Payload)) {
+		return true
+	}
+	for _, v := range in.Metadata {
+		if redact.Redacted(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// finalSteps returns the last recorded attempt of every invocation.
+func finalSteps(tr trace.ExecutionTrace) map[string]trace.Step {
+	out := make(map[string]trace.Step)
+	steps := append([]trace.Step(nil), tr.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Attempt < steps[j].Attempt })
+	for _, s := range steps {
+		out[s.InvocationID] = s
+	}
+	return out
+}
+
+// recordedOutcome answers with the outcome s recorded.
+func recordedOutcome(s trace.Step) agentfunc.AgentFunc {
+	return func(_ context.Context, _ agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		if s.Error != "" {
+			return agentfunc.AgentOutput{}, replayedError{msg: s.Error}
+		}
+		return s.Output, nil
+	}
+}
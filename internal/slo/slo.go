@@ -0,0 +1,370 @@
+// Package slo tracks request outcomes and latency against an availability
+// objective over rolling windows.
+package slo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultObjective is the availability target when none is configured.
+const DefaultObjective = 0.999
+
+// Resolution is the width of the buckets outcomes are counted in; rolling
+// windows are accurate to one bucket.
+const Resolution = 5 * time.Minute
+
+// Retention is how long outcomes are kept, the longest reported window.
+const Retention = 30 * 24 * time.Hour
+
+// Window is a named rolling window.
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Windows are reported for every series. The short windows make the burn
+// rate useful for alerting; the long ones are the contractual periods.
+var Windows = []Window{
+	{Name: "1h", Duration: time.Hour},
+	{Name: "24h", Duration: 24 * time.Hour},
+	{Name: "7d", Duration: 7 * 24 * time.Hour},
+	{Name: "30d", Duration: Retention},
+}
+
+// LatencyBuckets are the upper bounds of the latency histogram; slower
+// observations fall into a final unbounded bucket.
+var LatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// ParseObjective accepts a fraction ("0.999") or a percentage ("99.9" or
+// "99.9%"). An empty value yields DefaultObjective.
+func ParseObjective(raw string) (float64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return DefaultObjective, nil
+	}
+	percent := strings.HasSuffix(raw, "%")
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(raw, "%")), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid objective %q", raw)
+	}
+	if percent || v > 1 {
+		v /= 100
+	}
+	if v <= 0 || v >= 1 {
+		return 0, fmt.Errorf("objective %q must be between 0 and 100%% exclusive", raw)
+	}
+	return v, nil
+}
+
+type counts struct {
+	good int64
+	bad  int64
+}
+
+type series struct {
+	buckets map[int64]*counts
+	latency []int64
+	max     time.Duration
+}
+
+// Tracker counts good and bad outcomes per key, such as an endpoint or a
+// tenant. It is safe for concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{series: make(map[string]*series)}
+}
+
+// Record counts one outcome for key at the given time.
+func (t *Tracker) Record(key string, at time.Time, latency time.Duration, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, found := t.series[key]
+	if !found {
+		s = &series{buckets: make(map[int64]*counts), latency: make([]int64, len(LatencyBuckets)+1)}
+		t.series[key] = s
+	}
+	slot := bucketOf(at)
+	c, found := s.buckets[slot]
+	if !found {
+		c = &counts{}
+		s.buckets[slot] = c
+		s.prune(slot)
+	}
+	if ok {
+		c.good++
+	} else {
+		c.bad++
+	}
+	if latency < 0 {
+		latency = 0
+	}
+	s.latency[sort.Search(len(LatencyBuckets), func(i int) bool { return latency <= LatencyBuckets[i] })]++
+	s.max = max(s.max, latency)
+}
+
+// prune drops buckets that have aged out of retention relative to slot.
+func (s *series) prune(slot int64) {
+	oldest := slot - int64(Retention/Resolution)
+	for k := range s.buckets {
+		if k < oldest {
+			delete(s.buckets, k)
+		}
+	}
+}
+
+func bucketOf(at time.Time) int64 {
+	return at.UTC().Unix() / int64(Resolution/time.Second)
+}
+
+// SeriesState is one key's counters in serializable form: good and bad
+// counts per Resolution slot, latency bucket counts and the maximum.
+type SeriesState struct {
+	Buckets map[int64][2]int64 `json:"buckets"`
+	Latency []int64            `json:"latency"`
+	MaxNS   int64              `json:"max_ns"`
+}
+
+// TrackerState is a tracker in serializable form, keyed like the tracker.
+type TrackerState map[string]SeriesState
+
+func (t *Tracker) State() TrackerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := make(TrackerState, len(t.series))
+	for k, s := range t.series {
+		ss := SeriesState{Buckets: make(map[int64][2]int64, len(s.buckets)), Latency: append([]int64(nil), s.latency...), MaxNS: int64(s.max)}
+		for slot, c := range s.buckets {
+			ss.Buckets[slot] = [2]int64{c.good, c.bad}
+		}
+		st[k] = ss
+	}
+	return st
+}
+
+// Restore replaces the tracker's counters with st.
+func (t *Tracker) Restore(st TrackerState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.series = make(map[string]*series, len(st))
+	for k, ss := range st {
+		s := &series{buckets: make(map[int64]*counts, len(ss.Buckets)), latency: make([]int64, len(LatencyBuckets)+1), max: time.Duration(ss.MaxNS)}
+		copy(s.latency, ss.Latency)
+		for slot, c := range ss.Buckets {
+			s.buckets[slot] = &counts{good: c[0], bad: c[1]}
+		}
+		t.series[k] = s
+	}
+}
+
+// Keys returns the tracked keys in order.
+func (t *Tracker) Keys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]string, 0, len(t.series))
+	for k := range t.series {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Report summarizes key against objective as of now. Unknown keys report
+// no traffic, which meets any objective.
+func (t *Tracker) Report(key string, objective float64, now time.Time) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := newReport(key, objective, now)
+	if s, ok := t.series[key]; ok {
+		r.add(s, now)
+	}
+	return r.finish()
+}
+
+// Summary merges every key into one report named name.
+func (t *Tracker) Summary(name string, objective float64, now time.Time) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := newReport(name, objective, now)
+	for _, s := range t.series {
+		r.add(s, now)
+	}
+	return r.finish()
+}
+
+// Report is one key's availability and latency. Success and Errors cover
+// the retained period and windows are rolling and end at AsOf; Latency
+// covers every observation since the tracker started.
+type Report struct {
+	Key       string         `json:"key"`
+	Objective float64        `json:"objective"`
+	AsOf      time.Time      `json:"as_of"`
+	Success   int64          `json:"success"`
+	Errors    int64          `json:"errors"`
+	Latency   Latency        `json:"latency"`
+	Windows   []WindowReport `json:"windows"`
+}
+
+// WindowReport is availability over one rolling window. ErrorBudgetRemaining
+// is the fraction of allowed errors not yet spent and goes negative once the
+// objective is missed; BurnRate is the error rate relative to the allowed
+// rate, so 1 spends the budget exactly over the window.
+type WindowReport struct {
+	Window               string  `json:"window"`
+	Total                int64   `json:"total"`
+	Errors               int64   `json:"errors"`
+	Availability         float64 `json:"availability"`
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	BurnRate             float64 `json:"burn_rate"`
+	Met                  bool    `json:"met"`
+}
+
+// Window returns the named window report.
+func (r Report) Window(name string) (WindowReport, bool) {
+	for _, w := range r.Windows {
+		if w.Window == name {
+			return w, true
+		}
+	}
+	return WindowReport{}, false
+}
+
+// Latency is a latency histogram with percentile estimates. Percentiles are
+// the upper bound of the bucket they fall in, or the slowest observation for
+// the unbounded bucket.
+type Latency struct {
+	Buckets []LatencyBucket `json:"buckets"`
+	P50MS   float64         `json:"p50_ms"`
+	P95MS   float64         `json:"p95_ms"`
+	P99MS   float64         `json:"p99_ms"`
+	MaxMS   float64         `json:"max_ms"`
+}
+
+// LatencyBucket counts observations at or under LeMS; the last bucket has
+// no bound and omits it.
+type LatencyBucket struct {
+	LeMS  *float64 `json:"le_ms,omitempty"`
+	Count int64    `json:"count"`
+}
+
+type reportBuilder struct {
+	Report
+	windows []counts
+	latency []int64
+	max     time.Duration
+}
+
+func newReport(key string, objective float64, now time.Time) *reportBuilder {
+	return &reportBuilder{
+		Report:  Report{Key: key, Objective: objective, AsOf: now.UTC()},
+		windows: make([]counts, len(Windows)),
+		latency: make([]int64, len(LatencyBuckets)+1),
+	}
+}
+
+func (b *reportBuilder) add(s *series, now time.Time) {
+	current := bucketOf(now)
+	for slot, c := range s.buckets {
+		age := time.Duration(current-slot) * Resolution
+		if age < 0 || age >= Retention {
+			continue
+		}
+		b.Success += c.good
+		b.Errors += c.bad
+		for i, w := range Windows {
+			if age < w.Duration {
+				b.windows[i].good += c.good
+				b.windows[i].bad += c.bad
+			}
+		}
+	}
+	for i, n := range s.latency {
+		b.latency[i] += n
+	}
+	b.max = max(b.max, s.max)
+}
+
+func (b *reportBuilder) finish() Report {
+	budget := 1 - b.Objective
+	b.Report.Windows = make([]WindowReport, 0, len(Windows))
+	for i, w := range Windows {
+		c := b.windows[i]
+		wr := WindowReport{Window: w.Name, Total: c.good + c.bad, Errors: c.bad, Availability: 1, ErrorBudgetRemaining: 1, Met: true}
+		if wr.Total > 0 {
+			errRate := float64(c.bad) / float64(wr.Total)
+			wr.Availability = 1 - errRate
+			wr.BurnRate = round(errRate / budget)
+			wr.ErrorBudgetRemaining = round(1 - errRate/budget)
+			wr.Met = errRate <= budget+1e-12
+			wr.Availability = round(wr.Availability)
+		}
+		b.Report.Windows = append(b.Report.Windows, wr)
+	}
+
+	var total int64
+	for _, n := range b.latency {
+		total += n
+	}
+	b.Latency.Buckets = make([]LatencyBucket, 0, len(b.latency))
+	for i, n := range b.latency {
+		bucket := LatencyBucket{Count: n}
+		if i < len(LatencyBuckets) {
+			le := ms(LatencyBuckets[i])
+			bucket.LeMS = &le
+		}
+		b.Latency.Buckets = append(b.Latency.Buckets, bucket)
+	}
+	b.Latency.P50MS = b.percentile(0.50, total)
+	b.Latency.P95MS = b.percentile(0.95, total)
+	b.Latency.P99MS = b.percentile(0.99, total)
+	b.Latency.MaxMS = ms(b.max)
+	return b.Report
+}
+
+func (b *reportBuilder) percentile(q float64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i, n := range b.latency {
+		seen += n
+		if seen >= rank {
+			if i < len(LatencyBuckets) {
+				return math.Min(ms(LatencyBuckets[i]), ms(b.max))
+			}
+			break
+		}
+	}
+	return ms(b.max)
+}
+
+func ms(d time.Duration) float64 {
+	return round(float64(d) / float64(time.Millisecond))
+}
+
+// round keeps six decimal places so reports serialize stably.
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
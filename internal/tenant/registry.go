@@ -0,0 +1,201 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheTTL = 60 * time.Second
+
+var (
+	// ErrUnknownTenant reports a namespace with no control-plane tenant.
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrTenantSuspended reports a tenant an operator has suspended.
+	ErrTenantSuspended = errors.New("tenant suspended")
+)
+
+// Info is the control plane's view of a tenant.
+type Info struct {
+	ID         string            `json:"id"`
+	Status     string            `json:"status"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Admit refuses suspended tenants.
+func (i Info) Admit() error {
+	if i.Status == "suspended" {
+		return fmt.Errorf("%w: %q", ErrTenantSuspended, i.ID)
+	}
+	return nil
+}
+
+// Labels returns the tenant as trace attributes: tenant.id, tenant.status
+// and tenant.<attribute>. MetricLabels picks the ones safe for metrics.
+func (i Info) Labels() map[string]string {
+	out := make(map[string]string, len(i.Attributes)+2)
+	for k, v := range i.Attributes {
+		out["tenant."+k] = v
+	}
+	out["tenant.id"] = i.ID
+	if i.Status != "" {
+		out["tenant.status"] = i.Status
+	}
+	return out
+}
+
+// MetricLabels keeps tenant.id and tenant.status from labels. Attributes
+// stay on traces only: operators add them freely, and as metric labels each
+// new key or value would multiply every series.
+func MetricLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, 2)
+	for _, k := range []string{"tenant.id", "tenant.status"} {
+		if v, ok := labels[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// RegistryConfig configures tenant lookups against the control plane.
+type RegistryConfig struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	CacheTTL   time.Duration
+}
+
+type cachedInfo struct {
+	info      Info
+	known     bool
+	fetchedAt time.Time
+}
+
+// Registry resolves namespaces to control-plane tenants, caching both hits
+// and misses for CacheTTL so every run does not cost a round trip.
+type Registry struct {
+	cfg RegistryConfig
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedInfo
+}
+
+func NewRegistry(cfg RegistryConfig) (*Registry, error) {
+	cfg.BaseURL = strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("control plane url is empty")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	return &Registry{cfg: cfg, now: time.Now, cache: make(map[string]cachedInfo)}, nil
+}
+
+// RegistryFromEnv builds a registry when TENANT_VERIFY is true and
+// CONTROLPLANE_URL is set, and returns nil otherwise. TENANT_CACHE_TTL
+// overrides the cache lifetime.
+func RegistryFromEnv() (*Registry, error) {
+	if ok, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("TENANT_VERIFY"))); !ok {
+		return nil, nil
+	}
+	baseURL := strings.TrimSpace(os.Getenv("CONTROLPLANE_URL"))
+	if baseURL == "" {
+		return nil, fmt.Errorf("TENANT_VERIFY requires CONTROLPLANE_URL")
+	}
+	var ttl time.Duration
+	if v := strings.TrimSpace(os.Getenv("TENANT_CACHE_TTL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TENANT_CACHE_TTL: %w", err)
+		}
+		ttl = d
+	}
+	return NewRegistry(RegistryConfig{
+		BaseURL:  baseURL,
+		APIKey:   strings.TrimSpace(os.Getenv("CONTROLPLANE_API_KEY")),
+		CacheTTL: ttl,
+	})
+}
+
+// Lookup returns the tenant bound to namespace, or ErrUnknownTenant. A fresh
+// cache entry is served without a request. When the control plane is
+// unreachable a stale entry is returned alongside the error so callers can
+// decide whether to fail open.
+func (r *Registry) Lookup(ctx context.Context, namespace string) (Info, error) {
+	namespace = Normalize(namespace)
+	r.mu.Lock()
+	entry, ok := r.cache[namespace]
+	r.mu.Unlock()
+	if ok && r.now().Sub(entry.fetchedAt) < r.cfg.CacheTTL {
+		return entry.result(namespace)
+	}
+
+	info, known, err := r.fetch(ctx, namespace)
+	if err != nil {
+		if ok {
+			stale, _ := entry.result(namespace)
+			return stale, err
+		}
+		return Info{}, err
+	}
+	entry = cachedInfo{info: info, known: known, fetchedAt: r.now()}
+	r.mu.Lock()
+	r.cache[namespace] = entry
+	r.mu.Unlock()
+	return entry.result(namespace)
+}
+
+// Invalidate drops the cached entry so the next lookup refreshes it.
+func (r *Registry) Invalidate(namespace string) {
+	r.mu.Lock()
+	delete(r.cache, Normalize(namespace))
+	r.mu.Unlock()
+}
+
+func (e cachedInfo) result(namespace string) (Info, error) {
+	if !e.known {
+		return Info{}, fmt.Errorf("%w: %q", ErrUnknownTenant, namespace)
+	}
+	return e.info, nil
+}
+
+func (r *Registry) fetch(ctx context.Context, namespace string) (Info, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.cfg.BaseURL+"/v1/tenants/"+url.PathEscape(namespace), nil)
+	if err != nil {
+		return Info{}, false, err
+	}
+	if r.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", r.cfg.APIKey)
+	}
+	resp, err := r.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return Info{}, false, fmt.Errorf("fetch tenant %s: %w", namespace, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Info{}, false, nil
+	default:
+		return Info{}, false, fmt.Errorf("fetch tenant %s: status %d: %s", namespace, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var info Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return Info{}, false, fmt.Errorf("decode tenant %s: %w", namespace, err)
+	}
+	return info, true, nil
+}
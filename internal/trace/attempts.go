@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// CompareAttempts compares two runs of the same plan attempt by attempt. On
+// top of Compare it checks, for every attempt, its error, retry decision,
+// breaker admission and circuit transition, and that in actual each attempt
+// ran after the one before it and after its dependencies finished.
+func CompareAttempts(expected ExecutionTrace, actual ExecutionTrace) []Divergence {
+	out := Compare(expected, actual)
+	exp, act := attemptsByInvocation(expected), attemptsByInvocation(actual)
+
+	ids := make([]string, 0, len(exp))
+	for id := range exp {
+		if _, ok := act[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		es, as := exp[id], act[id]
+		for i := 0; i < len(es) && i < len(as); i++ {
+			e, a := es[i], as[i]
+			field := func(name string) string { return fmt.Sprintf("attempt[%d].%s", e.Attempt, name) }
+			check := func(name string, ev string, av string) {
+				if ev != av {
+					out = append(out, Divergence{InvocationID: id, Field: field(name), Expected: ev, Actual: av})
+				}
+			}
+			check("error", e.Error, a.Error)
+			check("retried", strconv.FormatBool(e.Retried), strconv.FormatBool(a.Retried))
+			check("breaker_rejected", strconv.FormatBool(e.BreakerRejected), strconv.FormatBool(a.BreakerRejected))
+			check("probe", strconv.FormatBool(e.Probe), strconv.FormatBool(a.Probe))
+			check("circuit_state", e.CircuitState, a.CircuitState)
+			check("circuit_after", e.CircuitAfter, a.CircuitAfter)
+		}
+	}
+	return append(out, orderViolations(actual)...)
+}
+
+// attemptsByInvocation groups steps by invocation, ordered by attempt.
+func attemptsByInvocation(tr ExecutionTrace) map[string][]Step {
+	m := make(map[string][]Step)
+	for _, s := range tr.Steps {
+		m[s.InvocationID] = append(m[s.InvocationID], s)
+	}
+	for _, steps := range m {
+		sort.SliceStable(steps, func(i, j int) bool { return steps[i].Attempt < steps[j].Attempt })
+	}
+	return m
+}
+
+// orderViolations reports attempts that, by recording order, started before
+// the previous attempt of their invocation or a dependency finished.
+func orderViolations(tr ExecutionTrace) []Divergence {
+	if !recordsDAG(tr) {
+		return nil
+	}
+	byInvocation := attemptsByInvocation(tr)
+	lastSeq := make(map[string]int, len(byInvocation))
+	for id, steps := range byInvocation {
+		for _, s := range steps {
+			lastSeq[id] = max(lastSeq[id], s.Seq)
+		}
+	}
+
+	var out []Divergence
+	ids := make([]string, 0, len(byInvocation))
+	for id := range byInvocation {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		steps := byInvocation[id]
+		for i, s := range steps {
+			if i > 0 && s.Seq < steps[i-1].Seq {
+				out = append(out, Divergence{InvocationID: id, Field: "order",
+					Expected: fmt.Sprintf("attempt %d after attempt %d", s.Attempt, steps[i-1].Attempt),
+					Actual:   fmt.Sprintf("attempt %d first", s.Attempt)})
+			}
+		}
+		first := steps[0]
+		for _, dep := range first.DependsOn {
+			if seq, ok := lastSeq[dep]; ok && first.Seq < seq {
+				out = append(out, Divergence{InvocationID: id, Field: "order",
+					Expected: "after " + dep, Actual: "before " + dep + " finished"})
+			}
+		}
+	}
+	return out
+}
@@ -5,20 +5,29 @@ import (
 	"encoding/hex"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // Divergence describes where two traces first diverge.
 type Divergence struct {
-	InvocationID string
-	Field        string
-	Expected     string
-	Actual       string
+	InvocationID string `json:"invocation_id"`
+	Field        string `json:"field"`
+	Expected     string `json:"expected,omitempty"`
+	Actual       string `json:"actual,omitempty"`
+	// Changes are the path-level differences of a "payload" divergence.
+	Changes []PathChange `json:"changes,omitempty"`
 }
 
 // Compare traces and return divergence list. Empty list means equivalent replay-significant behavior.
+// Besides the final attempt's outcome it compares attempt counts and, when
+// both traces record the DAG, each invocation's dependencies and level.
 func Compare(expected ExecutionTrace, actual ExecutionTrace) []Divergence {
 	expMap := latestByInvocation(expected)
 	actMap := latestByInvocation(actual)
+	expAttempts := attemptCounts(expected)
+	actAttempts := attemptCounts(actual)
+	dag := recordsDAG(expected) && recordsDAG(actual)
 
 	ids := make([]string, 0, len(expMap)+len(actMap))
 	seen := map[string]struct{}{}
@@ -48,6 +57,17 @@ func Compare(expected ExecutionTrace, actual ExecutionTrace) []Divergence {
 		if e.AgentID != a.AgentID {
 			out = append(out, Divergence{InvocationID: id, Field: "agent_id", Expected: e.AgentID, Actual: a.AgentID})
 		}
+		if dag {
+			if ed, ad := strings.Join(e.DependsOn, ","), strings.Join(a.DependsOn, ","); ed != ad {
+				out = append(out, Divergence{InvocationID: id, Field: "depends_on", Expected: ed, Actual: ad})
+			}
+			if e.Level != a.Level {
+				out = append(out, Divergence{InvocationID: id, Field: "level", Expected: strconv.Itoa(e.Level), Actual: strconv.Itoa(a.Level)})
+			}
+		}
+		if expAttempts[id] != actAttempts[id] {
+			out = append(out, Divergence{InvocationID: id, Field: "attempts", Expected: strconv.Itoa(expAttempts[id]), Actual: strconv.Itoa(actAttempts[id])})
+		}
 		if e.Error != a.Error {
 			out = append(out, Divergence{InvocationID: id, Field: "error", Expected: e.Error, Actual: a.Error})
 		}
@@ -69,7 +89,14 @@ func FormatDivergence(div []Divergence) string {
 	}
 	msg := "trace divergence detected:\n"
 	for _, d := range div {
-		msg += fmt.Sprintf("- invocation=%s field=%s expected=%q actual=%q\n", d.InvocationID, d.Field, d.Expected, d.Actual)
+		if len(d.Changes) == 0 {
+			msg += fmt.Sprintf("- invocation=%s field=%s expected=%q actual=%q\n", d.InvocationID, d.Field, d.Expected, d.Actual)
+			continue
+		}
+		msg += fmt.Sprintf("- invocation=%s field=%s changes=%d\n", d.InvocationID, d.Field, len(d.Changes))
+		for _, c := range d.Changes {
+			msg += "    " + formatChange(c) + "\n"
+		}
 	}
 	return msg
 }
@@ -85,6 +112,26 @@ func latestByInvocation(tr ExecutionTrace) map[string]Step {
 	return m
 }
 
+// attemptCounts counts the recorded steps of each invocation.
+func attemptCounts(tr ExecutionTrace) map[string]int {
+	m := make(map[string]int)
+	for _, s := range tr.Steps {
+		m[s.InvocationID]++
+	}
+	return m
+}
+
+// recordsDAG reports whether tr was recorded with dependency edges and
+// levels, which traces from before they existed lack.
+func recordsDAG(tr ExecutionTrace) bool {
+	for _, s := range tr.Steps {
+		if s.Seq > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func payloadHash(b []byte) string {
 	sum := sha256.Sum256(b)
 	return hex.EncodeToString(sum[:])
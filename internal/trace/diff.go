@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// Diff compares two traces like Compare and applies cfg: divergences of
+// ignored fields are dropped, and a payload divergence between two JSON
+// payloads becomes a "payload" divergence listing path-level Changes,
+// dropped entirely when every change is ignored or within tolerance.
+// Payloads that are not JSON keep their payload_hash divergence.
+func Diff(expected ExecutionTrace, actual ExecutionTrace, cfg DiffConfig) []Divergence {
+	ignored := make(map[string]bool, len(cfg.IgnoreFields))
+	for _, f := range cfg.IgnoreFields {
+		ignored[f] = true
+	}
+	expMap := latestByInvocation(expected)
+	actMap := latestByInvocation(actual)
+
+	out := make([]Divergence, 0)
+	for _, d := range Compare(expected, actual) {
+		if ignored[d.Field] {
+			continue
+		}
+		if d.Field == "payload_hash" && !ignored["payload"] {
+			changes, isJSON := DiffJSON(expMap[d.InvocationID].Output.Payload, actMap[d.InvocationID].Output.Payload, cfg)
+			if isJSON {
+				if len(changes) > 0 {
+					out = append(out, Divergence{InvocationID: d.InvocationID, Field: "payload", Changes: changes})
+				}
+				continue
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// formatChange renders one change as "+ path: v", "- path: v" or
+// "~ path: old -> new".
+func formatChange(c PathChange) string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, jsonText(c.Actual))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, jsonText(c.Expected))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, jsonText(c.Expected), jsonText(c.Actual))
+	}
+}
+
+func jsonText(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "?"
+	}
+	return string(b)
+}
+
+var diffHTML = template.Must(template.New("diff").Funcs(template.FuncMap{"json": jsonText, "change": formatChange, "join": strings.Join}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>fluxroute trace diff</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.v { font-family: monospace; white-space: pre-wrap; word-break: break-all; }
+tr.added { background: #e6ffed; }
+tr.removed { background: #ffeef0; }
+tr.changed { background: #fff8c5; }
+</style>
+</head>
+<body>
+<h1>Trace diff</h1>
+<p>expected <code>{{.Expected}}</code>, actual <code>{{.Actual}}</code>: {{len .Divergences}} divergence(s)</p>
+{{with .RootCauses}}
+<h2>Root causes</h2>
+<table>
+<tr><th>invocation</th><th>agent</th><th>level</th><th>diverged</th><th>input changes</th><th>fallout</th></tr>
+{{range .}}<tr><td>{{.InvocationID}}</td><td>{{.AgentID}}</td><td>{{.Level}}</td><td>{{join .Fields ", "}}</td><td class="v">{{range .InputChanges}}{{change .}}
+{{else}}unchanged{{end}}</td><td>{{join .Fallout ", "}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Divergences}}
+<h2>{{.InvocationID}}: {{.Field}}</h2>
+{{if .Changes}}
+<table>
+<tr><th>path</th><th>change</th><th>expected</th><th>actual</th></tr>
+{{range .Changes}}<tr class="{{.Kind}}"><td class="v">{{.Path}}</td><td>{{.Kind}}</td><td class="v">{{if ne .Kind "added"}}{{json .Expected}}{{end}}</td><td class="v">{{if ne .Kind "removed"}}{{json .Actual}}{{end}}</td></tr>
+{{end}}</table>
+{{else}}
+<table>
+<tr><th>expected</th><th>actual</th></tr>
+<tr class="changed"><td class="v">{{.Expected}}</td><td class="v">{{.Actual}}</td></tr>
+</table>
+{{end}}
+{{else}}
+<p>No divergence detected.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteDiffHTML renders a report as a standalone HTML page.
+func WriteDiffHTML(w io.Writer, report DiffReport) error {
+	return diffHTML.Execute(w, report)
+}
@@ -1,30 +1,383 @@
 package trace
 
 import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 )
 
+// Trace files are JSONL: a header line, one line per step, then a footer
+// line. Files that are a single ExecutionTrace JSON object (the format
+// before SchemaVersion 1) still load.
+const (
+	SchemaName    = "fluxroute.trace"
+	SchemaVersion = 1
+)
+
+const (
+	recordHeader = "header"
+	recordStep   = "step"
+	recordFooter = "footer"
+)
+
+// Compression selects how a trace file is compressed.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZlib Compression = "zlib"
+)
+
+// CompressionForPath picks the compression implied by a file name: ".gz"
+// for gzip, ".zz" or ".zlib" for zlib, otherwise none.
+func CompressionForPath(path string) Compression {
+	switch lower := strings.ToLower(path); {
+	case strings.HasSuffix(lower, ".gz"):
+		return CompressionGzip
+	case strings.HasSuffix(lower, ".zz"), strings.HasSuffix(lower, ".zlib"):
+		return CompressionZlib
+	default:
+		return CompressionNone
+	}
+}
+
+// Header opens a trace file.
+type Header struct {
+	Schema     string            `json:"schema"`
+	Version    int               `json:"version"`
+	TaskID     string            `json:"task_id"`
+	StartTime  time.Time         `json:"start_time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Footer closes a trace file. A file without one was cut short.
+type Footer struct {
+	EndTime      time.Time     `json:"end_time"`
+	TotalLatency time.Duration `json:"total_latency"`
+	Steps        int           `json:"steps"`
+}
+
+// record is one line of a trace file.
+type record struct {
+	Type string `json:"type"`
+	*Header
+	Step *Step `json:"step,omitempty"`
+	*Footer
+}
+
+// Writer streams a trace file one step at a time.
+type Writer struct {
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	comp   io.WriteCloser
+	steps  int
+	closed bool
+}
+
+// NewWriter writes the header for h to w. Close must be called to write the
+// footer and flush any compression.
+func NewWriter(w io.Writer, h Header, c Compression) (*Writer, error) {
+	tw := &Writer{}
+	switch c {
+	case CompressionNone:
+	case CompressionGzip:
+		tw.comp = gzip.NewWriter(w)
+	case CompressionZlib:
+		tw.comp = zlib.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("trace: unknown compression %q", c)
+	}
+	if tw.comp != nil {
+		w = tw.comp
+	}
+	tw.buf = bufio.NewWriterSize(w, 64<<10)
+	tw.enc = json.NewEncoder(tw.buf)
+	h.Schema, h.Version = SchemaName, SchemaVersion
+	if err := tw.enc.Encode(record{Type: recordHeader, Header: &h}); err != nil {
+		return nil, fmt.Errorf("trace: write header: %w", err)
+	}
+	return tw, nil
+}
+
+// WriteStep appends one step.
+func (w *Writer) WriteStep(s Step) error {
+	if w.closed {
+		return errors.New("trace: write step: writer is closed")
+	}
+	if err := w.enc.Encode(record{Type: recordStep, Step: &s}); err != nil {
+		return fmt.Errorf("trace: write step: %w", err)
+	}
+	w.steps++
+	return nil
+}
+
+// Close writes the footer, recording the number of steps written, and
+// flushes. It does not close the underlying writer.
+func (w *Writer) Close(f Footer) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	f.Steps = w.steps
+	if err := w.enc.Encode(record{Type: recordFooter, Footer: &f}); err != nil {
+		return fmt.Errorf("trace: write footer: %w", err)
+	}
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("trace: flush: %w", err)
+	}
+	if w.comp != nil {
+		if err := w.comp.Close(); err != nil {
+			return fmt.Errorf("trace: flush compression: %w", err)
+		}
+	}
+	return nil
+}
+
+// Encode writes tr to w as a trace file.
+func Encode(w io.Writer, tr ExecutionTrace, c Compression) error {
+	tw, err := NewWriter(w, Header{TaskID: tr.TaskID, StartTime: tr.StartTime, Attributes: tr.Attributes}, c)
+	if err != nil {
+		return err
+	}
+	for _, s := range tr.Steps {
+		if err := tw.WriteStep(s); err != nil {
+			return err
+		}
+	}
+	return tw.Close(Footer{EndTime: tr.EndTime, TotalLatency: tr.TotalLatency})
+}
+
+// SaveToFile writes tr to path, compressed as CompressionForPath implies.
 func SaveToFile(path string, tr ExecutionTrace) error {
-	b, err := json.MarshalIndent(tr, "", "  ")
+	f, err := os.Create(path)
 	if err != nil {
-		return fmt.Errorf("trace: marshal: %w", err)
+		return fmt.Errorf("trace: write %q: %w", path, err)
+	}
+	if err := Encode(f, tr, CompressionForPath(path)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("trace: write %q: %w", path, err)
 	}
-	if err := os.WriteFile(path, b, 0o644); err != nil {
+	if err := f.Close(); err != nil {
 		return fmt.Errorf("trace: write %q: %w", path, err)
 	}
 	return nil
 }
 
+// Reader iterates the steps of a trace file without loading them all.
+// Legacy single-object traces are decoded up front.
+type Reader struct {
+	dec    *json.Decoder
+	comp   io.Closer
+	file   io.Closer
+	header Header
+	footer *Footer
+	legacy []Step
+	done   bool
+}
+
+// NewReader reads the header from r, detecting gzip or zlib compression and
+// the legacy format.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	tr := &Reader{}
+	magic, _ := br.Peek(2)
+	var src io.Reader = br
+	switch {
+	case len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("trace: open gzip: %w", err)
+		}
+		tr.comp, src = zr, zr
+	case len(magic) == 2 && magic[0]&0x0f == 8 && (uint16(magic[0])<<8|uint16(magic[1]))%31 == 0:
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("trace: open zlib: %w", err)
+		}
+		tr.comp, src = zr, zr
+	}
+	tr.dec = json.NewDecoder(src)
+
+	var first json.RawMessage
+	if err := tr.dec.Decode(&first); err != nil {
+		tr.closeComp()
+		return nil, fmt.Errorf("trace: read header: %w", err)
+	}
+	var probe struct {
+		Type    string `json:"type"`
+		Version int    `json:"version"`
+	}
+	_ = json.Unmarshal(first, &probe)
+	if probe.Type != recordHeader {
+		return tr.loadLegacy(first)
+	}
+	if probe.Version > SchemaVersion {
+		tr.closeComp()
+		return nil, fmt.Errorf("trace: unsupported schema version %d (max %d)", probe.Version, SchemaVersion)
+	}
+	if err := json.Unmarshal(first, &tr.header); err != nil {
+		tr.closeComp()
+		return nil, fmt.Errorf("trace: read header: %w", err)
+	}
+	return tr, nil
+}
+
+func (r *Reader) loadLegacy(raw json.RawMessage) (*Reader, error) {
+	defer r.closeComp()
+	var tr ExecutionTrace
+	if err := json.Unmarshal(raw, &tr); err != nil {
+		return nil, fmt.Errorf("trace: unmarshal: %w", err)
+	}
+	r.header = Header{TaskID: tr.TaskID, StartTime: tr.StartTime, Attributes: tr.Attributes}
+	r.footer = &Footer{EndTime: tr.EndTime, TotalLatency: tr.TotalLatency, Steps: len(tr.Steps)}
+	r.legacy = tr.Steps
+	if r.legacy == nil {
+		r.legacy = []Step{}
+	}
+	r.dec = nil
+	return r, nil
+}
+
+// OpenFile opens a trace file for iteration. Close releases it.
+func OpenFile(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("trace: read %q: %w", path, err)
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("trace: read %q: %w", path, err)
+	}
+	r.file = f
+	return r, nil
+}
+
+// Header returns the trace's header. Version is 0 for legacy traces.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next step, or io.EOF after the last one.
+func (r *Reader) Next() (Step, error) {
+	if r.done {
+		return Step{}, io.EOF
+	}
+	if r.dec == nil {
+		if len(r.legacy) == 0 {
+			r.done = true
+			return Step{}, io.EOF
+		}
+		s := r.legacy[0]
+		r.legacy = r.legacy[1:]
+		return s, nil
+	}
+	for {
+		var rec record
+		if err := r.dec.Decode(&rec); err != nil {
+			r.done = true
+			if errors.Is(err, io.EOF) {
+				return Step{}, io.EOF
+			}
+			return Step{}, fmt.Errorf("trace: read step: %w", err)
+		}
+		switch rec.Type {
+		case recordStep:
+			if rec.Step == nil {
+				return Step{}, errors.New("trace: read step: empty step record")
+			}
+			return *rec.Step, nil
+		case recordFooter:
+			if rec.Footer != nil {
+				r.footer = rec.Footer
+			}
+			r.done = true
+			return Step{}, io.EOF
+		}
+		// Unknown record types are skipped so older readers tolerate
+		// additions within a schema version.
+	}
+}
+
+// Footer returns the footer once Next has returned io.EOF. It reports false
+// for a trace that was cut short.
+func (r *Reader) Footer() (Footer, bool) {
+	if r.footer == nil {
+		return Footer{}, false
+	}
+	return *r.footer, true
+}
+
+// Close releases the reader and the file it was opened from.
+func (r *Reader) Close() error {
+	r.closeComp()
+	if r.file != nil {
+		err := r.file.Close()
+		r.file = nil
+		return err
+	}
+	return nil
+}
+
+func (r *Reader) closeComp() {
+	if r.comp != nil {
+		_ = r.comp.Close()
+		r.comp = nil
+	}
+}
+
+// Decode reads a whole trace from r.
+func Decode(r io.Reader) (ExecutionTrace, error) {
+	tr, err := NewReader(r)
+	if err != nil {
+		return ExecutionTrace{}, err
+	}
+	defer tr.Close()
+	return tr.readAll()
+}
+
+// LoadFromFile reads a whole trace file, in either format.
 func LoadFromFile(path string) (ExecutionTrace, error) {
-	b, err := os.ReadFile(path)
+	r, err := OpenFile(path)
 	if err != nil {
-		return ExecutionTrace{}, fmt.Errorf("trace: read %q: %w", path, err)
+		return ExecutionTrace{}, err
 	}
-	var tr ExecutionTrace
-	if err := json.Unmarshal(b, &tr); err != nil {
-		return ExecutionTrace{}, fmt.Errorf("trace: unmarshal %q: %w", path, err)
+	defer r.Close()
+	tr, err := r.readAll()
+	if err != nil {
+		return ExecutionTrace{}, fmt.Errorf("trace: read %q: %w", path, err)
 	}
 	return tr, nil
 }
+
+func (r *Reader) readAll() (ExecutionTrace, error) {
+	h := r.Header()
+	out := ExecutionTrace{TaskID: h.TaskID, StartTime: h.StartTime, Attributes: h.Attributes}
+	for {
+		s, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ExecutionTrace{}, err
+		}
+		out.Steps = append(out.Steps, s)
+	}
+	f, ok := r.Footer()
+	if !ok {
+		return ExecutionTrace{}, errors.New("trace is truncated: missing footer")
+	}
+	if f.Steps != len(out.Steps) {
+		return ExecutionTrace{}, fmt.Errorf("trace is truncated: footer counts %d step(s), read %d", f.Steps, len(out.Steps))
+	}
+	out.EndTime, out.TotalLatency = f.EndTime, f.TotalLatency
+	return out, nil
+}
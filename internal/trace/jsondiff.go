@@ -0,0 +1,186 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/your-org/fluxroute/internal/jsonpath"
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of PathChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// PathChange is one difference between two JSON documents, addressed by a
+// path such as $.items[2].score.
+type PathChange struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Expected any    `json:"expected,omitempty"`
+	Actual   any    `json:"actual,omitempty"`
+}
+
+// DiffConfig tunes how traces are diffed. IgnorePaths drop payload changes
+// under matching JSON paths, IgnoreFields drop divergences by field name
+// (request_id, error, attempts, ...), and numbers within Tolerance of each
+// other are equal.
+//
+// Paths are jsonpath patterns: $.meta.ts matches exactly, * matches one key
+// or index ($.items[*].id), ** any number of them, and a pattern without a
+// leading $ matches at any depth (timestamp is **.timestamp).
+type DiffConfig struct {
+	IgnorePaths  []string `yaml:"ignore_paths" json:"ignore_paths"`
+	IgnoreFields []string `yaml:"ignore_fields" json:"ignore_fields"`
+	Tolerance    float64  `yaml:"tolerance" json:"tolerance"`
+}
+
+// LoadDiffConfig reads a DiffConfig from a YAML or JSON file.
+func LoadDiffConfig(path string) (DiffConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return DiffConfig{}, fmt.Errorf("trace: read diff config %q: %w", path, err)
+	}
+	var cfg DiffConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return DiffConfig{}, fmt.Errorf("trace: parse diff config %q: %w", path, err)
+	}
+	if cfg.Tolerance < 0 {
+		return DiffConfig{}, fmt.Errorf("trace: diff config %q: tolerance must not be negative", path)
+	}
+	for _, p := range cfg.IgnorePaths {
+		if _, err := jsonpath.Parse(p); err != nil {
+			return DiffConfig{}, fmt.Errorf("trace: diff config %q: ignore path %q: %w", path, p, err)
+		}
+	}
+	return cfg, nil
+}
+
+// DiffJSON structurally compares two JSON documents. Objects are compared
+// key by key and arrays index by index. The second result is false when
+// either document is not JSON, in which case no changes are returned.
+func DiffJSON(expected []byte, actual []byte, cfg DiffConfig) ([]PathChange, bool) {
+	ev, eok := decodeJSON(expected)
+	av, aok := decodeJSON(actual)
+	if !eok || !aok {
+		return nil, false
+	}
+	ignore := make([][]jsonpath.Seg, 0, len(cfg.IgnorePaths))
+	for _, p := range cfg.IgnorePaths {
+		if segs, err := jsonpath.Parse(p); err == nil {
+			ignore = append(ignore, segs)
+		}
+	}
+	d := jsonDiffer{ignore: ignore, tolerance: cfg.Tolerance}
+	d.diff(nil, ev, av)
+	return d.changes, true
+}
+
+func decodeJSON(b []byte) (any, bool) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	if dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+type jsonDiffer struct {
+	ignore    [][]jsonpath.Seg
+	tolerance float64
+	changes   []PathChange
+}
+
+func (d *jsonDiffer) add(path []jsonpath.Seg, kind string, expected any, actual any) {
+	for _, pattern := range d.ignore {
+		if jsonpath.Match(pattern, path) {
+			return
+		}
+	}
+	d.changes = append(d.changes, PathChange{Path: jsonpath.Format(path), Kind: kind, Expected: expected, Actual: actual})
+}
+
+func (d *jsonDiffer) diff(path []jsonpath.Seg, expected any, actual any) {
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			d.add(path, ChangeChanged, expected, actual)
+			return
+		}
+		keys := make([]string, 0, len(e)+len(a))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := jsonpath.Append(path, jsonpath.Key(k))
+			ev, eok := e[k]
+			av, aok := a[k]
+			switch {
+			case !aok:
+				d.add(child, ChangeRemoved, ev, nil)
+			case !eok:
+				d.add(child, ChangeAdded, nil, av)
+			default:
+				d.diff(child, ev, av)
+			}
+		}
+	case []any:
+		a, ok := actual.([]any)
+		if !ok {
+			d.add(path, ChangeChanged, expected, actual)
+			return
+		}
+		for i := 0; i < len(e) || i < len(a); i++ {
+			child := jsonpath.Append(path, jsonpath.Index(i))
+			switch {
+			case i >= len(a):
+				d.add(child, ChangeRemoved, e[i], nil)
+			case i >= len(e):
+				d.add(child, ChangeAdded, nil, a[i])
+			default:
+				d.diff(child, e[i], a[i])
+			}
+		}
+	case json.Number:
+		a, ok := actual.(json.Number)
+		if !ok {
+			d.add(path, ChangeChanged, expected, actual)
+			return
+		}
+		if e == a {
+			return
+		}
+		ef, eerr := e.Float64()
+		af, aerr := a.Float64()
+		if eerr == nil && aerr == nil && math.Abs(ef-af) <= d.tolerance {
+			return
+		}
+		d.add(path, ChangeChanged, expected, actual)
+	default:
+		if expected != actual {
+			d.add(path, ChangeChanged, expected, actual)
+		}
+	}
+}
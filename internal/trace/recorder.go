@@ -8,10 +8,13 @@ import (
 	"github.com/your-org/fluxroute/pkg/agentfunc"
 )
 
-// Recorder captures per-attempt trace steps and finalizes deterministic order.
+// Recorder captures per-attempt trace steps and finalizes them in the order
+// they started.
 type Recorder struct {
-	mu    sync.Mutex
-	trace ExecutionTrace
+	mu       sync.Mutex
+	trace    ExecutionTrace
+	seq      int
+	redactor Redactor
 }
 
 func NewRecorder(taskID string, start time.Time) *Recorder {
@@ -22,11 +25,44 @@ func (r *Recorder) AddStep(step Step) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.seq++
+	step.Seq = r.seq
+	if step.EndTime.IsZero() {
+		step.EndTime = time.Now()
+	}
+	if step.StartTime.IsZero() {
+		step.StartTime = step.EndTime.Add(-step.Duration)
+	}
+	step.DependsOn = append([]string(nil), step.DependsOn...)
+	if step.Policy != nil {
+		policy := *step.Policy
+		step.Policy = &policy
+	}
 	step.Input = cloneInput(step.Input)
 	step.Output = cloneOutput(step.Output)
+	if r.redactor != nil {
+		step = redactStep(step, r.redactor)
+	}
 	r.trace.Steps = append(r.trace.Steps, step)
 }
 
+// SetRedactor makes the recorder redact every step it is given, so
+// sensitive values never reach the trace.
+func (r *Recorder) SetRedactor(red Redactor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.redactor = red
+}
+
+// SetAttributes labels the trace with run-level attributes.
+func (r *Recorder) SetAttributes(attrs map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.trace.Attributes = cloneAttributes(attrs)
+}
+
 func (r *Recorder) Finalize(end time.Time) ExecutionTrace {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -37,16 +73,16 @@ func (r *Recorder) Finalize(end time.Time) ExecutionTrace {
 		EndTime:      end,
 		TotalLatency: end.Sub(r.trace.StartTime),
 		Steps:        append([]Step(nil), r.trace.Steps...),
+		Attributes:   cloneAttributes(r.trace.Attributes),
 	}
 
-	sort.Slice(out.Steps, func(i, j int) bool {
-		if out.Steps[i].InvocationID != out.Steps[j].InvocationID {
-			return out.Steps[i].InvocationID < out.Steps[j].InvocationID
-		}
-		if out.Steps[i].Attempt != out.Steps[j].Attempt {
-			return out.Steps[i].Attempt < out.Steps[j].Attempt
+	// Steps are added as they finish; order them by start so the trace reads
+	// as a timeline. Ties keep the order they were recorded in.
+	sort.SliceStable(out.Steps, func(i, j int) bool {
+		if !out.Steps[i].StartTime.Equal(out.Steps[j].StartTime) {
+			return out.Steps[i].StartTime.Before(out.Steps[j].StartTime)
 		}
-		return out.Steps[i].RequestID < out.Steps[j].RequestID
+		return out.Steps[i].Seq < out.Steps[j].Seq
 	})
 	return out
 }
@@ -78,3 +114,14 @@ func cloneOutput(in agentfunc.AgentOutput) agentfunc.AgentOutput {
 	}
 	return out
 }
+
+func cloneAttributes(in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package trace
+
+// Redactor scrubs sensitive values from what a trace records. Package
+// redact provides the implementation configured from a manifest.
+type Redactor interface {
+	RedactText(s string) string
+	RedactPayload(b []byte) []byte
+	RedactMap(m map[string]string) map[string]string
+}
+
+// Redact returns tr with the payloads, metadata and errors of every step
+// passed through r.
+func Redact(tr ExecutionTrace, r Redactor) ExecutionTrace {
+	out := tr
+	out.Steps = make([]Step, len(tr.Steps))
+	for i, s := range tr.Steps {
+		out.Steps[i] = redactStep(s, r)
+	}
+	return out
+}
+
+// redactStep redacts a step whose input and output are already cloned.
+func redactStep(s Step, r Redactor) Step {
+	s.Input.Payload = r.RedactPayload(s.Input.Payload)
+	s.Input.Metadata = r.RedactMap(s.Input.Metadata)
+	s.Output.Payload = r.RedactPayload(s.Output.Payload)
+	s.Output.Metadata = r.RedactMap(s.Output.Metadata)
+	s.Error = r.RedactText(s.Error)
+	return s
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/your-org/fluxroute/pkg/agentfunc"
@@ -15,6 +16,9 @@ import (
 type ResolveAgentFn func(agentID string) (agentfunc.AgentFunc, bool)
 
 // ReplayAndCompare re-executes final recorded invocations and validates output equality and order.
+// Invocations replay in the recorded DAG order (level, then start time), and
+// an invocation recorded as skipped for a failed dependency must be skipped
+// again: its dependencies must fail on replay too.
 func ReplayAndCompare(ctx context.Context, tr ExecutionTrace, timeout time.Duration, resolve ResolveAgentFn) error {
 	if len(tr.Steps) == 0 {
 		return errors.New("trace replay: no steps to replay")
@@ -23,11 +27,11 @@ func ReplayAndCompare(ctx context.Context, tr ExecutionTrace, timeout time.Durat
 		timeout = 30 * time.Second
 	}
 
-	expectedByInvocation := make(map[string]Step)
+	expectedByInvocation := latestByInvocation(tr)
+	firstStart := make(map[string]time.Time, len(expectedByInvocation))
 	for _, s := range tr.Steps {
-		prev, ok := expectedByInvocation[s.InvocationID]
-		if !ok || s.Attempt >= prev.Attempt {
-			expectedByInvocation[s.InvocationID] = s
+		if t, ok := firstStart[s.InvocationID]; !ok || s.StartTime.Before(t) {
+			firstStart[s.InvocationID] = s.StartTime
 		}
 	}
 
@@ -35,10 +39,31 @@ func ReplayAndCompare(ctx context.Context, tr ExecutionTrace, timeout time.Durat
 	for id := range expectedByInvocation {
 		invocationIDs = append(invocationIDs, id)
 	}
-	sort.Strings(invocationIDs)
+	sort.Slice(invocationIDs, func(i, j int) bool {
+		a, b := expectedByInvocation[invocationIDs[i]], expectedByInvocation[invocationIDs[j]]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		if ta, tb := firstStart[a.InvocationID], firstStart[b.InvocationID]; !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		return a.InvocationID < b.InvocationID
+	})
 
+	failed := make(map[string]bool, len(invocationIDs))
 	for _, invID := range invocationIDs {
 		expected := expectedByInvocation[invID]
+		dep, skipped := failedDependency(expected, failed), skippedForDependency(expected)
+		switch {
+		case skipped && dep == "":
+			return fmt.Errorf("trace replay: invocation %s was skipped for a failed dependency, but its dependencies succeeded", invID)
+		case !skipped && dep != "":
+			return fmt.Errorf("trace replay: invocation %s ran, but dependency %s failed on replay", invID, dep)
+		case skipped:
+			failed[invID] = true
+			continue
+		}
+
 		fn, ok := resolve(expected.AgentID)
 		if !ok {
 			return fmt.Errorf("trace replay: agent not found: %s", expected.AgentID)
@@ -55,6 +80,7 @@ func ReplayAndCompare(ctx context.Context, tr ExecutionTrace, timeout time.Durat
 			if actualErr.Error() != expected.Error {
 				return fmt.Errorf("trace replay: invocation %s error mismatch: got %q want %q", invID, actualErr.Error(), expected.Error)
 			}
+			failed[invID] = true
 			continue
 		}
 
@@ -72,6 +98,21 @@ func ReplayAndCompare(ctx context.Context, tr ExecutionTrace, timeout time.Durat
 	return nil
 }
 
+// skippedForDependency reports whether s records an invocation the engine
+// never ran because a dependency failed.
+func skippedForDependency(s Step) bool {
+	return s.Attempt == 0 && len(s.DependsOn) > 0 && strings.HasPrefix(s.Error, "dependency failed")
+}
+
+func failedDependency(s Step, failed map[string]bool) string {
+	for _, dep := range s.DependsOn {
+		if failed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
 func safeCall(fn agentfunc.AgentFunc, ctx context.Context, in agentfunc.AgentInput) (out agentfunc.AgentOutput, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -0,0 +1,197 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/your-org/fluxroute/internal/jsonpath"
+)
+
+// RootCause is a divergent invocation none of whose ancestors diverged.
+// Fallout lists the divergent invocations downstream of it, which are
+// likely consequences rather than separate problems.
+type RootCause struct {
+	InvocationID string       `json:"invocation_id"`
+	AgentID      string       `json:"agent_id"`
+	Level        int          `json:"level"`
+	Fields       []string     `json:"fields"`
+	InputChanges []PathChange `json:"input_changes,omitempty"`
+	Fallout      []string     `json:"fallout,omitempty"`
+}
+
+// DiffReport is the outcome of diffing two trace files.
+type DiffReport struct {
+	Expected    string       `json:"expected_trace"`
+	Actual      string       `json:"actual_trace"`
+	Divergences []Divergence `json:"divergences"`
+	RootCauses  []RootCause  `json:"root_causes,omitempty"`
+}
+
+// RootCauses walks the dependency edges recorded in either trace and splits
+// the divergent invocations into root causes, earliest first, and their
+// downstream fallout. Each root carries the diff of its input between the
+// traces: an unchanged input points at the invocation itself, a changed one
+// at whatever produced the input. Traces without dependency edges make
+// every divergent invocation a root.
+func RootCauses(expected ExecutionTrace, actual ExecutionTrace, div []Divergence, cfg DiffConfig) []RootCause {
+	if len(div) == 0 {
+		return nil
+	}
+	expMap := latestByInvocation(expected)
+	actMap := latestByInvocation(actual)
+
+	parents := make(map[string][]string)
+	for _, m := range []map[string]Step{expMap, actMap} {
+		for id, s := range m {
+			parents[id] = append(parents[id], s.DependsOn...)
+		}
+	}
+
+	fields := make(map[string][]string)
+	for _, d := range div {
+		if !slices.Contains(fields[d.InvocationID], d.Field) {
+			fields[d.InvocationID] = append(fields[d.InvocationID], d.Field)
+		}
+	}
+
+	// ancestors(id) is memoized over the union DAG; traces are acyclic, and
+	// the visiting set guards against a corrupt one.
+	memo := make(map[string]map[string]bool)
+	visiting := make(map[string]bool)
+	var ancestors func(id string) map[string]bool
+	ancestors = func(id string) map[string]bool {
+		if a, ok := memo[id]; ok {
+			return a
+		}
+		out := make(map[string]bool)
+		if visiting[id] {
+			return out
+		}
+		visiting[id] = true
+		for _, p := range parents[id] {
+			out[p] = true
+			for q := range ancestors(p) {
+				out[q] = true
+			}
+		}
+		visiting[id] = false
+		memo[id] = out
+		return out
+	}
+
+	stepOf := func(id string) Step {
+		if s, ok := expMap[id]; ok {
+			return s
+		}
+		return actMap[id]
+	}
+
+	var roots []RootCause
+	for id := range fields {
+		divergentAncestor := false
+		for a := range ancestors(id) {
+			if _, ok := fields[a]; ok {
+				divergentAncestor = true
+				break
+			}
+		}
+		if divergentAncestor {
+			continue
+		}
+		s := stepOf(id)
+		root := RootCause{InvocationID: id, AgentID: s.AgentID, Level: s.Level, Fields: fields[id]}
+		if e, eok := expMap[id]; eok {
+			if a, aok := actMap[id]; aok {
+				root.InputChanges = inputChanges(e.Input.Payload, a.Input.Payload, e.Input.Metadata, a.Input.Metadata, cfg)
+			}
+		}
+		for other := range fields {
+			if other != id && ancestors(other)[id] {
+				root.Fallout = append(root.Fallout, other)
+			}
+		}
+		sort.Strings(root.Fallout)
+		roots = append(roots, root)
+	}
+
+	sort.Slice(roots, func(i, j int) bool {
+		a, b := stepOf(roots[i].InvocationID), stepOf(roots[j].InvocationID)
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.Before(b.StartTime)
+		}
+		return roots[i].InvocationID < roots[j].InvocationID
+	})
+	return roots
+}
+
+// inputChanges diffs an invocation's input: the payload under $.payload
+// (structurally when both sides are JSON) and metadata under $.metadata.
+func inputChanges(expPayload []byte, actPayload []byte, expMeta map[string]string, actMeta map[string]string, cfg DiffConfig) []PathChange {
+	var out []PathChange
+	if changes, isJSON := DiffJSON(expPayload, actPayload, cfg); isJSON {
+		for _, c := range changes {
+			c.Path = "$.payload" + strings.TrimPrefix(c.Path, "$")
+			out = append(out, c)
+		}
+	} else if !bytes.Equal(expPayload, actPayload) {
+		out = append(out, PathChange{Path: "$.payload", Kind: ChangeChanged, Expected: string(expPayload), Actual: string(actPayload)})
+	}
+
+	keys := make([]string, 0, len(expMeta)+len(actMeta))
+	for k := range expMeta {
+		keys = append(keys, k)
+	}
+	for k := range actMeta {
+		if _, ok := expMeta[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ev, eok := expMeta[k]
+		av, aok := actMeta[k]
+		path := jsonpath.Format([]jsonpath.Seg{jsonpath.Key("metadata"), jsonpath.Key(k)})
+		switch {
+		case !aok:
+			out = append(out, PathChange{Path: path, Kind: ChangeRemoved, Expected: ev})
+		case !eok:
+			out = append(out, PathChange{Path: path, Kind: ChangeAdded, Actual: av})
+		case ev != av:
+			out = append(out, PathChange{Path: path, Kind: ChangeChanged, Expected: ev, Actual: av})
+		}
+	}
+	return out
+}
+
+// FormatRootCauses renders root causes for the text report.
+func FormatRootCauses(roots []RootCause) string {
+	if len(roots) == 0 {
+		return ""
+	}
+	fallout := 0
+	for _, r := range roots {
+		fallout += len(r.Fallout)
+	}
+	msg := fmt.Sprintf("root cause analysis: %d root cause(s), %d downstream divergence(s)\n", len(roots), fallout)
+	for _, r := range roots {
+		msg += fmt.Sprintf("- root invocation=%s agent=%s level=%d fields=%s\n", r.InvocationID, r.AgentID, r.Level, strings.Join(r.Fields, ","))
+		if len(r.InputChanges) == 0 {
+			msg += "    input: unchanged, the invocation itself behaved differently\n"
+		} else {
+			msg += "    input changes:\n"
+			for _, c := range r.InputChanges {
+				msg += "      " + formatChange(c) + "\n"
+			}
+		}
+		if len(r.Fallout) > 0 {
+			msg += fmt.Sprintf("    fallout: %s\n", strings.Join(r.Fallout, ", "))
+		}
+	}
+	return msg
+}
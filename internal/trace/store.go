@@ -0,0 +1,491 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/coordinator"
+)
+
+// ErrTraceNotFound is returned for a run the store does not hold.
+var ErrTraceNotFound = errors.New("trace not found")
+
+// Run statuses recorded in summaries.
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// maxSummaryErrors caps the error texts indexed per run.
+const maxSummaryErrors = 10
+
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// RunSummary is the indexed description of a stored run.
+type RunSummary struct {
+	RunID      string            `json:"run_id"`
+	TaskID     string            `json:"task_id"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Status     string            `json:"status"`
+	Agents     []string          `json:"agents"`
+	Errors     []string          `json:"errors,omitempty"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time"`
+	DurationMS int64             `json:"duration_ms"`
+	Steps      int               `json:"steps"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Query selects stored runs. Empty fields match everything; Since is
+// inclusive and Until exclusive, both on the run's start time.
+type Query struct {
+	Namespace string
+	Agent     string
+	Status    string
+	// Error matches runs with an error containing it, case-insensitively.
+	Error string
+	Since time.Time
+	Until time.Time
+	// Limit caps the result; zero means no limit.
+	Limit int
+}
+
+// Retention selects runs for garbage collection: those older than TTL and,
+// beyond the newest MaxRuns, the rest. Zero values disable a rule.
+type Retention struct {
+	TTL     time.Duration
+	MaxRuns int
+}
+
+// Store keeps every run's trace, keyed by run ID and indexed for queries.
+type Store interface {
+	Put(runID string, namespace string, tr ExecutionTrace) (RunSummary, error)
+	Get(runID string) (ExecutionTrace, RunSummary, error)
+	List(q Query) ([]RunSummary, error)
+	GC(r Retention, now time.Time) (int, error)
+}
+
+// Summarize builds the index entry for a run. A run failed when the final
+// attempt of any invocation failed.
+func Summarize(runID string, namespace string, tr ExecutionTrace) RunSummary {
+	s := RunSummary{
+		RunID:      runID,
+		TaskID:     tr.TaskID,
+		Namespace:  namespace,
+		Status:     RunSucceeded,
+		Agents:     []string{},
+		StartTime:  tr.StartTime,
+		EndTime:    tr.EndTime,
+		DurationMS: tr.TotalLatency.Milliseconds(),
+		Steps:      len(tr.Steps),
+		Attributes: cloneAttributes(tr.Attributes),
+	}
+	agents := make(map[string]struct{})
+	for _, st := range tr.Steps {
+		if st.AgentID != "" {
+			agents[st.AgentID] = struct{}{}
+		}
+	}
+	for a := range agents {
+		s.Agents = append(s.Agents, a)
+	}
+	sort.Strings(s.Agents)
+
+	latest := latestByInvocation(tr)
+	ids := make([]string, 0, len(latest))
+	for id := range latest {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	seen := make(map[string]struct{})
+	for _, id := range ids {
+		msg := latest[id].Error
+		if msg == "" {
+			continue
+		}
+		s.Status = RunFailed
+		if _, dup := seen[msg]; dup || len(s.Errors) >= maxSummaryErrors {
+			continue
+		}
+		seen[msg] = struct{}{}
+		s.Errors = append(s.Errors, msg)
+	}
+	return s
+}
+
+// Matches reports whether s is selected by q, ignoring Limit.
+func (q Query) Matches(s RunSummary) bool {
+	if q.Namespace != "" && s.Namespace != q.Namespace {
+		return false
+	}
+	if q.Status != "" && s.Status != q.Status {
+		return false
+	}
+	if q.Agent != "" {
+		i := sort.SearchStrings(s.Agents, q.Agent)
+		if i == len(s.Agents) || s.Agents[i] != q.Agent {
+			return false
+		}
+	}
+	if !q.Since.IsZero() && s.StartTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !s.StartTime.Before(q.Until) {
+		return false
+	}
+	if q.Error != "" {
+		needle := strings.ToLower(q.Error)
+		found := false
+		for _, e := range s.Errors {
+			if strings.Contains(strings.ToLower(e), needle) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseQueryTime accepts RFC 3339, a date (YYYY-MM-DD, UTC midnight), or a
+// duration meaning that long before now ("24h").
+func ParseQueryTime(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want RFC 3339, YYYY-MM-DD or a duration such as 24h)", raw)
+}
+
+// ValidateRunID rejects IDs that are unsafe as file names.
+func ValidateRunID(runID string) error {
+	if !runIDPattern.MatchString(runID) {
+		return fmt.Errorf("invalid run id %q", runID)
+	}
+	return nil
+}
+
+// FileStore keeps gzip-compressed trace files under dir/runs, each with its
+// summary beside it, and a JSONL index of every summary at dir/index.jsonl.
+// Get reads one run's files; List scans the whole index, so its cost grows
+// with the number of stored runs. New runs are appended to the index and
+// a run stored again is rewritten in place, so the index holds one line per
+// run. Processes sharing dir serialize index updates with a file lock.
+type FileStore struct {
+	dir  string
+	lock coordinator.Coordinator
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir, lock: coordinator.NewFileCoordinator(dir)}
+}
+
+// StoreConfigFromEnv reads TRACE_STORE_DIR, TRACE_STORE_TTL and
+// TRACE_STORE_MAX_RUNS. The store is nil when TRACE_STORE_DIR is unset.
+func StoreConfigFromEnv() (*FileStore, Retention, error) {
+	dir := strings.TrimSpace(os.Getenv("TRACE_STORE_DIR"))
+	if dir == "" {
+		return nil, Retention{}, nil
+	}
+	var r Retention
+	if raw := strings.TrimSpace(os.Getenv("TRACE_STORE_TTL")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return nil, Retention{}, fmt.Errorf("invalid TRACE_STORE_TTL %q", raw)
+		}
+		r.TTL = d
+	}
+	if raw := strings.TrimSpace(os.Getenv("TRACE_STORE_MAX_RUNS")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, Retention{}, fmt.Errorf("invalid TRACE_STORE_MAX_RUNS %q", raw)
+		}
+		r.MaxRuns = n
+	}
+	return NewFileStore(dir), r, nil
+}
+
+// Dir is the store's root directory.
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+func (s *FileStore) tracePath(runID string) string {
+	return filepath.Join(s.dir, "runs", runID+".jsonl.gz")
+}
+
+func (s *FileStore) summaryPath(runID string) string {
+	return filepath.Join(s.dir, "runs", runID+".json")
+}
+
+func (s *FileStore) indexPath() string {
+	return filepath.Join(s.dir, "index.jsonl")
+}
+
+// Put writes the run's trace and indexes it. Storing a run ID again
+// replaces it.
+func (s *FileStore) Put(runID string, namespace string, tr ExecutionTrace) (RunSummary, error) {
+	if err := ValidateRunID(runID); err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, "runs"), 0o755); err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: mkdir: %w", err)
+	}
+	sum := Summarize(runID, namespace, tr)
+	line, err := json.Marshal(sum)
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: encode summary: %w", err)
+	}
+	// Write the run's files before indexing it, so every index entry has
+	// them.
+	_, statErr := os.Stat(s.tracePath(runID))
+	replaced := statErr == nil
+	if err := writeFileAtomic(s.summaryPath(runID), line); err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: %w", err)
+	}
+	tmp := s.tracePath(runID) + ".tmp"
+	if err := SaveToFile(tmp, tr); err != nil {
+		_ = os.Remove(tmp)
+		return RunSummary{}, fmt.Errorf("trace store: %w", err)
+	}
+	if err := os.Rename(tmp, s.tracePath(runID)); err != nil {
+		_ = os.Remove(tmp)
+		return RunSummary{}, fmt.Errorf("trace store: %w", err)
+	}
+
+	err = s.withIndexLock(func() error {
+		if replaced {
+			index, err := s.readIndex()
+			if err != nil {
+				return err
+			}
+			index[runID] = sum
+			runs := make([]RunSummary, 0, len(index))
+			for _, r := range index {
+				runs = append(runs, r)
+			}
+			sortNewestFirst(runs)
+			return s.writeIndex(runs)
+		}
+		f, err := os.OpenFile(s.indexPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: index: %w", err)
+	}
+	return sum, nil
+}
+
+// Get loads a stored run from its own files, without reading the index.
+func (s *FileStore) Get(runID string) (ExecutionTrace, RunSummary, error) {
+	if err := ValidateRunID(runID); err != nil {
+		return ExecutionTrace{}, RunSummary{}, fmt.Errorf("%w: %s", ErrTraceNotFound, runID)
+	}
+	tr, err := LoadFromFile(s.tracePath(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return ExecutionTrace{}, RunSummary{}, fmt.Errorf("%w: %s", ErrTraceNotFound, runID)
+	}
+	if err != nil {
+		return ExecutionTrace{}, RunSummary{}, err
+	}
+	sum, err := s.readSummary(runID)
+	if err != nil {
+		return ExecutionTrace{}, RunSummary{}, err
+	}
+	return tr, sum, nil
+}
+
+// readSummary reads the summary stored beside a run's trace. Runs stored
+// before summaries were written beside traces are looked up in the index.
+func (s *FileStore) readSummary(runID string) (RunSummary, error) {
+	b, err := os.ReadFile(s.summaryPath(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		index, err := s.readIndex()
+		if err != nil {
+			return RunSummary{}, err
+		}
+		sum, ok := index[runID]
+		if !ok {
+			return RunSummary{}, fmt.Errorf("%w: %s", ErrTraceNotFound, runID)
+		}
+		return sum, nil
+	}
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: read summary: %w", err)
+	}
+	var sum RunSummary
+	if err := json.Unmarshal(b, &sum); err != nil {
+		return RunSummary{}, fmt.Errorf("trace store: decode summary %s: %w", runID, err)
+	}
+	return sum, nil
+}
+
+// List returns matching runs, newest first.
+func (s *FileStore) List(q Query) ([]RunSummary, error) {
+	index, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RunSummary, 0)
+	for _, sum := range index {
+		if q.Matches(sum) {
+			out = append(out, sum)
+		}
+	}
+	sortNewestFirst(out)
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+// GC deletes runs outside the retention policy and compacts the index. The
+// index is left untouched when nothing expires. It returns the number of
+// runs removed.
+func (s *FileStore) GC(r Retention, now time.Time) (int, error) {
+	if r.TTL <= 0 && r.MaxRuns <= 0 {
+		return 0, nil
+	}
+	removed := 0
+	err := s.withIndexLock(func() error {
+		index, err := s.readIndex()
+		if err != nil {
+			return err
+		}
+		runs := make([]RunSummary, 0, len(index))
+		for _, sum := range index {
+			runs = append(runs, sum)
+		}
+		sortNewestFirst(runs)
+
+		keep := make([]RunSummary, 0, len(runs))
+		for i, sum := range runs {
+			expired := r.TTL > 0 && sum.StartTime.Before(now.Add(-r.TTL))
+			if expired || (r.MaxRuns > 0 && i >= r.MaxRuns) {
+				for _, path := range []string{s.tracePath(sum.RunID), s.summaryPath(sum.RunID)} {
+					if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+				}
+				removed++
+				continue
+			}
+			keep = append(keep, sum)
+		}
+		if removed == 0 {
+			return nil
+		}
+		return s.writeIndex(keep)
+	})
+	if err != nil {
+		return removed, fmt.Errorf("trace store: gc: %w", err)
+	}
+	return removed, nil
+}
+
+// writeIndex replaces the index with runs, given newest first. Callers hold
+// the index lock.
+func (s *FileStore) writeIndex(runs []RunSummary) error {
+	// Oldest first, as appends would have written them.
+	var b strings.Builder
+	for i := len(runs) - 1; i >= 0; i-- {
+		line, err := json.Marshal(runs[i])
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return writeFileAtomic(s.indexPath(), []byte(b.String()))
+}
+
+// readIndex returns the latest entry per run ID.
+func (s *FileStore) readIndex() (map[string]RunSummary, error) {
+	out := make(map[string]RunSummary)
+	f, err := os.Open(s.indexPath())
+	if os.IsNotExist(err) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("trace store: read index: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var sum RunSummary
+		// A torn last line from a crashed writer is skipped.
+		if err := json.Unmarshal([]byte(line), &sum); err != nil || sum.RunID == "" {
+			continue
+		}
+		out[sum.RunID] = sum
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("trace store: read index: %w", err)
+	}
+	return out, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileStore) withIndexLock(fn func() error) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	lease, err := s.lock.Acquire(ctx, "trace-index", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lease.Release(context.Background()) }()
+	return fn()
+}
+
+func sortNewestFirst(runs []RunSummary) {
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartTime.Equal(runs[j].StartTime) {
+			return runs[i].StartTime.After(runs[j].StartTime)
+		}
+		return runs[i].RunID > runs[j].RunID
+	})
+}
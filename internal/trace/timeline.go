@@ -0,0 +1,65 @@
+package trace
+
+import "time"
+
+// CriticalPath returns the chain of invocations that determined the run's
+// end: starting from the invocation that finished last, it follows the
+// dependency that finished last back to a root. Each element is the
+// invocation's final step. Traces without dependency edges yield the single
+// invocation that finished last.
+func CriticalPath(tr ExecutionTrace) []Step {
+	latest := latestByInvocation(tr)
+	var sink *Step
+	for id := range latest {
+		s := latest[id]
+		if sink == nil || s.EndTime.After(sink.EndTime) || (s.EndTime.Equal(sink.EndTime) && s.InvocationID < sink.InvocationID) {
+			sink = &s
+		}
+	}
+	if sink == nil {
+		return nil
+	}
+
+	path := []Step{*sink}
+	seen := map[string]bool{sink.InvocationID: true}
+	for curr := *sink; ; {
+		var next *Step
+		for _, dep := range curr.DependsOn {
+			s, ok := latest[dep]
+			if !ok || seen[dep] {
+				continue
+			}
+			if next == nil || s.EndTime.After(next.EndTime) {
+				next = &s
+			}
+		}
+		if next == nil {
+			break
+		}
+		seen[next.InvocationID] = true
+		path = append([]Step{*next}, path...)
+		curr = *next
+	}
+	return path
+}
+
+// InvocationSpan is the wall-clock time from an invocation's first attempt
+// starting to its last attempt ending, including backoff between attempts.
+func InvocationSpan(tr ExecutionTrace, invocationID string) time.Duration {
+	var start, end time.Time
+	for _, s := range tr.Steps {
+		if s.InvocationID != invocationID {
+			continue
+		}
+		if start.IsZero() || s.StartTime.Before(start) {
+			start = s.StartTime
+		}
+		if s.EndTime.After(end) {
+			end = s.EndTime
+		}
+	}
+	if start.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
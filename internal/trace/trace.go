@@ -13,9 +13,21 @@ type ExecutionTrace struct {
 	StartTime    time.Time
 	EndTime      time.Time
 	TotalLatency time.Duration
+	// Attributes describe the run, such as the tenant it ran for.
+	Attributes map[string]string `json:",omitempty"`
 }
 
-// Step is a single agent invocation record.
+// Circuit breaker states recorded on steps.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// Step is a single agent invocation record. Together the steps of a trace
+// reconstruct the executed DAG (DependsOn, Level) and its timeline
+// (StartTime, EndTime, BackoffWaited). Fields after Attempt are empty in
+// traces recorded before they existed.
 type Step struct {
 	InvocationID string
 	AgentID      string
@@ -25,4 +37,44 @@ type Step struct {
 	Error        string
 	Duration     time.Duration
 	Attempt      int
+
+	// Seq is the order in which the recorder received the step.
+	Seq       int       `json:",omitempty"`
+	StartTime time.Time `json:",omitzero"`
+	EndTime   time.Time `json:",omitzero"`
+	// DependsOn lists the invocations this one waited for; Level is its
+	// depth in the plan, starting at 0 for invocations without dependencies.
+	DependsOn []string `json:",omitempty"`
+	Level     int      `json:",omitempty"`
+	// BackoffWaited is the retry backoff slept before this attempt.
+	BackoffWaited time.Duration `json:",omitempty"`
+	// CircuitState is the agent's breaker state when the attempt was
+	// admitted, CircuitAfter its state once the outcome was recorded.
+	CircuitState string `json:",omitempty"`
+	CircuitAfter string `json:",omitempty"`
+	// BreakerRejected marks an attempt refused by an open breaker; Probe a
+	// half-open trial attempt.
+	BreakerRejected bool `json:",omitempty"`
+	Probe           bool `json:",omitempty"`
+	// Retried reports whether the engine retried after this attempt;
+	// Retryable whether the attempt's error was eligible for a retry at all.
+	Retried   bool `json:",omitempty"`
+	Retryable bool `json:",omitempty"`
+	// Policy is the retry and breaker policy the invocation ran with.
+	Policy *Policy `json:",omitempty"`
+	// AgentVersion is the agent version that ran, when not the default v1.
+	AgentVersion string `json:",omitempty"`
+	// Reused marks a step whose outcome a what-if replay copied from the
+	// original trace instead of executing the agent.
+	Reused bool `json:",omitempty"`
+}
+
+// Policy is the effective retry and circuit breaker policy of an invocation,
+// kept so a replay can run the plan under the same resilience rules.
+type Policy struct {
+	MaxAttempts      int
+	Backoff          agentfunc.BackoffStrategy
+	FailureThreshold int           `json:",omitempty"`
+	ResetTimeout     time.Duration `json:",omitempty"`
+	ProbeTimeout     time.Duration `json:",omitempty"`
 }
@@ -0,0 +1,76 @@
+// Package usage reports metered router executions to the control plane.
+package usage
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/retry"
+	"github.com/your-org/fluxroute/internal/router"
+)
+
+// Output metadata keys agents set to report model and token usage.
+const (
+	MetadataModel        = "model"
+	MetadataInputTokens  = "input_tokens"
+	MetadataOutputTokens = "output_tokens"
+)
+
+// Event is one usage report. ID is deterministic for a run, agent and model
+// so a re-enqueued event is deduplicated by the control plane.
+type Event struct {
+	ID           string    `json:"event_id"`
+	TenantID     string    `json:"tenant_id"`
+	Namespace    string    `json:"namespace"`
+	RunID        string    `json:"run_id"`
+	Agent        string    `json:"agent"`
+	Model        string    `json:"model,omitempty"`
+	Invocations  int64     `json:"invocations"`
+	InputTokens  int64     `json:"input_tokens,omitempty"`
+	OutputTokens int64     `json:"output_tokens,omitempty"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// FromResults aggregates executed invocations of one run into one event per
+// agent and model. Invocations skipped for failed dependencies or an open
+// circuit did not run and are not billed.
+func FromResults(runID string, namespace string, tenantID string, results []router.AgentResult, at time.Time) []Event {
+	type key struct{ agent, model string }
+	byKey := make(map[key]*Event)
+	for _, r := range results {
+		if r.Invocation.ID == "" || errors.Is(r.Err, router.ErrDependencyFailed) || errors.Is(r.Err, retry.ErrCircuitOpen) {
+			continue
+		}
+		k := key{agent: r.Invocation.AgentID, model: strings.TrimSpace(r.Output.Metadata[MetadataModel])}
+		ev, ok := byKey[k]
+		if !ok {
+			id := runID + ":" + k.agent
+			if k.model != "" {
+				id += ":" + k.model
+			}
+			ev = &Event{ID: id, TenantID: tenantID, Namespace: namespace, RunID: runID, Agent: k.agent, Model: k.model, OccurredAt: at.UTC()}
+			byKey[k] = ev
+		}
+		ev.Invocations++
+		ev.InputTokens += metadataInt(r.Output.Metadata, MetadataInputTokens)
+		ev.OutputTokens += metadataInt(r.Output.Metadata, MetadataOutputTokens)
+	}
+
+	out := make([]Event, 0, len(byKey))
+	for _, ev := range byKey {
+		out = append(out, *ev)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func metadataInt(md map[string]string, key string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(md[key]), 10, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
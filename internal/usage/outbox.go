@@ -0,0 +1,151 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is an outbox record: a usage event or run outcome plus its
+// delivery state.
+type Entry struct {
+	Event         Event       `json:"event"`
+	Run           *RunOutcome `json:"run,omitempty"`
+	EnqueuedAt    time.Time   `json:"enqueued_at"`
+	Attempts      int         `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastError     string      `json:"last_error,omitempty"`
+}
+
+// ID is the outbox key of the entry's payload.
+func (e Entry) ID() string {
+	if e.Run != nil {
+		return e.Run.outboxID()
+	}
+	return e.Event.ID
+}
+
+// Outbox persists undelivered events as one JSON file per event so they
+// survive restarts. Events the control plane permanently rejects are moved
+// to the rejected/ subdirectory for inspection.
+type Outbox struct {
+	dir string
+}
+
+func NewOutbox(dir string) (*Outbox, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "fluxroute-usage-outbox")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "rejected"), 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir usage outbox: %w", err)
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+func (o *Outbox) Dir() string {
+	return o.dir
+}
+
+// Put stores an entry, replacing any entry with the same ID.
+func (o *Outbox) Put(e Entry) error {
+	if strings.TrimSpace(e.ID()) == "" {
+		return fmt.Errorf("usage event id is empty")
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode usage event: %w", err)
+	}
+	path := o.path(e.ID())
+	tmp, err := os.CreateTemp(o.dir, ".pending-*")
+	if err != nil {
+		return fmt.Errorf("write usage outbox: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write usage outbox: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("sync usage outbox: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write usage outbox: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("commit usage outbox entry: %w", err)
+	}
+	return nil
+}
+
+// Pending returns stored entries, oldest first. Unreadable files are skipped.
+func (o *Outbox) Pending() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(b, &e); err != nil {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].EnqueuedAt.Equal(out[j].EnqueuedAt) {
+			return out[i].EnqueuedAt.Before(out[j].EnqueuedAt)
+		}
+		return out[i].ID() < out[j].ID()
+	})
+	return out, nil
+}
+
+// Remove deletes a delivered entry by ID.
+func (o *Outbox) Remove(id string) error {
+	if err := os.Remove(o.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Reject moves an entry out of the delivery queue.
+func (o *Outbox) Reject(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(o.dir, "rejected", fileName(e.ID())), b, 0o644); err != nil {
+		return err
+	}
+	return o.Remove(e.ID())
+}
+
+func (o *Outbox) path(eventID string) string {
+	return filepath.Join(o.dir, fileName(eventID))
+}
+
+// fileName maps an event ID onto a safe file name.
+func fileName(eventID string) string {
+	var b strings.Builder
+	for _, r := range eventID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "%%%06x", r)
+		}
+	}
+	return b.String() + ".json"
+}
@@ -0,0 +1,236 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaseBackoff = time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+)
+
+// errRejected marks responses that will never succeed on retry.
+var errRejected = errors.New("usage event rejected")
+
+// ReporterConfig configures delivery to the control plane usage API. Role
+// is sent as X-Role, which only a control plane in insecure local mode
+// honours.
+type ReporterConfig struct {
+	BaseURL     string
+	APIKey      string
+	Role        string
+	OutboxDir   string
+	HTTPClient  *http.Client
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// FlushResult summarizes one delivery pass.
+type FlushResult struct {
+	Delivered  int
+	Duplicates int
+	Rejected   int
+	Pending    int
+}
+
+// Reporter delivers usage events through an on-disk outbox. Enqueue persists
+// events before any network call, so usage survives control plane outages
+// and router restarts; Flush retries pending events with exponential backoff.
+type Reporter struct {
+	cfg    ReporterConfig
+	outbox *Outbox
+	now    func() time.Time
+}
+
+func NewReporter(cfg ReporterConfig) (*Reporter, error) {
+	cfg.BaseURL = strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("control plane url is empty")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaultBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	outbox, err := NewOutbox(cfg.OutboxDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Reporter{cfg: cfg, outbox: outbox, now: time.Now}, nil
+}
+
+// ReporterFromEnv builds a reporter when CONTROLPLANE_URL is set and returns
+// nil otherwise.
+func ReporterFromEnv() (*Reporter, error) {
+	baseURL := strings.TrimSpace(os.Getenv("CONTROLPLANE_URL"))
+	if baseURL == "" {
+		return nil, nil
+	}
+	return NewReporter(ReporterConfig{
+		BaseURL:   baseURL,
+		APIKey:    strings.TrimSpace(os.Getenv("CONTROLPLANE_API_KEY")),
+		Role:      strings.TrimSpace(os.Getenv("REQUEST_ROLE")),
+		OutboxDir: strings.TrimSpace(os.Getenv("USAGE_OUTBOX_DIR")),
+	})
+}
+
+func (r *Reporter) Outbox() *Outbox {
+	return r.outbox
+}
+
+// Enqueue durably stores events for delivery.
+func (r *Reporter) Enqueue(events ...Event) error {
+	now := r.now().UTC()
+	for _, ev := range events {
+		if err := r.outbox.Put(Entry{Event: ev, EnqueuedAt: now, NextAttemptAt: now}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnqueueRun durably stores a run outcome for delivery.
+func (r *Reporter) EnqueueRun(o RunOutcome) error {
+	now := r.now().UTC()
+	return r.outbox.Put(Entry{Run: &o, EnqueuedAt: now, NextAttemptAt: now})
+}
+
+// Flush attempts delivery of every due event once. Transient failures are
+// rescheduled with backoff; permanent rejections are moved aside.
+func (r *Reporter) Flush(ctx context.Context) (FlushResult, error) {
+	entries, err := r.outbox.Pending()
+	if err != nil {
+		return FlushResult{}, err
+	}
+	var res FlushResult
+	var lastErr error
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			res.Pending++
+			continue
+		}
+		if e.NextAttemptAt.After(r.now()) {
+			res.Pending++
+			continue
+		}
+		duplicate, err := r.deliver(ctx, e)
+		switch {
+		case err == nil:
+			if err := r.outbox.Remove(e.ID()); err != nil {
+				lastErr = err
+			}
+			if duplicate {
+				res.Duplicates++
+			} else {
+				res.Delivered++
+			}
+		case errors.Is(err, errRejected):
+			e.Attempts++
+			e.LastError = err.Error()
+			if err := r.outbox.Reject(e); err != nil {
+				lastErr = err
+			}
+			res.Rejected++
+		default:
+			e.Attempts++
+			e.LastError = err.Error()
+			e.NextAttemptAt = r.now().Add(r.backoff(e.Attempts)).UTC()
+			if err := r.outbox.Put(e); err != nil {
+				lastErr = err
+			}
+			res.Pending++
+			lastErr = err
+		}
+	}
+	return res, lastErr
+}
+
+// Run flushes on every interval tick until ctx is done.
+func (r *Reporter) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Flush(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver posts a usage event to /v1/usage or a run outcome to
+// /v1/sla/runs.
+func (r *Reporter) deliver(ctx context.Context, e Entry) (bool, error) {
+	path, kind, id := "/v1/usage", "usage event", e.Event.ID
+	var payload any = e.Event
+	if e.Run != nil {
+		path, kind, id, payload = "/v1/sla/runs", "run outcome", e.Run.RunID, e.Run
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errRejected, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errRejected, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.cfg.Role != "" {
+		req.Header.Set("X-Role", r.cfg.Role)
+	}
+	if r.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", r.cfg.APIKey)
+	}
+	resp, err := r.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("post %s %s: %w", kind, id, err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		var ack struct {
+			Duplicate bool `json:"duplicate"`
+		}
+		_ = json.Unmarshal(msg, &ack)
+		return ack.Duplicate, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden, resp.StatusCode >= 500:
+		return false, fmt.Errorf("post %s %s: status %d: %s", kind, id, resp.StatusCode, strings.TrimSpace(string(msg)))
+	default:
+		return false, fmt.Errorf("%w: %s %s: status %d: %s", errRejected, kind, id, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+}
+
+func (r *Reporter) backoff(attempts int) time.Duration {
+	d := r.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.cfg.MaxBackoff {
+			return r.cfg.MaxBackoff
+		}
+	}
+	return d
+}
@@ -0,0 +1,43 @@
+package usage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/router"
+)
+
+// RunOutcome reports how one run ended so the control plane can account
+// the tenant's availability. A run succeeds when no invocation failed.
+type RunOutcome struct {
+	RunID        string    `json:"run_id"`
+	TenantID     string    `json:"tenant_id"`
+	Namespace    string    `json:"namespace"`
+	Succeeded    bool      `json:"succeeded"`
+	Invocations  int64     `json:"invocations"`
+	FailedAgents int64     `json:"failed_agents,omitempty"`
+	DurationMS   int64     `json:"duration_ms"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// RunFromResults summarizes a run's results. Failures skipped because a
+// dependency failed count once, at the failing agent.
+func RunFromResults(runID string, namespace string, tenantID string, results []router.AgentResult, duration time.Duration, at time.Time) RunOutcome {
+	o := RunOutcome{RunID: runID, TenantID: tenantID, Namespace: namespace, Invocations: int64(len(results)), DurationMS: duration.Milliseconds(), OccurredAt: at.UTC()}
+	for _, r := range results {
+		if r.Err != nil && !errors.Is(r.Err, router.ErrDependencyFailed) {
+			o.FailedAgents++
+		}
+	}
+	o.Succeeded = o.FailedAgents == 0
+	return o
+}
+
+// outboxID keeps run outcomes apart from the run's usage events, whose IDs
+// start with the run ID.
+func (o RunOutcome) outboxID() string {
+	if o.RunID == "" {
+		return ""
+	}
+	return "outcome:" + o.RunID
+}
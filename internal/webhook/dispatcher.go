@@ -0,0 +1,628 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBaseBackoff = 5 * time.Second
+	defaultMaxBackoff  = 10 * time.Minute
+	// maxAttemptLog bounds the attempts kept per delivery.
+	maxAttemptLog = 20
+	// defaultMaxDeliveries bounds the delivery log.
+	defaultMaxDeliveries = 10000
+)
+
+// DeliveryStatus is the lifecycle state of one event sent to one subscription.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDeadLettered deliveries exhausted their attempts and are only
+	// retried through Redeliver.
+	DeliveryDeadLettered DeliveryStatus = "dead_lettered"
+)
+
+// Attempt records one HTTP attempt.
+type Attempt struct {
+	At         time.Time     `json:"at"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+}
+
+type Delivery struct {
+	ID             string         `json:"id"`
+	SubscriptionID string         `json:"subscription_id"`
+	TenantID       string         `json:"tenant_id,omitempty"`
+	URL            string         `json:"url"`
+	Event          Event          `json:"event"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       []Attempt      `json:"attempts"`
+	AttemptCount   int            `json:"attempt_count"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func (d Delivery) clone() Delivery {
+	d.Attempts = append([]Attempt{}, d.Attempts...)
+	if d.NextAttemptAt != nil {
+		next := *d.NextAttemptAt
+		d.NextAttemptAt = &next
+	}
+	return d
+}
+
+// DeliveryFilter selects deliveries for the log. Empty fields match all.
+type DeliveryFilter struct {
+	SubscriptionID string
+	TenantID       string
+	EventType      string
+	Status         DeliveryStatus
+}
+
+type Config struct {
+	// HTTPClient defaults to a client that refuses to connect to loopback,
+	// private and link-local addresses unless AllowPrivateTargets is set.
+	HTTPClient  *http.Client
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxDeliveries bounds the delivery log. Beyond it the oldest settled
+	// deliveries are dropped first, then the oldest pending ones.
+	MaxDeliveries int
+	// AllowPrivateTargets permits subscriptions to loopback, private and
+	// link-local hosts, for development and tests.
+	AllowPrivateTargets bool
+}
+
+// ProcessResult summarizes one delivery pass.
+type ProcessResult struct {
+	Succeeded    int
+	Retrying     int
+	DeadLettered int
+}
+
+// Dispatcher holds subscriptions and the delivery log in memory. Publish
+// only enqueues; Process (or Run) performs the HTTP calls outside the lock.
+type Dispatcher struct {
+	cfg Config
+	now func() time.Time
+
+	mu            sync.Mutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]*Delivery
+	order         []string
+	inFlight      map[string]struct{}
+	subSeq        int64
+	eventSeq      int64
+	deliverySeq   int64
+	// changedSubs and changedDeliveries hold the IDs touched since Changes
+	// was last called; both are nil unless TrackChanges was called.
+	changedSubs       map[string]struct{}
+	changedDeliveries map[string]struct{}
+}
+
+func NewDispatcher(cfg Config) *Dispatcher {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = newHTTPClient(cfg.AllowPrivateTargets)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaultBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.MaxDeliveries <= 0 {
+		cfg.MaxDeliveries = defaultMaxDeliveries
+	}
+	return &Dispatcher{
+		cfg:           cfg,
+		now:           time.Now,
+		subscriptions: make(map[string]Subscription),
+		deliveries:    make(map[string]*Delivery),
+		inFlight:      make(map[string]struct{}),
+	}
+}
+
+// Subscribe validates and stores a subscription, returning it with its secret.
+func (d *Dispatcher) Subscribe(sub Subscription) (Subscription, error) {
+	if err := ValidateSubscription(&sub); err != nil {
+		return Subscription{}, err
+	}
+	if !d.cfg.AllowPrivateTargets {
+		if err := CheckTarget(sub.URL); err != nil {
+			return Subscription{}, err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subSeq++
+	sub.ID = fmt.Sprintf("whsub_%06d", d.subSeq)
+	sub.CreatedAt = d.now().UTC()
+	d.subscriptions[sub.ID] = sub
+	markChanged(d.changedSubs, sub.ID)
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription and dead-letters its pending deliveries.
+func (d *Dispatcher) Unsubscribe(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subscriptions[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
+	}
+	delete(d.subscriptions, id)
+	markChanged(d.changedSubs, id)
+	now := d.now().UTC()
+	for _, del := range d.deliveries {
+		if del.SubscriptionID == id && del.Status == DeliveryPending {
+			del.Status = DeliveryDeadLettered
+			del.NextAttemptAt = nil
+			del.UpdatedAt = now
+			markChanged(d.changedDeliveries, del.ID)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) Subscription(id string) (Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sub, ok := d.subscriptions[id]
+	if !ok {
+		return Subscription{}, fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
+	}
+	return sub, nil
+}
+
+// Subscriptions lists subscriptions for a tenant, including global ones;
+// an empty tenant lists all.
+func (d *Dispatcher) Subscriptions(tenantID string) []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Subscription, 0, len(d.subscriptions))
+	for _, sub := range d.subscriptions {
+		if tenantID != "" && sub.TenantID != "" && sub.TenantID != tenantID {
+			continue
+		}
+		out = append(out, sub)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Publish records an event and enqueues a delivery for every matching
+// subscription. It returns the stored event.
+func (d *Dispatcher) Publish(eventType string, tenantID string, data any) (Event, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now().UTC()
+	d.eventSeq++
+	ev := Event{ID: fmt.Sprintf("evt_%06d", d.eventSeq), Type: eventType, TenantID: tenantID, CreatedAt: now, Data: body}
+	for _, sub := range d.subscriptions {
+		if !sub.Matches(ev) {
+			continue
+		}
+		d.deliverySeq++
+		id := fmt.Sprintf("whdel_%06d", d.deliverySeq)
+		d.deliveries[id] = &Delivery{
+			ID:             id,
+			SubscriptionID: sub.ID,
+			TenantID:       tenantID,
+			URL:            sub.URL,
+			Event:          ev,
+			Status:         DeliveryPending,
+			Attempts:       []Attempt{},
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		d.order = append(d.order, id)
+		markChanged(d.changedDeliveries, id)
+	}
+	d.trimLocked()
+	return ev, nil
+}
+
+// trimLocked drops deliveries beyond MaxDeliveries, oldest settled ones
+// first. Deliveries in flight are kept until their attempt is recorded.
+func (d *Dispatcher) trimLocked() {
+	excess := len(d.deliveries) - d.cfg.MaxDeliveries
+	if excess <= 0 {
+		return
+	}
+	for _, settledOnly := range []bool{true, false} {
+		if excess <= 0 {
+			break
+		}
+		kept := d.order[:0]
+		for _, id := range d.order {
+			_, busy := d.inFlight[id]
+			if excess > 0 && !busy && (!settledOnly || d.deliveries[id].Status != DeliveryPending) {
+				delete(d.deliveries, id)
+				markChanged(d.changedDeliveries, id)
+				excess--
+				continue
+			}
+			kept = append(kept, id)
+		}
+		clear(d.order[len(kept):])
+		d.order = kept
+	}
+}
+
+func (d *Dispatcher) Delivery(id string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	del, ok := d.deliveries[id]
+	if !ok {
+		return Delivery{}, fmt.Errorf("%w: %s", ErrDeliveryNotFound, id)
+	}
+	return del.clone(), nil
+}
+
+// Deliveries returns the delivery log, newest first.
+func (d *Dispatcher) Deliveries(f DeliveryFilter) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Delivery, 0)
+	for _, del := range d.deliveries {
+		if f.SubscriptionID != "" && del.SubscriptionID != f.SubscriptionID {
+			continue
+		}
+		if f.TenantID != "" && del.TenantID != f.TenantID {
+			continue
+		}
+		if f.EventType != "" && del.Event.Type != f.EventType {
+			continue
+		}
+		if f.Status != "" && del.Status != f.Status {
+			continue
+		}
+		out = append(out, del.clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out
+}
+
+// Redeliver requeues a delivery for immediate retry with a fresh attempt budget.
+func (d *Dispatcher) Redeliver(id string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	del, ok := d.deliveries[id]
+	if !ok {
+		return Delivery{}, fmt.Errorf("%w: %s", ErrDeliveryNotFound, id)
+	}
+	now := d.now().UTC()
+	del.Status = DeliveryPending
+	del.AttemptCount = 0
+	del.NextAttemptAt = &now
+	del.UpdatedAt = now
+	markChanged(d.changedDeliveries, id)
+	return del.clone(), nil
+}
+
+// Process attempts every due pending delivery once.
+func (d *Dispatcher) Process(ctx context.Context) ProcessResult {
+	type job struct {
+		id     string
+		url    string
+		event  Event
+		secret string
+	}
+	d.mu.Lock()
+	now := d.now()
+	jobs := make([]job, 0)
+	for id, del := range d.deliveries {
+		if del.Status != DeliveryPending || (del.NextAttemptAt != nil && del.NextAttemptAt.After(now)) {
+			continue
+		}
+		if _, busy := d.inFlight[id]; busy {
+			continue
+		}
+		sub, ok := d.subscriptions[del.SubscriptionID]
+		if !ok {
+			continue
+		}
+		d.inFlight[id] = struct{}{}
+		jobs = append(jobs, job{id: id, url: del.URL, event: del.Event, secret: sub.Secret})
+	}
+	d.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].id < jobs[j].id })
+
+	var res ProcessResult
+	for _, j := range jobs {
+		attempt := d.send(ctx, j.id, j.url, j.secret, j.event)
+		switch d.record(j.id, attempt) {
+		case DeliverySucceeded:
+			res.Succeeded++
+		case DeliveryDeadLettered:
+			res.DeadLettered++
+		default:
+			res.Retrying++
+		}
+	}
+	return res
+}
+
+// SubscriptionState is a subscription including its signing secret.
+type SubscriptionState struct {
+	Subscription
+	Secret string `json:"secret"`
+}
+
+// DispatcherState is the dispatcher's subscriptions and delivery log in
+// serializable form, used to share them between control-plane replicas.
+type DispatcherState struct {
+	Subscriptions []SubscriptionState `json:"subscriptions,omitempty"`
+	Deliveries    []Delivery          `json:"deliveries,omitempty"`
+	SubSeq        int64               `json:"sub_seq"`
+	EventSeq      int64               `json:"event_seq"`
+	DeliverySeq   int64               `json:"delivery_seq"`
+}
+
+func (d *Dispatcher) State() DispatcherState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := DispatcherState{SubSeq: d.subSeq, EventSeq: d.eventSeq, DeliverySeq: d.deliverySeq}
+	for _, sub := range d.subscriptions {
+		st.Subscriptions = append(st.Subscriptions, SubscriptionState{Subscription: sub, Secret: sub.Secret})
+	}
+	sort.Slice(st.Subscriptions, func(i, j int) bool { return st.Subscriptions[i].ID < st.Subscriptions[j].ID })
+	for _, del := range d.deliveries {
+		st.Deliveries = append(st.Deliveries, del.clone())
+	}
+	sort.Slice(st.Deliveries, func(i, j int) bool { return st.Deliveries[i].ID < st.Deliveries[j].ID })
+	return st
+}
+
+// Restore replaces subscriptions and deliveries with st. Deliveries in
+// flight on this dispatcher finish against the restored log.
+func (d *Dispatcher) Restore(st DispatcherState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subSeq, d.eventSeq, d.deliverySeq = st.SubSeq, st.EventSeq, st.DeliverySeq
+	d.subscriptions = make(map[string]Subscription, len(st.Subscriptions))
+	for _, sub := range st.Subscriptions {
+		s := sub.Subscription
+		s.Secret = sub.Secret
+		d.subscriptions[s.ID] = s
+	}
+	d.deliveries = make(map[string]*Delivery, len(st.Deliveries))
+	d.order = make([]string, 0, len(st.Deliveries))
+	for _, del := range st.Deliveries {
+		del := del.clone()
+		d.deliveries[del.ID] = &del
+		d.order = append(d.order, del.ID)
+	}
+	d.sortOrderLocked()
+	d.trimLocked()
+	if d.changedSubs != nil {
+		clear(d.changedSubs)
+		clear(d.changedDeliveries)
+	}
+}
+
+// sortOrderLocked orders the delivery log oldest first. IDs are zero-padded
+// sequence numbers that outgrow their padding.
+func (d *Dispatcher) sortOrderLocked() {
+	sort.Slice(d.order, func(i, j int) bool {
+		a, b := d.order[i], d.order[j]
+		return len(a) < len(b) || len(a) == len(b) && a < b
+	})
+}
+
+// DispatcherChanges is what changed in a dispatcher since its changes were
+// last taken: subscriptions and deliveries by value, and the IDs of those
+// removed since.
+type DispatcherChanges struct {
+	Subscriptions     []SubscriptionState `json:"subscriptions,omitempty"`
+	Unsubscribed      []string            `json:"unsubscribed,omitempty"`
+	Deliveries        []Delivery          `json:"deliveries,omitempty"`
+	DroppedDeliveries []string            `json:"dropped_deliveries,omitempty"`
+	SubSeq            int64               `json:"sub_seq"`
+	EventSeq          int64               `json:"event_seq"`
+	DeliverySeq       int64               `json:"delivery_seq"`
+}
+
+// Empty reports whether c changes nothing.
+func (c DispatcherChanges) Empty() bool {
+	return len(c.Subscriptions)+len(c.Unsubscribed)+len(c.Deliveries)+len(c.DroppedDeliveries) == 0
+}
+
+// TrackChanges makes the dispatcher remember which subscriptions and
+// deliveries change, so replicas can copy just those through Changes.
+func (d *Dispatcher) TrackChanges() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.changedSubs == nil {
+		d.changedSubs = make(map[string]struct{})
+		d.changedDeliveries = make(map[string]struct{})
+	}
+}
+
+func markChanged(changed map[string]struct{}, id string) {
+	if changed != nil {
+		changed[id] = struct{}{}
+	}
+}
+
+// Changes returns what changed since the last call and starts over. It is
+// empty unless TrackChanges was called.
+func (d *Dispatcher) Changes() DispatcherChanges {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := DispatcherChanges{SubSeq: d.subSeq, EventSeq: d.eventSeq, DeliverySeq: d.deliverySeq}
+	for id := range d.changedSubs {
+		if sub, ok := d.subscriptions[id]; ok {
+			c.Subscriptions = append(c.Subscriptions, SubscriptionState{Subscription: sub, Secret: sub.Secret})
+		} else {
+			c.Unsubscribed = append(c.Unsubscribed, id)
+		}
+	}
+	for id := range d.changedDeliveries {
+		if del, ok := d.deliveries[id]; ok {
+			c.Deliveries = append(c.Deliveries, del.clone())
+		} else {
+			c.DroppedDeliveries = append(c.DroppedDeliveries, id)
+		}
+	}
+	sort.Slice(c.Subscriptions, func(i, j int) bool { return c.Subscriptions[i].ID < c.Subscriptions[j].ID })
+	sort.Strings(c.Unsubscribed)
+	sort.Slice(c.Deliveries, func(i, j int) bool { return c.Deliveries[i].ID < c.Deliveries[j].ID })
+	sort.Strings(c.DroppedDeliveries)
+	clear(d.changedSubs)
+	clear(d.changedDeliveries)
+	return c
+}
+
+// ApplyChanges copies another dispatcher's changes into this one. The
+// delivery log is not trimmed: dropped deliveries arrive as changes.
+func (d *Dispatcher) ApplyChanges(c DispatcherChanges) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subSeq, d.eventSeq, d.deliverySeq = max(d.subSeq, c.SubSeq), max(d.eventSeq, c.EventSeq), max(d.deliverySeq, c.DeliverySeq)
+	for _, sub := range c.Subscriptions {
+		s := sub.Subscription
+		s.Secret = sub.Secret
+		d.subscriptions[s.ID] = s
+	}
+	for _, id := range c.Unsubscribed {
+		delete(d.subscriptions, id)
+	}
+	added := false
+	for _, del := range c.Deliveries {
+		del := del.clone()
+		if _, ok := d.deliveries[del.ID]; !ok {
+			d.order = append(d.order, del.ID)
+			added = true
+		}
+		d.deliveries[del.ID] = &del
+	}
+	for _, id := range c.DroppedDeliveries {
+		delete(d.deliveries, id)
+	}
+	if len(c.DroppedDeliveries) > 0 {
+		kept := d.order[:0]
+		for _, id := range d.order {
+			if _, ok := d.deliveries[id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		clear(d.order[len(kept):])
+		d.order = kept
+	}
+	if added {
+		d.sortOrderLocked()
+	}
+}
+
+// Run processes deliveries on every interval tick until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.Process(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, deliveryID string, url string, secret string, ev Event) Attempt {
+	start := d.now()
+	attempt := Attempt{At: start.UTC()}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, ev.Type)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, Sign(secret, start, body))
+	resp, err := d.cfg.HTTPClient.Do(req)
+	attempt.Duration = d.now().Sub(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return attempt
+}
+
+func (d *Dispatcher) record(id string, attempt Attempt) DeliveryStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, id)
+	del, ok := d.deliveries[id]
+	if !ok {
+		return DeliveryPending
+	}
+	del.Attempts = append(del.Attempts, attempt)
+	if len(del.Attempts) > maxAttemptLog {
+		del.Attempts = del.Attempts[len(del.Attempts)-maxAttemptLog:]
+	}
+	del.AttemptCount++
+	markChanged(d.changedDeliveries, id)
+	now := d.now().UTC()
+	del.UpdatedAt = now
+	switch {
+	case attempt.Error == "":
+		del.Status = DeliverySucceeded
+		del.NextAttemptAt = nil
+	case del.AttemptCount >= d.cfg.MaxAttempts:
+		del.Status = DeliveryDeadLettered
+		del.NextAttemptAt = nil
+	default:
+		next := now.Add(d.backoff(del.AttemptCount))
+		del.NextAttemptAt = &next
+	}
+	return del.Status
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		b *= 2
+		if b >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+	return b
+}
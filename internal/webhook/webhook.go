@@ -0,0 +1,231 @@
+// Package webhook delivers signed control-plane event notifications to
+// subscriber endpoints with retries and a dead-letter list.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Event types published by the control plane.
+const (
+	EventTenantCreated         = "tenant.created"
+	EventUsageThresholdCrossed = "usage.threshold_crossed"
+	EventInvoiceFinalized      = "invoice.finalized"
+	EventQuotaExceeded         = "quota.exceeded"
+)
+
+var EventTypes = []string{EventTenantCreated, EventUsageThresholdCrossed, EventInvoiceFinalized, EventQuotaExceeded}
+
+// Delivery request headers.
+const (
+	HeaderSignature = "X-Fluxroute-Signature"
+	HeaderEvent     = "X-Fluxroute-Event"
+	HeaderDelivery  = "X-Fluxroute-Delivery"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound     = errors.New("webhook delivery not found")
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrPrivateTarget        = errors.New("webhook target is not a public address")
+)
+
+// Event is the JSON body posted to subscribers.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	TenantID  string          `json:"tenant_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Subscription routes events to one endpoint. An empty TenantID receives
+// events for every tenant. Secret is only returned when the subscription is
+// created.
+type Subscription struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the subscription wants the event.
+func (s Subscription) Matches(ev Event) bool {
+	if s.TenantID != "" && s.TenantID != ev.TenantID {
+		return false
+	}
+	for _, t := range s.Events {
+		if t == "*" || t == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSubscription normalizes and checks a subscription before storage.
+func ValidateSubscription(sub *Subscription) error {
+	sub.URL = strings.TrimSpace(sub.URL)
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url %q", sub.URL)
+	}
+	if len(sub.Events) == 0 {
+		return fmt.Errorf("at least one event type is required")
+	}
+	seen := make(map[string]struct{}, len(sub.Events))
+	events := make([]string, 0, len(sub.Events))
+	for _, raw := range sub.Events {
+		t := strings.ToLower(strings.TrimSpace(raw))
+		if !knownEvent(t) {
+			return fmt.Errorf("unknown event type %q", raw)
+		}
+		if _, dup := seen[t]; dup {
+			continue
+		}
+		seen[t] = struct{}{}
+		events = append(events, t)
+	}
+	sub.Events = events
+	if sub.Secret == "" {
+		secret, err := NewSecret()
+		if err != nil {
+			return err
+		}
+		sub.Secret = secret
+	}
+	return nil
+}
+
+// CheckTarget rejects URLs naming localhost or a loopback, private,
+// link-local or unspecified IP address. Host names are checked again when
+// the delivery connects, since they may resolve to such an address.
+func CheckTarget(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url %q", raw)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+	}
+	return nil
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnat.Contains(addr)
+}
+
+// cgnat is the shared address space of RFC 6598.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// newHTTPClient returns the default delivery client. Unless private targets
+// are allowed its dialer refuses non-public addresses, which also covers
+// redirects and host names resolving to internal addresses.
+func newHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if addr, err := netip.ParseAddr(host); err != nil || !publicAddr(addr) {
+				return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+	}
+}
+
+func knownEvent(t string) bool {
+	if t == "*" {
+		return true
+	}
+	for _, known := range EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a body sent at ts. The MAC
+// covers "<unix seconds>.<body>" so a captured request cannot be replayed
+// with a fresh timestamp.
+func Sign(secret string, ts time.Time, body []byte) string {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + unix + ",v1=" + mac(secret, unix, body)
+}
+
+// Verify checks a signature header against body. A non-zero tolerance also
+// rejects signatures older or newer than tolerance relative to now.
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			unix = v
+		case "v1":
+			sig = v
+		}
+	}
+	ts, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, unix, body))) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		skew := now.Sub(time.Unix(ts, 0))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > tolerance {
+			return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+		}
+	}
+	return nil
+}
+
+func mac(secret string, unix string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	_, _ = h.Write([]byte(unix))
+	_, _ = h.Write([]byte("."))
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,331 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CassetteVersion is the cassette file format version.
+const CassetteVersion = 1
+
+// secretQueryParams are stripped from recorded URLs and ignored when matching;
+// Gemini, for one, passes its API key as ?key=.
+var secretQueryParams = map[string]bool{
+	"key":          true,
+	"api_key":      true,
+	"apikey":       true,
+	"access_token": true,
+	"token":        true,
+}
+
+// Cassette is a recording of provider HTTP interactions. Metadata carries
+// whatever the recording side needs to rebuild its clients on replay.
+type Cassette struct {
+	Version      int               `json:"version"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Interactions []Interaction     `json:"interactions"`
+}
+
+// Interaction is one recorded request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request with credentials removed: request headers are
+// not kept and secret query parameters are stripped from the URL.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is the provider's answer to a RecordedRequest.
+type RecordedResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   string            `json:"body"`
+}
+
+// Redactor scrubs sensitive values from recorded bodies. Package redact
+// provides the implementation configured from a manifest.
+type Redactor interface {
+	RedactPayload(b []byte) []byte
+}
+
+// Redact passes every recorded request and response body through r, so a
+// cassette saved next to a redacted trace holds no more than the trace.
+func (c *Cassette) Redact(r Redactor) {
+	for i := range c.Interactions {
+		in := &c.Interactions[i]
+		in.Request.Body = string(r.RedactPayload([]byte(in.Request.Body)))
+		in.Response.Body = string(r.RedactPayload([]byte(in.Response.Body)))
+	}
+}
+
+// LoadCassette reads a cassette written by Cassette.Save.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read %q: %w", path, err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cassette: decode %q: %w", path, err)
+	}
+	if c.Version > CassetteVersion {
+		return nil, fmt.Errorf("cassette: %q has version %d, newest supported is %d", path, c.Version, CassetteVersion)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette as indented JSON, replacing path atomically.
+func (c *Cassette) Save(path string) error {
+	if c.Version == 0 {
+		c.Version = CassetteVersion
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: encode: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("cassette: create dir: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("cassette: write %q: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("cassette: write %q: %w", path, err)
+	}
+	return nil
+}
+
+// Recorder is an http.RoundTripper that forwards requests to a base transport
+// and records every completed exchange.
+type Recorder struct {
+	base http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecorder wraps base, or http.DefaultTransport when base is nil.
+func NewRecorder(base http.RoundTripper) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    redactURL(req.URL).String(),
+			Body:   string(reqBody),
+		},
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: recordHeader(resp.Header),
+			Body:   string(respBody),
+		},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Version: CassetteVersion, Interactions: append([]Interaction(nil), r.interactions...)}
+}
+
+// Replayer is an http.RoundTripper that serves recorded responses without
+// touching the network. Requests match on method, path, query without
+// secret parameters and canonical JSON body; the host is ignored, so a
+// cassette recorded against one base URL replays against another.
+// Interactions sharing a request are served in recording order, and the last
+// one keeps being served once they run out.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	redactor     Redactor
+	byKey        map[string][]Interaction
+	servedN      map[string]int
+}
+
+// NewReplayer serves the interactions of c.
+func NewReplayer(c *Cassette) *Replayer {
+	r := &Replayer{interactions: c.Interactions}
+	r.index()
+	return r
+}
+
+// SetRedactor makes the replayer redact request bodies before matching
+// them, for cassettes recorded with Cassette.Redact. Redaction is
+// deterministic, so a live request matches its redacted recording. Call it
+// before the first request.
+func (r *Replayer) SetRedactor(red Redactor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.redactor = red
+	r.index()
+}
+
+// index keys the interactions by request. Recorded bodies are redacted too,
+// which leaves already redacted ones unchanged. Callers hold mu or own r.
+func (r *Replayer) index() {
+	r.byKey, r.servedN = map[string][]Interaction{}, map[string]int{}
+	for _, in := range r.interactions {
+		u, err := url.Parse(in.Request.URL)
+		if err != nil {
+			continue
+		}
+		k := requestKey(in.Request.Method, u, r.redact([]byte(in.Request.Body)))
+		r.byKey[k] = append(r.byKey[k], in)
+	}
+}
+
+func (r *Replayer) redact(body []byte) []byte {
+	if r.redactor == nil {
+		return body
+	}
+	return r.redactor.RedactPayload(body)
+}
+
+// RoundTrip implements http.RoundTripper. A request with no recorded
+// interaction fails with ErrNoInteraction.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	k := requestKey(req.Method, req.URL, r.redact(body))
+	recorded := r.byKey[k]
+	n := r.servedN[k]
+	if n < len(recorded) {
+		r.servedN[k] = n + 1
+	} else {
+		n = len(recorded) - 1
+	}
+	r.mu.Unlock()
+	if n < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, redactURL(req.URL).Path)
+	}
+
+	rec := recorded[n].Response
+	header := make(http.Header, len(rec.Header))
+	for name, v := range rec.Header {
+		header.Set(name, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
+
+// readRequestBody drains req.Body and puts an identical reader back.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read request: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func redactURL(u *url.URL) *url.URL {
+	out := *u
+	out.User = nil
+	q := out.Query()
+	for name := range q {
+		if secretQueryParams[strings.ToLower(name)] {
+			q.Del(name)
+		}
+	}
+	out.RawQuery = q.Encode()
+	return &out
+}
+
+// requestKey normalizes a request for matching.
+func requestKey(method string, u *url.URL, body []byte) string {
+	r := redactURL(u)
+	return strings.ToUpper(method) + " " + r.EscapedPath() + "?" + r.RawQuery + "\n" + string(canonicalJSON(body))
+}
+
+// canonicalJSON re-encodes a JSON body with sorted keys and no insignificant
+// whitespace; other bodies are returned trimmed.
+func canonicalJSON(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return bytes.TrimSpace(body)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return bytes.TrimSpace(body)
+	}
+	return b
+}
+
+// recordHeader keeps the response headers worth replaying, dropping cookies
+// and anything that looks like a credential.
+func recordHeader(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if lower == "set-cookie" || strings.Contains(lower, "auth") || strings.Contains(lower, "key") || strings.Contains(lower, "token") {
+			continue
+		}
+		out[name] = h.Get(name)
+	}
+	return out
+}
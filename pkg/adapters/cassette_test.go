@@ -0,0 +1,79 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderReplayerRoundTrip(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"overloaded"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"text":"world"}`))
+	}))
+	defer srv.Close()
+
+	post := func(client *http.Client, base string, body string) (int, string, error) {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, base+"/v1beta/models/m:generateContent?key=secret-key", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer secret-key")
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), nil
+	}
+
+	rec := NewRecorder(srv.Client().Transport)
+	recording := &http.Client{Transport: rec}
+	for range 2 {
+		if _, _, err := post(recording, srv.URL, `{"prompt":"hello","max":1}`); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Cassette().Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	srv.Close()
+
+	c, err := LoadCassette(path)
+	if err != nil || len(c.Interactions) != 2 {
+		t.Fatalf("load: %+v %v", c, err)
+	}
+	in := c.Interactions[0]
+	if strings.Contains(in.Request.URL, "secret-key") || in.Response.Header["Set-Cookie"] != "" {
+		t.Fatalf("expected credentials stripped, got %+v", in)
+	}
+
+	// Another host and a reordered JSON body still match, in recording order.
+	replaying := &http.Client{Transport: NewReplayer(c)}
+	want := []struct {
+		status int
+		body   string
+	}{{503, `{"error":"overloaded"}`}, {200, `{"text":"world"}`}, {200, `{"text":"world"}`}}
+	for i, w := range want {
+		status, body, err := post(replaying, "http://replay.invalid", "{ \"max\": 1, \"prompt\": \"hello\" }")
+		if err != nil || status != w.status || body != w.body {
+			t.Fatalf("replay %d: got %d %q (%v), want %d %q", i, status, body, err, w.status, w.body)
+		}
+	}
+	if _, _, err := post(replaying, "http://replay.invalid", `{"prompt":"other"}`); !errors.Is(err, ErrNoInteraction) {
+		t.Fatalf("expected ErrNoInteraction for unrecorded request, got %v", err)
+	}
+}
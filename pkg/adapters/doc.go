@@ -4,4 +4,7 @@
 //   - openai
 //   - anthropic
 //   - gemini
+//
+// Recorder and Replayer are http.RoundTrippers that capture provider
+// exchanges into a Cassette and serve them back offline.
 package adapters
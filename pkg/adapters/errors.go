@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrMissingAPIKey = errors.New("missing api key")
 	ErrEmptyPrompt   = errors.New("prompt is empty")
+	ErrNoInteraction = errors.New("cassette: no recorded interaction matches request")
 )
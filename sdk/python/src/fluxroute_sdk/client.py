@@ -2,6 +2,7 @@ from __future__ import annotations
 
 import json
 from dataclasses import asdict
+from decimal import Decimal
 from typing import Any
 from urllib import error, parse, request
 
@@ -77,8 +78,10 @@ class FluxRouteClient:
         return Invoice(
             tenant_id=data.get("tenant_id", ""),
             invocations=int(data.get("invocations", 0)),
-            usd_per_thousand=float(data.get("usd_per_thousand", 0.0)),
-            amount_usd=float(data.get("amount_usd", 0.0)),
+            status=str(data.get("status", "")),
+            currency=str(data.get("currency", "USD")),
+            subtotal=Decimal(str(data.get("subtotal", {}).get("amount", "0"))),
+            total=Decimal(str(data.get("total", {}).get("amount", "0"))),
         )
 
     def get_invoice_csv(self, tenant_id: str) -> str:
@@ -1,6 +1,7 @@
 from __future__ import annotations
 
 from dataclasses import dataclass
+from decimal import Decimal
 
 
 @dataclass(frozen=True)
@@ -13,5 +14,7 @@ class TenantUsage:
 class Invoice:
     tenant_id: str
     invocations: int
-    usd_per_thousand: float
-    amount_usd: float
+    status: str
+    currency: str
+    subtotal: Decimal
+    total: Decimal
@@ -10,11 +10,21 @@ export interface UsageListResponse {
   page_size: number;
 }
 
+/** Exact decimal amount encoded as a string, e.g. "6.25". */
+export interface Money {
+  amount: string;
+  currency: string;
+}
+
 export interface Invoice {
   tenant_id: string;
+  status: "draft" | "finalized" | "void";
+  currency: string;
   invocations: number;
-  usd_per_thousand: number;
-  amount_usd: number;
+  subtotal: Money;
+  credits: Money;
+  tax: Money;
+  total: Money;
 }
 
 export interface BillingSummary {
@@ -0,0 +1,65 @@
+package replay
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/fluxroute/internal/app"
+)
+
+func TestGoldenFixturesMatch(t *testing.T) {
+	report, err := app.RunGoldenTests("../golden", false)
+	if err != nil {
+		t.Fatalf("run golden tests: %v", err)
+	}
+	if !report.OK() || report.Passed == 0 {
+		t.Fatalf("golden fixtures diverged; rerun `fluxroute-cli test tests/golden --update` if intended:\n%s", app.FormatGoldenReport(report))
+	}
+}
+
+func TestGoldenRunnerReportsDivergenceAndUpdates(t *testing.T) {
+	dir := t.TempDir()
+	caseDir := filepath.Join(dir, "echo")
+	if err := os.MkdirAll(caseDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := "agents:\n  - id: summarize_agent\npipeline:\n  - step: summarize_agent\n"
+	if err := os.WriteFile(filepath.Join(caseDir, "manifest.yaml"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := app.RunGoldenTests(dir, false)
+	if err != nil {
+		t.Fatalf("run golden tests: %v", err)
+	}
+	if report.Errors != 1 || !strings.Contains(report.Cases[0].Error, "--update") {
+		t.Fatalf("expected a missing golden to be an error, got %+v", report.Cases)
+	}
+
+	if report, err = app.RunGoldenTests(dir, true); err != nil || report.Updated != 1 {
+		t.Fatalf("expected the golden to be written, got %+v (%v)", report, err)
+	}
+	if err := os.WriteFile(filepath.Join(caseDir, "input.json"), []byte(`{"message":"changed"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = app.RunGoldenTests(dir, false)
+	if err != nil {
+		t.Fatalf("run golden tests: %v", err)
+	}
+	if report.Failed != 1 || report.Cases[0].Divergences[0].Field != "payload_hash" {
+		t.Fatalf("expected a payload divergence, got %+v", report.Cases)
+	}
+
+	var junit bytes.Buffer
+	if err := app.WriteGoldenJUnit(&junit, report); err != nil {
+		t.Fatalf("write junit: %v", err)
+	}
+	for _, want := range []string{`<testsuites tests="1" failures="1" errors="0">`, `<testcase name="echo"`, `<failure message="1 divergence(s) from golden.json">`} {
+		if !strings.Contains(junit.String(), want) {
+			t.Fatalf("junit report missing %q:\n%s", want, junit.String())
+		}
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/trace"
 )
 
 func TestReplayFromTraceFile(t *testing.T) {
@@ -54,3 +56,98 @@ func writeManifest(t *testing.T, data string) string {
 	}
 	return path
 }
+
+func TestDAGReplayFromTraceFile(t *testing.T) {
+	manifestPath := writeManifest(t, `
+agents:
+  - id: flaky_classify
+    retry:
+      max_attempts: 3
+      backoff: linear
+  - id: fail_enrich
+    circuit_breaker:
+      failure_threshold: 1
+  - id: summarize_agent
+pipeline:
+  - step: flaky_classify
+  - step: fail_enrich
+  - step: summarize_agent
+    depends_on: fail_enrich
+`)
+	tracePath := filepath.Join(t.TempDir(), "trace.jsonl")
+	t.Setenv("TRACE_OUTPUT", tracePath)
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+
+	if _, err := app.RunManifestReport(manifestPath); err != nil {
+		t.Fatalf("run manifest report: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := app.ReplayTraceDAG(tracePath, &out); err != nil {
+		t.Fatalf("dag replay failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "dag replay matched 4 attempt(s) across 3 invocation(s)") {
+		t.Fatalf("unexpected replay output: %q", out.String())
+	}
+}
+
+func TestWhatIfReplayReusesUpstreamAndSwapsAgentVersion(t *testing.T) {
+	manifestPath := writeManifest(t, `
+agents:
+  - id: classify
+  - id: enrich
+    versions:
+      v2: {}
+  - id: summarize
+pipeline:
+  - step: classify
+  - step: enrich
+    depends_on: classify
+  - step: summarize
+    depends_on: enrich
+`)
+	dir := t.TempDir()
+	tracePath := filepath.Join(dir, "trace.jsonl")
+	t.Setenv("TRACE_OUTPUT", tracePath)
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+	if _, err := app.RunManifestReport(manifestPath); err != nil {
+		t.Fatalf("run manifest report: %v", err)
+	}
+
+	var out bytes.Buffer
+	opts := app.WhatIfOptions{From: "0002_enrich", Overrides: []string{"agent=v2"}, ManifestPath: manifestPath}
+	if err := app.ReplayFrom(tracePath, opts, &out); err != nil {
+		t.Fatalf("what-if replay: %v", err)
+	}
+	if !strings.Contains(out.String(), "reused 1 step(s), re-executed 2") {
+		t.Fatalf("unexpected what-if summary: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "root invocation=0002_enrich") {
+		t.Fatalf("expected enrich as the root cause: %q", out.String())
+	}
+
+	whatIf, err := trace.LoadFromFile(filepath.Join(dir, "trace.whatif.jsonl"))
+	if err != nil {
+		t.Fatalf("load what-if trace: %v", err)
+	}
+	for _, s := range whatIf.Steps {
+		switch s.InvocationID {
+		case "0001_classify":
+			if !s.Reused {
+				t.Fatalf("expected classify to be reused: %+v", s)
+			}
+		case "0002_enrich":
+			if s.Reused || s.AgentVersion != "v2" || !strings.Contains(string(s.Output.Payload), "enrich@v2") {
+				t.Fatalf("expected enrich to run v2: %+v", s)
+			}
+		case "0003_summarize":
+			if s.Reused {
+				t.Fatalf("expected summarize to re-execute: %+v", s)
+			}
+		}
+	}
+
+	if err := app.ReplayFrom(tracePath, app.WhatIfOptions{From: "0002_enrich", Overrides: []string{"agent=v3"}, ManifestPath: manifestPath}, &out); err == nil {
+		t.Fatal("expected an unregistered version to be rejected")
+	}
+}
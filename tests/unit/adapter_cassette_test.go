@@ -0,0 +1,125 @@
+package unit
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/redact"
+	"github.com/your-org/fluxroute/pkg/adapters"
+)
+
+func TestRecordedProviderPipelineReplaysOffline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"output_text":"classified","usage":{"input_tokens":3,"output_tokens":1}}`))
+	}))
+	tracePath := filepath.Join(t.TempDir(), "trace.jsonl")
+	t.Setenv("TRACE_OUTPUT", tracePath)
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+	t.Setenv("REQUEST_ROLE", "operator")
+	t.Setenv("OPENAI_API_KEY", "sk-live-secret")
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+	t.Setenv("ADAPTER_CASSETTE_MODE", "record")
+
+	report, err := app.RunManifestReport(writeManifest(t, `
+agents:
+  - id: classify_agent
+    provider: openai
+    model: gpt-4o-mini
+  - id: summarize_agent
+pipeline:
+  - step: classify_agent
+  - step: summarize_agent
+    depends_on: classify_agent
+`))
+	if err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	if got := string(report.Results[0].Output.Payload); got != "classified" {
+		t.Fatalf("expected provider output, got %q", got)
+	}
+	srv.Close()
+
+	raw, err := os.ReadFile(tracePath + ".cassette.json")
+	if err != nil {
+		t.Fatalf("expected sidecar cassette: %v", err)
+	}
+	if strings.Contains(string(raw), "sk-live-secret") {
+		t.Fatalf("cassette leaked the api key: %s", raw)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ADAPTER_CASSETTE_MODE", "")
+	var out bytes.Buffer
+	if err := app.ReplayTrace(tracePath, &out); err != nil {
+		t.Fatalf("offline replay: %v", err)
+	}
+	if !strings.Contains(out.String(), "using cassette") {
+		t.Fatalf("expected cassette replay, got %q", out.String())
+	}
+
+	cassette, err := adapters.LoadCassette(tracePath + ".cassette.json")
+	if err != nil {
+		t.Fatalf("load cassette: %v", err)
+	}
+	cassette.Interactions[0].Response.Body = `{"output_text":"changed"}`
+	if err := cassette.Save(tracePath + ".cassette.json"); err != nil {
+		t.Fatalf("save cassette: %v", err)
+	}
+	if err := app.ReplayTrace(tracePath, &out); err == nil || !strings.Contains(err.Error(), "payload mismatch") {
+		t.Fatalf("expected payload mismatch against edited cassette, got %v", err)
+	}
+}
+
+func TestRedactedCassetteKeepsPromptsOutAndStillReplays(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"output_text":"wrote to jane.doe@example.com"}`))
+	}))
+	defer srv.Close()
+	r, err := redact.New(redact.Config{Detectors: []string{redact.DetectorEmail}, Mode: redact.ModeTokenize}, []byte(strings.Repeat("k", redact.KeySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := `{"model":"gpt-4o-mini","input":"email jane.doe@example.com the invoice"}`
+	send := func(client *http.Client) string {
+		t.Helper()
+		resp, err := client.Post(srv.URL+"/v1/responses", "application/json", strings.NewReader(prompt))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		var b bytes.Buffer
+		_, _ = b.ReadFrom(resp.Body)
+		return b.String()
+	}
+
+	recorder := adapters.NewRecorder(nil)
+	send(&http.Client{Transport: recorder})
+	cassette := recorder.Cassette()
+	cassette.Redact(r)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "jane.doe@example.com") {
+		t.Fatalf("cassette leaked the prompt's email: %s", raw)
+	}
+
+	loaded, err := adapters.LoadCassette(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	replayer := adapters.NewReplayer(loaded)
+	replayer.SetRedactor(r)
+	if got := send(&http.Client{Transport: replayer}); !strings.Contains(got, "[tok:email:") {
+		t.Fatalf("expected the live prompt to match its redacted recording, got %q", got)
+	}
+}
@@ -1,13 +1,18 @@
 package unit
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/your-org/fluxroute/internal/billing"
 )
 
 func TestRateCardInvoice(t *testing.T) {
-	rate, err := billing.NewRateCard(2.5)
+	rate, err := billing.NewRateCard(usd("2.5"))
 	if err != nil {
 		t.Fatalf("new rate card failed: %v", err)
 	}
@@ -16,13 +21,343 @@ func TestRateCardInvoice(t *testing.T) {
 	if invoice.TenantID != "tenant-a" {
 		t.Fatalf("unexpected tenant id: %q", invoice.TenantID)
 	}
-	if invoice.AmountUSD != 6.25 {
-		t.Fatalf("unexpected amount: %f", invoice.AmountUSD)
+	if invoice.Total != usd("6.25") {
+		t.Fatalf("unexpected amount: %s", invoice.Total)
 	}
 }
 
 func TestRateCardRejectsNegativePrice(t *testing.T) {
-	if _, err := billing.NewRateCard(-1.0); err == nil {
+	if _, err := billing.NewRateCard(usd("-1")); err == nil {
 		t.Fatal("expected error for negative rate")
 	}
 }
+
+func TestCatalogGraduatedAndVolumeTiers(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("1"))
+	catalog := billing.NewCatalog(rate)
+	tiers := []billing.Tier{{UpTo: 1000, PerThousand: amt("2.0")}, {PerThousand: amt("1.0")}}
+	if err := catalog.UpsertPlan(billing.PricePlan{ID: "grad", Mode: billing.TierGraduated, Tiers: tiers}); err != nil {
+		t.Fatalf("upsert graduated plan: %v", err)
+	}
+	if err := catalog.UpsertPlan(billing.PricePlan{ID: "vol", Mode: billing.TierVolume, Tiers: tiers}); err != nil {
+		t.Fatalf("upsert volume plan: %v", err)
+	}
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	usage := []billing.UsageRecord{{Invocations: 3000, OccurredAt: start.Add(time.Hour)}}
+
+	_ = catalog.Assign(billing.Assignment{TenantID: "g", PlanID: "grad", EffectiveFrom: start})
+	_ = catalog.Assign(billing.Assignment{TenantID: "v", PlanID: "vol", EffectiveFrom: start})
+
+	if inv, _ := catalog.Invoice("g", start, end, usage); inv.Total != usd("4") {
+		t.Fatalf("expected graduated amount 4, got %s", inv.Total)
+	}
+	if inv, _ := catalog.Invoice("v", start, end, usage); inv.Total != usd("3") {
+		t.Fatalf("expected volume amount 3, got %s", inv.Total)
+	}
+}
+
+func TestCatalogSplitsPeriodOnMidMonthPlanChange(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("1"))
+	catalog := billing.NewCatalog(rate)
+	if err := catalog.UpsertPlan(billing.PricePlan{ID: "enterprise", Tiers: []billing.Tier{{PerThousand: amt("4.0")}}, MinimumMonthly: amt("50")}); err != nil {
+		t.Fatalf("upsert plan: %v", err)
+	}
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	change := time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)
+	if err := catalog.Assign(billing.Assignment{TenantID: "tenant-a", PlanID: "enterprise", EffectiveFrom: change}); err != nil {
+		t.Fatalf("assign plan: %v", err)
+	}
+
+	usage := []billing.UsageRecord{
+		{Invocations: 1000, OccurredAt: change.Add(-time.Hour)},
+		{Invocations: 2000, OccurredAt: change.Add(time.Hour)},
+		{Invocations: 9000, OccurredAt: start.AddDate(0, 1, 1)},
+	}
+	inv, err := catalog.Invoice("tenant-a", start, start.AddDate(0, 1, 0), usage)
+	if err != nil {
+		t.Fatalf("invoice: %v", err)
+	}
+	if len(inv.Lines) != 3 {
+		t.Fatalf("expected 2 usage lines and a top-up, got %+v", inv.Lines)
+	}
+	if inv.Lines[0].PlanID != billing.DefaultPlanID || inv.Lines[0].Amount != amt("1") || !inv.Lines[0].To.Equal(change) {
+		t.Fatalf("unexpected first line: %+v", inv.Lines[0])
+	}
+	if inv.Lines[1].PlanID != "enterprise" || inv.Lines[1].Amount != amt("8") || !inv.Lines[1].From.Equal(change) {
+		t.Fatalf("unexpected second line: %+v", inv.Lines[1])
+	}
+	if inv.Lines[2].Kind != billing.LineMinimumCommitment || inv.Lines[2].Amount != amt("41") {
+		t.Fatalf("expected minimum commitment top-up, got %+v", inv.Lines[2])
+	}
+	if inv.Invocations != 3000 {
+		t.Fatalf("expected out-of-period usage to be excluded, got %d", inv.Invocations)
+	}
+	if inv.Subtotal != usd("50") || inv.Total != usd("50") {
+		t.Fatalf("expected subtotal and total 50, got subtotal=%s total=%s", inv.Subtotal, inv.Total)
+	}
+}
+
+func TestPricePlanValidation(t *testing.T) {
+	cases := []billing.PricePlan{
+		{ID: "", Tiers: []billing.Tier{{PerThousand: amt("1")}}},
+		{ID: "p", Tiers: nil},
+		{ID: "p", Tiers: []billing.Tier{{UpTo: 100, PerThousand: amt("1")}}},
+		{ID: "p", Tiers: []billing.Tier{{UpTo: 100, PerThousand: amt("1")}, {UpTo: 50, PerThousand: amt("1")}, {PerThousand: amt("1")}}},
+		{ID: "p", Mode: "weird", Tiers: []billing.Tier{{PerThousand: amt("1")}}},
+	}
+	for i, p := range cases {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("case %d: expected validation error for %+v", i, p)
+		}
+	}
+}
+
+func TestCatalogPricesTokenMetersPerModel(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("1"))
+	catalog := billing.NewCatalog(rate)
+	plan := billing.PricePlan{
+		ID: "llm",
+		Prices: []billing.MeterPrice{
+			{Meter: billing.MeterInvocations, Tiers: []billing.Tier{{PerThousand: amt("1")}}},
+			{Meter: billing.MeterInputTokens, Tiers: []billing.Tier{{PerThousand: amt("0.5")}}},
+			{Meter: billing.MeterInputTokens, Model: "gpt-4o", Tiers: []billing.Tier{{PerThousand: amt("2.5")}}},
+			{Meter: billing.MeterOutputTokens, Tiers: []billing.Tier{{PerThousand: amt("10")}}},
+		},
+	}
+	if err := catalog.UpsertPlan(plan); err != nil {
+		t.Fatalf("upsert plan: %v", err)
+	}
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	_ = catalog.Assign(billing.Assignment{TenantID: "tenant-t", PlanID: "llm", EffectiveFrom: start})
+
+	usage := []billing.UsageRecord{
+		{Model: "gpt-4o", Invocations: 1000, InputTokens: 2000, OutputTokens: 100, OccurredAt: start.Add(time.Hour)},
+		{Model: "claude-3-haiku", Invocations: 1000, InputTokens: 4000, OccurredAt: start.Add(2 * time.Hour)},
+	}
+	inv, err := catalog.Invoice("tenant-t", start, start.AddDate(0, 1, 0), usage)
+	if err != nil {
+		t.Fatalf("invoice: %v", err)
+	}
+	// invocations 2.0 + gpt-4o input 5.0 + haiku input 2.0 + output 1.0
+	if inv.Total != usd("10") {
+		t.Fatalf("expected 10, got %s (%+v)", inv.Total, inv.Lines)
+	}
+	if inv.InputTokens != 6000 || inv.OutputTokens != 100 {
+		t.Fatalf("unexpected token totals: in=%d out=%d", inv.InputTokens, inv.OutputTokens)
+	}
+	if len(inv.Lines) != 5 {
+		t.Fatalf("expected 5 itemized meter lines, got %+v", inv.Lines)
+	}
+}
+
+func TestPricePlanRejectsUnknownMeter(t *testing.T) {
+	p := billing.PricePlan{ID: "p", Prices: []billing.MeterPrice{{Meter: "gpu_seconds", Tiers: []billing.Tier{{PerThousand: amt("1")}}}}}
+	if err := p.Validate(); err == nil {
+		t.Fatal("expected unknown meter error")
+	}
+}
+
+func TestInvoiceLifecycleAndTaxHook(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("2"))
+	inv := rate.Invoice("tenant-a", 5000)
+	if inv.Status != billing.StatusDraft {
+		t.Fatalf("expected draft, got %s", inv.Status)
+	}
+	inv.Lines = append(inv.Lines, billing.LineItem{Kind: billing.LineCredit, Description: "promo", Amount: amt("-4")})
+	err := inv.ApplyTax(func(_ billing.Invoice, taxable billing.Money) []billing.TaxLine {
+		return []billing.TaxLine{{Description: "VAT 10%", RatePercent: 10, Amount: taxable.Amount / 10}}
+	})
+	if err != nil {
+		t.Fatalf("apply tax: %v", err)
+	}
+	if inv.Subtotal != usd("10") || inv.Credits != usd("4") || inv.Tax != usd("0.6") || inv.Total != usd("6.6") {
+		t.Fatalf("unexpected totals: %+v", inv)
+	}
+
+	if err := inv.Finalize(time.Now()); err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	if err := inv.ApplyTax(nil); !errors.Is(err, billing.ErrInvoiceImmutable) {
+		t.Fatalf("expected immutable error, got %v", err)
+	}
+	if err := inv.Finalize(time.Now()); !errors.Is(err, billing.ErrInvalidInvoiceStatus) {
+		t.Fatalf("expected invalid transition, got %v", err)
+	}
+	if err := inv.Void(time.Now(), "duplicate"); err != nil || inv.Status != billing.StatusVoid {
+		t.Fatalf("void: %v (%s)", err, inv.Status)
+	}
+}
+
+func TestRenderInvoiceFormats(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("1"))
+	inv := rate.Invoice("tenant-<a>", 1000)
+	inv.ID = "inv_000001"
+
+	var buf bytes.Buffer
+	if err := billing.Render(&buf, inv, billing.FormatCSV); err != nil {
+		t.Fatalf("render csv: %v", err)
+	}
+	if !strings.Contains(buf.String(), "inv_000001,tenant-<a>,draft,USD,total,") {
+		t.Fatalf("missing total row: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := billing.Render(&buf, inv, billing.FormatHTML); err != nil {
+		t.Fatalf("render html: %v", err)
+	}
+	if !strings.Contains(buf.String(), "tenant-&lt;a&gt;") {
+		t.Fatalf("expected escaped tenant in html: %s", buf.String())
+	}
+
+	if _, err := billing.ParseRenderFormat("pdf"); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+}
+
+func amt(s string) billing.Amount { return billing.MustParseAmount(s) }
+
+func usd(s string) billing.Money { return billing.NewMoney(amt(s), billing.USD) }
+
+func TestAmountParseFormatAndRound(t *testing.T) {
+	cases := map[string]string{"0.1": "0.1", "-2.500": "-2.5", "12": "12", ".000125": "0.000125"}
+	for in, want := range cases {
+		a, err := billing.ParseAmount(in)
+		if err != nil || a.String() != want {
+			t.Fatalf("ParseAmount(%q) = %s, %v; want %s", in, a, err, want)
+		}
+	}
+	for _, bad := range []string{"", "1.2345678", "1e3", "abc", "-"} {
+		if _, err := billing.ParseAmount(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+	if got := amt("0.005").Round(2); got != amt("0.01") {
+		t.Fatalf("expected half-up rounding, got %s", got)
+	}
+	if got := amt("-0.005").Round(2); got != amt("-0.01") {
+		t.Fatalf("expected half away from zero, got %s", got)
+	}
+	if got := amt("3").StringFixed(2); got != "3.00" {
+		t.Fatalf("unexpected fixed format %q", got)
+	}
+
+	var decoded struct {
+		A billing.Amount `json:"a"`
+		B billing.Amount `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a":"0.1","b":0.2}`), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.A+decoded.B != amt("0.3") {
+		t.Fatalf("expected exact decimal sum, got %s", decoded.A+decoded.B)
+	}
+}
+
+func TestInvoiceRoundingModes(t *testing.T) {
+	// 3 invocations at 1.666 per 1000 is 0.004998 per model.
+	tiers := []billing.Tier{{PerThousand: amt("1.666")}}
+	usage := []billing.UsageRecord{}
+	start := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, model := range []string{"a", "b", "c"} {
+		usage = append(usage, billing.UsageRecord{Model: model, Invocations: 3, OccurredAt: start})
+	}
+	rate, _ := billing.NewRateCard(usd("1"))
+	catalog := billing.NewCatalog(rate)
+	for _, mode := range []billing.RoundingMode{billing.RoundPerLine, billing.RoundPerInvoice} {
+		plan := billing.PricePlan{
+			ID:       string(mode),
+			Rounding: mode,
+			Prices:   []billing.MeterPrice{{Meter: billing.MeterInvocations, Model: "a", Tiers: tiers}, {Meter: billing.MeterInvocations, Model: "b", Tiers: tiers}, {Meter: billing.MeterInvocations, Model: "c", Tiers: tiers}},
+		}
+		if err := catalog.UpsertPlan(plan); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+		_ = catalog.Assign(billing.Assignment{TenantID: string(mode), PlanID: plan.ID, EffectiveFrom: start})
+	}
+
+	perLine, _ := catalog.Invoice(string(billing.RoundPerLine), start, start.AddDate(0, 1, 0), usage)
+	if perLine.Total != usd("0") {
+		t.Fatalf("per-line rounding should round each 0.004998 line to 0, got %s", perLine.Total)
+	}
+	perInvoice, _ := catalog.Invoice(string(billing.RoundPerInvoice), start, start.AddDate(0, 1, 0), usage)
+	if perInvoice.Total != usd("0.01") || perInvoice.Lines[0].Amount != amt("0.004998") {
+		t.Fatalf("per-invoice rounding should keep line precision and round 0.014994 to 0.01, got %s (%+v)", perInvoice.Total, perInvoice.Lines)
+	}
+}
+
+func TestCatalogMultiCurrencyPlans(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("1"))
+	catalog := billing.NewCatalog(rate)
+	if err := catalog.UpsertPlan(billing.PricePlan{ID: "eu", Currency: "eur", Tiers: []billing.Tier{{PerThousand: amt("0.9")}}}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := catalog.UpsertPlan(billing.PricePlan{ID: "jp", Currency: "JPY", Tiers: []billing.Tier{{PerThousand: amt("150.5")}}}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := catalog.UpsertPlan(billing.PricePlan{ID: "bad", Currency: "euro", Tiers: []billing.Tier{{PerThousand: amt("1")}}}); err == nil {
+		t.Fatal("expected invalid currency error")
+	}
+
+	start := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	usage := []billing.UsageRecord{{Invocations: 1000, OccurredAt: start.Add(time.Hour)}}
+	_ = catalog.Assign(billing.Assignment{TenantID: "t-eu", PlanID: "eu", EffectiveFrom: start})
+	_ = catalog.Assign(billing.Assignment{TenantID: "t-jp", PlanID: "jp", EffectiveFrom: start})
+
+	if inv, err := catalog.Invoice("t-eu", start, end, usage); err != nil || inv.Total != billing.NewMoney(amt("0.9"), "EUR") {
+		t.Fatalf("unexpected EUR invoice: %+v, %v", inv.Total, err)
+	}
+	if inv, err := catalog.Invoice("t-jp", start, end, usage); err != nil || inv.Total.String() != "151 JPY" {
+		t.Fatalf("expected JPY rounded to whole yen, got %s, %v", inv.Total, err)
+	}
+
+	_ = catalog.Assign(billing.Assignment{TenantID: "t-eu", PlanID: "default", EffectiveFrom: start.AddDate(0, 0, 15)})
+	if _, err := catalog.Invoice("t-eu", start, end, usage); !errors.Is(err, billing.ErrCurrencyMismatch) {
+		t.Fatalf("expected currency mismatch across a mid-period switch, got %v", err)
+	}
+}
+
+func TestAccrualMatchesInvoiceUsageCharges(t *testing.T) {
+	rate, _ := billing.NewRateCard(usd("1"))
+	catalog := billing.NewCatalog(rate)
+	tiers := []billing.Tier{{UpTo: 1000, PerThousand: amt("2.0")}, {PerThousand: amt("1.0")}}
+	_ = catalog.UpsertPlan(billing.PricePlan{ID: "grad", Mode: billing.TierGraduated, Tiers: tiers})
+	_ = catalog.UpsertPlan(billing.PricePlan{ID: "vol", Mode: billing.TierVolume, Tiers: tiers})
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	_ = catalog.Assign(billing.Assignment{TenantID: "g", PlanID: "grad", EffectiveFrom: start})
+	_ = catalog.Assign(billing.Assignment{TenantID: "v", PlanID: "vol", EffectiveFrom: start})
+	_ = catalog.Assign(billing.Assignment{TenantID: "m", PlanID: "grad", EffectiveFrom: start.AddDate(0, 0, 10)})
+
+	usage := []billing.UsageRecord{
+		{Invocations: 600, OccurredAt: start.Add(time.Hour)},
+		{Invocations: 600, OccurredAt: start.AddDate(0, 0, 12)},
+		{Invocations: 1800, OccurredAt: start.AddDate(0, 0, 20)},
+		{Invocations: 5000, OccurredAt: end},
+	}
+	for _, tenant := range []string{"g", "v", "m"} {
+		a := catalog.NewAccrual(tenant, start, end)
+		for _, u := range usage {
+			if _, err := catalog.Accrue(a, u); err != nil {
+				t.Fatalf("%s: accrue: %v", tenant, err)
+			}
+		}
+		inv, err := catalog.Invoice(tenant, start, end, usage)
+		if err != nil {
+			t.Fatalf("%s: invoice: %v", tenant, err)
+		}
+		var charges billing.Amount
+		for _, line := range inv.Lines {
+			if line.Kind == billing.LineUsage {
+				charges += line.Amount
+			}
+		}
+		if a.Usage != charges || a.Currency != inv.Currency {
+			t.Fatalf("%s: accrued %s %s, invoice usage charges %s %s", tenant, a.Usage, a.Currency, charges, inv.Currency)
+		}
+	}
+}
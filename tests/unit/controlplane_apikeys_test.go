@@ -0,0 +1,184 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/controlplane"
+)
+
+type issuedKey struct {
+	ID       string   `json:"id"`
+	Token    string   `json:"token"`
+	TenantID string   `json:"tenant_id"`
+	Scopes   []string `json:"scopes"`
+	Role     string   `json:"role"`
+}
+
+func keyRequest(t *testing.T, h http.Handler, method string, path string, token string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, path, nil)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	// A client-supplied role must never matter once keys are in use.
+	req.Header.Set("X-Role", "admin")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func issueKey(t *testing.T, h http.Handler, adminToken string, body string) issuedKey {
+	t.Helper()
+	rec := keyRequest(t, h, http.MethodPost, "/v1/keys", adminToken, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("issue key %s: %d %s", body, rec.Code, rec.Body.String())
+	}
+	var k issuedKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &k); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	return k
+}
+
+func TestControlplaneScopedTenantKeys(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "bootstrap-secret")
+	svc := controlplane.NewService()
+	for _, id := range []string{"acme", "globex"} {
+		if err := svc.AddTenant(id); err != nil {
+			t.Fatalf("add tenant: %v", err)
+		}
+	}
+	h := svc.Handler()
+
+	for _, scope := range []string{"admin", "billing:admin"} {
+		if rec := keyRequest(t, h, http.MethodPost, "/v1/keys", "bootstrap-secret", `{"tenant_id":"acme","scopes":["`+scope+`"]}`); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected tenant %s key to be rejected, got %d", scope, rec.Code)
+		}
+	}
+	router := issueKey(t, h, "bootstrap-secret", `{"name":"acme-router","tenant_id":"acme","scopes":["usage:write","usage:read"]}`)
+	if router.Role != "operator" || !strings.HasPrefix(router.Token, "frk_") {
+		t.Fatalf("unexpected issued key: %+v", router)
+	}
+	for _, k := range svc.ListKeys("acme") {
+		if k.Hash == router.Token || len(k.Hash) != 64 {
+			t.Fatalf("expected only a sha-256 hash at rest, got %q", k.Hash)
+		}
+	}
+	rec := keyRequest(t, h, http.MethodGet, "/v1/keys", "bootstrap-secret", "")
+	if strings.Contains(rec.Body.String(), router.Token) {
+		t.Fatal("key listing must not expose tokens")
+	}
+
+	if rec := keyRequest(t, h, http.MethodPost, "/v1/tenants", router.Token, `{"id":"evil"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected X-Role to be ignored for a scoped key, got %d", rec.Code)
+	}
+	if rec := keyRequest(t, h, http.MethodPost, "/v1/usage", router.Token, `{"tenant_id":"acme","invocations":3}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected usage write for own tenant, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := keyRequest(t, h, http.MethodPost, "/v1/usage", router.Token, `{"tenant_id":"globex","invocations":3}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected cross-tenant usage write to be denied, got %d", rec.Code)
+	}
+	if rec := keyRequest(t, h, http.MethodGet, "/v1/usage?tenant_id=globex", router.Token, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected cross-tenant usage read to be denied, got %d", rec.Code)
+	}
+	rec = keyRequest(t, h, http.MethodGet, "/v1/usage", router.Token, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tenant_id":"acme"`) || !strings.Contains(rec.Body.String(), `"invocations":3`) {
+		t.Fatalf("expected usage read pinned to own tenant, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = keyRequest(t, h, http.MethodGet, "/v1/tenants", router.Token, "")
+	if strings.Contains(rec.Body.String(), "globex") {
+		t.Fatalf("tenant key must only list its tenant: %s", rec.Body.String())
+	}
+	if rec := keyRequest(t, h, http.MethodGet, "/v1/billing/summary", router.Token, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected cross-tenant summary to be denied, got %d", rec.Code)
+	}
+	if rec := keyRequest(t, h, http.MethodPost, "/v1/billing/rates", router.Token, `{"per_thousand":"9"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected billing admin scope to be required, got %d", rec.Code)
+	}
+
+	finance := issueKey(t, h, "bootstrap-secret", `{"name":"finance","scopes":["billing:admin"]}`)
+	if rec := keyRequest(t, h, http.MethodPost, "/v1/billing/rates", finance.Token, `{"per_thousand":"9"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected billing admin to set rates, got %d", rec.Code)
+	}
+	if rec := keyRequest(t, h, http.MethodGet, "/v1/keys", finance.Token, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected key management to require admin, got %d", rec.Code)
+	}
+
+	rec = keyRequest(t, h, http.MethodGet, "/v1/keys/self", router.Token, "")
+	if !strings.Contains(rec.Body.String(), `"tenant_id":"acme"`) || !strings.Contains(rec.Body.String(), `"role":"operator"`) {
+		t.Fatalf("unexpected whoami: %s", rec.Body.String())
+	}
+}
+
+func TestControlplaneKeyRotationRevocationAndExpiry(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	h := svc.Handler()
+
+	// With no keys issued the control plane runs in local mode and trusts
+	// X-Role; the first admin key switches it to key auth.
+	admin := issueKey(t, h, "", `{"name":"ops","scopes":["admin"]}`)
+	if rec := keyRequest(t, h, http.MethodGet, "/v1/tenants", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected key auth once a key exists, got %d", rec.Code)
+	}
+	if rec := keyRequest(t, h, http.MethodGet, "/v1/tenants", "frk_000000000000_nope", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown token to be rejected, got %d", rec.Code)
+	}
+
+	reader := issueKey(t, h, admin.Token, `{"scopes":["usage:read"],"ttl":"24h"}`)
+	rec := keyRequest(t, h, http.MethodPost, "/v1/keys/"+reader.ID+"/rotate", admin.Token, `{"grace_period":"1h"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("rotate: %d %s", rec.Code, rec.Body.String())
+	}
+	var rotated issuedKey
+	_ = json.Unmarshal(rec.Body.Bytes(), &rotated)
+	for _, token := range []string{reader.Token, rotated.Token} {
+		if rec := keyRequest(t, h, http.MethodGet, "/v1/tenants", token, ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected both keys to work during grace, got %d", rec.Code)
+		}
+	}
+	old, err := svc.GetKey(reader.ID)
+	if err != nil || old.ReplacedBy != rotated.ID || old.ExpiresAt == nil || old.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expected old key to expire after grace, got %+v, %v", old, err)
+	}
+
+	rec = keyRequest(t, h, http.MethodPost, "/v1/keys/"+rotated.ID+"/rotate", admin.Token, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("rotate without grace: %d", rec.Code)
+	}
+	rec = keyRequest(t, h, http.MethodGet, "/v1/tenants", rotated.Token, "")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "revoked") {
+		t.Fatalf("expected rotated-away key to be revoked, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := keyRequest(t, h, http.MethodDelete, "/v1/keys/"+reader.ID, admin.Token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: %d", rec.Code)
+	}
+	if rec := keyRequest(t, h, http.MethodGet, "/v1/tenants", reader.Token, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked key to fail, got %d", rec.Code)
+	}
+
+	_, short, err := svc.IssueKey(controlplane.IssueKeyInput{Scopes: []string{"usage:read"}, ExpiresAt: time.Now().Add(20 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("issue short key: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	rec = keyRequest(t, h, http.MethodGet, "/v1/tenants", short, "")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "expired") {
+		t.Fatalf("expected expired key to be rejected, got %d %s", rec.Code, rec.Body.String())
+	}
+	if _, _, err := svc.IssueKey(controlplane.IssueKeyInput{Scopes: []string{"usage:read"}, ExpiresAt: time.Now().Add(-time.Minute)}); err == nil {
+		t.Fatal("expected past expiry to be rejected")
+	}
+}
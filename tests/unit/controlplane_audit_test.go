@@ -0,0 +1,113 @@
+package unit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/controlplane"
+)
+
+func TestControlplaneAuditTrail(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "controlplane-audit.log")
+	t.Setenv("CONTROLPLANE_API_KEY", "bootstrap-secret")
+	t.Setenv("CONTROLPLANE_AUDIT_LOG_PATH", logPath)
+	svc := controlplane.NewService()
+	h := svc.Handler()
+
+	do := func(method, path, token, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "203.0.113.7:51234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/tenants", "bootstrap-secret", `{"id":"acme"}`, map[string]string{"X-Request-ID": "req-onboard-1"})
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Request-ID") != "req-onboard-1" {
+		t.Fatalf("create tenant: %d, request id %q", rec.Code, rec.Header().Get("X-Request-ID"))
+	}
+	rec = do(http.MethodPost, "/v1/keys", "bootstrap-secret", `{"tenant_id":"acme","scopes":["usage:read","usage:write"]}`, nil)
+	var router issuedKey
+	_ = json.Unmarshal(rec.Body.Bytes(), &router)
+	if rec := do(http.MethodPost, "/v1/usage", router.Token, `{"tenant_id":"acme","invocations":4}`, nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("record usage: %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/v1/billing/rates", router.Token, `{"per_thousand":"9"}`, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected rate change to be denied, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/v1/billing/rates", "bootstrap-secret", `{"per_thousand":"2.5","currency":"EUR"}`, nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("set rate: %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/v1/tenants", "", `{"id":"nobody"}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated create to fail, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/v1/audit", router.Token, "", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected audit log to require admin, got %d", rec.Code)
+	}
+
+	events := svc.Audit().Query(audit.Filter{})
+	if len(events) != 6 {
+		t.Fatalf("expected 6 mutation events (reads are not audited), got %d: %+v", len(events), events)
+	}
+	created := svc.Audit().Query(audit.Filter{RequestID: "req-onboard-1"})
+	if len(created) != 1 || created[0].Action != "tenant.create" || created[0].Actor != "bootstrap" || created[0].Role != "admin" ||
+		created[0].SourceIP != "203.0.113.7" || created[0].Resource != "tenants/acme" || created[0].Status != controlplane.AuditSuccess ||
+		!strings.Contains(string(created[0].After), `"acme"`) {
+		t.Fatalf("unexpected tenant event: %+v", created)
+	}
+	usage := svc.Audit().Query(audit.Filter{Action: "usage.record"})
+	if len(usage) != 1 || usage[0].Actor != router.ID || usage[0].TenantID != "acme" ||
+		!strings.Contains(string(usage[0].Before), `"invocations":0`) || !strings.Contains(string(usage[0].After), `"invocations":4`) {
+		t.Fatalf("unexpected usage event: %+v", usage)
+	}
+
+	rec = do(http.MethodGet, "/v1/audit?action=rate.update&page_size=1", "bootstrap-secret", "", nil)
+	var page struct {
+		Items []audit.Event `json:"items"`
+		Total int           `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode audit page: %v", err)
+	}
+	if page.Total != 2 || len(page.Items) != 1 {
+		t.Fatalf("expected two rate events paged to one, got %s", rec.Body.String())
+	}
+	newest := page.Items[0]
+	if newest.Status != controlplane.AuditSuccess || !strings.Contains(string(newest.Before), `"1"`) || !strings.Contains(string(newest.After), `"EUR"`) {
+		t.Fatalf("expected newest rate change with before/after values, got %+v", newest)
+	}
+	rec = do(http.MethodGet, "/v1/audit?status=denied", "bootstrap-secret", "", nil)
+	_ = json.Unmarshal(rec.Body.Bytes(), &page)
+	if page.Total != 2 || page.Items[0].Actor != "unauthenticated" || page.Items[1].Actor != router.ID || !strings.Contains(page.Items[1].Error, "billing:admin") {
+		t.Fatalf("unexpected denied events: %s", rec.Body.String())
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	lines := 0
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+		var ev audit.Event
+		if err := json.Unmarshal(s.Bytes(), &ev); err != nil || ev.ID == "" || ev.RequestID == "" {
+			t.Fatalf("bad audit line %q: %v", s.Text(), err)
+		}
+	}
+	if lines != 6 {
+		t.Fatalf("expected 6 persisted events, got %d", lines)
+	}
+}
@@ -0,0 +1,374 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/coordinator"
+)
+
+func TestElectorFailover(t *testing.T) {
+	coord := coordinator.NewMemoryCoordinator()
+	a := coordinator.NewElector(coord, "leader", "a", 150*time.Millisecond)
+	b := coordinator.NewElector(coord, "leader", "b", 150*time.Millisecond)
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		defer close(doneA)
+		a.Run(ctxA, func(ctx context.Context) { <-ctx.Done() })
+	}()
+	waitFor(t, "a to lead", a.IsLeader)
+
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	go b.Run(ctxB, func(ctx context.Context) { <-ctx.Done() })
+	time.Sleep(200 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("expected b to follow while a holds the lease")
+	}
+	if leader, _ := b.Leader(context.Background()); leader != "a" {
+		t.Fatalf("expected leader a, got %q", leader)
+	}
+
+	stopA()
+	<-doneA
+	waitFor(t, "b to take over", b.IsLeader)
+	if leader, _ := a.Leader(context.Background()); leader != "b" {
+		t.Fatalf("expected leader b, got %q", leader)
+	}
+}
+
+func TestControlplaneSnapshotRestore(t *testing.T) {
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	if err := svc.AddUsage("acme", 7); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	data, err := svc.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	restored := controlplane.NewService()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := restored.ListTenants(); len(got) != 1 || got[0] != "acme" {
+		t.Fatalf("unexpected tenants after restore: %v", got)
+	}
+	if got := restored.Usage("acme"); got != 7 {
+		t.Fatalf("expected usage 7 after restore, got %d", got)
+	}
+	if err := restored.Restore([]byte(`{"format":99}`)); err == nil {
+		t.Fatal("expected unknown state format to be rejected")
+	}
+}
+
+func TestControlplaneHAFollowerForwardsWrites(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	coord := coordinator.NewMemoryCoordinator()
+	store := controlplane.NewFileStateStore(t.TempDir())
+	replica := func(syncInterval time.Duration) (*controlplane.Service, *httptest.Server) {
+		srv := httptest.NewUnstartedServer(nil)
+		svc := controlplane.NewService()
+		err := svc.EnableHA(controlplane.HAConfig{
+			Coordinator:  coord,
+			Store:        store,
+			AdvertiseURL: "http://" + srv.Listener.Addr().String(),
+			LeaseTTL:     300 * time.Millisecond,
+			SyncInterval: syncInterval,
+		})
+		if err != nil {
+			t.Fatalf("enable ha: %v", err)
+		}
+		srv.Config.Handler = svc.Handler()
+		srv.Start()
+		t.Cleanup(srv.Close)
+		return svc, srv
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leader, _ := replica(20 * time.Millisecond)
+	go leader.Run(ctx)
+	waitFor(t, "leader election", leader.IsLeader)
+	// The follower's periodic sync is too slow to matter: it must catch up
+	// when forwarding the write.
+	follower, followerSrv := replica(time.Hour)
+	go follower.Run(ctx)
+
+	req, _ := http.NewRequest(http.MethodPost, followerSrv.URL+"/v1/tenants", strings.NewReader(`{"id":"acme"}`))
+	req.Header.Set("X-Role", "admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("create tenant via follower: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected forwarded write to succeed, got %d", resp.StatusCode)
+	}
+	if got := leader.ListTenants(); len(got) != 1 {
+		t.Fatalf("expected leader to apply the write, got %v", got)
+	}
+	req, _ = http.NewRequest(http.MethodGet, followerSrv.URL+"/v1/tenants/acme", nil)
+	req.Header.Set("X-Role", "admin")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("read tenant via follower: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected follower to read its own write, got %d", resp.StatusCode)
+	}
+	if follower.IsLeader() {
+		t.Fatal("expected follower not to lead")
+	}
+}
+
+func TestControlplaneStateStoresFenceAppends(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start miniredis: %v", err)
+	}
+	defer mr.Close()
+	redisStore, err := controlplane.NewRedisStateStore("redis://"+mr.Addr(), "test")
+	if err != nil {
+		t.Fatalf("redis store: %v", err)
+	}
+	stores := map[string]controlplane.StateStore{
+		"file":  controlplane.NewFileStateStore(t.TempDir()),
+		"redis": redisStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if v, err := store.Append(ctx, 0, []byte("one")); err != nil || v != 1 {
+				t.Fatalf("expected first append at version 1, got %d (%v)", v, err)
+			}
+			if _, err := store.Append(ctx, 0, []byte("racer")); !errors.Is(err, controlplane.ErrStaleVersion) {
+				t.Fatalf("expected stale append to be rejected, got %v", err)
+			}
+			if v, err := store.Append(ctx, 1, []byte("two")); err != nil || v != 2 {
+				t.Fatalf("expected second append at version 2, got %d (%v)", v, err)
+			}
+			entries, err := store.Entries(ctx, 1)
+			if err != nil || len(entries) != 1 || string(entries[0]) != "two" {
+				t.Fatalf("expected entries after 1 to be [two], got %q (%v)", entries, err)
+			}
+
+			if err := store.Checkpoint(ctx, 2, []byte("state@2")); err != nil {
+				t.Fatalf("checkpoint: %v", err)
+			}
+			if _, err := store.Entries(ctx, 1); !errors.Is(err, controlplane.ErrCompacted) {
+				t.Fatalf("expected compacted entries, got %v", err)
+			}
+			if _, err := store.Append(ctx, 1, []byte("late")); !errors.Is(err, controlplane.ErrStaleVersion) {
+				t.Fatalf("expected append behind the checkpoint to be rejected, got %v", err)
+			}
+			if v, err := store.Append(ctx, 2, []byte("three")); err != nil || v != 3 {
+				t.Fatalf("expected append after checkpoint at version 3, got %d (%v)", v, err)
+			}
+			data, v, err := store.Load(ctx)
+			if err != nil || v != 2 || string(data) != "state@2" {
+				t.Fatalf("expected checkpoint at 2, got %q@%d (%v)", data, v, err)
+			}
+			entries, err = store.Entries(ctx, 2)
+			if err != nil || len(entries) != 1 || string(entries[0]) != "three" {
+				t.Fatalf("expected entries after checkpoint to be [three], got %q (%v)", entries, err)
+			}
+			if v, err := store.Version(ctx); err != nil || v != 3 {
+				t.Fatalf("expected version 3, got %d (%v)", v, err)
+			}
+		})
+	}
+}
+
+func TestControlplaneHAReplicasFollowLogAndCheckpoints(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	coord := coordinator.NewMemoryCoordinator()
+	store := controlplane.NewFileStateStore(t.TempDir())
+	enable := func(svc *controlplane.Service, addr string) {
+		err := svc.EnableHA(controlplane.HAConfig{
+			Coordinator:     coord,
+			Store:           store,
+			AdvertiseURL:    addr,
+			LeaseTTL:        300 * time.Millisecond,
+			SyncInterval:    20 * time.Millisecond,
+			CheckpointEvery: 3,
+		})
+		if err != nil {
+			t.Fatalf("enable ha: %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leader := controlplane.NewService()
+	enable(leader, "http://leader")
+	go leader.Run(ctx)
+	waitFor(t, "leader election", leader.IsLeader)
+	follower := controlplane.NewService()
+	enable(follower, "http://follower")
+	go follower.Run(ctx)
+
+	handler := leader.Handler()
+	post := func(path, body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-Role", "admin")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code >= 300 {
+			t.Fatalf("POST %s: %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	for _, id := range []string{"acme", "globex", "initech", "umbrella"} {
+		post("/v1/tenants", `{"id":"`+id+`"}`)
+	}
+	post("/v1/usage", `{"tenant_id":"acme","invocations":5}`)
+
+	waitFor(t, "follower to apply the log", func() bool {
+		return len(follower.ListTenants()) == 4 && follower.Usage("acme") == 5
+	})
+
+	// A replica joining after a checkpoint loads it and the entries since.
+	late := controlplane.NewService()
+	enable(late, "http://late")
+	if got := late.ListTenants(); len(got) != 4 {
+		t.Fatalf("expected late replica to load four tenants, got %v", got)
+	}
+	if got := late.Usage("acme"); got != 5 {
+		t.Fatalf("expected late replica to load usage 5, got %d", got)
+	}
+}
+
+// failingStore fails appends while fail is set.
+type failingStore struct {
+	controlplane.StateStore
+	fail atomic.Bool
+}
+
+func (f *failingStore) Append(ctx context.Context, prev int64, entry []byte) (int64, error) {
+	if f.fail.Load() {
+		return 0, errors.New("store unavailable")
+	}
+	return f.StateStore.Append(ctx, prev, entry)
+}
+
+func TestControlplaneHARollsBackUnpersistedWrites(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	store := &failingStore{StateStore: controlplane.NewFileStateStore(t.TempDir())}
+	svc := controlplane.NewService()
+	err := svc.EnableHA(controlplane.HAConfig{
+		Coordinator:  coordinator.NewMemoryCoordinator(),
+		Store:        store,
+		AdvertiseURL: "http://leader",
+		LeaseTTL:     300 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("enable ha: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.Run(ctx)
+	waitFor(t, "leader election", svc.IsLeader)
+
+	handler := svc.Handler()
+	create := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/tenants", strings.NewReader(`{"id":"acme"}`))
+		req.Header.Set("X-Role", "admin")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	store.fail.Store(true)
+	if code := create(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected unpersisted write to fail with 503, got %d", code)
+	}
+	if got := svc.ListTenants(); len(got) != 0 {
+		t.Fatalf("expected failed write to be rolled back, got %v", got)
+	}
+	store.fail.Store(false)
+	if code := create(); code != http.StatusCreated {
+		t.Fatalf("expected retried write to succeed once, got %d", code)
+	}
+}
+
+func TestControlplaneFinalizeMonthAndCompactRollups(t *testing.T) {
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	month := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if err := svc.AddUsageAt("acme", 3, month.Add(36*time.Hour)); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+
+	invoices, err := svc.FinalizeMonth(month)
+	if err != nil {
+		t.Fatalf("finalize month: %v", err)
+	}
+	if len(invoices) != 1 || invoices[0].Status != billing.StatusFinalized {
+		t.Fatalf("expected one finalized invoice, got %+v", invoices)
+	}
+	again, err := svc.FinalizeMonth(month)
+	if err != nil || len(again) != 0 {
+		t.Fatalf("expected second finalization to be a no-op, got %+v (%v)", again, err)
+	}
+
+	if removed := svc.CompactRollups(month.AddDate(0, 1, 0)); removed != 1 {
+		t.Fatalf("expected one hourly rollup removed, got %d", removed)
+	}
+	if got := svc.Usage("acme"); got != 3 {
+		t.Fatalf("expected totals to survive compaction, got %d", got)
+	}
+	q := controlplane.TimeseriesQuery{TenantID: "acme", From: month, To: month.AddDate(0, 0, 2), Granularity: controlplane.GranularityHour}
+	if _, err := svc.UsageTimeseries(q); !errors.Is(err, controlplane.ErrHourlyCompacted) {
+		t.Fatalf("expected hourly query over compacted range to be rejected, got %v", err)
+	}
+	q.Granularity = controlplane.GranularityDay
+	if ts, err := svc.UsageTimeseries(q); err != nil || ts.Series[0].Points[1].Invocations != 3 {
+		t.Fatalf("expected daily series to keep the usage, got %+v (%v)", ts, err)
+	}
+	q.Granularity, q.From, q.To = controlplane.GranularityHour, month.AddDate(0, 1, 0), month.AddDate(0, 1, 1)
+	if _, err := svc.UsageTimeseries(q); err != nil {
+		t.Fatalf("expected hourly query after the cutoff to work: %v", err)
+	}
+
+	restored := controlplane.NewService()
+	data, _ := svc.Snapshot()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	q.From = month
+	if _, err := restored.UsageTimeseries(q); !errors.Is(err, controlplane.ErrHourlyCompacted) {
+		t.Fatalf("expected the compaction cutoff to survive a snapshot, got %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -5,14 +5,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/your-org/fluxroute/internal/billing"
 	"github.com/your-org/fluxroute/internal/controlplane"
 )
 
 func TestControlplaneHandler(t *testing.T) {
 	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
 	svc := controlplane.NewService()
 	h := svc.Handler()
 
@@ -58,7 +61,7 @@ func TestControlplaneHandler(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 for invoice, got %d", w.Code)
 	}
-	if !bytes.Contains(w.Body.Bytes(), []byte("amount_usd")) {
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"total"`)) {
 		t.Fatalf("expected invoice payload, got %s", w.Body.String())
 	}
 
@@ -112,6 +115,8 @@ func TestControlplaneHandler(t *testing.T) {
 }
 
 func TestControlplaneRBACDenied(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
 	svc := controlplane.NewService()
 	h := svc.Handler()
 
@@ -125,6 +130,20 @@ func TestControlplaneRBACDenied(t *testing.T) {
 	}
 }
 
+func TestControlplaneIgnoresXRoleWithoutInsecureLocalMode(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "")
+	h := controlplane.NewService().Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/tenants", strings.NewReader(`{"id":"tenant-b"}`))
+	req.Header.Set("X-Role", "admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an unconfigured control plane to refuse X-Role admin, got %d", w.Code)
+	}
+}
+
 func TestControlplaneAPIKeyMiddleware(t *testing.T) {
 	t.Setenv("CONTROLPLANE_API_KEY", "top-secret")
 	svc := controlplane.NewService()
@@ -156,6 +175,7 @@ func TestControlplaneAPIKeyMiddleware(t *testing.T) {
 
 func TestControlplaneBillingSummary(t *testing.T) {
 	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
 	svc := controlplane.NewService()
 	if err := svc.AddTenant("tenant-s"); err != nil {
 		t.Fatalf("add tenant: %v", err)
@@ -180,6 +200,7 @@ func TestControlplaneBillingSummary(t *testing.T) {
 
 func TestControlplaneRejectsNonPositiveUsage(t *testing.T) {
 	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
 	svc := controlplane.NewService()
 	if err := svc.AddTenant("tenant-x"); err != nil {
 		t.Fatalf("add tenant: %v", err)
@@ -195,3 +216,274 @@ func TestControlplaneRejectsNonPositiveUsage(t *testing.T) {
 		t.Fatalf("expected 400 for non-positive usage, got %d", w.Code)
 	}
 }
+
+func TestControlplanePerTenantPlanAssignment(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("tenant-e"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	now := time.Now().UTC()
+	if err := svc.AddUsageAt("tenant-e", 2000, now); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+
+	h := svc.Handler()
+	plan := []byte(`{"id":"enterprise","mode":"graduated","tiers":[{"up_to":1000,"per_thousand":"3"},{"up_to":0,"per_thousand":"1"}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/billing/plans", bytes.NewReader(plan))
+	req.Header.Set("X-Role", "admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for plan upsert, got %d: %s", w.Code, w.Body.String())
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	assign, _ := json.Marshal(map[string]any{"tenant_id": "tenant-e", "plan_id": "enterprise", "effective_from": monthStart.Format(time.RFC3339)})
+	req = httptest.NewRequest(http.MethodPost, "/v1/billing/plans/assignments", bytes.NewReader(assign))
+	req.Header.Set("X-Role", "admin")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for plan assignment, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/billing/invoice?tenant_id=tenant-e&month="+now.Format("2006-01"), nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for invoice, got %d", w.Code)
+	}
+	var inv struct {
+		Total billing.Money `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &inv); err != nil {
+		t.Fatalf("decode invoice: %v", err)
+	}
+	if inv.Total != billing.NewMoney(billing.MustParseAmount("4"), billing.USD) {
+		t.Fatalf("expected tiered amount 4, got %s", inv.Total)
+	}
+}
+
+func TestControlplaneRecordsTokenMeters(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("tenant-m"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	h := svc.Handler()
+
+	body := []byte(`{"tenant_id":"tenant-m","invocations":2,"input_tokens":300,"output_tokens":40,"model":"gpt-4o-mini"}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/usage", bytes.NewReader(body))
+	req.Header.Set("X-Role", "admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/usage?tenant_id=tenant-m", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var got struct {
+		InputTokens  int64                      `json:"input_tokens"`
+		OutputTokens int64                      `json:"output_tokens"`
+		ByModel      map[string]json.RawMessage `json:"by_model"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode usage: %v", err)
+	}
+	if got.InputTokens != 300 || got.OutputTokens != 40 {
+		t.Fatalf("unexpected token totals: %s", w.Body.String())
+	}
+	if _, ok := got.ByModel["gpt-4o-mini"]; !ok {
+		t.Fatalf("expected per-model breakdown, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/billing/invoice?tenant_id=tenant-m&format=csv", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !bytes.Contains(w.Body.Bytes(), []byte("default,input_tokens,gpt-4o-mini,")) {
+		t.Fatalf("expected itemized token line in csv, got %s", w.Body.String())
+	}
+}
+
+func TestControlplaneInvoiceLifecycle(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("tenant-i"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	month := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	if err := svc.AddUsageAt("tenant-i", 2000, month.Add(time.Hour)); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	svc.SetTaxHook(func(_ billing.Invoice, taxable billing.Money) []billing.TaxLine {
+		return []billing.TaxLine{{Description: "sales tax", RatePercent: 5, Amount: taxable.Amount * 5 / 100}}
+	})
+	h := svc.Handler()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Role", "admin")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/v1/billing/invoices", `{"tenant_id":"tenant-i","month":"2026-05"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created billing.Invoice
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.ID == "" || created.Status != billing.StatusDraft {
+		t.Fatalf("unexpected draft: %+v", created)
+	}
+	if w := do(http.MethodPost, "/v1/billing/invoices", `{"tenant_id":"tenant-i","month":"2026-05"}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate period, got %d", w.Code)
+	}
+
+	w = do(http.MethodPost, "/v1/billing/invoices/"+created.ID+"/finalize", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 finalizing, got %d: %s", w.Code, w.Body.String())
+	}
+	var final billing.Invoice
+	_ = json.Unmarshal(w.Body.Bytes(), &final)
+	if final.Status != billing.StatusFinalized || final.Tax.Amount.String() != "0.1" || final.Total.Amount.String() != "2.1" {
+		t.Fatalf("unexpected finalized invoice: %+v", final)
+	}
+	if w := do(http.MethodPost, "/v1/billing/invoices/"+created.ID+"/finalize", ""); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 re-finalizing, got %d", w.Code)
+	}
+
+	// Late usage must not change a finalized document.
+	_ = svc.AddUsageAt("tenant-i", 5000, month.Add(2*time.Hour))
+	w = do(http.MethodGet, "/v1/billing/invoices/"+created.ID+"?format=html", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected html invoice, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got, _ := svc.GetInvoice(created.ID); got.Total.Amount.String() != "2.1" {
+		t.Fatalf("finalized invoice changed: %+v", got)
+	}
+
+	w = do(http.MethodPost, "/v1/billing/invoices/"+created.ID+"/void", `{"reason":"re-issue"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 voiding, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/v1/billing/invoices?tenant_id=tenant-i&status=void", "")
+	if !strings.Contains(w.Body.String(), `"total":1`) {
+		t.Fatalf("expected one void invoice, got %s", w.Body.String())
+	}
+	if w := do(http.MethodPost, "/v1/billing/invoices", `{"tenant_id":"tenant-i","month":"2026-05"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected re-issue after void, got %d", w.Code)
+	}
+}
+
+func TestControlplaneRateAPIAndSummaryUseMoney(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	_ = svc.AddTenant("tenant-x")
+	_ = svc.AddTenant("tenant-y")
+	month := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	_ = svc.AddUsageAt("tenant-x", 3000, month.Add(time.Hour))
+	_ = svc.AddUsageAt("tenant-y", 1000, month.Add(time.Hour))
+	h := svc.Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/billing/rates", strings.NewReader(`{"per_thousand":"0.1","currency":"eur"}`))
+	req.Header.Set("X-Role", "admin")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/billing/rates", nil))
+	if !strings.Contains(w.Body.String(), `"per_thousand":"0.1"`) || !strings.Contains(w.Body.String(), `"currency":"EUR"`) {
+		t.Fatalf("unexpected rate payload: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/billing/summary?month=2026-08", nil))
+	var summary struct {
+		Totals []struct {
+			TenantID string        `json:"tenant_id"`
+			Amount   billing.Money `json:"amount"`
+		} `json:"totals"`
+		GrandTotalAmounts []billing.Money `json:"grand_total_amounts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("decode summary: %v", err)
+	}
+	if len(summary.Totals) != 2 || summary.Totals[0].Amount.String() != "0.30 EUR" {
+		t.Fatalf("unexpected summary rows: %s", w.Body.String())
+	}
+	if len(summary.GrandTotalAmounts) != 1 || summary.GrandTotalAmounts[0].String() != "0.40 EUR" {
+		t.Fatalf("unexpected grand totals: %s", w.Body.String())
+	}
+}
+
+func TestControlplaneUsageTimeseries(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	_ = svc.AddTenant("tenant-ts")
+	day := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	for _, in := range []controlplane.UsageInput{
+		{TenantID: "tenant-ts", Agent: "llm", Model: "gpt-4o", Invocations: 2, InputTokens: 100, OccurredAt: day.Add(90 * time.Minute)},
+		{TenantID: "tenant-ts", Agent: "llm", Model: "haiku", Invocations: 1, OccurredAt: day.Add(100 * time.Minute)},
+		{TenantID: "tenant-ts", Agent: "parse", Invocations: 4, OccurredAt: day.Add(26 * time.Hour)},
+		{TenantID: "tenant-ts", Agent: "parse", Invocations: 9, OccurredAt: day.AddDate(0, 1, 0)},
+	} {
+		if err := svc.RecordUsage(in); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	h := svc.Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/v1/usage/timeseries?tenant_id=tenant-ts&from=2026-09-01&to=2026-09-03&granularity=day&group_by=agent")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var ts controlplane.Timeseries
+	if err := json.Unmarshal(w.Body.Bytes(), &ts); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(ts.Series) != 2 || ts.Series[0].Group != "llm" || ts.Series[1].Group != "parse" {
+		t.Fatalf("unexpected series: %+v", ts.Series)
+	}
+	if p := ts.Series[0].Points; len(p) != 2 || p[0].Invocations != 3 || p[0].InputTokens != 100 || p[1].Invocations != 0 {
+		t.Fatalf("unexpected llm points: %+v", p)
+	}
+	if p := ts.Series[1].Points; p[1].Invocations != 4 {
+		t.Fatalf("expected next-month usage excluded, got %+v", p)
+	}
+
+	w = get("/v1/usage/timeseries?tenant_id=tenant-ts&from=2026-09-01T01:00:00Z&to=2026-09-01T02:00:00Z&granularity=hour&group_by=model&format=csv")
+	if w.Header().Get("Content-Type") != "text/csv" || !strings.Contains(w.Body.String(), "tenant-ts,2026-09-01T01:00:00Z,gpt-4o,2,100,0") {
+		t.Fatalf("unexpected csv: %s", w.Body.String())
+	}
+
+	w = get("/v1/usage/timeseries?tenant_id=tenant-ts&from=2026-01-01&to=2026-12-31&granularity=month")
+	_ = json.Unmarshal(w.Body.Bytes(), &ts)
+	if len(ts.Series) != 1 || len(ts.Series[0].Points) != 12 || ts.Series[0].Points[8].Invocations != 7 || ts.Series[0].Points[9].Invocations != 9 {
+		t.Fatalf("unexpected monthly rollup: %+v", ts.Series)
+	}
+
+	if w := get("/v1/usage/timeseries?tenant_id=tenant-ts&from=2020-01-01&to=2026-01-01&granularity=hour"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized range, got %d", w.Code)
+	}
+	if w := get("/v1/usage/timeseries?tenant_id=tenant-ts&granularity=week"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad granularity, got %d", w.Code)
+	}
+}
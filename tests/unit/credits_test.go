@@ -0,0 +1,149 @@
+package unit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/quota"
+)
+
+func TestCreditLedgerDrawdownAndExpiry(t *testing.T) {
+	l := billing.NewCreditLedger()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	usd := func(v string) billing.Money { return billing.NewMoney(billing.MustParseAmount(v), billing.USD) }
+
+	if _, err := l.Grant("acme", billing.CreditPurchased, usd("10"), time.Time{}, "order 42", now); err != nil {
+		t.Fatalf("grant purchased: %v", err)
+	}
+	promo, err := l.Grant("acme", billing.CreditPromotional, usd("5"), now.Add(24*time.Hour), "", now)
+	if err != nil {
+		t.Fatalf("grant promo: %v", err)
+	}
+	if _, err := l.Grant("acme", billing.CreditPurchased, billing.NewMoney(billing.AmountFromInt(1), "EUR"), time.Time{}, "", now); !errors.Is(err, billing.ErrCurrencyMismatch) {
+		t.Fatalf("expected single-currency account, got %v", err)
+	}
+
+	month := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	drawn, err := l.Draw("acme", usd("3.5"), month, now.Add(time.Hour))
+	if err != nil || drawn.Amount != billing.MustParseAmount("3.5") {
+		t.Fatalf("draw: %v, %v", drawn, err)
+	}
+	grants := l.Grants("acme", now.Add(time.Hour))
+	if grants[1].ID != promo.ID || grants[1].Remaining != billing.MustParseAmount("1.5") || grants[0].Remaining != billing.AmountFromInt(10) {
+		t.Fatalf("expected the expiring promo grant to be drawn first: %+v", grants)
+	}
+
+	later := now.Add(48 * time.Hour)
+	if got := l.Balance("acme", later); got.Amount != billing.AmountFromInt(10) {
+		t.Fatalf("expected promo remainder to expire, balance %v", got)
+	}
+	drawn, _ = l.Draw("acme", usd("12"), month, later)
+	if drawn.Amount != billing.AmountFromInt(10) {
+		t.Fatalf("expected draw to stop at the balance, got %v", drawn)
+	}
+	if applied := l.Applied("acme", billing.USD, month, month.AddDate(0, 1, 0)); applied != billing.MustParseAmount("13.5") {
+		t.Fatalf("expected 13.5 applied to March, got %s", applied)
+	}
+	restored := billing.NewCreditLedger()
+	restored.Restore(l.State())
+	if applied := restored.Applied("acme", billing.USD, month, month.AddDate(0, 1, 0)); applied != billing.MustParseAmount("13.5") {
+		t.Fatalf("expected applied credit to survive a restore, got %s", applied)
+	}
+
+	kinds := make([]string, 0)
+	for _, e := range l.Entries("acme", later) {
+		kinds = append(kinds, string(e.Kind)+":"+e.Amount.Amount.String()+"="+e.Balance.Amount.String())
+	}
+	want := "grant:10=10 grant:5=15 drawdown:-3.5=11.5 expiry:-1.5=10 drawdown:-10=0"
+	if strings.Join(kinds, " ") != want {
+		t.Fatalf("ledger:\n got %s\nwant %s", strings.Join(kinds, " "), want)
+	}
+}
+
+func TestControlplanePrepaidCredits(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	h := svc.Handler()
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Role", "admin")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Usage from before the tenant was prepaid stays on the invoice.
+	if err := svc.AddUsage("acme", 1000); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	if rec := call(http.MethodPost, "/v1/credits/acme/grants", `{"amount":"5","currency":"EUR"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected grant in a foreign currency to conflict, got %d", rec.Code)
+	}
+	rec := call(http.MethodPost, "/v1/credits/acme/grants", `{"amount":"5","kind":"purchased","note":"starter pack"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("grant: %d %s", rec.Code, rec.Body.String())
+	}
+	if err := svc.AddUsage("acme", 2000); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+
+	var balance controlplane.CreditBalance
+	rec = call(http.MethodGet, "/v1/credits/acme", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &balance); err != nil {
+		t.Fatalf("decode balance: %v", err)
+	}
+	if balance.Balance.Amount != billing.AmountFromInt(3) || len(balance.Grants) != 1 {
+		t.Fatalf("expected 3 USD left after 2 USD of usage, got %s", rec.Body.String())
+	}
+
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	inv, err := svc.PreviewInvoice("acme", start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if inv.Subtotal.Amount != billing.AmountFromInt(3) || inv.Credits.Amount != billing.AmountFromInt(2) || inv.Total.Amount != billing.AmountFromInt(1) {
+		t.Fatalf("expected 3 subtotal, 2 credits, 1 due: %+v", inv)
+	}
+
+	if err := svc.AddUsage("acme", 4000); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	inv, _ = svc.PreviewInvoice("acme", start, start.AddDate(0, 1, 0))
+	if inv.Credits.Amount != billing.AmountFromInt(5) || inv.Total.Amount != billing.AmountFromInt(2) {
+		t.Fatalf("expected credits capped at the 5 granted and 2 overage due: %+v", inv)
+	}
+	status, err := svc.QuotaStatus("acme", time.Now())
+	if err != nil || status.Credits == nil || status.Credits.State != quota.StateWarn || status.Admit(1) != nil {
+		t.Fatalf("expected an empty non-blocking balance to warn only: %+v, %v", status, err)
+	}
+
+	if rec := call(http.MethodPut, "/v1/credits/acme", `{"block_at_zero":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("configure: %d %s", rec.Code, rec.Body.String())
+	}
+	status, _ = svc.QuotaStatus("acme", time.Now())
+	if err := status.Admit(1); !errors.Is(err, quota.ErrQuotaExceeded) || !strings.Contains(err.Error(), "prepaid credit balance") {
+		t.Fatalf("expected exhausted prepaid tenant to be blocked, got %v", err)
+	}
+
+	rec = call(http.MethodGet, "/v1/credits/acme/ledger?kind=drawdown", "")
+	var ledger struct {
+		Items []billing.LedgerEntry `json:"items"`
+		Total int                   `json:"total"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &ledger)
+	if ledger.Total != 2 || ledger.Items[0].Amount.Amount != -billing.AmountFromInt(3) || ledger.Items[0].Balance.Amount != 0 {
+		t.Fatalf("unexpected drawdown history: %s", rec.Body.String())
+	}
+}
@@ -47,3 +47,38 @@ func TestPrometheusRecorderAndEndpoint(t *testing.T) {
 		t.Fatalf("missing circuit metric: %s", text)
 	}
 }
+
+func TestPrometheusRecorderTenantLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	rec, err := metrics.NewPrometheusRecorderWithLabels(reg, map[string]string{"tenant.id": "acme", "tenant.tier": "gold"})
+	if err != nil {
+		t.Fatalf("new prometheus recorder: %v", err)
+	}
+	rec.ObserveInvocation("agent_a", "success", 10*time.Millisecond)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != "fluxroute_invocations_total" {
+			continue
+		}
+		labels := map[string]string{}
+		for _, l := range f.GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["tenant_id"] != "acme" || labels["tenant_tier"] != "gold" || labels["agent_id"] != "agent_a" {
+			t.Fatalf("unexpected labels: %v", labels)
+		}
+		return
+	}
+	t.Fatal("missing invocations metric")
+}
+
+func TestPrometheusRecorderRejectsCollidingLabels(t *testing.T) {
+	_, err := metrics.NewPrometheusRecorderWithLabels(prometheus.NewRegistry(), map[string]string{"tenant.a.b": "x", "tenant.a_b": "y"})
+	if err == nil || !strings.Contains(err.Error(), "tenant_a_b") {
+		t.Fatalf("expected labels sharing a name to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/quota"
+)
+
+func TestControlplaneQuotaStatus(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	h := svc.Handler()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/v1/quotas/acme", strings.NewReader(body))
+		req.Header.Set("X-Role", "admin")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put(`{"limits":[{"metric":"invocations_per_day","soft":5,"hard":3}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected soft > hard to be rejected, got %d", rec.Code)
+	}
+	if rec := put(`{"limits":[{"metric":"tokens_per_month","hard":1.5}]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected fractional token limit to be rejected, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPut, "/v1/quotas/acme", strings.NewReader(`{"limits":[]}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected non-admin put to be forbidden, got %d", rec.Code)
+	}
+	rec = put(`{"limits":[
+		{"metric":"invocations_per_day","soft":8,"hard":10},
+		{"metric":"tokens_per_month","soft":"1000"},
+		{"metric":"spend_per_month","hard":"0.01"}
+	]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put quota: %d %s", rec.Code, rec.Body.String())
+	}
+
+	now := time.Now().UTC()
+	if err := svc.RecordUsage(controlplane.UsageInput{TenantID: "acme", Invocations: 9, InputTokens: 900, OutputTokens: 200, OccurredAt: now}); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+	if err := svc.RecordUsage(controlplane.UsageInput{TenantID: "acme", Invocations: 50, OccurredAt: now.AddDate(0, 0, -40)}); err != nil {
+		t.Fatalf("record old usage: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/quotas/acme/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: %d %s", rec.Code, rec.Body.String())
+	}
+	var status quota.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	byMetric := map[quota.Metric]quota.Check{}
+	for _, c := range status.Checks {
+		byMetric[c.Metric] = c
+	}
+	day := byMetric[quota.InvocationsPerDay]
+	if day.Used.String() != "9" || day.State != quota.StateWarn || day.Remaining == nil || day.Remaining.String() != "1" {
+		t.Fatalf("unexpected daily invocation check: %+v", day)
+	}
+	if tokens := byMetric[quota.TokensPerMonth]; tokens.Used.String() != "1100" || tokens.State != quota.StateWarn || tokens.Remaining != nil {
+		t.Fatalf("unexpected token check: %+v", tokens)
+	}
+	if spend := byMetric[quota.SpendPerMonth]; spend.State != quota.StateExceeded || spend.Currency != "USD" {
+		t.Fatalf("unexpected spend check: %+v", spend)
+	}
+	if status.State != quota.StateExceeded {
+		t.Fatalf("expected overall exceeded state, got %s", status.State)
+	}
+	if err := status.Admit(1); !errors.Is(err, quota.ErrQuotaExceeded) || !strings.Contains(err.Error(), "spend_per_month") {
+		t.Fatalf("expected spend quota to block, got %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/quotas/missing/status", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown tenant, got %d", rec.Code)
+	}
+}
+
+func TestQuotaSpendAccruesAndFollowsPriceChanges(t *testing.T) {
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	if err := svc.SetQuota("acme", []quota.Limit{{Metric: quota.SpendPerMonth, Hard: billing.MustParseAmount("100")}}); err != nil {
+		t.Fatalf("set quota: %v", err)
+	}
+	now := time.Now().UTC()
+	spend := func() string {
+		t.Helper()
+		status, err := svc.QuotaStatus("acme", now)
+		if err != nil {
+			t.Fatalf("quota status: %v", err)
+		}
+		return status.Checks[0].Used.String()
+	}
+	for i := 0; i < 3; i++ {
+		if err := svc.RecordUsage(controlplane.UsageInput{TenantID: "acme", Invocations: 1000, OccurredAt: now}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if got := spend(); got != "3" {
+		t.Fatalf("expected 3 accrued at the default rate, got %s", got)
+	}
+
+	if err := svc.UpsertPlan(billing.PricePlan{ID: "pro", Tiers: []billing.Tier{{PerThousand: billing.MustParseAmount("5")}}}); err != nil {
+		t.Fatalf("upsert plan: %v", err)
+	}
+	if err := svc.AssignPlan("acme", "pro", now.Add(-time.Second)); err != nil {
+		t.Fatalf("assign plan: %v", err)
+	}
+	if got := spend(); got != "15" {
+		t.Fatalf("expected spend re-rated on the new plan to be 15, got %s", got)
+	}
+	if err := svc.RecordUsage(controlplane.UsageInput{TenantID: "acme", Invocations: 1000, OccurredAt: now}); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+	if got := spend(); got != "20" {
+		t.Fatalf("expected 20 after one more accrued event, got %s", got)
+	}
+}
+
+func TestRunManifestRejectedByQuota(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("quota-team"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	if err := svc.SetQuota("quota-team", []quota.Limit{{Metric: quota.InvocationsPerDay, Hard: billing.AmountFromInt(3)}}); err != nil {
+		t.Fatalf("set quota: %v", err)
+	}
+	var statusCalls atomic.Int64
+	cp := svc.Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/status") {
+			statusCalls.Add(1)
+		}
+		cp.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	t.Setenv("CONTROLPLANE_URL", srv.URL)
+	t.Setenv("REQUEST_ROLE", "operator")
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+	t.Setenv("QUOTA_CACHE_TTL", "1h")
+
+	path := writeManifest(t, `
+router:
+  namespace: quota-team
+agents:
+  - id: summarize_agent
+  - id: classify_agent
+pipeline:
+  - step: summarize_agent
+  - step: classify_agent
+    depends_on: summarize_agent
+`)
+	if _, err := app.RunManifestReport(path); err != nil {
+		t.Fatalf("first run should fit in quota: %v", err)
+	}
+	_, err := app.RunManifestReport(path)
+	if !errors.Is(err, quota.ErrQuotaExceeded) || !strings.Contains(err.Error(), "invocations_per_day used 2 of hard limit 3") {
+		t.Fatalf("expected second run to be rejected from the cached view, got %v", err)
+	}
+	if got := statusCalls.Load(); got != 1 {
+		t.Fatalf("expected one status fetch with a warm cache, got %d", got)
+	}
+}
+
+func TestQuotaClientServesStaleStatusWhenControlplaneDown(t *testing.T) {
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeQuotaStatus(w, quota.NewStatus("acme", time.Now(), []quota.Check{
+			quota.Evaluate(quota.Limit{Metric: quota.InvocationsPerMonth, Hard: billing.AmountFromInt(5)}, billing.AmountFromInt(1), "", time.Now().Add(time.Hour)),
+		}))
+	}))
+	defer srv.Close()
+
+	client, err := quota.NewClient(quota.ClientConfig{BaseURL: srv.URL, CacheTTL: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if _, err := client.Status(context.Background(), "acme"); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	client.Consume("acme", 3, 0)
+	down.Store(true)
+	status, err := client.Status(context.Background(), "acme")
+	if err == nil {
+		t.Fatal("expected refresh error while control plane is down")
+	}
+	if err := status.Admit(2); !errors.Is(err, quota.ErrQuotaExceeded) {
+		t.Fatalf("expected stale view with local usage to block, got %v", err)
+	}
+	if err := status.Admit(1); err != nil {
+		t.Fatalf("expected one more invocation to fit, got %v", err)
+	}
+}
+
+func writeQuotaStatus(w http.ResponseWriter, status quota.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
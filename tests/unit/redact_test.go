@@ -0,0 +1,266 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/redact"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/trace"
+)
+
+const testRedactionKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestRedactorDetectorsFieldsAndTokens(t *testing.T) {
+	cfg := redact.Config{
+		Fields:    []string{"$.customer.ssn", "password"},
+		Detectors: []string{redact.DetectorEmail, redact.DetectorAPIKey, redact.DetectorCard},
+		Patterns:  []redact.Pattern{{Name: "order", Regex: `ORD-[0-9]{6}`}},
+	}
+	masker, err := redact.New(cfg, nil)
+	if err != nil {
+		t.Fatalf("new masker: %v", err)
+	}
+	text := "mail jane@example.com, key sk-abcdefghijklmnopqrstuv, card 4111 1111 1111 1111, ref 4111 1111 1111 1112, order ORD-123456"
+	got := masker.RedactText(text)
+	want := "mail [redacted:email], key [redacted:api_key], card [redacted:card], ref 4111 1111 1111 1112, order [redacted:order]"
+	if got != want {
+		t.Fatalf("unexpected masking:\n got %s\nwant %s", got, want)
+	}
+
+	payload := []byte(`{"customer":{"ssn":"123-45-6789","name":"Jane","contact":"jane@example.com"},"auth":{"password":{"v":1}},"note":"<b>ok</b>"}`)
+	out := string(masker.RedactPayload(payload))
+	for _, leaked := range []string{"123-45-6789", "jane@example.com", `"v":1`} {
+		if strings.Contains(out, leaked) {
+			t.Fatalf("payload leaked %q: %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, `"name":"Jane"`) || !strings.Contains(out, `"note":"<b>ok</b>"`) {
+		t.Fatalf("payload lost unrelated values: %s", out)
+	}
+	clean := []byte(`{ "name": "Jane" }`)
+	if got := masker.RedactPayload(clean); !bytes.Equal(got, clean) {
+		t.Fatalf("expected untouched payload to keep its bytes, got %s", got)
+	}
+
+	cfg.Mode = redact.ModeTokenize
+	key := bytes.Repeat([]byte{7}, redact.KeySize)
+	tokenizer, err := redact.New(cfg, key)
+	if err != nil {
+		t.Fatalf("new tokenizer: %v", err)
+	}
+	once := tokenizer.RedactText(text)
+	if once != tokenizer.RedactText(text) || once != tokenizer.RedactText(once) {
+		t.Fatalf("expected deterministic, idempotent tokens: %s", once)
+	}
+	revealed, n, err := redact.Reveal(once, key)
+	if err != nil || n != 4 || revealed != text {
+		t.Fatalf("expected the original text back from 4 tokens, got %d %q (%v)", n, revealed, err)
+	}
+	if _, _, err := redact.Reveal(once, bytes.Repeat([]byte{8}, redact.KeySize)); err == nil {
+		t.Fatal("expected reveal with another key to fail")
+	}
+	if _, err := redact.New(cfg, nil); !errors.Is(err, redact.ErrNoKey) {
+		t.Fatalf("expected ErrNoKey without a key, got %v", err)
+	}
+	if err := (redact.Config{Detectors: []string{"phone"}}).Validate(); err == nil {
+		t.Fatal("expected an unknown detector to be rejected")
+	}
+}
+
+func TestAuditLoggerRedactsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger := audit.NewLogger(path)
+	r, err := redact.New(redact.Config{Detectors: []string{redact.DetectorEmail}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.SetRedactor(r)
+	if err := logger.Record(audit.Event{Actor: "admin", Action: "update", Resource: "tenants/acme", Status: "success",
+		Error: "notify ops@example.com", After: []byte(`{"billing_email":"ap@acme.test"}`)}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "@example.com") || strings.Contains(string(raw), "ap@acme.test") {
+		t.Fatalf("audit log leaked an email: %s", raw)
+	}
+}
+
+func TestControlplaneAuditTrailRedactsEvents(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	t.Setenv("CONTROLPLANE_AUDIT_LOG_PATH", logPath)
+	t.Setenv("CONTROLPLANE_REDACTION_CONFIG", writeManifest(t, `
+redaction:
+  detectors: [email]
+`))
+	redactor, err := controlplane.RedactorFromEnv()
+	if err != nil || redactor == nil {
+		t.Fatalf("redactor from env: %v %v", redactor, err)
+	}
+	svc := controlplane.NewService()
+	svc.SetRedactor(redactor)
+	handler := svc.Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/tenants", strings.NewReader(`{"id":"acme","attributes":{"billing_email":"ap@acme.test"}}`))
+	req.Header.Set("X-Role", "admin")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create tenant: %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/audit", nil)
+	req.Header.Set("X-Role", "admin")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	state, _ := json.Marshal(svc.Audit().State())
+	raw, _ := os.ReadFile(logPath)
+	for name, text := range map[string]string{"audit api": rec.Body.String(), "trail state": string(state), "audit log": string(raw)} {
+		if strings.Contains(text, "ap@acme.test") {
+			t.Fatalf("%s leaked an email: %s", name, text)
+		}
+		if !strings.Contains(text, "[redacted:email]") {
+			t.Fatalf("expected %s to hold the redacted event: %s", name, text)
+		}
+	}
+}
+
+func TestRunManifestRedactsTraceLogsAndExports(t *testing.T) {
+	var sentPlain atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), "hello") {
+			sentPlain.Store(true)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "messages") {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid x-api-key sk-ant-REDACTED for billing@example.com"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"output_text":"reach jane.doe@example.com, card 4111-1111-1111-1111","usage":{"input_tokens":3,"output_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	tracePath := filepath.Join(dir, "trace.jsonl")
+	exportPath := filepath.Join(dir, "astragraph.json")
+	t.Setenv("TRACE_OUTPUT", tracePath)
+	t.Setenv("ASTRAGRAPH_AUDIT_PATH", exportPath)
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+	t.Setenv("REQUEST_ROLE", "admin")
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("ANTHROPIC_BASE_URL", srv.URL)
+	t.Setenv("REDACTION_KEY", testRedactionKey)
+	t.Setenv("ADAPTER_CASSETTE_MODE", "record")
+
+	var out bytes.Buffer
+	manifestPath := writeManifest(t, `
+agents:
+  - id: classify_agent
+    provider: openai
+  - id: enrich_agent
+    provider: anthropic
+pipeline:
+  - step: classify_agent
+  - step: enrich_agent
+redaction:
+  mode: tokenize
+  fields: [message]
+  detectors: [email, api_key, card]
+`)
+	err := app.RunManifest(manifestPath, &out)
+	if err == nil {
+		t.Fatal("expected the failing provider to fail the run")
+	}
+
+	recorded, err := trace.LoadFromFile(tracePath)
+	if err != nil {
+		t.Fatalf("load trace: %v", err)
+	}
+	exportRaw, _ := os.ReadFile(exportPath)
+	cassetteRaw, err := os.ReadFile(tracePath + ".cassette.json")
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	for name, raw := range map[string]string{"trace": traceText(recorded), "export": string(exportRaw), "logs": out.String(), "cassette": string(cassetteRaw)} {
+		for _, leaked := range []string{"jane.doe@example.com", "4111-1111-1111-1111", "sk-ant-", "billing@example.com", `"hello"`} {
+			if strings.Contains(raw, leaked) {
+				t.Fatalf("%s leaked %q:\n%s", name, leaked, raw)
+			}
+		}
+	}
+	if !strings.Contains(out.String(), "[tok:api_key:") {
+		t.Fatalf("expected tokenized provider error in logs: %s", out.String())
+	}
+
+	var revealed bytes.Buffer
+	n, err := app.RevealTokens(tracePath, "", &revealed)
+	if err != nil {
+		t.Fatalf("reveal: %v", err)
+	}
+	plain, err := trace.Decode(&revealed)
+	if err != nil {
+		t.Fatalf("decode revealed trace: %v", err)
+	}
+	if text := traceText(plain); n == 0 || !strings.Contains(text, "jane.doe@example.com") || !strings.Contains(text, "billing@example.com") {
+		t.Fatalf("expected revealed trace to contain the original values (%d tokens):\n%s", n, text)
+	}
+
+	// A what-if replay re-executes agents with the revealed inputs and
+	// refuses to feed them tokens when it has no key to reveal them.
+	from := recorded.Steps[0].InvocationID
+	if err := app.ReplayFrom(tracePath, app.WhatIfOptions{From: from}, io.Discard); !errors.Is(err, router.ErrRedactedInput) {
+		t.Fatalf("expected redacted inputs to be refused, got %v", err)
+	}
+	sentPlain.Store(false)
+	whatIfPath := filepath.Join(dir, "whatif.jsonl")
+	if err := app.ReplayFrom(tracePath, app.WhatIfOptions{From: from, ManifestPath: manifestPath, Output: whatIfPath}, io.Discard); err != nil {
+		t.Fatalf("what-if replay: %v", err)
+	}
+	if !sentPlain.Load() {
+		t.Fatal("expected the re-executed agent to receive the revealed input")
+	}
+	whatIf, err := trace.LoadFromFile(whatIfPath)
+	if err != nil {
+		t.Fatalf("load what-if trace: %v", err)
+	}
+	if text := traceText(whatIf); strings.Contains(text, `"hello"`) || strings.Contains(text, "jane.doe@example.com") {
+		t.Fatalf("what-if trace leaked revealed values:\n%s", text)
+	}
+
+	t.Setenv("REQUEST_ROLE", "operator")
+	if _, err := app.RevealTokens(tracePath, "", &revealed); err == nil {
+		t.Fatal("expected reveal to require the admin role")
+	}
+}
+
+// traceText flattens the payloads, metadata and errors of tr's steps.
+func traceText(tr trace.ExecutionTrace) string {
+	var b strings.Builder
+	for _, s := range tr.Steps {
+		b.Write(s.Input.Payload)
+		b.Write(s.Output.Payload)
+		for k, v := range s.Input.Metadata {
+			b.WriteString(k + "=" + v)
+		}
+		b.WriteString(s.Error)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
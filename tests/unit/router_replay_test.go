@@ -0,0 +1,90 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/agent"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+func recordBreakerRun(t *testing.T) trace.ExecutionTrace {
+	t.Helper()
+	reg := agent.NewRegistry()
+	_ = reg.Register("down", func(context.Context, agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		return agentfunc.AgentOutput{}, errors.New("boom")
+	})
+	_ = reg.Register("echo", func(_ context.Context, in agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		return agentfunc.AgentOutput{RequestID: in.RequestID, Payload: in.Payload}, nil
+	})
+	eng := router.NewEngine(reg, agentfunc.RouterConfig{DefaultTimeout: time.Second})
+	eng.SetClock(router.NewVirtualClock(time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)))
+	_, tr := eng.RunPlan(context.Background(), router.ExecutionPlan{TaskID: "cb", Nodes: []router.PlanNode{
+		{
+			Invocation:           router.AgentInvocation{ID: "a", AgentID: "down", Input: agentfunc.AgentInput{RequestID: "r1"}},
+			RetryPolicy:          agentfunc.RetryPolicy{MaxAttempts: 4, Backoff: agentfunc.BackoffLinear},
+			CircuitBreakerPolicy: agentfunc.CircuitBreakerPolicy{FailureThreshold: 2, ResetTimeout: 150 * time.Millisecond},
+		},
+		{Invocation: router.AgentInvocation{ID: "b", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r2", Payload: []byte("x")}}},
+		{Invocation: router.AgentInvocation{ID: "c", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r3"}}, DependsOn: []string{"a"}},
+	}})
+	return tr
+}
+
+func TestReplayRerunsRecordedPlanOnVirtualClock(t *testing.T) {
+	tr := recordBreakerRun(t)
+	// Attempts 1-2 fail and open the breaker; after 200ms of backoff the
+	// reset timeout has passed, so attempts 3 and 4 are failing probes.
+	if got := len(tr.Steps); got != 6 {
+		t.Fatalf("expected 4 attempts of a plus b and skipped c, got %d: %+v", got, tr.Steps)
+	}
+	if tr.TotalLatency != 600*time.Millisecond {
+		t.Fatalf("expected virtual backoff of 600ms, got %s", tr.TotalLatency)
+	}
+
+	replayed, div, err := router.Replay(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(div) != 0 {
+		t.Fatalf("expected faithful replay, got %s", trace.FormatDivergence(div))
+	}
+	probes := 0
+	for _, s := range replayed.Steps {
+		if s.Probe {
+			probes++
+		}
+	}
+	if probes != 2 {
+		t.Fatalf("expected two half-open probes on replay, got %d", probes)
+	}
+
+	// Under a longer reset timeout the breaker would have rejected attempt 3.
+	for i := range tr.Steps {
+		if tr.Steps[i].Policy != nil && tr.Steps[i].InvocationID == "a" {
+			tr.Steps[i].Policy.ResetTimeout = time.Hour
+		}
+	}
+	_, div, err = router.Replay(context.Background(), tr)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	fields := map[string]bool{}
+	for _, d := range div {
+		fields[d.Field] = true
+	}
+	if !fields["attempts"] || !fields["attempt[3].breaker_rejected"] {
+		t.Fatalf("expected attempts and breaker divergences, got %s", trace.FormatDivergence(div))
+	}
+}
+
+func TestReplayRejectsTracesWithoutPolicies(t *testing.T) {
+	tr := trace.ExecutionTrace{Steps: []trace.Step{{InvocationID: "1", AgentID: "a", Attempt: 1}}}
+	if _, _, err := router.Replay(context.Background(), tr); !errors.Is(err, router.ErrTraceWithoutPolicy) {
+		t.Fatalf("expected ErrTraceWithoutPolicy, got %v", err)
+	}
+}
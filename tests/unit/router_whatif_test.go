@@ -0,0 +1,91 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/your-org/fluxroute/internal/agent"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+func TestReplayFromOverridesPayloadAndReusesTheRest(t *testing.T) {
+	calls := map[string]int{}
+	reg := agent.NewRegistry()
+	_ = reg.Register("echo", func(_ context.Context, in agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		calls[in.RequestID]++
+		return agentfunc.AgentOutput{RequestID: in.RequestID, Payload: in.Payload}, nil
+	})
+	eng := router.NewEngine(reg, agentfunc.RouterConfig{})
+	_, tr := eng.RunPlan(context.Background(), router.ExecutionPlan{TaskID: "whatif", Nodes: []router.PlanNode{
+		{Invocation: router.AgentInvocation{ID: "a", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r1", Payload: []byte(`{"n":1}`)}}},
+		{Invocation: router.AgentInvocation{ID: "b", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r2", Payload: []byte(`{"n":2}`)}}, DependsOn: []string{"a"}},
+		{Invocation: router.AgentInvocation{ID: "c", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r3", Payload: []byte(`{"n":3}`)}}, DependsOn: []string{"b"}},
+		{Invocation: router.AgentInvocation{ID: "d", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r4"}}},
+	}})
+	clear(calls)
+
+	replayed, err := router.ReplayFrom(context.Background(), tr, reg, router.WhatIf{From: "b", Payload: []byte(`{"n":20}`)})
+	if err != nil {
+		t.Fatalf("replay from: %v", err)
+	}
+	if calls["r1"] != 0 || calls["r4"] != 0 || calls["r2"] != 1 || calls["r3"] != 1 {
+		t.Fatalf("expected only b and c to execute, got %v", calls)
+	}
+	steps := map[string]trace.Step{}
+	for _, s := range replayed.Steps {
+		steps[s.InvocationID] = s
+	}
+	if !steps["a"].Reused || !steps["d"].Reused || steps["b"].Reused || steps["c"].Reused {
+		t.Fatalf("unexpected reuse marks: %+v", replayed.Steps)
+	}
+	if string(steps["a"].Output.Payload) != `{"n":1}` || string(steps["b"].Output.Payload) != `{"n":20}` {
+		t.Fatalf("unexpected outputs: a=%s b=%s", steps["a"].Output.Payload, steps["b"].Output.Payload)
+	}
+
+	div := trace.Diff(tr, replayed, trace.DiffConfig{})
+	roots := trace.RootCauses(tr, replayed, div, trace.DiffConfig{})
+	if len(roots) != 1 || roots[0].InvocationID != "b" || len(roots[0].InputChanges) == 0 {
+		t.Fatalf("expected b's changed input as the only root cause, got %+v", roots)
+	}
+
+	if _, err := router.ReplayFrom(context.Background(), tr, reg, router.WhatIf{From: "zz"}); !errors.Is(err, router.ErrUnknownInvocation) {
+		t.Fatalf("expected ErrUnknownInvocation, got %v", err)
+	}
+	if _, err := router.ReplayFrom(context.Background(), tr, reg, router.WhatIf{From: "b", AgentVersion: "v9"}); err == nil {
+		t.Fatal("expected an unregistered version to be rejected")
+	}
+}
+
+func TestReplayFromKeepsRecordedVersionsAndRefusesRedactedInputs(t *testing.T) {
+	reg := agent.NewRegistry()
+	for _, version := range []string{"v1", "v2"} {
+		_ = reg.RegisterVersion("echo", version, func(_ context.Context, in agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+			return agentfunc.AgentOutput{RequestID: in.RequestID, Payload: []byte(`"` + version + `"`)}, nil
+		})
+	}
+	eng := router.NewEngine(reg, agentfunc.RouterConfig{})
+	_, tr := eng.RunPlan(context.Background(), router.ExecutionPlan{TaskID: "versions", Nodes: []router.PlanNode{
+		{Invocation: router.AgentInvocation{ID: "a", AgentID: "echo", Input: agentfunc.AgentInput{RequestID: "r1"}}},
+		{Invocation: router.AgentInvocation{ID: "b", AgentID: "echo", Version: "v2", Input: agentfunc.AgentInput{RequestID: "r2", Payload: []byte(`{"to":"[redacted:email]"}`)}}, DependsOn: []string{"a"}},
+	}})
+
+	if _, err := router.ReplayFrom(context.Background(), tr, reg, router.WhatIf{From: "a"}); !errors.Is(err, router.ErrRedactedInput) {
+		t.Fatalf("expected b's redacted input to be refused, got %v", err)
+	}
+	replayed, err := router.ReplayFrom(context.Background(), tr, reg, router.WhatIf{From: "b", Payload: []byte(`{"to":"a@example.com"}`)})
+	if err != nil {
+		t.Fatalf("replay from: %v", err)
+	}
+	for _, s := range replayed.Steps {
+		if s.InvocationID == "b" && (s.AgentVersion != "v2" || string(s.Output.Payload) != `"v2"`) {
+			t.Fatalf("expected b to re-execute its recorded version v2, got %q -> %s", s.AgentVersion, s.Output.Payload)
+		}
+	}
+
+	if _, div, err := router.Replay(context.Background(), tr); err != nil || len(div) != 0 {
+		t.Fatalf("expected versioned trace to replay without divergences, got %+v (%v)", div, err)
+	}
+}
@@ -0,0 +1,186 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/slo"
+	"github.com/your-org/fluxroute/internal/usage"
+)
+
+func TestSLOTrackerWindowsAndErrorBudget(t *testing.T) {
+	if got, err := slo.ParseObjective("99.5%"); err != nil || got != 0.995 {
+		t.Fatalf("parse objective: %v, %v", got, err)
+	}
+	if _, err := slo.ParseObjective("100"); err == nil {
+		t.Fatalf("expected a 100%% objective to be rejected")
+	}
+
+	now := time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC)
+	tr := slo.NewTracker()
+	// 1000 requests ten days ago with 2 failures, 1000 today with 1 failure.
+	for i := 0; i < 1000; i++ {
+		tr.Record("GET /usage", now.Add(-10*24*time.Hour), 20*time.Millisecond, i >= 2)
+		tr.Record("GET /usage", now.Add(-30*time.Minute), 80*time.Millisecond, i >= 1)
+	}
+	tr.Record("GET /usage", now.Add(-40*24*time.Hour), time.Millisecond, false)
+
+	r := tr.Report("GET /usage", 0.999, now)
+	if r.Success != 1997 || r.Errors != 3 {
+		t.Fatalf("expected outcomes past retention dropped, got %d/%d", r.Success, r.Errors)
+	}
+	week, _ := r.Window("7d")
+	if week.Total != 1000 || week.Availability != 0.999 || !week.Met || week.ErrorBudgetRemaining != 0 || week.BurnRate != 1 {
+		t.Fatalf("unexpected 7d window: %+v", week)
+	}
+	month, _ := r.Window("30d")
+	if month.Total != 2000 || month.Availability != 0.9985 || month.Met || month.ErrorBudgetRemaining != -0.5 || month.BurnRate != 1.5 {
+		t.Fatalf("unexpected 30d window: %+v", month)
+	}
+	if r.Latency.P50MS != 25 || r.Latency.P99MS != 80 || r.Latency.MaxMS != 80 {
+		t.Fatalf("unexpected latency percentiles: %+v", r.Latency)
+	}
+
+	idle := tr.Report("GET /tenants", 0.999, now)
+	if w, _ := idle.Window("30d"); w.Availability != 1 || !w.Met || w.BurnRate != 0 {
+		t.Fatalf("expected an idle endpoint to meet its objective: %+v", w)
+	}
+}
+
+func TestControlplaneSLAReports(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	t.Setenv("CONTROLPLANE_SLO_OBJECTIVE", "99.5%")
+	svc := controlplane.NewService()
+	for _, id := range []string{"acme", "globex"} {
+		if err := svc.AddTenant(id); err != nil {
+			t.Fatalf("add tenant: %v", err)
+		}
+	}
+	h := svc.Handler()
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Role", "admin")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	call(http.MethodGet, "/v1/tenants", "")
+	call(http.MethodPost, "/v1/tenants", `{"id":`)
+	var sla struct {
+		SLOTarget    string       `json:"slo_target"`
+		Availability slo.Report   `json:"availability"`
+		Endpoints    []slo.Report `json:"endpoints"`
+	}
+	if err := json.Unmarshal(call(http.MethodGet, "/sla", "").Body.Bytes(), &sla); err != nil {
+		t.Fatalf("decode sla: %v", err)
+	}
+	if sla.SLOTarget != "99.5%" || len(sla.Endpoints) != 2 || sla.Endpoints[0].Key != "GET /tenants" || sla.Endpoints[1].Key != "POST /tenants" {
+		t.Fatalf("unexpected endpoint breakdown: %+v", sla)
+	}
+	if sla.Endpoints[1].Success != 1 || sla.Availability.Errors != 0 {
+		t.Fatalf("expected client errors not to spend the error budget: %+v", sla)
+	}
+
+	// Runs reach the control plane through the router's usage outbox.
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	reporter, err := usage.NewReporter(usage.ReporterConfig{BaseURL: srv.URL, Role: "operator", OutboxDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("new reporter: %v", err)
+	}
+	failed := []router.AgentResult{
+		{Invocation: router.AgentInvocation{AgentID: "a"}, Err: errors.New("boom")},
+		{Invocation: router.AgentInvocation{AgentID: "b"}, Err: router.ErrDependencyFailed},
+	}
+	outcome := usage.RunFromResults("run_2", "acme", "acme", failed, 1500*time.Millisecond, time.Now())
+	if outcome.Succeeded || outcome.FailedAgents != 1 {
+		t.Fatalf("expected one failing agent, got %+v", outcome)
+	}
+	_ = reporter.EnqueueRun(usage.RunFromResults("run_1", "acme", "acme", nil, 200*time.Millisecond, time.Now()))
+	_ = reporter.EnqueueRun(outcome)
+	if res, err := reporter.Flush(context.Background()); err != nil || res.Delivered != 2 {
+		t.Fatalf("deliver run outcomes: %+v, %v", res, err)
+	}
+	_ = reporter.EnqueueRun(outcome)
+	if res, err := reporter.Flush(context.Background()); err != nil || res.Duplicates != 1 {
+		t.Fatalf("expected duplicate run outcome to be acknowledged, got %+v, %v", res, err)
+	}
+
+	var report slo.Report
+	rec := call(http.MethodGet, "/v1/sla/tenants/acme?objective=0.9", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode tenant sla: %s", rec.Body.String())
+	}
+	week, _ := report.Window("7d")
+	if report.Objective != 0.9 || week.Total != 2 || week.Errors != 1 || week.Met || week.BurnRate != 5 || report.Latency.MaxMS != 1500 {
+		t.Fatalf("unexpected tenant report: %s", rec.Body.String())
+	}
+	report, _ = svc.TenantSLA("globex", 0, time.Now())
+	if w, _ := report.Window("30d"); report.Objective != 0.995 || w.Total != 0 || !w.Met {
+		t.Fatalf("expected a tenant without runs to meet the default objective: %+v", report)
+	}
+	if rec := call(http.MethodGet, "/v1/sla/tenants/nope", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown tenant to 404, got %d", rec.Code)
+	}
+	if rec := call(http.MethodPost, "/v1/sla/runs", `{"run_id":"run_9","tenant_id":"nope","succeeded":true}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected run for unknown tenant to 404, got %d", rec.Code)
+	}
+}
+
+func TestControlplaneRunOutcomeIDsExpireWithTheSLAWindow(t *testing.T) {
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	now := time.Now()
+	stale := controlplane.RunOutcomeInput{RunID: "run_old", TenantID: "acme", Succeeded: true, OccurredAt: now.Add(-slo.Retention - time.Minute)}
+	if err := svc.RecordRunOutcome(stale); !errors.Is(err, controlplane.ErrStaleRunOutcome) {
+		t.Fatalf("expected an outcome older than the window to be rejected, got %v", err)
+	}
+	recent := controlplane.RunOutcomeInput{RunID: "run_1", TenantID: "acme", Succeeded: true, OccurredAt: now.Add(-slo.Retention + time.Hour)}
+	if err := svc.RecordRunOutcome(recent); err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	if err := svc.RecordRunOutcome(recent); !errors.Is(err, controlplane.ErrDuplicateRunOutcome) {
+		t.Fatalf("expected a repeated run id inside the window to be a duplicate, got %v", err)
+	}
+
+	// A checkpoint written before run_1 aged out still carries it; the next
+	// outcome prunes it so checkpoints stop growing.
+	snap, err := svc.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	var st map[string]json.RawMessage
+	if err := json.Unmarshal(snap, &st); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	st["run_ids_at"], _ = json.Marshal(map[string]time.Time{"run_1": recent.OccurredAt, "run_ancient": now.Add(-slo.Retention - time.Hour)})
+	snap, _ = json.Marshal(st)
+	if err := svc.Restore(snap); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if err := svc.RecordRunOutcome(controlplane.RunOutcomeInput{RunID: "run_2", TenantID: "acme", Succeeded: true}); err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	snap, _ = svc.Snapshot()
+	var pruned struct {
+		RunIDs map[string]time.Time `json:"run_ids_at"`
+	}
+	if err := json.Unmarshal(snap, &pruned); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if _, ok := pruned.RunIDs["run_ancient"]; ok || len(pruned.RunIDs) != 2 {
+		t.Fatalf("expected run ids outside the window to be pruned, got %v", pruned.RunIDs)
+	}
+}
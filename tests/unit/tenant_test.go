@@ -1,8 +1,18 @@
 package unit
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/audit"
+	"github.com/your-org/fluxroute/internal/controlplane"
 	"github.com/your-org/fluxroute/internal/tenant"
 )
 
@@ -18,3 +28,140 @@ func TestNamespaceNormalizeValidate(t *testing.T) {
 		t.Fatal("expected invalid namespace error")
 	}
 }
+
+func TestControlplaneTenantStatusAndAttributes(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	h := svc.Handler()
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Role", "admin")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call(http.MethodPost, "/v1/tenants", `{"id":"acme","attributes":{"tier":"gold","region":"eu"}}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create tenant: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodPost, "/v1/tenants", `{"id":"globex","attributes":{"Tier":"gold"}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid attribute key to be rejected, got %d", rec.Code)
+	}
+	rec := call(http.MethodPatch, "/v1/tenants/acme", `{"status":"suspended","attributes":{"region":"","plan":"annual"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update tenant: %d %s", rec.Code, rec.Body.String())
+	}
+	got, err := svc.Tenant("acme")
+	if err != nil {
+		t.Fatalf("tenant: %v", err)
+	}
+	if got.Status != controlplane.TenantSuspended || got.SuspendedAt == nil || len(got.Attributes) != 2 || got.Attributes["plan"] != "annual" || got.Attributes["tier"] != "gold" {
+		t.Fatalf("unexpected tenant after update: %+v", got)
+	}
+	if rec := call(http.MethodPatch, "/v1/tenants/acme", `{"status":"deleted"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown status to be rejected, got %d", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/v1/tenants/nope", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown tenant to 404, got %d", rec.Code)
+	}
+	entries := svc.Audit().Query(audit.Filter{Action: "tenant.update", Status: controlplane.AuditSuccess})
+	if len(entries) != 1 {
+		t.Fatalf("expected one tenant.update audit entry, got %d", len(entries))
+	}
+}
+
+func TestTenantRegistryCachesLookups(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if _, err := svc.CreateTenant("acme", map[string]string{"tier": "gold"}); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	var calls atomic.Int64
+	var down atomic.Bool
+	cp := svc.Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		cp.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	registry, err := tenant.NewRegistry(tenant.RegistryConfig{BaseURL: srv.URL, CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		info, err := registry.Lookup(context.Background(), "ACME")
+		if err != nil || info.Admit() != nil {
+			t.Fatalf("lookup: %+v, %v", info, err)
+		}
+		if labels := info.Labels(); labels["tenant.id"] != "acme" || labels["tenant.tier"] != "gold" || labels["tenant.status"] != "active" {
+			t.Fatalf("unexpected labels: %v", labels)
+		}
+		if labels := tenant.MetricLabels(info.Labels()); len(labels) != 2 || labels["tenant.id"] != "acme" || labels["tenant.status"] != "active" {
+			t.Fatalf("expected metric labels without attributes, got %v", labels)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := registry.Lookup(context.Background(), "initech"); !errors.Is(err, tenant.ErrUnknownTenant) {
+			t.Fatalf("expected unknown tenant, got %v", err)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected hits and misses to be cached, got %d fetches", got)
+	}
+
+	registry.Invalidate("acme")
+	down.Store(true)
+	if _, err := registry.Lookup(context.Background(), "acme"); err == nil {
+		t.Fatal("expected an error while the control plane is down")
+	}
+}
+
+func TestRunManifestVerifiesTenant(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if _, err := svc.CreateTenant("verified-team", map[string]string{"tier": "gold"}); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	srv := httptest.NewServer(svc.Handler())
+	defer srv.Close()
+	t.Setenv("CONTROLPLANE_URL", srv.URL)
+	t.Setenv("REQUEST_ROLE", "operator")
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+	t.Setenv("TENANT_VERIFY", "true")
+	t.Setenv("TENANT_CACHE_TTL", "1ns")
+
+	manifest := `
+router:
+  namespace: %s
+agents:
+  - id: summarize_agent
+pipeline:
+  - step: summarize_agent
+`
+	report, err := app.RunManifestReport(writeManifest(t, strings.Replace(manifest, "%s", "verified-team", 1)))
+	if err != nil {
+		t.Fatalf("run for active tenant: %v", err)
+	}
+	if attrs := report.Trace.Attributes; attrs["tenant.id"] != "verified-team" || attrs["tenant.tier"] != "gold" {
+		t.Fatalf("expected tenant attributes on the trace, got %v", attrs)
+	}
+
+	if _, err := app.RunManifestReport(writeManifest(t, strings.Replace(manifest, "%s", "unknown-team", 1))); !errors.Is(err, tenant.ErrUnknownTenant) {
+		t.Fatalf("expected unknown tenant to be refused, got %v", err)
+	}
+	suspended := controlplane.TenantSuspended
+	if _, err := svc.UpdateTenant("verified-team", controlplane.TenantUpdate{Status: &suspended}); err != nil {
+		t.Fatalf("suspend tenant: %v", err)
+	}
+	if _, err := app.RunManifestReport(writeManifest(t, strings.Replace(manifest, "%s", "verified-team", 1))); !errors.Is(err, tenant.ErrTenantSuspended) {
+		t.Fatalf("expected suspended tenant to be refused, got %v", err)
+	}
+}
@@ -2,8 +2,10 @@ package unit
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -76,3 +78,127 @@ func TestDebugTraceCreatesNoFiles(t *testing.T) {
 		t.Fatal("expected empty temp dir")
 	}
 }
+
+func TestDiffJSONPathsIgnoreRulesAndTolerance(t *testing.T) {
+	expected := []byte(`{"id":"a1","score":0.500,"tags":["x","y"],"meta":{"ts":"2026-10-18T09:00:00Z","source":"crm"},"items":[{"id":1,"v":2}]}`)
+	actual := []byte(`{"id":"b2","score":0.5004,"tags":["x"],"meta":{"ts":"2026-10-19T09:00:00Z"},"items":[{"id":9,"v":3}],"extra":true}`)
+
+	changes, isJSON := trace.DiffJSON(expected, actual, trace.DiffConfig{
+		IgnorePaths: []string{"$.id", "ts", "$.items[*].id"},
+		Tolerance:   0.001,
+	})
+	if !isJSON {
+		t.Fatal("expected JSON payloads")
+	}
+	got := map[string]string{}
+	for _, c := range changes {
+		got[c.Path] = c.Kind
+	}
+	want := map[string]string{
+		"$.extra":       trace.ChangeAdded,
+		"$.items[0].v":  trace.ChangeChanged,
+		"$.meta.source": trace.ChangeRemoved,
+		"$.tags[1]":     trace.ChangeRemoved,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for path, kind := range want {
+		if got[path] != kind {
+			t.Fatalf("expected %s %s, got %v", path, kind, got)
+		}
+	}
+	if _, isJSON := trace.DiffJSON([]byte("ok"), []byte(`{}`), trace.DiffConfig{}); isJSON {
+		t.Fatal("expected plain text payload not to be diffed as JSON")
+	}
+}
+
+func TestDebugTraceStructuralDiffFormats(t *testing.T) {
+	dir := t.TempDir()
+	expPath := filepath.Join(dir, "exp.json")
+	actPath := filepath.Join(dir, "act.json")
+	cfgPath := filepath.Join(dir, "diff.yaml")
+	step := func(requestID string, payload string) trace.Step {
+		return trace.Step{InvocationID: "1", AgentID: "a", Attempt: 1, Output: agentfunc.AgentOutput{RequestID: requestID, Payload: []byte(payload)}}
+	}
+	_ = trace.SaveToFile(expPath, trace.ExecutionTrace{TaskID: "t", Steps: []trace.Step{step("r1", `{"label":"spam","at":"09:00","score":0.91}`)}})
+	_ = trace.SaveToFile(actPath, trace.ExecutionTrace{TaskID: "t", Steps: []trace.Step{step("r2", `{"label":"ham","at":"09:05","score":0.9}`)}})
+	if err := os.WriteFile(cfgPath, []byte("ignore_paths: [at]\nignore_fields: [request_id]\ntolerance: 0.05\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	err := app.DebugTraceWithOptions(expPath, actPath, app.DebugOptions{ConfigPath: cfgPath}, &out)
+	if err == nil || !strings.Contains(out.String(), `~ $.label: "spam" -> "ham"`) {
+		t.Fatalf("expected label change only, got %v:\n%s", err, out.String())
+	}
+	if strings.Contains(out.String(), "request_id") || strings.Contains(out.String(), "score") || strings.Contains(out.String(), "$.at") {
+		t.Fatalf("expected ignored fields and tolerated numbers to be hidden:\n%s", out.String())
+	}
+
+	out.Reset()
+	_ = app.DebugTraceWithOptions(expPath, actPath, app.DebugOptions{ConfigPath: cfgPath, Format: "json"}, &out)
+	var report struct {
+		Divergences []trace.Divergence `json:"divergences"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || len(report.Divergences) != 1 || report.Divergences[0].Changes[0].Path != "$.label" {
+		t.Fatalf("unexpected json report %s (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	_ = app.DebugTraceWithOptions(expPath, actPath, app.DebugOptions{ConfigPath: cfgPath, Format: "html"}, &out)
+	if !strings.Contains(out.String(), `<tr class="changed"><td class="v">$.label</td>`) {
+		t.Fatalf("unexpected html report:\n%s", out.String())
+	}
+}
+
+func TestRootCausesSeparateUpstreamChangesFromFallout(t *testing.T) {
+	step := func(id string, level int, input string, output string, deps ...string) trace.Step {
+		return trace.Step{
+			InvocationID: id, AgentID: id + "_agent", Attempt: 1, Seq: level + 1, Level: level, DependsOn: deps,
+			Input:  agentfunc.AgentInput{Payload: []byte(input)},
+			Output: agentfunc.AgentOutput{Payload: []byte(output)},
+		}
+	}
+	expected := trace.ExecutionTrace{Steps: []trace.Step{
+		step("extract", 0, `{"doc":1}`, `{"entities":["acme"]}`),
+		step("classify", 1, `{"entities":["acme"]}`, `{"label":"b2b"}`, "extract"),
+		step("route", 2, `{"label":"b2b"}`, `{"queue":"sales"}`, "classify"),
+		step("audit", 0, `{"doc":1}`, `{"ok":true}`),
+		step("notify", 1, `{"ok":true}`, `{"sent":true}`, "audit"),
+	}}
+	actual := trace.ExecutionTrace{Steps: []trace.Step{
+		step("extract", 0, `{"doc":1}`, `{"entities":["acme","globex"]}`),
+		step("classify", 1, `{"entities":["acme","globex"]}`, `{"label":"b2c"}`, "extract"),
+		step("route", 2, `{"label":"b2c"}`, `{"queue":"support"}`, "classify"),
+		step("audit", 0, `{"doc":1}`, `{"ok":false}`),
+		step("notify", 1, `{"ok":true}`, `{"sent":true}`, "audit"),
+	}}
+
+	div := trace.Diff(expected, actual, trace.DiffConfig{})
+	roots := trace.RootCauses(expected, actual, div, trace.DiffConfig{})
+	if len(roots) != 2 || roots[0].InvocationID != "audit" || roots[1].InvocationID != "extract" {
+		t.Fatalf("expected roots audit and extract, got %+v", roots)
+	}
+	if got := strings.Join(roots[1].Fallout, ","); got != "classify,route" {
+		t.Fatalf("expected classify and route as extract's fallout, got %q", got)
+	}
+	if len(roots[0].Fallout) != 0 || len(roots[1].InputChanges) != 0 {
+		t.Fatalf("expected no fallout for audit and unchanged input for extract, got %+v", roots)
+	}
+
+	// A root whose input changed shows the input diff: here classify, when
+	// extract's divergence is ignored.
+	cfg := trace.DiffConfig{IgnorePaths: []string{"entities"}}
+	roots = trace.RootCauses(expected, actual, trace.Diff(expected, actual, cfg), trace.DiffConfig{})
+	if len(roots) != 2 || roots[1].InvocationID != "classify" {
+		t.Fatalf("expected classify to become a root, got %+v", roots)
+	}
+	in := roots[1].InputChanges
+	if len(in) != 1 || in[0].Path != "$.payload.entities[1]" || in[0].Kind != trace.ChangeAdded {
+		t.Fatalf("expected classify's input diff, got %+v", in)
+	}
+	if text := trace.FormatRootCauses(roots); !strings.Contains(text, `+ $.payload.entities[1]: "globex"`) || !strings.Contains(text, "fallout: route") {
+		t.Fatalf("unexpected root cause report:\n%s", text)
+	}
+}
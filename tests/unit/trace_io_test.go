@@ -0,0 +1,131 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+func sampleTrace(steps int) trace.ExecutionTrace {
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := trace.ExecutionTrace{TaskID: "task-io", StartTime: start, EndTime: start.Add(time.Second), TotalLatency: time.Second, Attributes: map[string]string{"tenant.id": "acme"}}
+	for i := 0; i < steps; i++ {
+		tr.Steps = append(tr.Steps, trace.Step{
+			InvocationID: "inv-" + string(rune('a'+i)),
+			AgentID:      "agent",
+			Output:       agentfunc.AgentOutput{RequestID: "r", Payload: []byte(`{"n":1}`)},
+			Attempt:      1,
+		})
+	}
+	return tr
+}
+
+func TestTraceFileRoundTripAndCompression(t *testing.T) {
+	dir := t.TempDir()
+	tr := sampleTrace(3)
+	for _, name := range []string{"trace.jsonl", "trace.jsonl.gz", "trace.jsonl.zz"} {
+		path := filepath.Join(dir, name)
+		if err := trace.SaveToFile(path, tr); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+		got, err := trace.LoadFromFile(path)
+		if err != nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+		if got.TaskID != tr.TaskID || len(got.Steps) != 3 || got.TotalLatency != time.Second || !got.EndTime.Equal(tr.EndTime) || got.Attributes["tenant.id"] != "acme" {
+			t.Fatalf("%s did not round-trip: %+v", name, got)
+		}
+		if div := trace.Compare(tr, got); len(div) != 0 {
+			t.Fatalf("%s steps changed: %s", name, trace.FormatDivergence(div))
+		}
+	}
+
+	plain, _ := os.ReadFile(filepath.Join(dir, "trace.jsonl"))
+	lines := strings.Split(strings.TrimSpace(string(plain)), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], `"schema":"fluxroute.trace"`) || !strings.Contains(lines[4], `"steps":3`) {
+		t.Fatalf("expected header, 3 step lines and footer, got:\n%s", plain)
+	}
+	gz, _ := os.ReadFile(filepath.Join(dir, "trace.jsonl.gz"))
+	if len(gz) < 2 || gz[0] != 0x1f || gz[1] != 0x8b {
+		t.Fatal("expected .gz trace to be gzip-compressed")
+	}
+}
+
+func TestTraceReaderIteratesLazily(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := trace.NewWriter(&buf, trace.Header{TaskID: "stream"}, trace.CompressionGzip)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := w.WriteStep(trace.Step{InvocationID: "inv", Attempt: i + 1}); err != nil {
+			t.Fatalf("write step: %v", err)
+		}
+	}
+	if err := w.Close(trace.Footer{}); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	r, err := trace.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("new reader: %v", err)
+	}
+	defer r.Close()
+	if h := r.Header(); h.TaskID != "stream" || h.Version != trace.SchemaVersion {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	n := 0
+	for {
+		s, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		n++
+		if s.Attempt != n {
+			t.Fatalf("expected attempt %d, got %d", n, s.Attempt)
+		}
+	}
+	if f, ok := r.Footer(); !ok || f.Steps != 100 || n != 100 {
+		t.Fatalf("expected 100 steps and a footer, got %d %+v %v", n, f, ok)
+	}
+}
+
+func TestTraceLoadsLegacyJSONAndRejectsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy.json")
+	b, _ := json.MarshalIndent(sampleTrace(2), "", "  ")
+	if err := os.WriteFile(legacy, b, 0o644); err != nil {
+		t.Fatalf("write legacy trace: %v", err)
+	}
+	got, err := trace.LoadFromFile(legacy)
+	if err != nil {
+		t.Fatalf("load legacy trace: %v", err)
+	}
+	if got.TaskID != "task-io" || len(got.Steps) != 2 || got.TotalLatency != time.Second {
+		t.Fatalf("unexpected legacy trace: %+v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := trace.Encode(&buf, sampleTrace(2), trace.CompressionNone); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	lines := strings.SplitAfter(buf.String(), "\n")
+	if _, err := trace.Decode(strings.NewReader(strings.Join(lines[:2], ""))); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("expected truncated trace error, got %v", err)
+	}
+	if _, err := trace.Decode(strings.NewReader(`{"type":"header","schema":"fluxroute.trace","version":99}`)); err == nil {
+		t.Fatal("expected newer schema version to be rejected")
+	}
+}
@@ -0,0 +1,120 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/agent"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/trace"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+func TestTraceRecordsDAGAndTimeline(t *testing.T) {
+	reg := agent.NewRegistry()
+	calls := 0
+	_ = reg.Register("flaky", func(_ context.Context, in agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		calls++
+		if calls == 1 {
+			return agentfunc.AgentOutput{}, errors.New("transient")
+		}
+		return agentfunc.AgentOutput{RequestID: in.RequestID, Payload: []byte("a")}, nil
+	})
+	_ = reg.Register("echo", func(_ context.Context, in agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		return agentfunc.AgentOutput{RequestID: in.RequestID, Payload: in.Payload}, nil
+	})
+	eng := router.NewEngine(reg, agentfunc.RouterConfig{DefaultTimeout: time.Second})
+	_, tr := eng.RunPlan(context.Background(), router.ExecutionPlan{TaskID: "dag", Nodes: []router.PlanNode{
+		{Invocation: router.AgentInvocation{ID: "z_first", AgentID: "flaky"}, RetryPolicy: agentfunc.RetryPolicy{MaxAttempts: 2}},
+		{Invocation: router.AgentInvocation{ID: "a_second", AgentID: "echo"}, DependsOn: []string{"z_first"}},
+	}})
+
+	if len(tr.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %+v", tr.Steps)
+	}
+	first, retry, second := tr.Steps[0], tr.Steps[1], tr.Steps[2]
+	if first.InvocationID != "z_first" || retry.InvocationID != "z_first" || second.InvocationID != "a_second" {
+		t.Fatalf("expected steps in start order, got %s, %s, %s", first.InvocationID, retry.InvocationID, second.InvocationID)
+	}
+	if !first.Retried || first.Level != 0 || first.CircuitState != trace.CircuitClosed || first.EndTime.Before(first.StartTime) {
+		t.Fatalf("unexpected first attempt: %+v", first)
+	}
+	if retry.Attempt != 2 || retry.BackoffWaited <= 0 || retry.Retried {
+		t.Fatalf("expected second attempt to record its backoff, got %+v", retry)
+	}
+	if second.Level != 1 || len(second.DependsOn) != 1 || second.DependsOn[0] != "z_first" || second.StartTime.Before(retry.EndTime) {
+		t.Fatalf("expected dependent step at level 1 after its dependency, got %+v", second)
+	}
+
+	path := trace.CriticalPath(tr)
+	if len(path) != 2 || path[0].InvocationID != "z_first" || path[1].InvocationID != "a_second" {
+		t.Fatalf("unexpected critical path: %+v", path)
+	}
+	if span := trace.InvocationSpan(tr, "z_first"); span < retry.BackoffWaited {
+		t.Fatalf("expected invocation span to include backoff, got %s", span)
+	}
+}
+
+func TestTraceRecordsCircuitBreakerFlags(t *testing.T) {
+	reg := agent.NewRegistry()
+	_ = reg.Register("down", func(context.Context, agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+		return agentfunc.AgentOutput{}, errors.New("boom")
+	})
+	eng := router.NewEngine(reg, agentfunc.RouterConfig{
+		DefaultTimeout: time.Second,
+		CircuitBreaker: agentfunc.CircuitBreakerPolicy{FailureThreshold: 1, ResetTimeout: time.Minute},
+	})
+	plan := router.ExecutionPlan{TaskID: "cb", Nodes: []router.PlanNode{{Invocation: router.AgentInvocation{ID: "1", AgentID: "down"}}}}
+
+	_, tr := eng.RunPlan(context.Background(), plan)
+	if s := tr.Steps[0]; s.CircuitState != trace.CircuitClosed || s.CircuitAfter != trace.CircuitOpen || s.BreakerRejected {
+		t.Fatalf("expected failure to open the breaker, got %+v", s)
+	}
+	_, tr = eng.RunPlan(context.Background(), plan)
+	if s := tr.Steps[0]; !s.BreakerRejected || s.CircuitState != trace.CircuitOpen || s.Probe {
+		t.Fatalf("expected attempt rejected by open breaker, got %+v", s)
+	}
+}
+
+func TestCompareUsesAttemptsAndDependencies(t *testing.T) {
+	step := func(id string, attempt int, deps ...string) trace.Step {
+		return trace.Step{InvocationID: id, AgentID: "a", Attempt: attempt, Seq: attempt, DependsOn: deps}
+	}
+	expected := trace.ExecutionTrace{Steps: []trace.Step{step("1", 1), step("2", 1, "1")}}
+	actual := trace.ExecutionTrace{Steps: []trace.Step{step("1", 1), step("1", 2), step("2", 1)}}
+
+	fields := map[string]string{}
+	for _, d := range trace.Compare(expected, actual) {
+		fields[d.Field] = d.InvocationID
+	}
+	if fields["attempts"] != "1" || fields["depends_on"] != "2" {
+		t.Fatalf("expected attempts and depends_on divergences, got %v", fields)
+	}
+}
+
+func TestReplayAndCompareFollowsDependencies(t *testing.T) {
+	tr := trace.ExecutionTrace{Steps: []trace.Step{
+		{InvocationID: "child", AgentID: "echo", Attempt: 0, Level: 1, DependsOn: []string{"parent"}, Error: "dependency failed: parent: boom"},
+		{InvocationID: "parent", AgentID: "fail", Attempt: 1, Error: "boom"},
+	}}
+	resolve := func(failing bool) trace.ResolveAgentFn {
+		return func(agentID string) (agentfunc.AgentFunc, bool) {
+			return func(context.Context, agentfunc.AgentInput) (agentfunc.AgentOutput, error) {
+				if agentID == "fail" && failing {
+					return agentfunc.AgentOutput{}, errors.New("boom")
+				}
+				return agentfunc.AgentOutput{}, nil
+			}, true
+		}
+	}
+	if err := trace.ReplayAndCompare(context.Background(), tr, time.Second, resolve(true)); err != nil {
+		t.Fatalf("expected replay to match, got %v", err)
+	}
+	err := trace.ReplayAndCompare(context.Background(), tr, time.Second, resolve(false))
+	if err == nil || !strings.Contains(err.Error(), "parent") {
+		t.Fatalf("expected parent divergence, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package unit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/app"
+	"github.com/your-org/fluxroute/internal/trace"
+)
+
+func storedTrace(start time.Time, agent string, errText string) trace.ExecutionTrace {
+	return trace.ExecutionTrace{
+		TaskID:       "task",
+		StartTime:    start,
+		EndTime:      start.Add(time.Second),
+		TotalLatency: time.Second,
+		Steps:        []trace.Step{{InvocationID: "1", AgentID: agent, Attempt: 1, Error: errText}},
+	}
+}
+
+func TestTraceStoreIndexesAndQueriesRuns(t *testing.T) {
+	dir := t.TempDir()
+	store := trace.NewFileStore(dir)
+	yesterday := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	runs := []struct {
+		id, ns, agent, err string
+		start              time.Time
+	}{
+		{"run_a", "team-a", "classify_agent", "agent timeout: deadline exceeded", yesterday},
+		{"run_b", "team-a", "classify_agent", "", yesterday.Add(time.Hour)},
+		{"run_c", "team-b", "summarize_agent", "boom", yesterday.Add(24 * time.Hour)},
+	}
+	for _, r := range runs {
+		if _, err := store.Put(r.id, r.ns, storedTrace(r.start, r.agent, r.err)); err != nil {
+			t.Fatalf("put %s: %v", r.id, err)
+		}
+	}
+
+	failed, err := store.List(trace.Query{Agent: "classify_agent", Status: trace.RunFailed, Since: yesterday, Until: yesterday.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(failed) != 1 || failed[0].RunID != "run_a" || failed[0].Namespace != "team-a" {
+		t.Fatalf("expected run_a, got %+v", failed)
+	}
+	all, _ := store.List(trace.Query{})
+	if len(all) != 3 || all[0].RunID != "run_c" {
+		t.Fatalf("expected all runs newest first, got %+v", all)
+	}
+	if byErr, _ := store.List(trace.Query{Error: "TIMEOUT"}); len(byErr) != 1 || byErr[0].RunID != "run_a" {
+		t.Fatalf("expected error text match, got %+v", byErr)
+	}
+
+	tr, sum, err := store.Get("run_c")
+	if err != nil || tr.TaskID != "task" || sum.Status != trace.RunFailed {
+		t.Fatalf("get run_c: %+v %+v %v", tr, sum, err)
+	}
+	if _, _, err := store.Get("../etc/passwd"); !errors.Is(err, trace.ErrTraceNotFound) {
+		t.Fatalf("expected unsafe id to be not found, got %v", err)
+	}
+
+	before, err := os.Stat(filepath.Join(dir, "index.jsonl"))
+	if err != nil {
+		t.Fatalf("stat index: %v", err)
+	}
+	if removed, err := store.GC(trace.Retention{TTL: 48 * time.Hour}, yesterday.Add(30*time.Hour)); err != nil || removed != 0 {
+		t.Fatalf("expected nothing to expire, got %d (%v)", removed, err)
+	}
+	if after, err := os.Stat(filepath.Join(dir, "index.jsonl")); err != nil || !os.SameFile(before, after) {
+		t.Fatalf("expected gc without expiries to leave the index alone (%v)", err)
+	}
+
+	removed, err := store.GC(trace.Retention{TTL: 12 * time.Hour}, yesterday.Add(30*time.Hour))
+	if err != nil || removed != 2 {
+		t.Fatalf("expected ttl gc to remove 2 runs, got %d (%v)", removed, err)
+	}
+	if _, _, err := store.Get("run_a"); !errors.Is(err, trace.ErrTraceNotFound) {
+		t.Fatalf("expected run_a collected, got %v", err)
+	}
+	if _, err := store.Put("run_d", "team-b", storedTrace(yesterday.Add(25*time.Hour), "a", "")); err != nil {
+		t.Fatalf("put run_d: %v", err)
+	}
+	if removed, _ := store.GC(trace.Retention{MaxRuns: 1}, time.Now()); removed != 1 {
+		t.Fatalf("expected max-runs gc to remove 1 run, got %d", removed)
+	}
+	if left, _ := store.List(trace.Query{}); len(left) != 1 || left[0].RunID != "run_d" {
+		t.Fatalf("expected newest run kept, got %+v", left)
+	}
+}
+
+func TestTraceStoreReplacesRunsInPlaceAndGetsWithoutTheIndex(t *testing.T) {
+	dir := t.TempDir()
+	store := trace.NewFileStore(dir)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	if _, err := store.Put("run_a", "team-a", storedTrace(start, "a", "")); err != nil {
+		t.Fatalf("put run_a: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := store.Put("run_b", "team-a", storedTrace(start.Add(time.Hour), "b", "")); err != nil {
+			t.Fatalf("put run_b: %v", err)
+		}
+	}
+	if _, err := store.Put("run_b", "team-b", storedTrace(start.Add(time.Hour), "b", "boom")); err != nil {
+		t.Fatalf("replace run_b: %v", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.jsonl"))
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	if lines := strings.Count(string(index), "\n"); lines != 2 {
+		t.Fatalf("expected one index line per run, got %d:\n%s", lines, index)
+	}
+	if runs, _ := store.List(trace.Query{}); len(runs) != 2 || runs[0].RunID != "run_b" || runs[0].Namespace != "team-b" || runs[0].Status != trace.RunFailed {
+		t.Fatalf("expected the replaced run listed once, got %+v", runs)
+	}
+
+	// Get reads the run's own files, not the index.
+	if err := os.Remove(filepath.Join(dir, "index.jsonl")); err != nil {
+		t.Fatalf("remove index: %v", err)
+	}
+	if _, sum, err := store.Get("run_b"); err != nil || sum.Namespace != "team-b" || sum.Status != trace.RunFailed {
+		t.Fatalf("get run_b without the index: %+v %v", sum, err)
+	}
+	if _, _, err := store.Get("run_missing"); !errors.Is(err, trace.ErrTraceNotFound) {
+		t.Fatalf("expected a missing run to be not found, got %v", err)
+	}
+}
+
+func TestRunManifestStoresTraceAndRouterServesIt(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TRACE_STORE_DIR", dir)
+	t.Setenv("USAGE_OUTBOX_DIR", t.TempDir())
+	t.Setenv("REQUEST_ROLE", "operator")
+
+	report, err := app.RunManifestReport(writeManifest(t, `
+router:
+  namespace: store-team
+agents:
+  - id: summarize_agent
+pipeline:
+  - step: summarize_agent
+`))
+	if err != nil {
+		t.Fatalf("run manifest: %v", err)
+	}
+
+	h := app.RouterHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/traces?namespace=store-team&agent=summarize_agent", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list traces: %d %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		Runs []trace.RunSummary `json:"runs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Runs) != 1 || list.Runs[0].RunID != report.RunID {
+		t.Fatalf("expected stored run %s, got %s (%v)", report.RunID, rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/traces/"+report.RunID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get trace: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/traces/run_missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown run, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/traces?status=weird", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid status, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/router"
+	"github.com/your-org/fluxroute/internal/usage"
+	"github.com/your-org/fluxroute/pkg/agentfunc"
+)
+
+func TestUsageFromResultsAggregatesPerModel(t *testing.T) {
+	ok := func(id string, agentID string, md map[string]string) router.AgentResult {
+		return router.AgentResult{Invocation: router.AgentInvocation{ID: id, AgentID: agentID}, Output: agentfunc.AgentOutput{Metadata: md}}
+	}
+	results := []router.AgentResult{
+		ok("1", "llm", map[string]string{"model": "gpt-4o", "input_tokens": "100", "output_tokens": "20"}),
+		ok("2", "llm", map[string]string{"model": "gpt-4o", "input_tokens": "50"}),
+		ok("3", "parse", nil),
+		{Invocation: router.AgentInvocation{ID: "4", AgentID: "parse"}, Err: errors.New("agent failed")},
+		{Invocation: router.AgentInvocation{ID: "5", AgentID: "store"}, Err: fmt.Errorf("%w: 4: boom", router.ErrDependencyFailed)},
+	}
+	events := usage.FromResults("run_1", "team-a", "tenant-a", results, time.Now())
+	if len(events) != 2 {
+		t.Fatalf("expected events for llm/gpt-4o and parse, got %+v", events)
+	}
+	if events[0].ID != "run_1:llm:gpt-4o" || events[0].Invocations != 2 || events[0].InputTokens != 150 || events[0].OutputTokens != 20 {
+		t.Fatalf("unexpected model event: %+v", events[0])
+	}
+	if events[1].ID != "run_1:parse" || events[1].Agent != "parse" || events[1].Invocations != 2 {
+		t.Fatalf("unexpected agent event: %+v", events[1])
+	}
+}
+
+func TestUsageReporterRetriesAndControlplaneDedupes(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("team-a"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	var down atomic.Bool
+	down.Store(true)
+	cp := svc.Handler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		cp.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	reporter, err := usage.NewReporter(usage.ReporterConfig{BaseURL: srv.URL, Role: "operator", OutboxDir: dir, BaseBackoff: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("new reporter: %v", err)
+	}
+	ev := usage.Event{ID: "run_x", TenantID: "team-a", Namespace: "team-a", RunID: "run_x", Invocations: 3, OccurredAt: time.Now()}
+	if err := reporter.Enqueue(ev); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	res, err := reporter.Flush(context.Background())
+	if err == nil || res.Pending != 1 {
+		t.Fatalf("expected pending event while control plane is down, got %+v, %v", res, err)
+	}
+	pending, _ := reporter.Outbox().Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("expected retry state on disk, got %+v", pending)
+	}
+
+	down.Store(false)
+	// A fresh reporter over the same directory picks up the queued event.
+	reporter, _ = usage.NewReporter(usage.ReporterConfig{BaseURL: srv.URL, Role: "operator", OutboxDir: dir})
+	if res, err := reporter.Flush(context.Background()); err != nil || res.Delivered != 1 {
+		t.Fatalf("expected delivery after recovery, got %+v, %v", res, err)
+	}
+	_ = reporter.Enqueue(ev)
+	if res, err := reporter.Flush(context.Background()); err != nil || res.Duplicates != 1 {
+		t.Fatalf("expected duplicate acknowledgement, got %+v, %v", res, err)
+	}
+	if got := svc.Usage("team-a"); got != 3 {
+		t.Fatalf("expected usage counted once, got %d", got)
+	}
+
+	_ = reporter.Enqueue(usage.Event{ID: "run_y", TenantID: "unknown", Invocations: 1, OccurredAt: time.Now()})
+	if res, _ := reporter.Flush(context.Background()); res.Rejected != 1 {
+		t.Fatalf("expected unknown tenant to be rejected, got %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rejected", "run_y.json")); err != nil {
+		t.Fatalf("expected rejected event kept for inspection: %v", err)
+	}
+	if pending, _ := reporter.Outbox().Pending(); len(pending) != 0 {
+		t.Fatalf("expected empty outbox, got %+v", pending)
+	}
+}
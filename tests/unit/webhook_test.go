@@ -0,0 +1,241 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/your-org/fluxroute/internal/billing"
+	"github.com/your-org/fluxroute/internal/controlplane"
+	"github.com/your-org/fluxroute/internal/quota"
+	"github.com/your-org/fluxroute/internal/webhook"
+)
+
+func TestWebhookSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Now()
+	header := webhook.Sign("secret", now, body)
+	if err := webhook.Verify("secret", header, body, now, time.Minute); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := webhook.Verify("secret", header, []byte(`{"id":"evt_2"}`), now, time.Minute); !errors.Is(err, webhook.ErrInvalidSignature) {
+		t.Fatalf("expected tampered body to fail, got %v", err)
+	}
+	if err := webhook.Verify("other", header, body, now, time.Minute); !errors.Is(err, webhook.ErrInvalidSignature) {
+		t.Fatalf("expected wrong secret to fail, got %v", err)
+	}
+	if err := webhook.Verify("secret", header, body, now.Add(time.Hour), time.Minute); !errors.Is(err, webhook.ErrInvalidSignature) {
+		t.Fatalf("expected stale signature to fail, got %v", err)
+	}
+}
+
+func TestControlplaneWebhookEvents(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	var mu sync.Mutex
+	var secret string
+	received := map[string]webhook.Event{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if err := webhook.Verify(secret, r.Header.Get(webhook.HeaderSignature), body, time.Now(), time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var ev webhook.Event
+		if err := json.Unmarshal(body, &ev); err != nil || ev.Type != r.Header.Get(webhook.HeaderEvent) {
+			http.Error(w, "bad event", http.StatusBadRequest)
+			return
+		}
+		received[ev.Type] = ev
+	}))
+	defer receiver.Close()
+
+	svc := controlplane.NewService()
+	h := svc.Handler()
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(`{"url":"`+receiver.URL+`","events":["*"]}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected global subscription to require admin, got %d", rec.Code)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(`{"url":"`+receiver.URL+`","events":["*"]}`))
+	req.Header.Set("X-Role", "admin")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("subscribe: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.ID == "" || !strings.HasPrefix(created.Secret, "whsec_") {
+		t.Fatalf("expected id and generated secret, got %s", rec.Body.String())
+	}
+	mu.Lock()
+	secret = created.Secret
+	mu.Unlock()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks/"+created.ID, nil))
+	if strings.Contains(rec.Body.String(), created.Secret) {
+		t.Fatal("secret must not be returned after creation")
+	}
+
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	if err := svc.SetQuota("acme", []quota.Limit{{Metric: quota.InvocationsPerMonth, Soft: billing.AmountFromInt(5), Hard: billing.AmountFromInt(10)}}); err != nil {
+		t.Fatalf("set quota: %v", err)
+	}
+	if err := svc.AddUsage("acme", 6); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	if err := svc.AddUsage("acme", 6); err != nil {
+		t.Fatalf("add usage: %v", err)
+	}
+	now := time.Now().UTC()
+	inv, err := svc.CreateInvoice("acme", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("create invoice: %v", err)
+	}
+	if _, err := svc.FinalizeInvoice(inv.ID); err != nil {
+		t.Fatalf("finalize invoice: %v", err)
+	}
+
+	res := svc.Webhooks().Process(context.Background())
+	if res.Succeeded != 4 || res.Retrying != 0 {
+		t.Fatalf("expected 4 successful deliveries, got %+v", res)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, typ := range webhook.EventTypes {
+		if _, ok := received[typ]; !ok {
+			t.Fatalf("missing %s event, got %v", typ, received)
+		}
+	}
+	var crossed struct {
+		Check quota.Check `json:"check"`
+	}
+	_ = json.Unmarshal(received[webhook.EventUsageThresholdCrossed].Data, &crossed)
+	if crossed.Check.State != quota.StateWarn || crossed.Check.Used.String() != "6" {
+		t.Fatalf("unexpected threshold payload: %s", received[webhook.EventUsageThresholdCrossed].Data)
+	}
+	if received[webhook.EventInvoiceFinalized].TenantID != "acme" {
+		t.Fatalf("unexpected invoice event: %+v", received[webhook.EventInvoiceFinalized])
+	}
+}
+
+func TestWebhookRetriesThenDeadLetters(t *testing.T) {
+	t.Setenv("CONTROLPLANE_API_KEY", "")
+	t.Setenv("CONTROLPLANE_INSECURE_LOCAL", "true")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_BASE_BACKOFF", "1ns")
+	var healthy atomic.Bool
+	var calls atomic.Int64
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	svc := controlplane.NewService()
+	if err := svc.AddTenant("acme"); err != nil {
+		t.Fatalf("add tenant: %v", err)
+	}
+	h := svc.Handler()
+	subscribe := func(role string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(`{"tenant_id":"acme","url":"`+receiver.URL+`","events":["invoice.finalized"]}`))
+		req.Header.Set("X-Role", role)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := subscribe("viewer"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a read-only caller to be refused, got %d", rec.Code)
+	}
+	rec := subscribe("admin")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("subscribe: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := svc.Webhooks().Publish(webhook.EventTenantCreated, "acme", nil); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := svc.Webhooks().Publish(webhook.EventInvoiceFinalized, "acme", map[string]string{"id": "inv_1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond)
+		svc.Webhooks().Process(context.Background())
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected 3 attempts for the one matching event, got %d", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/webhooks/deliveries?status=dead_lettered", nil))
+	var log struct {
+		Items []webhook.Delivery `json:"items"`
+		Total int                `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &log); err != nil {
+		t.Fatalf("decode delivery log: %v", err)
+	}
+	if log.Total != 1 || log.Items[0].AttemptCount != 3 || len(log.Items[0].Attempts) != 3 || log.Items[0].Attempts[0].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected dead letters: %s", rec.Body.String())
+	}
+
+	healthy.Store(true)
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhooks/deliveries/"+log.Items[0].ID+"/redeliver", nil)
+	req.Header.Set("X-Role", "admin")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("redeliver: %d %s", rec.Code, rec.Body.String())
+	}
+	if res := svc.Webhooks().Process(context.Background()); res.Succeeded != 1 {
+		t.Fatalf("expected redelivery to succeed, got %+v", res)
+	}
+	del, err := svc.Webhooks().Delivery(log.Items[0].ID)
+	if err != nil || del.Status != webhook.DeliverySucceeded || len(del.Attempts) != 4 {
+		t.Fatalf("unexpected delivery after redelivery: %+v, %v", del, err)
+	}
+}
+
+func TestWebhookRejectsPrivateTargetsAndCapsDeliveryLog(t *testing.T) {
+	d := webhook.NewDispatcher(webhook.Config{MaxDeliveries: 3})
+	for _, target := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://10.1.2.3/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+		if _, err := d.Subscribe(webhook.Subscription{URL: target, Events: []string{"*"}}); !errors.Is(err, webhook.ErrPrivateTarget) {
+			t.Fatalf("expected %s to be rejected, got %v", target, err)
+		}
+	}
+	if _, err := d.Subscribe(webhook.Subscription{URL: "https://hooks.example.com/fluxroute", Events: []string{"*"}}); err != nil {
+		t.Fatalf("subscribe public target: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := d.Publish(webhook.EventTenantCreated, "acme", nil); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	log := d.Deliveries(webhook.DeliveryFilter{})
+	if len(log) != 3 || log[0].Event.ID != "evt_000005" || log[2].Event.ID != "evt_000003" {
+		t.Fatalf("expected the three newest deliveries to be kept, got %+v", log)
+	}
+}